@@ -2,55 +2,340 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
 	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"securitiesModule/broadcast"
+	"securitiesModule/cache"
+	"securitiesModule/compress"
+	"securitiesModule/config"
+	"securitiesModule/cors"
+	"securitiesModule/jobs"
+	"securitiesModule/metrics"
+	"securitiesModule/ratelimit"
 	"securitiesModule/securities"
+	"securitiesModule/securities/alerts"
+	"securitiesModule/securities/moex"
+	"securitiesModule/securities/portfolio"
 	"securitiesModule/securities/securitiesSQL"
+	"securitiesModule/securities/securitiesSQLite"
+	"securitiesModule/timeout"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	_ "modernc.org/sqlite"
 )
 
-// db is the main sql database, which contains data about securuties
-var db *sql.DB
+// logger is the logger of the service, its level is set in settings
+var logger = slog.Default()
+
+// store is the main storage, which contains data about securuties
+var store securities.Store
+
+// portfolios is the storage of portfolios, it's the same database as the main storage
+var portfolios portfolio.Store
+
+// alertStore is the storage of price alerts, it's the same database as the main storage
+var alertStore alerts.Store
 
 // htmlDir is the directory with html files
 var htmlDir string
 
+// devMode means that html templates are parsed on every request, so they may be edited without restart
+var devMode bool
+
+// templates contains parsed html templates by file name
+var templates map[string]*template.Template
+
+// templateNames are the names of html template files in html directory
+var templateNames = []string{"errorPage.html", "mainPage.html", "allSecurities.html", "addSecurity.html", "securityData.html", "compareSecurities.html", "securityList.html"}
+
 // httpPath is the main path for http requests
 var httpPath string
 
+// listenAddr is the address for http server (host:port)
+var listenAddr string
+
+// shutdownTimeout is the time for active requests to be finished when server is stopped
+const shutdownTimeout = 30 * time.Second
+
+// readOnly means that we work only with data already stored in database - no Moscow Exchange requests and no database changes
+var readOnly bool
+
+// apiKeyHeader is the request header with API key
+const apiKeyHeader = "X-API-Key"
+
+// apiKeys are the keys which allow requests to change data, keys are not checked if there are none
+var apiKeys []string
+
+// apiKeysForReads means that API key is required for all requests of json api, not only for requests which change data
+var apiKeysForReads bool
+
+// corsPolicy tells which origins may call json api from browsers
+var corsPolicy *cors.Policy
+
+// requestTimeout is the maximum time of serving one http request, streams are not limited
+var requestTimeout time.Duration
+
+// requestLimiter limits the rate of all requests of every client
+var requestLimiter *ratelimit.Limiter
+
+// updateLimiter limits the rate of requests which update data on Moscow Exchange, they are also counted by requestLimiter
+var updateLimiter *ratelimit.Limiter
+
+// internalHeader marks requests of html pages to json api, its value is internalToken and the rate limit key of the page client
+const internalHeader = "X-Internal-Request"
+
+// internalToken is generated on start, so clients can't pass their requests for requests of html pages
+var internalToken string
+
+// verifyOnAdd means that security is checked on Moscow Exchange before adding it to database
+var verifyOnAdd bool
+
+// autoUpdate means that last quotes of all securities are updated every trading day at autoUpdateTime
+var autoUpdate bool
+
+// autoUpdateTime is the time from the beginning of the day (Moscow time) for scheduled update of last quotes
+var autoUpdateTime time.Duration
+
+// autoUpdateCheckPeriod is the period of checking if it's time for scheduled update of last quotes
+const autoUpdateCheckPeriod = time.Minute
+
+// moscowTime is the time zone of Moscow Exchange
+var moscowTime = time.FixedZone("MSK", 3*60*60)
+
+// listConcurrency is the maximum number of simultaneous Moscow Exchange requests while processing the list of securities from file
+var listConcurrency int
+
+// maxListFileSize is the maximum size of the uploaded file with the list of securities
+const maxListFileSize = 1 << 20
+
+// maxListFormSize is the maximum size of other fields of the form with the list of securities
+const maxListFormSize = 1 << 12
+
+// maxSecurityIdLength is the maximum length of security id, it's the size of id column in storage
+const maxSecurityIdLength = 20
+
+// listJobTTL is the time of keeping finished jobs processing lists of securities
+const listJobTTL = time.Hour
+
+// readyTimeout limits the storage check of readiness probe
+const readyTimeout = 2 * time.Second
+
+// listJobs keeps jobs processing lists of securities from files
+var listJobs *jobs.Manager[securityListData]
+
+// listCache keeps json responses of all securities listing, it's cleared after every change of securities or quotes
+var listCache *cache.Cache[[]byte]
+
+// lastQuotesUpdates notifies streams of last quotes that last quotes of all securities were updated
+var lastQuotesUpdates = broadcast.New[struct{}](1)
+
+// securityUpdate tells that quotes of security with the given id were stored, quotes of all securities were updated if All is set
+type securityUpdate struct {
+	Id  string
+	All bool
+}
+
+// securityUpdates notifies websocket connections that quotes of securities were stored
+// Updates are dropped for connections which are too slow to take them
+var securityUpdates = broadcast.New[securityUpdate](64)
+
+// streamKeepAlive is the period of comments sent to idle streams, so proxies don't close the connections
+const streamKeepAlive = 30 * time.Second
+
+// errReadOnly is the text of error for requests which can't be executed in read-only mode
+const errReadOnly = "read-only mode: the request is not allowed"
+
 // generalSecurityData contains security data with last prices (string)
 type generalSecurityData struct {
+	XMLName       xml.Name `json:"-" xml:"Security"`
 	ID            string
 	Name          string
 	Type          string
 	Currency      string
 	LastPriceDate string
 	LastPrice     string
+	LastUpdated   string // empty if quotes were never updated
+}
+
+// staleSecuritiesData contains securities which quotes were not updated for the given number of days
+type staleSecuritiesData struct {
+	Days       int
+	Securities []generalSecurityData
 }
 
+// defaultStaleDays is the number of days without quotes update after which security is stale if it's not set in request
+const defaultStaleDays = 7
+
 // AllSecuritiesData contains general security data for all securities (considering type and currency filters)
 type AllSecuritiesData struct {
+	XMLName        xml.Name `json:"-" xml:"AllSecurities"`
 	TypeFilter     string
 	CurrencyFilter string
-	Securities     []generalSecurityData
+	Search         string `json:",omitempty" xml:",omitempty"`
+	Sort           string
+	Desc           bool
+	Limit          int
+	Offset         int
+	Total          int
+	IncludeDeleted bool                  `json:",omitempty" xml:",omitempty"`
+	Securities     []generalSecurityData `xml:"Securities>Security"`
+}
+
+// allSecuritiesPage contains data of the page with all securities and offsets of the previous and next pages
+type allSecuritiesPage struct {
+	AllSecuritiesData
+	HasPrev    bool
+	PrevOffset int
+	HasNext    bool
+	NextOffset int
+}
+
+// defaultPageLimit is the number of securities in the page of all securities list if it's not set in request
+const defaultPageLimit = 50
+
+// securityInfo contains general security data for json requests and responses
+type securityInfo struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+}
+
+// quotesInfo contains security quotes for json responses
+type quotesInfo struct {
+	Begin  string  `json:"begin"`
+	End    string  `json:"end"`
+	Open   float64 `json:"open"`
+	Close  float64 `json:"close"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Volume float64 `json:"volume"`
+}
+
+// securityResource contains general security data and its last daily quotes for json responses
+type securityResource struct {
+	securityInfo
+	LastQuotes *quotesInfo `json:"lastQuotes,omitempty"`
+}
+
+// positionInfo contains portfolio position for json requests and responses
+type positionInfo struct {
+	Id       string  `json:"id"`
+	Type     string  `json:"type"`
+	Quantity float64 `json:"quantity"`
+	AvgPrice float64 `json:"avgPrice"`
+}
+
+// portfolioInfo contains portfolio with its positions for json requests and responses
+type portfolioInfo struct {
+	Id        int64          `json:"id"`
+	Name      string         `json:"name"`
+	Positions []positionInfo `json:"positions"`
+}
+
+// positionValueInfo contains value of portfolio position by close price for json responses
+type positionValueInfo struct {
+	positionInfo
+	Currency string  `json:"currency"`
+	Close    float64 `json:"close"`
+	Rate     float64 `json:"rate"`
+	Value    float64 `json:"value"`
+	PL       float64 `json:"pl"`
+}
+
+// portfolioValueInfo contains value of portfolio by close prices of the date for json responses
+type portfolioValueInfo struct {
+	Id        int64               `json:"id"`
+	Name      string              `json:"name"`
+	Date      string              `json:"date"`
+	Currency  string              `json:"currency"`
+	Value     float64             `json:"value"`
+	Cost      float64             `json:"cost"`
+	PL        float64             `json:"pl"`
+	Positions []positionValueInfo `json:"positions"`
+}
+
+// portfolioPointInfo is the value of portfolio for one date of the series
+type portfolioPointInfo struct {
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	PL    float64 `json:"pl"`
+}
+
+// portfolioSeriesInfo contains values of portfolio for the period to draw the chart
+type portfolioSeriesInfo struct {
+	Id       int64                `json:"id"`
+	Name     string               `json:"name"`
+	Interval int                  `json:"interval"`
+	Currency string               `json:"currency"`
+	Points   []portfolioPointInfo `json:"points"`
+}
+
+// alertInfo contains price alert for json requests and responses
+type alertInfo struct {
+	Id        int64   `json:"id"`
+	Security  string  `json:"security"`
+	Type      string  `json:"type"`
+	Direction string  `json:"direction"`
+	Threshold float64 `json:"threshold"`
+	Enabled   bool    `json:"enabled"`
+	URL       string  `json:"url,omitempty"`
+}
+
+// firingInfo is a firing of price alert for json responses
+type firingInfo struct {
+	Close         float64 `json:"close"`
+	Date          string  `json:"date"`
+	FiredAt       string  `json:"firedAt"`
+	Delivery      string  `json:"delivery,omitempty"`
+	DeliveryError string  `json:"deliveryError,omitempty"`
+}
+
+// alertDetailsInfo contains price alert with its firings for json responses
+type alertDetailsInfo struct {
+	alertInfo
+	Firings []firingInfo `json:"firings"`
+}
+
+// moverData contains security data with the change (%) between its last two daily close prices
+type moverData struct {
+	securityInfo
+	LastClose float64 `json:"lastClose"`
+	Change    float64 `json:"change"`
 }
 
 // expSecurityQuotes contains security quotes and some extra data (string)
 type expSecurityQuotes struct {
+	XMLName     xml.Name `json:"-" xml:"Quotes"`
 	Interval    string
 	Begin       string
 	End         string
@@ -58,418 +343,3648 @@ type expSecurityQuotes struct {
 	Close       string
 	High        string
 	Low         string
+	Volume      string
 	Change      string
 	TotalChange string
+	SMA         string
+	RSI         string
+	BBMiddle    string
+	BBUpper     string
+	BBLower     string
+}
+
+// correlationData contains correlation of two securities returns for the given period (string)
+type correlationData struct {
+	Id1         string
+	Type1       string
+	Id2         string
+	Type2       string
+	DateFrom    string
+	DateTill    string
+	Interval    string
+	Correlation string
+}
+
+// betaData contains beta of security versus the benchmark for the period (string)
+type betaData struct {
+	Id            string
+	Type          string
+	Benchmark     string
+	BenchmarkType string
+	DateFrom      string
+	DateTill      string
+	Interval      string
+	Beta          string
+}
+
+// defaultBenchmark is the index which is the benchmark for beta if it's not set in request
+const defaultBenchmark = "IMOEX"
+
+// gapsData contains the trading days without quotes of security (string)
+type gapsData struct {
+	Id       string
+	Type     string
+	Interval string
+	Missing  []string
+}
+
+// dividendData contains one dividend of security (string)
+type dividendData struct {
+	Date     string
+	Value    string
+	Currency string
+}
+
+// dividendsData contains dividends of security (string)
+type dividendsData struct {
+	Id        string
+	Type      string
+	Dividends []dividendData
+}
+
+// bondPaymentData contains one payment of bond (string), start is empty if the coupon period is unknown
+type bondPaymentData struct {
+	Date         string
+	Start        string
+	Coupon       string
+	Amortization string
+}
+
+// bondData contains face value and payments of bond (string)
+type bondData struct {
+	Id        string
+	Type      string
+	FaceValue string
+	Payments  []bondPaymentData
+}
+
+// securityListPrice contains prices of security from the list for the period (string)
+type securityListPrice struct {
+	Id         string
+	PriceBegin string
+	PriceEnd   string
+	Change     string
+}
+
+// securityListError contains the error of security from the list
+type securityListError struct {
+	Id    string
+	Error string
+}
+
+// securityListData contains the result of processing the list of securities from file - prices sorted by change and errors sorted by id
+type securityListData struct {
+	File       string // name of the uploaded file without extension
+	Securities []securityListPrice
+	Errors     []securityListError
+}
+
+// jobData contains progress of the job processing the list of securities, the result is set when the job is done
+type jobData struct {
+	Id        int64
+	Done      bool
+	Total     int
+	Processed int
+	Errors    []securityListError
+	Error     string            `json:",omitempty"`
+	Result    *securityListData `json:",omitempty"`
 }
 
 // securityData contains data of security (string) and expanded quotes data
 type securityData struct {
-	Id           string
-	Name         string
-	Type         string
-	Currency     string
-	DateFrom     string
-	DateTill     string
-	Interval     string
-	UpdatePrices string
-	ExpQuotes    []expSecurityQuotes
+	XMLName         xml.Name `json:"-" xml:"SecurityData"`
+	Id              string
+	Name            string
+	Type            string
+	Currency        string
+	DateFrom        string
+	DateTill        string
+	Interval        string
+	UpdatePrices    string
+	SMA             string
+	RSI             string
+	BB              string
+	BBDev           string
+	DisplayCurrency string
+	TotalReturn     string
+	Bond            bondYieldsData
+	MaxDrawdown     maxDrawdownData
+	HighLow         highLowData
+	AverageVolume   string // mean volume of the last averageVolumePeriod quotes of the period
+	RiskFree        string // annual risk-free rate (%) for Sharpe and Sortino ratios
+	Sharpe          string
+	Sortino         string
+	ExpQuotes       []expSecurityQuotes `xml:"ExpQuotes>Quotes"`
 }
 
-func init() {
-	settingsFileName := "src\\conf.json"
+// bondYieldsData contains face value and yields (%) of bond by the last price of the period (string), it's empty for other securities
+type bondYieldsData struct {
+	FaceValue       string
+	CurrentYield    string
+	YieldToMaturity string
+}
 
-	file, err := os.Open(settingsFileName)
-	if err != nil {
-		log.Fatal("settings file not found")
+// maxDrawdownData contains the largest decline of security price for the period (string)
+type maxDrawdownData struct {
+	Drawdown string
+	Peak     string
+	Trough   string
+}
+
+// highLowData contains the highest and the lowest prices of security for 52 weeks till the end of the period (string)
+// FromHigh and FromLow are the differences (%) of the last price from them, they are empty if there are no quotes
+type highLowData struct {
+	High     string
+	HighDate string
+	Low      string
+	LowDate  string
+	FromHigh string
+	FromLow  string
+}
+
+// highLowWindow is the window of the highest and the lowest prices of security
+const highLowWindow = 52 * 7 * 24 * time.Hour
+
+// averageVolumePeriod is the number of quotes for average volume of security
+const averageVolumePeriod = 20
+
+// defaultRiskFree is the annual risk-free rate (%) for Sharpe and Sortino ratios if it's not set in request
+// It's close to yields of short-term Russian government bonds
+const defaultRiskFree = 10.0
+
+// configFlag is the command-line flag with the path to settings file
+var configFlag = flag.String("config", "", "path to settings file (default is src/conf.json or "+configEnv+" environment variable)")
+
+// devFlag is the command-line flag to turn on dev mode (the same as DevMode setting)
+var devFlag = flag.Bool("dev", false, "parse html templates on every request")
+
+// configEnv is the environment variable with the path to settings file
+const configEnv = "SECURITIES_CONFIG"
+
+// settingsFileName returns the path to settings file
+// The path is taken from command-line flag, then from environment variable, otherwise the default path is used
+// If there is no file in the default path, settings are taken only from environment variables
+func settingsFileName() string {
+	if *configFlag != "" {
+		return *configFlag
 	}
-	defer file.Close()
 
-	data, err := io.ReadAll(file)
-	if err != nil {
-		log.Fatal(err.Error())
+	if fileName := os.Getenv(configEnv); fileName != "" {
+		return fileName
 	}
 
-	type settings struct {
-		HtmlDir  string
-		HttpPath string
-		MySQL    string
-		MainDB   string
-		DemoData bool
+	fileName := filepath.Join("src", "conf.json")
+	if _, err := os.Stat(fileName); errors.Is(err, os.ErrNotExist) {
+		return ""
 	}
-	conf := settings{}
-	err = json.Unmarshal(data, &conf)
+
+	return fileName
+}
+
+// setup parses command-line flags, loads settings and opens the storage
+// It's called at the start of main, so flags of all packages are already defined
+func setup() {
+	flag.Parse()
+
+	conf, err := config.Load(settingsFileName())
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal("loading settings", "error", err)
 	}
 
+	// the level is checked by config
+	logLevel, _ := config.ParseLogLevel(conf.LogLevel)
+	logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+	moex.Logger = logger
+	securitiesSQL.Logger = logger
+
 	htmlDir = conf.HtmlDir
 	httpPath = conf.HttpPath
-	sqlParam := conf.MySQL
-	dbName := conf.MainDB
-	demoData := conf.DemoData
+	listenAddr = conf.ListenAddr
+	readOnly = conf.ReadOnly
+	corsPolicy = cors.New(conf.CORSOrigins, conf.CORSMethods, conf.CORSHeaders)
+	apiKeys = conf.APIKeys
+	apiKeysForReads = conf.APIKeysForReads
+	requestTimeout = time.Duration(conf.RequestTimeout) * time.Second
+	requestLimiter = ratelimit.New(conf.RateLimit, conf.RateBurst, requestKey)
+	updateLimiter = ratelimit.New(conf.UpdateRateLimit, conf.UpdateRateBurst, clientKey)
+	verifyOnAdd = conf.VerifyOnAdd
+	autoUpdate = conf.AutoUpdate
+	listConcurrency = conf.ListConcurrency
+	listCache = cache.New[[]byte](time.Duration(conf.ListCacheTTL) * time.Second)
+	devMode = conf.DevMode || *devFlag
+
+	updateTime, err := time.Parse("15:04", conf.AutoUpdateTime)
+	if err != nil {
+		fatal("wrong time of scheduled update", "error", err)
+	}
+	autoUpdateTime = time.Duration(updateTime.Hour())*time.Hour + time.Duration(updateTime.Minute())*time.Minute
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		fatal("generating internal token", "error", err)
+	}
+	internalToken = hex.EncodeToString(token)
+
+	templates, err = parseTemplates()
+	if err != nil {
+		fatal("parsing html templates", "dir", htmlDir, "error", err)
+	}
+
+	securitiesSQL.Pool = securitiesSQL.PoolSettings{
+		MaxOpenConns:    conf.MaxOpenConns,
+		MaxIdleConns:    conf.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(conf.ConnMaxLifetime) * time.Second,
+	}
+
+	switch conf.Backend {
+	case "mysql":
+		store, err = openMySQLStore(conf.MySQL, conf.MainDB, conf.DemoData)
+	case "sqlite":
+		store, err = openSQLiteStore(conf.SQLiteFile, conf.DemoData)
+	}
+	if err != nil {
+		fatal("opening storage", "backend", conf.Backend, "error", err)
+	}
+
+	var ok bool
+	portfolios, ok = store.(portfolio.Store)
+	if !ok {
+		fatal("storage doesn't keep portfolios", "backend", conf.Backend)
+	}
 
-	db, err = sql.Open("mysql", sqlParam+"/"+dbName)
+	alertStore, ok = store.(alerts.Store)
+	if !ok {
+		fatal("storage doesn't keep alerts", "backend", conf.Backend)
+	}
+
+	err = metrics.RegisterStorageStats(store.GetStats)
+	if err != nil {
+		fatal("registering storage metrics", "error", err)
+	}
+
+	// stored quotes are pushed to websocket subscribers
+	store = notifyingStore{store}
+}
+
+// fatal logs the error with its fields and stops the service, it's used only while starting and stopping the service
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// parseTemplates parses all html templates
+func parseTemplates() (map[string]*template.Template, error) {
+	res := make(map[string]*template.Template, len(templateNames))
+
+	for _, name := range templateNames {
+		html, err := template.ParseFiles(filepath.Join(htmlDir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		res[name] = html
+	}
+
+	return res, nil
+}
+
+// getTemplate returns html template with the given file name
+// Templates are parsed once at start, but in dev mode they are parsed again on every call
+func getTemplate(name string) (*template.Template, error) {
+	if devMode {
+		return template.ParseFiles(filepath.Join(htmlDir, name))
+	}
+
+	html, ok := templates[name]
+	if !ok {
+		return nil, fmt.Errorf("html template %s not found", name)
+	}
+
+	return html, nil
+}
+
+// openMySQLStore opens MySQL database (or creates it if it doesn't exist) and returns the store to work with it
+func openMySQLStore(sqlParam string, dbName string, demoData bool) (securities.Store, error) {
+	sqlDB, err := sql.Open("mysql", sqlParam+"/"+dbName)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
+	securitiesSQL.Pool.Apply(sqlDB)
+	db := securitiesSQL.NewDB(sqlDB, securitiesSQL.MySQL)
 
 	err = db.Ping()
 	if err != nil {
+		if readOnly {
+			// we can't create database in read-only mode
+			return nil, err
+		}
+
 		// if database doesn't exist we'll create it
 		db, err = securitiesSQL.CreateDatabase(sqlParam, dbName)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 
 		if demoData {
 			err := securitiesSQL.PutTestDataInDatabase(db)
 			if err != nil {
-				log.Fatal(err)
+				return nil, err
 			}
 		}
 	}
-}
 
-func main() {
-	defer db.Close()
+	if !readOnly {
+		err = securitiesSQL.UpgradeDatabase(db)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// http requests to get json data
-	http.HandleFunc("/securities/getAllSecuritiesLastQuotes", getAllSecuritiesLastQuotesHandler)
-	http.HandleFunc("/securities/addSecurity", addSecurityHandler)
-	http.HandleFunc("/securities/getLastQuotes", getLastQuotesHandler)
-	http.HandleFunc("/securities/getSecurityData", getSecurityDataHandler)
-	http.HandleFunc("/securities/delete", deleteSecurityHandler)
+	return securitiesSQL.NewStore(db), nil
+}
 
-	// http requests to work with html pages
-	http.HandleFunc("/securities", enterHandler)
-	http.HandleFunc("/securities/all", allSecuritiesHandler)
-	http.HandleFunc("/securities/add", addSecurityPageHandler)
-	http.HandleFunc("/securities/allQuotes", getQuotesPageHandler)
-	http.HandleFunc("/securities/security", securityHandler)
-	http.HandleFunc("/securities/compare", compareHandler)
-	http.HandleFunc("/securities/securityList", securityListHandler)
+// openSQLiteStore opens SQLite database file (or creates it if it doesn't exist) and returns the store to work with it
+func openSQLiteStore(fileName string, demoData bool) (securities.Store, error) {
+	if fileName == "" {
+		return nil, errors.New("SQLite database file is not set")
+	}
 
-	// finish working
-	err := http.ListenAndServe("localhost:8080", nil)
-	log.Fatal(err)
-}
+	_, err := os.Stat(fileName)
+	newFile := errors.Is(err, os.ErrNotExist)
+	if newFile && readOnly {
+		// we can't create database in read-only mode
+		return nil, fmt.Errorf("SQLite database file %s not found", fileName)
+	}
 
-// getDateFromString returns date (no time) from the given string
-func getDateFromString(dateString string, defaultDate time.Time) time.Time {
-	if dateString != "" {
-		date, err := time.Parse("2006-01-02", dateString)
+	db, err := securitiesSQLite.OpenDatabase(fileName, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if newFile && demoData {
+		err := securitiesSQL.PutTestDataInDatabase(db)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
-		return date
 	}
 
-	return defaultDate
+	return securitiesSQL.NewStore(db), nil
 }
 
-// showErrorPage opens error page
-func showErrorPage(writer http.ResponseWriter, errToDisplay string) {
-	html, err := template.ParseFiles(htmlDir + "errorPage.html")
+func main() {
+	setup()
+
+	// metrics of the service for Prometheus
+	http.Handle("/metrics", promhttp.Handler())
+
+	// health checks for load balancers and orchestrators
+	// probes come often from the same address, so they aren't rate limited, readiness check has its own timeout
+	http.HandleFunc("/healthz", metrics.InstrumentHandler("/healthz", healthzHandler))
+	http.HandleFunc("/readyz", metrics.InstrumentHandler("/readyz", readyzHandler))
+
+	// http requests to get json data
+	handleAPIFunc("/securities/getAllSecuritiesLastQuotes", getAllSecuritiesLastQuotesHandler)
+	handleAPIFunc("/securities/addSecurity", addSecurityHandler)
+	handleAPIFunc("/securities/getLastQuotes", getLastQuotesHandler)
+	handleAPIFunc("/securities/getSecurityData", getSecurityDataHandler)
+	handleAPIFunc("/securities/delete", deleteSecurityHandler)
+	handleAPIFunc("/securities/deleteSecurities", deleteSecuritiesHandler)
+	handleAPIFunc("/securities/restore", restoreSecurityHandler)
+	handleAPIFunc("/securities/refetchDay", refetchDayHandler)
+	handleAPIFunc("/securities/getCorrelation", getCorrelationHandler)
+	handleAPIFunc("/securities/beta", getBetaHandler)
+	handleAPIFunc("/securities/gaps", getGapsHandler)
+	handleAPIFunc("/securities/dividends", getDividendsHandler)
+	handleAPIFunc("/securities/bond", getBondHandler)
+	handleAPIFunc("/securities/stale", getStaleSecuritiesHandler)
+	handleAPIFunc("/securities/topMovers", topMoversHandler)
+	handleAPIFunc("/securities/search", searchSecuritiesHandler)
+	handleAPIFunc("/securities/export", exportSecurityHandler)
+	handleStreamFunc("/securities/stream", streamLastQuotesHandler)
+	handleStreamFunc("/securities/ws", securityUpdatesHandler)
+	handleAPIFunc("/securities/jobs/", jobResourceHandler)
+	handleAPIFunc("/securities/", securityResourceHandler)
+	handleAPIFunc("/portfolios", portfoliosHandler)
+	handleAPIFunc("/portfolios/", portfolioResourceHandler)
+	handleAPIFunc("/alerts", alertsHandler)
+	handleAPIFunc("/alerts/", alertResourceHandler)
+
+	// http requests to work with html pages
+	handleFunc("/securities", enterHandler)
+	handleFunc("/securities/all", allSecuritiesHandler)
+	handleFunc("/securities/add", addSecurityPageHandler)
+	handleFunc("/securities/allQuotes", getQuotesPageHandler)
+	handleFunc("/securities/security", securityHandler)
+	handleFunc("/securities/compare", compareHandler)
+	handleFunc("/securities/securityList", securityListHandler)
+
+	server := &http.Server{Addr: listenAddr}
+
+	// streams never become idle, so they are finished at once when the server is shut down
+	server.RegisterOnShutdown(lastQuotesUpdates.Close)
+	server.RegisterOnShutdown(securityUpdates.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// jobs are cancelled with the server, so they don't use closed database
+	listJobs = jobs.New[securityListData](ctx, listJobTTL)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "addr", listenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// scheduled updates are stopped with the server, so they don't use closed database
+	scheduler := new(sync.WaitGroup)
+	if autoUpdate && !readOnly {
+		scheduler.Add(1)
+
+		go func() {
+			defer scheduler.Done()
+			runAutoUpdates(ctx)
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		stop()
+		scheduler.Wait()
+		listJobs.Wait()
+		store.Close()
+		fatal("http server failed", "error", err)
+	case <-ctx.Done():
+	}
+
+	// finish working - active requests (quote updates for example) get some time to be finished before database is closed
+	logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal(err) // we can't work without error page
+		logger.Error("http server shutdown", "error", err)
 	}
 
-	errData := struct{ Err string }{errToDisplay}
+	scheduler.Wait()
+	listJobs.Wait()
 
-	err = html.Execute(writer, errData)
+	err = store.Close()
 	if err != nil {
-		log.Fatal(err) // we can't work without error page
+		logger.Error("closing database", "error", err)
 	}
 }
 
-// executeRequest executes given HTTP request
-func executeRequest(writer http.ResponseWriter, request string, resStruct any) {
-	resp, err := http.Get(request)
-	if err != nil {
-		showErrorPage(writer, err.Error())
-		return
+// handleFunc registers the handler for the pattern in the default mux, requests and errors of handler are counted in metrics
+// Responses are compressed with gzip for clients which accept it, clients which exceed the rate of requests get 429 error
+// Requests which aren't served in requestTimeout get 503 error
+func handleFunc(pattern string, handler http.HandlerFunc) {
+	registerFunc(pattern, timeout.Handler(requestTimeout, handler))
+}
+
+// handleAPIFunc registers the handler of json api as handleFunc
+func handleAPIFunc(pattern string, handler http.HandlerFunc) {
+	handleFunc(pattern, apiHandler(handler))
+}
+
+// handleStreamFunc registers the handler of json api which streams updates to the client, streams are not limited in time
+func handleStreamFunc(pattern string, handler http.HandlerFunc) {
+	registerFunc(pattern, apiHandler(handler))
+}
+
+// registerFunc registers the handler for the pattern in the default mux with metrics, rate limit and compression
+func registerFunc(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, metrics.InstrumentHandler(pattern, requestLimiter.Handler(compress.Gzip(handler))))
+}
+
+// apiHandler wraps the handler of json api, cross-origin requests are allowed by corsPolicy
+// API key is checked for all requests if apiKeysForReads is set, otherwise only requests which change data check it
+func apiHandler(handler http.HandlerFunc) http.HandlerFunc {
+	if apiKeysForReads {
+		handler = requireAPIKey(handler)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		showErrorPage(writer, resp.Header["Err"][0])
-		return
+	return corsPolicy.Handler(handler)
+}
+
+// getDateFromString returns date (no time) from the given string
+func getDateFromString(dateString string, defaultDate time.Time) (time.Time, error) {
+	if dateString != "" {
+		return time.Parse("2006-01-02", dateString)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return defaultDate, nil
+}
+
+// getPeriodFromStrings returns the period from the given strings (the last month by default)
+// The period includes the whole last day
+func getPeriodFromStrings(dateFromString string, dateTillString string) (time.Time, time.Time, error) {
+	dateFrom, err := getDateFromString(dateFromString, time.Now().Truncate(time.Hour*24).AddDate(0, -1, 0))
 	if err != nil {
-		showErrorPage(writer, resp.Header["Err"][0])
-		return
+		return time.Time{}, time.Time{}, err
 	}
 
-	err = json.Unmarshal(body, &resStruct)
+	dateTill, err := getDateFromString(dateTillString, time.Now().Truncate(time.Hour*24))
 	if err != nil {
-		showErrorPage(writer, err.Error())
-		return
+		return time.Time{}, time.Time{}, err
+	}
+
+	dateFrom = dateFrom.UTC()
+	dateTill = dateTill.Add(time.Second * (60*60*24 - 1)).UTC()
+	if dateFrom.After(dateTill) {
+		return time.Time{}, time.Time{}, errors.New("date from can't be after date till")
 	}
+
+	return dateFrom, dateTill, nil
 }
 
-/////////////////////////
-///// HTTP Handlers /////
-/////////////////////////
+// getPageFromStrings converts strings with limit and offset of the page to int
+// The default limit is used if limit string is empty
+func getPageFromStrings(limitString string, offsetString string) (int, int, error) {
+	limit := defaultPageLimit
+	if limitString != "" {
+		var err error
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("wrong limit %s", limitString)
+		}
+	}
 
-// getAllSecuritiesLastQuotesHandler gets all securities of the given type and currency from database with it's last quotes
-func getAllSecuritiesLastQuotesHandler(writer http.ResponseWriter, request *http.Request) {
-	typeNameFilter := request.URL.Query().Get("type")
-	currencyNameFilter := request.URL.Query().Get("currency")
+	offset := 0
+	if offsetString != "" {
+		var err error
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("wrong offset %s", offsetString)
+		}
+	}
+
+	return limit, offset, nil
+}
 
-	secList, err := securitiesSQL.GetAllSecuritiesData(db, typeNameFilter, currencyNameFilter)
+// showErrorPage opens error page
+// The error is sent as plain text if there is no error page
+func showErrorPage(writer http.ResponseWriter, errToDisplay string) {
+	html, err := getTemplate("errorPage.html")
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		logger.Error("error page", "error", err)
+		http.Error(writer, errToDisplay, http.StatusInternalServerError)
 		return
 	}
 
-	wg := new(sync.WaitGroup)
-	mu := new(sync.Mutex)
+	errData := struct{ Err string }{errToDisplay}
 
-	generalSecData := new([]generalSecurityData)
-	for _, sec := range secList {
-		wg.Add(1)
+	// the client has already got timeout error if the request took too long
+	err = html.Execute(writer, errData)
+	if err != nil && !errors.Is(err, http.ErrHandlerTimeout) {
+		logger.Error("error page", "error", err)
+	}
+}
 
-		go func(sec *securities.Security) {
-			defer wg.Done()
+// errorData is the body of error response
+type errorData struct {
+	Error string `json:"error"`
+}
 
-			q := sec.LastQuotes(securities.IntervalDay)
+// writeError sends error response with the given HTTP status code and json body {"error": "..."}
+// Server errors are logged, errors of requests are only sent to the client
+func writeError(writer http.ResponseWriter, status int, errText string) {
+	if status >= http.StatusInternalServerError {
+		logger.Error("request failed", "status", status, "error", errText)
+	}
 
-			secData := generalSecurityData{
-				ID:            sec.Id(),
-				Name:          sec.Name(),
-				Type:          string(sec.SType()),
-				Currency:      string(sec.Currency()),
-				LastPriceDate: q.End.Format("02-01-2006 15:04"),
-				LastPrice:     fmt.Sprintf("%f", q.Close),
-			}
+	res, _ := json.Marshal(errorData{Error: errText})
 
-			mu.Lock()
-			*generalSecData = append(*generalSecData, secData)
-			mu.Unlock()
-		}(sec)
-	}
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(res)
+}
 
-	wg.Wait()
+// xmlContentType is the content type of XML responses
+const xmlContentType = "application/xml; charset=utf-8"
 
-	sort.Slice(*generalSecData, func(i, j int) bool {
-		return (*generalSecData)[i].ID < (*generalSecData)[j].ID
-	})
+// wantsXML checks if the client asks for XML in Accept header, JSON is sent otherwise
+// The first of XML and JSON media types listed in the header wins, quality values are not compared
+func wantsXML(request *http.Request) bool {
+	for _, part := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
 
-	allSecData := AllSecuritiesData{
-		TypeFilter:     typeNameFilter,
-		CurrencyFilter: currencyNameFilter,
-		Securities:     *generalSecData,
+		switch mediaType {
+		case "application/xml", "text/xml":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+
+	return false
+}
+
+// marshalData converts data to XML (with the header) if asXML is true and to JSON otherwise
+func marshalData(data any, asXML bool) ([]byte, error) {
+	if !asXML {
+		return json.Marshal(data)
+	}
+
+	res, err := xml.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), res...), nil
+}
+
+// setDataContentType sets content type of response with data in XML or JSON
+// The response depends on Accept header, so caches are told to keep both variants
+func setDataContentType(writer http.ResponseWriter, asXML bool) {
+	writer.Header().Add("Vary", "Accept")
+	if asXML {
+		writer.Header().Set("Content-Type", xmlContentType)
+	} else {
+		writer.Header().Set("Content-Type", "application/json")
+	}
+}
+
+// storeErrorStatus returns HTTP status code for the error got from storage
+func storeErrorStatus(err error) int {
+	if errors.Is(err, securities.ErrSecurityNotExist) || errors.Is(err, portfolio.ErrPortfolioNotExist) || errors.Is(err, portfolio.ErrNoQuotes) || errors.Is(err, securities.ErrNoRate) || errors.Is(err, securities.ErrNoBondInfo) || errors.Is(err, alerts.ErrAlertNotExist) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, securities.ErrSecurityExists) {
+		return http.StatusConflict
+	}
+
+	// Moscow Exchange or database didn't answer before the deadline of the request
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusInternalServerError
+}
+
+// maxErrorBodySize is the maximum size of error response body we read to get error text
+const maxErrorBodySize = 4096
+
+// responseError returns error from the failed response
+// Error text is taken from json body of our handlers, then from Err header (if there is any), then from plain text body
+// If there is no error text at all, the response status is used
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+
+	errData := errorData{}
+	if json.Unmarshal(body, &errData) == nil && errData.Error != "" {
+		return errors.New(errData.Error)
+	}
+
+	if errText := resp.Header.Get("Err"); errText != "" {
+		return errors.New(errText)
+	}
+
+	if errText := strings.TrimSpace(string(body)); errText != "" && !strings.HasPrefix(errText, "{") {
+		return fmt.Errorf("%s: %s", resp.Status, errText)
+	}
+
+	return errors.New(resp.Status)
+}
+
+// apiGet sends GET request to json api of the service for the original request of html page
+// API key of the original request is passed on, so pages can't be used to change data without the key
+func apiGet(original *http.Request, apiURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(original.Context(), http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := original.Header.Get(apiKeyHeader); key != "" {
+		req.Header.Set(apiKeyHeader, key)
+	}
+	req.Header.Set(internalHeader, internalToken+" "+clientKey(original))
+
+	return http.DefaultClient.Do(req)
+}
+
+// requestData executes given HTTP request for the original request of html page and puts the result into resStruct
+func requestData(original *http.Request, request string, resStruct any) error {
+	resp, err := apiGet(original, request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, &resStruct)
+}
+
+// executeRequest executes given HTTP request for the original request of html page and opens error page if something goes wrong
+// Returns false if error page was opened, so the caller shouldn't write anything else
+func executeRequest(writer http.ResponseWriter, original *http.Request, request string, resStruct any) bool {
+	err := requestData(original, request, resStruct)
+	if err != nil {
+		showErrorPage(writer, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// getSecurityForPeriod gets security data from database leaving only quotes of the given interval which end in the given period
+func getSecurityForPeriod(id string, sType securities.SecurityType, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) (*securities.Security, error) {
+	sec := securities.GetQuickSecurity(id, sType)
+
+	err := store.GetSecurityData(sec)
+	if err != nil {
+		return nil, err
+	}
+
+	var quotes []securities.SecurityQuotes
+	for _, q := range *sec.QuotesOfInterval(interval) {
+		if dateFrom.After(q.End) || q.End.After(dateTill) {
+			continue
+		}
+
+		quotes = append(quotes, q)
+	}
+
+	res := securities.GetSecurity(sec.Id(), sec.Name(), sec.SType(), sec.Currency())
+	res.AddQuotes(quotes)
+
+	return res, nil
+}
+
+// indicatorValuesByDate returns indicator values by begin date of quotes
+func indicatorValuesByDate(values []securities.IndicatorValue) map[time.Time]float64 {
+	res := make(map[time.Time]float64, len(values))
+	for _, v := range values {
+		res[v.Begin] = v.Value
+	}
+
+	return res
+}
+
+// alignIndicatorValues returns indicator values by begin date of quotes
+// Quotes must be sorted by begin date, the values correspond to the last quotes (as indicators skip the first quotes)
+func alignIndicatorValues(quotes []securities.SecurityQuotes, values []float64) map[time.Time]float64 {
+	res := make(map[time.Time]float64, len(values))
+
+	offset := len(quotes) - len(values)
+	if offset < 0 {
+		return res
+	}
+
+	for i, v := range values {
+		res[quotes[i+offset].Begin] = v
+	}
+
+	return res
+}
+
+// rejectInReadOnly sends read-only mode error if the service works in read-only mode
+// Returns true if the request was rejected
+func rejectInReadOnly(writer http.ResponseWriter) bool {
+	if !readOnly {
+		return false
+	}
+
+	writeError(writer, http.StatusForbidden, errReadOnly)
+	return true
+}
+
+// validAPIKey checks if the key is one of apiKeys, keys are compared in constant time
+func validAPIKey(key string) bool {
+	valid := false
+	for _, k := range apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			valid = true
+		}
+	}
+
+	return valid
+}
+
+// rejectUnauthorized sends 401 error if API keys are set and the request has no valid key in X-API-Key header
+// Returns true if the request was rejected
+func rejectUnauthorized(writer http.ResponseWriter, request *http.Request) bool {
+	if len(apiKeys) == 0 {
+		return false
+	}
+
+	key := request.Header.Get(apiKeyHeader)
+	if key == "" {
+		writeError(writer, http.StatusUnauthorized, "API key is required")
+		return true
+	}
+
+	if !validAPIKey(key) {
+		writeError(writer, http.StatusUnauthorized, "wrong API key")
+		return true
+	}
+
+	return false
+}
+
+// rejectWrite sends error if the request can't change data - it has no valid API key or the service works in read-only mode
+// Returns true if the request was rejected
+func rejectWrite(writer http.ResponseWriter, request *http.Request) bool {
+	return rejectUnauthorized(writer, request) || rejectInReadOnly(writer)
+}
+
+// requireAPIKey checks API key of all requests of handler, requests without valid key are rejected with 401 error
+func requireAPIKey(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if rejectUnauthorized(writer, request) {
+			return
+		}
+
+		handler(writer, request)
+	}
+}
+
+// internalClient returns the rate limit key of the page client if the request is sent by html page to json api
+func internalClient(request *http.Request) (string, bool) {
+	token, client, found := strings.Cut(request.Header.Get(internalHeader), " ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(internalToken)) != 1 {
+		return "", false
+	}
+
+	return client, true
+}
+
+// clientKey returns the rate limit key of the client - valid API key or IP address
+// Requests of html pages to json api are counted for the client of the page
+func clientKey(request *http.Request) string {
+	if client, ok := internalClient(request); ok {
+		return client
+	}
+
+	if key := request.Header.Get(apiKeyHeader); key != "" && validAPIKey(key) {
+		return "key:" + key
+	}
+
+	return ratelimit.RemoteIP(request)
+}
+
+// requestKey returns the key of requestLimiter, requests of html pages to json api aren't limited as the page request is already counted
+func requestKey(request *http.Request) string {
+	if _, ok := internalClient(request); ok {
+		return ""
+	}
+
+	return clientKey(request)
+}
+
+// rejectTooManyUpdates sends 429 error if the client exceeds the rate of requests which update data on Moscow Exchange
+// Returns true if the request was rejected
+func rejectTooManyUpdates(writer http.ResponseWriter, request *http.Request) bool {
+	ok, retryAfter := updateLimiter.Allow(request)
+	if ok {
+		return false
+	}
+
+	ratelimit.Reject(writer, retryAfter)
+	return true
+}
+
+// updateLastQuotes updates last quotes of all securities
+// Manual and scheduled updates made at the same time share one update
+func updateLastQuotes(ctx context.Context) error {
+	err := store.UpdateAllSecuritiesLastQuotes(ctx, "", "")
+
+	// some quotes may be written even if there is an error
+	listCache.Clear()
+	lastQuotesUpdates.Publish(struct{}{})
+
+	alertErr := checkAlerts(ctx, time.Now())
+	if alertErr != nil {
+		logger.Error("checking alerts", "error", alertErr)
+	}
+
+	return err
+}
+
+// checkAlerts checks enabled price alerts by stored last quotes, records fired alerts and sends them to webhooks
+func checkAlerts(ctx context.Context, now time.Time) error {
+	alertList, err := alertStore.GetAllAlerts()
+	if err != nil {
+		return err
+	}
+
+	enabled := 0
+	for _, a := range alertList {
+		if a.Enabled {
+			enabled++
+		}
+	}
+
+	if enabled == 0 {
+		return nil
+	}
+
+	secList, _, err := store.GetAllSecuritiesData("", "", securities.SortByID, false, 0, 0, false)
+	if err != nil {
+		return err
+	}
+
+	firings := alerts.Evaluate(alertList, secList, now)
+	if len(firings) == 0 {
+		return nil
+	}
+
+	err = alertStore.FireAlerts(firings)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range firings {
+		logger.Info("alert fired", "alert", f.AlertId, "close", f.Close)
+	}
+
+	deliverFirings(ctx, alertList, firings)
+
+	return nil
+}
+
+// deliverFirings sends pending firings to webhooks of their alerts and records the results of delivery
+// Webhooks are sent at once, it returns when all of them are delivered or failed
+func deliverFirings(ctx context.Context, alertList []*alerts.Alert, firings []alerts.Firing) {
+	byId := make(map[int64]*alerts.Alert, len(alertList))
+	for _, a := range alertList {
+		byId[a.Id] = a
+	}
+
+	wg := new(sync.WaitGroup)
+	for _, f := range firings {
+		a, ok := byId[f.AlertId]
+		if !ok || f.Delivery != alerts.DeliveryPending {
+			continue
+		}
+
+		wg.Add(1)
+		go func(a *alerts.Alert, f alerts.Firing) {
+			defer wg.Done()
+
+			status := alerts.Delivered
+			deliveryErr := alerts.Deliver(ctx, a, f)
+			if deliveryErr != nil {
+				status = alerts.DeliveryFailed
+				logger.Warn("alert webhook failed", "alert", a.Id, "url", a.URL, "error", deliveryErr)
+			}
+
+			err := alertStore.SetFiringDelivery(f.Id, status, alerts.DeliveryError(deliveryErr))
+			if err != nil {
+				logger.Error("recording alert delivery", "alert", a.Id, "error", err)
+			}
+		}(a, f)
+	}
+
+	wg.Wait()
+}
+
+// runAutoUpdates updates last quotes of all securities once a trading day after autoUpdateTime (Moscow time) until the context is done
+// If the service is started after this time, quotes are updated at once
+func runAutoUpdates(ctx context.Context) {
+	logger.Info("scheduled update of last quotes every trading day", "time", fmt.Sprintf("%02d:%02d MSK", int(autoUpdateTime.Hours()), int(autoUpdateTime.Minutes())%60))
+
+	ticker := time.NewTicker(autoUpdateCheckPeriod)
+	defer ticker.Stop()
+
+	var lastDay time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			now = now.In(moscowTime)
+			day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, moscowTime)
+
+			if day.Equal(lastDay) || now.Before(day.Add(autoUpdateTime)) || !moex.IsTradingDay(day) {
+				continue
+			}
+			lastDay = day
+
+			start := time.Now()
+			err := updateLastQuotes(ctx)
+			if err != nil {
+				logger.Error("scheduled update of last quotes failed", "error", err)
+				continue
+			}
+
+			logger.Info("scheduled update of last quotes finished", "duration", time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+/////////////////////////
+///// HTTP Handlers /////
+/////////////////////////
+
+// healthData contains the status of the service for health checks
+type healthData struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// writeHealth sends the status of the service with the given HTTP status code
+func writeHealth(writer http.ResponseWriter, status int, data healthData) {
+	res, _ := json.Marshal(data)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(status)
+	writer.Write(res)
+}
+
+// healthzHandler answers that the service process is up, storage isn't checked
+func healthzHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	writeHealth(writer, http.StatusOK, healthData{Status: "ok"})
+}
+
+// readyzHandler answers if the service is ready to serve requests - storage is reachable and answers queries
+// 503 is returned if storage fails or doesn't answer in readyTimeout
+func readyzHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodHead)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), readyTimeout)
+	defer cancel()
+
+	err := store.Ping(ctx)
+	if err != nil {
+		logger.Warn("storage is not ready", "error", err)
+		writeHealth(writer, http.StatusServiceUnavailable, healthData{Status: "unavailable", Error: err.Error()})
+		return
+	}
+
+	writeHealth(writer, http.StatusOK, healthData{Status: "ok"})
+}
+
+// allSecuritiesLastQuotes gets the page of securities with last prices from storage and converts it to json (or XML if asXML is true)
+func allSecuritiesLastQuotes(typeNameFilter string, currencyNameFilter string, sortField securities.SortField, desc bool, limit int, offset int, includeDeleted bool, asXML bool) ([]byte, error) {
+	secList, total, err := store.GetAllSecuritiesData(typeNameFilter, currencyNameFilter, sortField, desc, limit, offset, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	// securities are already sorted by storage and have only last quotes, so the list is converted as it is
+	generalSecData := make([]generalSecurityData, 0, len(secList))
+	for _, sec := range secList {
+		generalSecData = append(generalSecData, getGeneralSecurityData(sec))
+	}
+
+	allSecData := AllSecuritiesData{
+		TypeFilter:     typeNameFilter,
+		CurrencyFilter: currencyNameFilter,
+		Sort:           string(sortField),
+		Desc:           desc,
+		Limit:          limit,
+		Offset:         offset,
+		Total:          total,
+		IncludeDeleted: includeDeleted,
+		Securities:     generalSecData,
+	}
+
+	return marshalData(allSecData, asXML)
+}
+
+// getGeneralSecurityData converts security with last quotes to general security data
+func getGeneralSecurityData(sec *securities.Security) generalSecurityData {
+	var q securities.SecurityQuotes
+	if quotes := *sec.QuotesOfInterval(securities.IntervalDay); len(quotes) > 0 {
+		q = quotes[len(quotes)-1]
+	}
+
+	data := generalSecurityData{
+		ID:            sec.Id(),
+		Name:          sec.Name(),
+		Type:          string(sec.SType()),
+		Currency:      string(sec.Currency()),
+		LastPriceDate: q.End.Format("02-01-2006 15:04"),
+		LastPrice:     fmt.Sprintf("%f", q.Close),
+	}
+
+	if !sec.LastUpdated().IsZero() {
+		data.LastUpdated = sec.LastUpdated().Format("02-01-2006 15:04")
+	}
+
+	return data
+}
+
+// getAllSecuritiesLastQuotesHandler gets all securities of the given type and currency from database with it's last quotes
+// The answer is XML if the client asks for it in Accept header and json otherwise
+func getAllSecuritiesLastQuotesHandler(writer http.ResponseWriter, request *http.Request) {
+	typeNameFilter := request.URL.Query().Get("type")
+	currencyNameFilter := request.URL.Query().Get("currency")
+
+	if typeNameFilter != "" && securities.GetSecurityTypeFromString(typeNameFilter) == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeNameFilter))
+		return
+	}
+
+	if currencyNameFilter != "" && securities.GetSecurityCurrencyFromString(currencyNameFilter) == securities.UnknownCurrency {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", currencyNameFilter))
+		return
+	}
+
+	sortString := request.URL.Query().Get("sort")
+	sortField := securities.GetSortFieldFromString(sortString)
+	if sortField == securities.UnknownSortField {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown sort field %s", sortString))
+		return
+	}
+
+	desc := request.URL.Query().Get("desc") == "true"
+	includeDeleted := request.URL.Query().Get("includeDeleted") == "true"
+
+	limit, offset, err := getPageFromStrings(request.URL.Query().Get("limit"), request.URL.Query().Get("offset"))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	asXML := wantsXML(request)
+
+	// the same page is cached for the same parameters and format, concurrent requests share one database query
+	key := strings.Join([]string{typeNameFilter, currencyNameFilter, string(sortField), strconv.FormatBool(desc), strconv.Itoa(limit), strconv.Itoa(offset), strconv.FormatBool(includeDeleted), strconv.FormatBool(asXML)}, "|")
+	res, err := listCache.Get(key, func() ([]byte, error) {
+		return allSecuritiesLastQuotes(typeNameFilter, currencyNameFilter, sortField, desc, limit, offset, includeDeleted, asXML)
+	})
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	setDataContentType(writer, asXML)
+	writer.Write(res)
+}
+
+// streamLastQuotesHandler sends last quotes of securities of the given type and currency as server-sent events
+// The current quotes are sent at once and then every time last quotes are updated until the client disconnects
+func streamLastQuotesHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	typeNameFilter := request.URL.Query().Get("type")
+	currencyNameFilter := request.URL.Query().Get("currency")
+
+	if typeNameFilter != "" && securities.GetSecurityTypeFromString(typeNameFilter) == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeNameFilter))
+		return
+	}
+
+	if currencyNameFilter != "" && securities.GetSecurityCurrencyFromString(currencyNameFilter) == securities.UnknownCurrency {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", currencyNameFilter))
+		return
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeError(writer, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	// subscription goes first, so updates made while the current quotes are read are not missed
+	updates, unsubscribe := lastQuotesUpdates.Subscribe()
+	defer unsubscribe()
+
+	res, err := allSecuritiesLastQuotes(typeNameFilter, currencyNameFilter, securities.SortByID, false, 0, 0, false, false)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+
+	// send writes the event and sends it to the client at once, false is returned if the client is gone
+	send := func(event string, data []byte) bool {
+		// json has no line breaks, so it's sent as one data line
+		_, err := fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event, data)
+		if err != nil {
+			return false
+		}
+
+		flusher.Flush()
+		return true
+	}
+
+	if !send("quotes", res) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			res, err = allSecuritiesLastQuotes(typeNameFilter, currencyNameFilter, securities.SortByID, false, 0, 0, false, false)
+			if err != nil {
+				// the stream is already started, so the error is sent as an event
+				logger.Warn("stream of last quotes failed", "error", err)
+				errData, _ := json.Marshal(errorData{Error: err.Error()})
+				send("error", errData)
+				return
+			}
+
+			if !send("quotes", res) {
+				return
+			}
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(writer, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// wsRequest is a message of websocket client, Action is "subscribe" or "unsubscribe"
+type wsRequest struct {
+	Action string
+	Ids    []string
+
+	err error // the message is wrong
+}
+
+// wsMessage is a message sent to websocket client
+// Type is "subscriptions" (Ids are all current subscriptions), "update" (Security has new last quotes) or "error"
+type wsMessage struct {
+	Type     string
+	Ids      []string             `json:",omitempty"`
+	Security *generalSecurityData `json:",omitempty"`
+	Error    string               `json:",omitempty"`
+}
+
+// maxWsRequestSize is the maximum size of message of websocket client
+const maxWsRequestSize = 1 << 12
+
+// wsWriteTimeout limits writing of one message to websocket client
+const wsWriteTimeout = 10 * time.Second
+
+// wsUpgrader upgrades http connections to websocket, only clients from the same origin and origins allowed by corsPolicy are accepted
+var wsUpgrader = websocket.Upgrader{CheckOrigin: checkWsOrigin}
+
+// checkWsOrigin checks that websocket client comes from the same origin as the request or from the origin allowed by corsPolicy
+// Requests without Origin header are not sent by browsers, so they are accepted
+func checkWsOrigin(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, request.Host) {
+		return true
+	}
+
+	return corsPolicy.Allowed(origin)
+}
+
+// lastQuotesOf returns securities with last quotes from storage which ids are in the set
+func lastQuotesOf(ids map[string]bool) ([]generalSecurityData, error) {
+	secList, _, err := store.GetAllSecuritiesData("", "", securities.SortByID, false, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []generalSecurityData{}
+	for _, sec := range secList {
+		if ids[sec.Id()] {
+			res = append(res, getGeneralSecurityData(sec))
+		}
+	}
+
+	return res, nil
+}
+
+// securityUpdatesHandler pushes last quotes of securities to websocket client every time their quotes are stored
+// Client subscribes to securities with {"Action": "subscribe", "Ids": [...]} and unsubscribes with {"Action": "unsubscribe", "Ids": [...]}
+// Current last quotes of newly subscribed securities are sent at once
+func securityUpdatesHandler(writer http.ResponseWriter, request *http.Request) {
+	// the error answer is written by upgrader
+	conn, err := wsUpgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	updates, unsubscribe := securityUpdates.Subscribe()
+	defer unsubscribe()
+
+	// messages of client are read in another goroutine, the channel is closed when client disconnects
+	requests := make(chan wsRequest)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(requests)
+
+		conn.SetReadLimit(maxWsRequestSize)
+		conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+		})
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var req wsRequest
+			err = json.Unmarshal(data, &req)
+			if err != nil {
+				req.err = fmt.Errorf("wrong message: %w", err)
+			}
+
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// send writes the message to client, false is returned if the client is gone
+	send := func(msg wsMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(msg) == nil
+	}
+
+	// sendQuotes sends last quotes of securities with the given ids
+	sendQuotes := func(ids map[string]bool) bool {
+		secData, err := lastQuotesOf(ids)
+		if err != nil {
+			logger.Warn("websocket update failed", "error", err)
+			return send(wsMessage{Type: "error", Error: err.Error()})
+		}
+
+		for i := range secData {
+			if !send(wsMessage{Type: "update", Security: &secData[i]}) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	subscriptions := make(map[string]bool)
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+
+			if req.err != nil {
+				if !send(wsMessage{Type: "error", Error: req.err.Error()}) {
+					return
+				}
+				continue
+			}
+
+			added := make(map[string]bool)
+			switch req.Action {
+			case "subscribe":
+				for _, id := range req.Ids {
+					if id == "" || len(id) > maxSecurityIdLength {
+						if !send(wsMessage{Type: "error", Error: fmt.Sprintf("wrong security id %q", id)}) {
+							return
+						}
+						continue
+					}
+
+					if !subscriptions[id] {
+						subscriptions[id] = true
+						added[id] = true
+					}
+				}
+			case "unsubscribe":
+				for _, id := range req.Ids {
+					delete(subscriptions, id)
+				}
+			default:
+				if !send(wsMessage{Type: "error", Error: fmt.Sprintf("unknown action %s", req.Action)}) {
+					return
+				}
+				continue
+			}
+
+			ids := make([]string, 0, len(subscriptions))
+			for id := range subscriptions {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+
+			if !send(wsMessage{Type: "subscriptions", Ids: ids}) {
+				return
+			}
+
+			if len(added) > 0 && !sendQuotes(added) {
+				return
+			}
+		case u, ok := <-updates:
+			if !ok {
+				// the server is shut down
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(wsWriteTimeout))
+				return
+			}
+
+			if u.All && len(subscriptions) > 0 {
+				if !sendQuotes(subscriptions) {
+					return
+				}
+			} else if subscriptions[u.Id] {
+				if !sendQuotes(map[string]bool{u.Id: true}) {
+					return
+				}
+			}
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// getStaleSecuritiesHandler gets securities which quotes were not updated for the given number of days (or were never updated)
+func getStaleSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
+	days := defaultStaleDays
+	if daysString := request.URL.Query().Get("days"); daysString != "" {
+		var err error
+		days, err = strconv.Atoi(daysString)
+		if err != nil || days <= 0 {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong number of days %s", daysString))
+			return
+		}
+	}
+
+	secList, _, err := store.GetAllSecuritiesData("", "", securities.SortByID, false, 0, 0, false)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	threshold := time.Now().UTC().AddDate(0, 0, -days)
+
+	staleData := staleSecuritiesData{
+		Days:       days,
+		Securities: []generalSecurityData{},
+	}
+
+	for _, sec := range secList {
+		if sec.LastUpdated().IsZero() || sec.LastUpdated().Before(threshold) {
+			staleData.Securities = append(staleData.Securities, getGeneralSecurityData(sec))
+		}
+	}
+
+	res, err := json.Marshal(staleData)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// addSecurityHandler adds new security to database
+// Security data is taken from json body of POST request or from query parameters of GET request (used by html page)
+// Omitted name, type and currency are taken from Moscow Exchange, the security is checked there before adding if verifyOnAdd is set
+func addSecurityHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+		return
+	}
+
+	var secInfo securityInfo
+	if request.Method == http.MethodPost {
+		decoder := json.NewDecoder(request.Body)
+		decoder.DisallowUnknownFields()
+
+		err := decoder.Decode(&secInfo)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
+			return
+		}
+	} else {
+		secInfo = securityInfo{
+			Id:       request.URL.Query().Get("id"),
+			Name:     request.URL.Query().Get("name"),
+			Type:     request.URL.Query().Get("type"),
+			Currency: request.URL.Query().Get("currency"),
+		}
+	}
+
+	if secInfo.Id == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	var desc *moex.SecurityDescription
+	var ok bool
+
+	// omitted values are taken from Moscow Exchange
+	if secInfo.Name == "" || secInfo.Type == "" || secInfo.Currency == "" {
+		desc, ok = getSecurityDescription(request.Context(), writer, secInfo.Id)
+		if !ok {
+			return
+		}
+
+		if secInfo.Name == "" {
+			secInfo.Name = desc.Name
+		}
+		if secInfo.Type == "" {
+			secInfo.Type = string(desc.Type)
+		}
+		if secInfo.Currency == "" {
+			secInfo.Currency = string(desc.Currency)
+		}
+	}
+
+	sType := securities.GetSecurityTypeFromString(secInfo.Type)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", secInfo.Type))
+		return
+	}
+
+	cur := securities.GetSecurityCurrencyFromString(secInfo.Currency)
+	if cur == securities.UnknownCurrency {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", secInfo.Currency))
+		return
+	}
+
+	if verifyOnAdd {
+		if desc == nil {
+			desc, ok = getSecurityDescription(request.Context(), writer, secInfo.Id)
+			if !ok {
+				return
+			}
+		}
+
+		err := desc.Check(sType)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	sec := securities.GetSecurity(secInfo.Id, secInfo.Name, sType, cur)
+
+	// the old GET form has always answered OK for existing security
+	err := store.AddSecurity(sec)
+	if err != nil && !(request.Method == http.MethodGet && errors.Is(err, securities.ErrSecurityExists)) {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	if request.Method == http.MethodGet {
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+
+	res, err := json.Marshal(securityInfo{
+		Id:       sec.Id(),
+		Name:     sec.Name(),
+		Type:     string(sec.SType()),
+		Currency: string(sec.Currency()),
+	})
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	writer.Write(res)
+}
+
+// getSecurityDescription gets security description from Moscow Exchange and sends error if it fails
+// Returns false if the error was sent
+func getSecurityDescription(ctx context.Context, writer http.ResponseWriter, id string) (*moex.SecurityDescription, bool) {
+	desc, err := moex.GetSecurityDescription(ctx, id)
+	if errors.Is(err, moex.ErrUnknownSecurity) {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeError(writer, http.StatusBadGateway, err.Error())
+		return nil, false
+	}
+
+	return desc, true
+}
+
+// getLastQuotesHandler gets last quotes for all securities
+func getLastQuotesHandler(writer http.ResponseWriter, request *http.Request) {
+	if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+		return
+	}
+
+	err := updateLastQuotes(request.Context())
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+}
+
+// getSecurityDataHandler gets security data and quotes
+// The answer is XML if the client asks for it in Accept header and json otherwise
+func getSecurityDataHandler(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	dateFromString := request.URL.Query().Get("dateFrom")
+	dateTillString := request.URL.Query().Get("dateTill")
+	intervalString := request.URL.Query().Get("interval")
+	updatePricesString := request.URL.Query().Get("updatePrices")
+	smaString := request.URL.Query().Get("sma")
+	rsiString := request.URL.Query().Get("rsi")
+	bbString := request.URL.Query().Get("bb")
+	bbDevString := request.URL.Query().Get("bbdev")
+	displayCurrencyString := request.URL.Query().Get("displayCurrency")
+	riskFreeString := request.URL.Query().Get("riskFree")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	displayCurrency := securities.UnknownCurrency
+	if displayCurrencyString != "" {
+		displayCurrency = securities.GetSecurityCurrencyFromString(displayCurrencyString)
+		if displayCurrency == securities.UnknownCurrency {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", displayCurrencyString))
+			return
+		}
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	smaPeriod := 0
+	if smaString != "" {
+		smaPeriod, err = strconv.Atoi(smaString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	rsiPeriod := 0
+	if rsiString != "" {
+		rsiPeriod, err = strconv.Atoi(rsiString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	bbPeriod := 0
+	if bbString != "" {
+		bbPeriod, err = strconv.Atoi(bbString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	bbDev := 2.0
+	if bbDevString != "" {
+		bbDev, err = strconv.ParseFloat(bbDevString, 64)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	riskFree := defaultRiskFree
+	if riskFreeString != "" {
+		riskFree, err = strconv.ParseFloat(riskFreeString, 64)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(dateFromString, dateTillString)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// prices are updated only from the last stored quotes in incremental mode and only for missing days in backfill mode
+	incremental := updatePricesString == "incremental"
+	backfill := updatePricesString == "backfill"
+	updatePrices := updatePricesString == "true" || incremental || backfill
+
+	if updatePrices {
+		if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+			return
+		}
+
+		sec := securities.GetQuickSecurity(id, sType)
+
+		if incremental {
+			err = store.UpdateSecurityQuotesIncremental(request.Context(), sec, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+		} else if backfill {
+			_, err = store.BackfillSecurityQuotes(request.Context(), sec, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+		} else {
+			err = store.UpdateSecurityQuotes(request.Context(), sec, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+		}
+		if err != nil {
+			logger.Warn("quotes update failed", "id", sec.Id(), "type", sType, "interval", qInterval, "mode", updatePricesString,
+				"dateFrom", dateFrom.Format("2006-01-02"), "dateTill", dateTill.Format("2006-01-02"), "error", err)
+			writeError(writer, storeErrorStatus(err), err.Error())
+			return
+		}
+
+		// coupons of bonds are updated with their prices
+		if sType == securities.Bond {
+			err = store.UpdateBondInfo(request.Context(), sec)
+			if err != nil {
+				writeError(writer, storeErrorStatus(err), err.Error())
+				return
+			}
+		}
+
+		listCache.Clear()
+	}
+
+	sec := securities.GetQuickSecurity(id, sType)
+
+	err = store.GetSecurityData(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	if displayCurrency != securities.UnknownCurrency && displayCurrency != sec.Currency() {
+		lookback := smaPeriod
+		for _, period := range []int{rsiPeriod, bbPeriod} {
+			if period > lookback {
+				lookback = period
+			}
+		}
+
+		sec, err = convertSecurityQuotes(request.Context(), sec, securities.QuotesInterval(qInterval), dateFrom, dateTill, lookback, displayCurrency)
+		if err != nil {
+			writeError(writer, storeErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	quotes := *sec.QuotesOfInterval(securities.QuotesInterval(qInterval))
+	expSeqQuotes := new([]expSecurityQuotes)
+
+	// indicators are calculated for all loaded quotes, so the first values in the period can use earlier quotes
+	smaValues := indicatorValuesByDate(sec.SMA(securities.QuotesInterval(qInterval), smaPeriod))
+	rsiValues := alignIndicatorValues(quotes, sec.RSI(securities.QuotesInterval(qInterval), rsiPeriod))
+
+	bbMiddle, bbUpper, bbLower := sec.BollingerBands(securities.QuotesInterval(qInterval), bbPeriod, bbDev)
+	bbMiddleValues := alignIndicatorValues(quotes, bbMiddle)
+	bbUpperValues := alignIndicatorValues(quotes, bbUpper)
+	bbLowerValues := alignIndicatorValues(quotes, bbLower)
+
+	// security with quotes only for the period to calculate statistics
+	periodSec := securities.GetSecurity(sec.Id(), sec.Name(), sec.SType(), sec.Currency())
+
+	startPrice := 0.0
+	prevPrice := 0.0
+	for _, q := range quotes {
+		if dateFrom.After(q.End) || q.End.After(dateTill) {
+			continue
+		}
+
+		periodSec.SetQuotes(q)
+
+		totalChange := 0.0
+		if startPrice != 0.0 {
+			totalChange = (q.Close - startPrice) / startPrice * 100
+		} else {
+			startPrice = q.Close
+		}
+
+		change := 0.0
+		if prevPrice != 0.0 {
+			change = (q.Close - prevPrice) / prevPrice * 100
+		}
+		prevPrice = q.Close
+
+		sQuotes := expSecurityQuotes{
+			Interval:    fmt.Sprint(qInterval),
+			Begin:       q.Begin.Format("02.01.2006 15:04:05"),
+			End:         q.End.Format("02.01.2006 15:04:05"),
+			Open:        fmt.Sprintf("%f", q.Open),
+			Close:       fmt.Sprintf("%f", q.Close),
+			High:        fmt.Sprintf("%f", q.High),
+			Low:         fmt.Sprintf("%f", q.Low),
+			Volume:      fmt.Sprintf("%.0f", q.Volume),
+			Change:      fmt.Sprintf("%.2f", change),
+			TotalChange: fmt.Sprintf("%.2f", totalChange),
+		}
+
+		if v, ok := smaValues[q.Begin]; ok {
+			sQuotes.SMA = fmt.Sprintf("%f", v)
+		}
+
+		if v, ok := rsiValues[q.Begin]; ok {
+			sQuotes.RSI = fmt.Sprintf("%.2f", v)
+		}
+
+		if v, ok := bbMiddleValues[q.Begin]; ok {
+			sQuotes.BBMiddle = fmt.Sprintf("%f", v)
+			sQuotes.BBUpper = fmt.Sprintf("%f", bbUpperValues[q.Begin])
+			sQuotes.BBLower = fmt.Sprintf("%f", bbLowerValues[q.Begin])
+		}
+
+		*expSeqQuotes = append(*expSeqQuotes, sQuotes)
+	}
+
+	// dividends of the period are converted into the currency of prices by rates of their dates
+	dividends, err := store.GetSecurityDividends(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	pricesCurrency := sec.Currency()
+	if displayCurrency != securities.UnknownCurrency {
+		pricesCurrency = displayCurrency
+	}
+
+	periodDividends := make([]securities.Dividend, 0, len(dividends))
+	for _, d := range dividends {
+		if d.Date.Before(dateFrom) || d.Date.After(dateTill) {
+			continue
+		}
+
+		if d.Currency != pricesCurrency {
+			d.Value, err = ratesStore().ConvertPrice(request.Context(), d.Value, d.Currency, pricesCurrency, d.Date)
+			if err != nil {
+				writeError(writer, storeErrorStatus(err), err.Error())
+				return
+			}
+			d.Currency = pricesCurrency
+		}
+
+		periodDividends = append(periodDividends, d)
+	}
+
+	totalReturn := periodSec.TotalReturn(securities.QuotesInterval(qInterval), periodDividends)
+
+	bondYields, err := getBondYields(sec, securities.QuotesInterval(qInterval), dateFrom, dateTill)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	drawdown, peak, trough := periodSec.MaxDrawdown(securities.QuotesInterval(qInterval))
+	maxDrawdown := maxDrawdownData{Drawdown: fmt.Sprintf("%.2f", drawdown)}
+	if drawdown < 0 {
+		maxDrawdown.Peak = peak.Format("02.01.2006 15:04:05")
+		maxDrawdown.Trough = trough.Format("02.01.2006 15:04:05")
+	}
+
+	highLow := getHighLow(sec, securities.QuotesInterval(qInterval), dateTill)
+
+	secData := securityData{
+		Id:            sec.Id(),
+		Name:          sec.Name(),
+		Type:          string(sec.SType()),
+		Currency:      string(sec.Currency()),
+		DateFrom:      dateFrom.Format("2006-01-02"),
+		DateTill:      dateTill.Format("2006-01-02"),
+		Interval:      fmt.Sprint(qInterval),
+		UpdatePrices:  updatePricesString,
+		SMA:           smaString,
+		RSI:           rsiString,
+		BB:            bbString,
+		BBDev:         bbDevString,
+		TotalReturn:   fmt.Sprintf("%.2f", totalReturn),
+		Bond:          bondYields,
+		MaxDrawdown:   maxDrawdown,
+		HighLow:       highLow,
+		AverageVolume: fmt.Sprintf("%.0f", periodSec.AverageVolume(securities.QuotesInterval(qInterval), averageVolumePeriod)),
+		RiskFree:      fmt.Sprintf("%.2f", riskFree),
+		Sharpe:        fmt.Sprintf("%.2f", periodSec.Sharpe(securities.QuotesInterval(qInterval), riskFree/100)),
+		Sortino:       fmt.Sprintf("%.2f", periodSec.Sortino(securities.QuotesInterval(qInterval), riskFree/100)),
+		ExpQuotes:     *expSeqQuotes,
+	}
+
+	if displayCurrency != securities.UnknownCurrency {
+		secData.DisplayCurrency = string(displayCurrency)
+	}
+
+	asXML := wantsXML(request)
+
+	res, err := marshalData(secData, asXML)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	setDataContentType(writer, asXML)
+	writer.Write(res)
+}
+
+// getHighLow returns the highest and the lowest prices of security for 52 weeks till dateTill by the given interval quotes
+// All loaded quotes before dateTill are used if they cover less than 52 weeks
+func getHighLow(sec *securities.Security, interval securities.QuotesInterval, dateTill time.Time) highLowData {
+	tillSec := securities.GetSecurity(sec.Id(), sec.Name(), sec.SType(), sec.Currency())
+
+	var last securities.SecurityQuotes
+	for _, q := range *sec.QuotesOfInterval(interval) {
+		if q.End.After(dateTill) {
+			continue
+		}
+
+		tillSec.SetQuotes(q)
+		if q.End.After(last.End) {
+			last = q
+		}
+	}
+
+	high, low, highDate, lowDate := tillSec.HighLow(interval, highLowWindow)
+	if highDate.IsZero() {
+		return highLowData{}
+	}
+
+	res := highLowData{
+		High:     fmt.Sprintf("%f", high),
+		HighDate: highDate.Format("02.01.2006 15:04:05"),
+		Low:      fmt.Sprintf("%f", low),
+		LowDate:  lowDate.Format("02.01.2006 15:04:05"),
+	}
+
+	if high != 0.0 {
+		res.FromHigh = fmt.Sprintf("%.2f", (last.Close-high)/high*100)
+	}
+	if low != 0.0 {
+		res.FromLow = fmt.Sprintf("%.2f", (last.Close-low)/low*100)
+	}
+
+	return res
+}
+
+// getBondYields returns face value and yields of bond by the close price of the last quotes of interval in the period
+// Prices of bonds are in percents of face value, so quotes in the currency of security are used
+// Empty data is returned for other securities, for bonds without stored info and if there are no quotes in the period
+func getBondYields(sec *securities.Security, interval securities.QuotesInterval, dateFrom time.Time, dateTill time.Time) (bondYieldsData, error) {
+	if sec.SType() != securities.Bond {
+		return bondYieldsData{}, nil
+	}
+
+	bond, err := store.GetBondInfo(sec)
+	if errors.Is(err, securities.ErrNoBondInfo) {
+		return bondYieldsData{}, nil
+	}
+	if err != nil {
+		return bondYieldsData{}, err
+	}
+
+	q := sec.QuotesForDate(interval, dateTill)
+	if q.Interval == securities.IntervalUnknown || q.End.Before(dateFrom) {
+		return bondYieldsData{}, nil
+	}
+
+	res := bondYieldsData{FaceValue: fmt.Sprintf("%.2f", bond.FaceValueAt(q.End))}
+
+	// yields are left empty if they can't be calculated - for matured bonds for example
+	currentYield, err := bond.CurrentYield(q.Close, q.End)
+	if err == nil {
+		res.CurrentYield = fmt.Sprintf("%.2f", currentYield)
+	}
+
+	ytm, err := securities.YieldToMaturity(bond, q.Close, q.End)
+	if err == nil {
+		res.YieldToMaturity = fmt.Sprintf("%.2f", ytm)
+	}
+
+	return res, nil
+}
+
+// convertSecurityQuotes returns the copy of security with quotes of interval converted into the currency by rates of quote dates
+// Only quotes which end not later than dateTill are converted, and not more than lookback of them end before dateFrom
+// Earlier quotes let indicators be calculated from the beginning of the period, rates of every day are got once
+func convertSecurityQuotes(ctx context.Context, sec *securities.Security, interval securities.QuotesInterval, dateFrom time.Time, dateTill time.Time, lookback int, currency securities.SecurityCurrency) (*securities.Security, error) {
+	quotes := *sec.QuotesOfInterval(interval)
+
+	first := len(quotes)
+	for i, q := range quotes {
+		if !dateFrom.After(q.End) {
+			first = i
+			break
+		}
+	}
+
+	first -= lookback
+	if first < 0 {
+		first = 0
+	}
+
+	rates := ratesStore()
+	dayRates := map[time.Time]float64{}
+	converted := make([]securities.SecurityQuotes, 0, len(quotes)-first)
+	for _, q := range quotes[first:] {
+		if q.End.After(dateTill) {
+			break
+		}
+
+		day := time.Date(q.Begin.Year(), q.Begin.Month(), q.Begin.Day(), 0, 0, 0, 0, time.UTC)
+		rate, ok := dayRates[day]
+		if !ok {
+			var err error
+			rate, err = rates.ConvertPrice(ctx, 1, sec.Currency(), currency, day)
+			if err != nil {
+				return nil, err
+			}
+
+			dayRates[day] = rate
+		}
+
+		q.Open *= rate
+		q.Close *= rate
+		q.High *= rate
+		q.Low *= rate
+		converted = append(converted, q)
+	}
+
+	res := securities.GetSecurity(sec.Id(), sec.Name(), sec.SType(), sec.Currency())
+	res.SetLastUpdated(sec.LastUpdated())
+	res.AddQuotes(converted)
+
+	return res, nil
+}
+
+// exportSecurityHandler writes security quotes of the given interval for the given period as csv file
+// Rows are written to response one by one through the small csv buffer, so the whole file is never kept in memory
+func exportSecurityHandler(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	dateFromString := request.URL.Query().Get("dateFrom")
+	dateTillString := request.URL.Query().Get("dateTill")
+	intervalString := request.URL.Query().Get("interval")
+	format := request.URL.Query().Get("format")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	if format != "" && format != "csv" {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown format %s", format))
+		return
+	}
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(dateFromString, dateTillString)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sec, err := getSecurityForPeriod(id, sType, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	fileName := fmt.Sprintf("%s_%s_%s.csv", sec.Id(), dateFrom.Format("2006-01-02"), dateTill.Format("2006-01-02"))
+	writer.Header().Set("Content-Type", "text/csv")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	// the response is already begun, so errors are only logged
+	exportLog := logger.With("id", sec.Id(), "interval", qInterval, "dateFrom", dateFrom.Format("2006-01-02"), "dateTill", dateTill.Format("2006-01-02"))
+
+	csvWriter := csv.NewWriter(writer)
+
+	err = csvWriter.Write([]string{"begin", "end", "open", "high", "low", "close", "volume"})
+	if err != nil {
+		exportLog.Error("writing csv export", "error", err)
+		return
+	}
+
+	for _, q := range *sec.QuotesOfInterval(securities.QuotesInterval(qInterval)) {
+		err = csvWriter.Write([]string{
+			q.Begin.Format("2006-01-02 15:04:05"),
+			q.End.Format("2006-01-02 15:04:05"),
+			strconv.FormatFloat(q.Open, 'f', -1, 64),
+			strconv.FormatFloat(q.High, 'f', -1, 64),
+			strconv.FormatFloat(q.Low, 'f', -1, 64),
+			strconv.FormatFloat(q.Close, 'f', -1, 64),
+			strconv.FormatFloat(q.Volume, 'f', -1, 64),
+		})
+		if err != nil {
+			exportLog.Error("writing csv export", "error", err)
+			return
+		}
+	}
+
+	csvWriter.Flush()
+	if err = csvWriter.Error(); err != nil {
+		exportLog.Error("writing csv export", "error", err)
+	}
+}
+
+// deleteSecurityHandler marks security as deleted in database, its quotes are kept
+// It's used by the form of html page, so it redirects to the main page after deletion
+func deleteSecurityHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	sec := securities.GetQuickSecurity(id, sType)
+
+	err := store.DeleteSecurity(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	http.Redirect(writer, request, "/securities", http.StatusSeeOther)
+}
+
+// restoreSecurityHandler restores deleted security with all its quotes
+func restoreSecurityHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	err := store.RestoreSecurity(securities.GetQuickSecurity(id, sType))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// deleteSecuritiesHandler marks the list of securities from json body like [{"id": "GAZP", "type": "share"}] as deleted
+// All securities are deleted at once, nothing is deleted if any of them is wrong
+func deleteSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	var list []securityInfo
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&list)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
+		return
+	}
+
+	if len(list) == 0 {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	secSlice := make([]*securities.Security, 0, len(list))
+	for _, secInfo := range list {
+		if secInfo.Id == "" || secInfo.Type == "" {
+			writeError(writer, http.StatusBadRequest, "not enough values")
+			return
+		}
+
+		sType := securities.GetSecurityTypeFromString(secInfo.Type)
+		if sType == securities.UnknownType {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", secInfo.Type))
+			return
+		}
+
+		secSlice = append(secSlice, securities.GetQuickSecurity(secInfo.Id, sType))
+	}
+
+	err = store.DeleteSecurities(secSlice)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// securityFromPath gets security type and id from the path like /securities/{type}/{id}
+func securityFromPath(path string) (*securities.Security, error) {
+	parts := strings.Split(strings.TrimPrefix(path, "/securities/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("wrong path %s", path)
+	}
+
+	sType := securities.GetSecurityTypeFromString(parts[0])
+	if sType == securities.UnknownType {
+		return nil, fmt.Errorf("unknown type %s", parts[0])
+	}
+
+	return securities.GetQuickSecurity(parts[1], sType), nil
+}
+
+// securityResourceHandler works with one security by the path /securities/{type}/{id}
+func securityResourceHandler(writer http.ResponseWriter, request *http.Request) {
+	sec, err := securityFromPath(request.URL.Path)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, err.Error())
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		getSecurityResource(writer, sec)
+	case http.MethodPut:
+		updateSecurityResource(writer, request, sec)
+	case http.MethodDelete:
+		deleteSecurityResource(writer, request, sec)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPut+", "+http.MethodDelete)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+	}
+}
+
+// getSecurityResource writes security data with its last daily quotes
+func getSecurityResource(writer http.ResponseWriter, sec *securities.Security) {
+	err := store.GetSecurityData(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	secRes := securityResource{
+		securityInfo: securityInfo{
+			Id:       sec.Id(),
+			Name:     sec.Name(),
+			Type:     string(sec.SType()),
+			Currency: string(sec.Currency()),
+		},
+	}
+
+	q := sec.LastQuotes(securities.IntervalDay)
+	if !q.Begin.IsZero() {
+		secRes.LastQuotes = &quotesInfo{
+			Begin:  q.Begin.Format("2006-01-02 15:04:05"),
+			End:    q.End.Format("2006-01-02 15:04:05"),
+			Open:   q.Open,
+			Close:  q.Close,
+			High:   q.High,
+			Low:    q.Low,
+			Volume: q.Volume,
+		}
+	}
+
+	res, err := json.Marshal(secRes)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// deleteSecurityResource marks security as deleted in database and writes no content
+func deleteSecurityResource(writer http.ResponseWriter, request *http.Request, sec *securities.Security) {
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	err := store.DeleteSecurity(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// updateSecurityResource changes name and currency of security from json body, quotes are kept
+func updateSecurityResource(writer http.ResponseWriter, request *http.Request, sec *securities.Security) {
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	var secInfo struct {
+		Name     string `json:"name"`
+		Currency string `json:"currency"`
+	}
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&secInfo)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
+		return
+	}
+
+	if secInfo.Name == "" || secInfo.Currency == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	cur := securities.GetSecurityCurrencyFromString(secInfo.Currency)
+	if cur == securities.UnknownCurrency {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", secInfo.Currency))
+		return
+	}
+
+	sec = securities.GetSecurity(sec.Id(), secInfo.Name, sec.SType(), cur)
+
+	err = store.UpdateSecurity(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	res, err := json.Marshal(securityInfo{
+		Id:       sec.Id(),
+		Name:     sec.Name(),
+		Type:     string(sec.SType()),
+		Currency: string(sec.Currency()),
+	})
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getPortfolioInfo converts portfolio to json data
+func getPortfolioInfo(p *portfolio.Portfolio) portfolioInfo {
+	res := portfolioInfo{
+		Id:        p.Id,
+		Name:      p.Name,
+		Positions: make([]positionInfo, 0, len(p.Positions)),
+	}
+
+	for _, pos := range p.Positions {
+		res.Positions = append(res.Positions, positionInfo{
+			Id:       pos.Id,
+			Type:     string(pos.Type),
+			Quantity: pos.Quantity,
+			AvgPrice: pos.AvgPrice,
+		})
+	}
+
+	return res
+}
+
+// portfoliosHandler gets the list of all portfolios (GET) or adds a new portfolio from json body (POST)
+func portfoliosHandler(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		getPortfolios(writer)
+	case http.MethodPost:
+		addPortfolio(writer, request)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+	}
+}
+
+// getPortfolios gets all portfolios with their positions
+func getPortfolios(writer http.ResponseWriter) {
+	list, err := portfolios.GetAllPortfolios()
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	infoList := make([]portfolioInfo, 0, len(list))
+	for _, p := range list {
+		infoList = append(infoList, getPortfolioInfo(p))
+	}
+
+	res, err := json.Marshal(infoList)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// addPortfolio adds a new portfolio with positions from json body, the portfolio with its new id is returned
+func addPortfolio(writer http.ResponseWriter, request *http.Request) {
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	var info portfolioInfo
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&info)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
+		return
+	}
+
+	positions := make([]portfolio.Position, 0, len(info.Positions))
+	for _, pos := range info.Positions {
+		positions = append(positions, portfolio.Position{
+			Id:       pos.Id,
+			Type:     securities.GetSecurityTypeFromString(pos.Type),
+			Quantity: pos.Quantity,
+			AvgPrice: pos.AvgPrice,
+		})
+	}
+
+	p, err := portfolio.New(info.Name, positions)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = portfolios.AddPortfolio(p)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	res, err := json.Marshal(getPortfolioInfo(p))
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusCreated)
+	writer.Write(res)
+}
+
+// notifyingStore notifies websocket connections about every update of stored quotes
+type notifyingStore struct {
+	securities.Store
+}
+
+// UpdateSecurityQuotes gets security quotes from Moscow Exchange, writes them down to storage and notifies subscribers of security
+func (s notifyingStore) UpdateSecurityQuotes(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	err := s.Store.UpdateSecurityQuotes(ctx, sec, dateFrom, dateTill, interval)
+	if err == nil {
+		securityUpdates.Publish(securityUpdate{Id: sec.Id()})
+	}
+
+	return err
+}
+
+// UpdateSecurityQuotesIncremental gets new security quotes from Moscow Exchange, merges them with stored quotes and notifies subscribers of security
+func (s notifyingStore) UpdateSecurityQuotesIncremental(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	err := s.Store.UpdateSecurityQuotesIncremental(ctx, sec, dateFrom, dateTill, interval)
+	if err == nil {
+		securityUpdates.Publish(securityUpdate{Id: sec.Id()})
+	}
+
+	return err
+}
+
+// BackfillSecurityQuotes gets missing security quotes from Moscow Exchange and notifies subscribers of security if some quotes are added
+func (s notifyingStore) BackfillSecurityQuotes(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) (int, error) {
+	added, err := s.Store.BackfillSecurityQuotes(ctx, sec, dateFrom, dateTill, interval)
+	if added > 0 {
+		securityUpdates.Publish(securityUpdate{Id: sec.Id()})
+	}
+
+	return added, err
+}
+
+// RefetchSecurityQuotesForDate replaces stored security quotes for the date with quotes from Moscow Exchange and notifies subscribers of security
+func (s notifyingStore) RefetchSecurityQuotesForDate(ctx context.Context, sec *securities.Security, date time.Time) error {
+	err := s.Store.RefetchSecurityQuotesForDate(ctx, sec, date)
+	if err == nil {
+		securityUpdates.Publish(securityUpdate{Id: sec.Id()})
+	}
+
+	return err
+}
+
+// UpdateAllSecuritiesLastQuotes gets last day quotes of all securities from Moscow Exchange and notifies all subscribers
+func (s notifyingStore) UpdateAllSecuritiesLastQuotes(ctx context.Context, typeNameFilter string, currencyNameFilter string) error {
+	err := s.Store.UpdateAllSecuritiesLastQuotes(ctx, typeNameFilter, currencyNameFilter)
+
+	// some quotes may be written even if there is an error
+	securityUpdates.Publish(securityUpdate{All: true})
+
+	return err
+}
+
+// storedRates gives stored currency rates without Moscow Exchange requests, it's used in read-only mode
+type storedRates struct {
+	securities.Store
+}
+
+// GetCurrencyRate returns the last stored rate of currency in rubles not older than moex.MaxDaysBack days before the date
+func (s storedRates) GetCurrencyRate(ctx context.Context, currency securities.SecurityCurrency, date time.Time) (float64, error) {
+	if currency == securities.RUB {
+		return 1, nil
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	id, ok := moex.CurrencyRateIds[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", securities.ErrNoRate, currency)
+	}
+
+	sec := securities.GetQuickSecurity(id, securities.Currency)
+	err := s.GetSecurityData(sec)
+	if err != nil && !errors.Is(err, securities.ErrSecurityNotExist) {
+		return 0, err
+	}
+
+	q := sec.QuotesForDate(securities.IntervalDay, day.AddDate(0, 0, 1).Add(-time.Second))
+	if err != nil || q.Interval == securities.IntervalUnknown || q.Begin.Before(day.AddDate(0, 0, -moex.MaxDaysBack)) {
+		return 0, fmt.Errorf("%w: %s for %s", securities.ErrNoRate, currency, day.Format("2006-01-02"))
+	}
+
+	return q.Close, nil
+}
+
+// ConvertPrice converts amount from one currency to another by stored rates of the date, cross rates are got through rubles
+func (s storedRates) ConvertPrice(ctx context.Context, amount float64, from securities.SecurityCurrency, to securities.SecurityCurrency, date time.Time) (float64, error) {
+	if from == to && from != securities.UnknownCurrency {
+		return amount, nil
+	}
+
+	fromRate, err := s.GetCurrencyRate(ctx, from, date)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %s to %s: %w", from, to, err)
+	}
+
+	toRate, err := s.GetCurrencyRate(ctx, to, date)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %s to %s: %w", from, to, err)
+	}
+
+	return amount * fromRate / toRate, nil
+}
+
+// ratesStore returns the store to get currency rates, missing rates aren't got from Moscow Exchange in read-only mode
+func ratesStore() securities.Store {
+	if readOnly {
+		return storedRates{store}
+	}
+
+	return store
+}
+
+// portfolioResourceHandler gets value of portfolio /portfolios/{id} by close prices of the date (today by default) in the currency (rubles by default)
+// or values of portfolio for the period /portfolios/{id}/series
+func portfolioResourceHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	idString := strings.TrimPrefix(request.URL.Path, "/portfolios/")
+	series := strings.HasSuffix(idString, "/series")
+	idString = strings.TrimSuffix(idString, "/series")
+	id, err := strconv.ParseInt(idString, 10, 64)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("wrong path %s", request.URL.Path))
+		return
+	}
+
+	if series {
+		getPortfolioSeries(writer, request, id)
+		return
+	}
+
+	date, err := getDateFromString(request.URL.Query().Get("date"), time.Now().UTC())
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	base, err := getBaseCurrency(request)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := portfolios.GetPortfolio(id)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	valuation, err := p.Value(request.Context(), ratesStore(), date, base)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	valueInfo := portfolioValueInfo{
+		Id:        p.Id,
+		Name:      p.Name,
+		Date:      valuation.Date.Format("2006-01-02"),
+		Currency:  string(valuation.Currency),
+		Value:     valuation.Value,
+		Cost:      valuation.Cost,
+		PL:        valuation.PL,
+		Positions: make([]positionValueInfo, 0, len(valuation.Positions)),
+	}
+
+	for _, pos := range valuation.Positions {
+		valueInfo.Positions = append(valueInfo.Positions, positionValueInfo{
+			positionInfo: positionInfo{
+				Id:       pos.Id,
+				Type:     string(pos.Type),
+				Quantity: pos.Quantity,
+				AvgPrice: pos.AvgPrice,
+			},
+			Currency: string(pos.Currency),
+			Close:    pos.Close,
+			Rate:     pos.Rate,
+			Value:    pos.Value,
+			PL:       pos.PL,
+		})
+	}
+
+	res, err := json.Marshal(valueInfo)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getBaseCurrency returns the currency of portfolio valuation from the request, rubles by default
+func getBaseCurrency(request *http.Request) (securities.SecurityCurrency, error) {
+	currencyString := request.URL.Query().Get("currency")
+	if currencyString == "" {
+		return securities.RUB, nil
+	}
+
+	base := securities.GetSecurityCurrencyFromString(currencyString)
+	if base == securities.UnknownCurrency {
+		return base, fmt.Errorf("unknown currency %s", currencyString)
+	}
+
+	return base, nil
+}
+
+// getPortfolioSeries gets values of portfolio for every date of quotes of the interval (daily by default) in the period (the last month by default)
+// in the currency (rubles by default)
+func getPortfolioSeries(writer http.ResponseWriter, request *http.Request, id int64) {
+	var err error
+
+	intervalString := request.URL.Query().Get("interval")
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(request.URL.Query().Get("dateFrom"), request.URL.Query().Get("dateTill"))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	base, err := getBaseCurrency(request)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p, err := portfolios.GetPortfolio(id)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	points, err := p.ValueSeries(request.Context(), ratesStore(), dateFrom, dateTill, securities.QuotesInterval(qInterval), base)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	seriesInfo := portfolioSeriesInfo{
+		Id:       p.Id,
+		Name:     p.Name,
+		Interval: qInterval,
+		Currency: string(base),
+		Points:   make([]portfolioPointInfo, 0, len(points)),
+	}
+
+	for _, point := range points {
+		seriesInfo.Points = append(seriesInfo.Points, portfolioPointInfo{
+			Date:  point.Date.Format("2006-01-02"),
+			Value: point.Value,
+			PL:    point.PL,
+		})
+	}
+
+	res, err := json.Marshal(seriesInfo)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// refetchDayHandler gets security quotes for the given date from Moscow Exchange again and replaces stored quotes with them
+func refetchDayHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.Header().Set("Allow", http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	dateString := request.URL.Query().Get("date")
+
+	if id == "" || typeString == "" || dateString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", dateString)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sec := securities.GetQuickSecurity(id, sType)
+
+	err = store.RefetchSecurityQuotesForDate(request.Context(), sec, date)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	listCache.Clear()
+
+	writer.WriteHeader(http.StatusOK)
+}
+
+// getCorrelationHandler gets correlation of two securities returns for the given period
+func getCorrelationHandler(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	id1 := request.URL.Query().Get("id1")
+	id2 := request.URL.Query().Get("id2")
+	typeString := request.URL.Query().Get("type")
+	type2String := request.URL.Query().Get("type2")
+	dateFromString := request.URL.Query().Get("dateFrom")
+	dateTillString := request.URL.Query().Get("dateTill")
+	intervalString := request.URL.Query().Get("interval")
+
+	if id1 == "" || id2 == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	if type2String == "" {
+		type2String = typeString
+	}
+
+	sType1 := securities.GetSecurityTypeFromString(typeString)
+	if sType1 == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	sType2 := securities.GetSecurityTypeFromString(type2String)
+	if sType2 == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", type2String))
+		return
+	}
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(dateFromString, dateTillString)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sec1, err := getSecurityForPeriod(id1, sType1, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	sec2, err := getSecurityForPeriod(id2, sType2, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	corr, err := securities.Correlation(sec1, sec2, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	corrData := correlationData{
+		Id1:         sec1.Id(),
+		Type1:       string(sec1.SType()),
+		Id2:         sec2.Id(),
+		Type2:       string(sec2.SType()),
+		DateFrom:    dateFrom.Format("2006-01-02"),
+		DateTill:    dateTill.Format("2006-01-02"),
+		Interval:    fmt.Sprint(qInterval),
+		Correlation: fmt.Sprintf("%.4f", corr),
+	}
+
+	res, err := json.Marshal(corrData)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getBetaHandler gets beta of security versus the benchmark (IMOEX index by default) by quotes for the period
+func getBetaHandler(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	benchmark := request.URL.Query().Get("benchmark")
+	benchmarkTypeString := request.URL.Query().Get("benchmarkType")
+	dateFromString := request.URL.Query().Get("dateFrom")
+	dateTillString := request.URL.Query().Get("dateTill")
+	intervalString := request.URL.Query().Get("interval")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	if benchmark == "" {
+		benchmark = defaultBenchmark
+	}
+
+	if benchmarkTypeString == "" {
+		benchmarkTypeString = string(securities.Index)
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	benchmarkType := securities.GetSecurityTypeFromString(benchmarkTypeString)
+	if benchmarkType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", benchmarkTypeString))
+		return
+	}
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(dateFromString, dateTillString)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sec, err := getSecurityForPeriod(id, sType, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	benchmarkSec, err := getSecurityForPeriod(benchmark, benchmarkType, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	beta, err := securities.Beta(sec, benchmarkSec, securities.QuotesInterval(qInterval))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data := betaData{
+		Id:            sec.Id(),
+		Type:          string(sec.SType()),
+		Benchmark:     benchmarkSec.Id(),
+		BenchmarkType: string(benchmarkSec.SType()),
+		DateFrom:      dateFrom.Format("2006-01-02"),
+		DateTill:      dateTill.Format("2006-01-02"),
+		Interval:      fmt.Sprint(qInterval),
+		Beta:          fmt.Sprintf("%.4f", beta),
+	}
+
+	res, err := json.Marshal(data)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getGapsHandler gets the trading days which have no stored quotes of security
+// The whole stored history is checked unless dateFrom or dateTill is given
+func getGapsHandler(writer http.ResponseWriter, request *http.Request) {
+	var err error
+
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	dateFromString := request.URL.Query().Get("dateFrom")
+	dateTillString := request.URL.Query().Get("dateTill")
+	intervalString := request.URL.Query().Get("interval")
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	qInterval := securities.IntervalDay
+	if intervalString != "" {
+		qInterval, err = strconv.Atoi(intervalString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var sec *securities.Security
+	if dateFromString == "" && dateTillString == "" {
+		sec = securities.GetQuickSecurity(id, sType)
+		err = store.GetSecurityData(sec)
+	} else {
+		var dateFrom, dateTill time.Time
+		dateFrom, dateTill, err = getPeriodFromStrings(dateFromString, dateTillString)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		sec, err = getSecurityForPeriod(id, sType, dateFrom, dateTill, securities.QuotesInterval(qInterval))
+	}
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	gaps := gapsData{
+		Id:       sec.Id(),
+		Type:     string(sec.SType()),
+		Interval: fmt.Sprint(qInterval),
+		Missing:  []string{},
+	}
+
+	for _, date := range sec.MissingDates(securities.QuotesInterval(qInterval), moex.Calendar{}) {
+		gaps.Missing = append(gaps.Missing, date.Format("2006-01-02"))
+	}
+
+	res, err := json.Marshal(gaps)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getDividendsHandler gets stored dividends of security
+// Dividends are got from Moscow Exchange first if updateDividends is set
+func getDividendsHandler(writer http.ResponseWriter, request *http.Request) {
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	updateDividends := request.URL.Query().Get("updateDividends") == "true"
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeString))
+		return
+	}
+
+	sec := securities.GetQuickSecurity(id, sType)
+
+	if updateDividends {
+		if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+			return
+		}
+
+		err := store.UpdateSecurityDividends(request.Context(), sec)
+		if err != nil {
+			writeError(writer, storeErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	dividends, err := store.GetSecurityDividends(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	divData := dividendsData{
+		Id:        sec.Id(),
+		Type:      string(sec.SType()),
+		Dividends: make([]dividendData, 0, len(dividends)),
+	}
+
+	for _, d := range dividends {
+		divData.Dividends = append(divData.Dividends, dividendData{
+			Date:     d.Date.Format("2006-01-02"),
+			Value:    fmt.Sprintf("%f", d.Value),
+			Currency: string(d.Currency),
+		})
+	}
+
+	res, err := json.Marshal(divData)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getBondHandler gets stored face value and payments of bond
+// Bond info is got from Moscow Exchange first if updateBond is set
+func getBondHandler(writer http.ResponseWriter, request *http.Request) {
+	id := request.URL.Query().Get("id")
+	typeString := request.URL.Query().Get("type")
+	updateBond := request.URL.Query().Get("updateBond") == "true"
+
+	if id == "" || typeString == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
+		return
+	}
+
+	sType := securities.GetSecurityTypeFromString(typeString)
+	if sType != securities.Bond {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("type %s is not bond", typeString))
+		return
+	}
+
+	sec := securities.GetQuickSecurity(id, sType)
+
+	if updateBond {
+		if rejectWrite(writer, request) || rejectTooManyUpdates(writer, request) {
+			return
+		}
+
+		err := store.UpdateBondInfo(request.Context(), sec)
+		if err != nil {
+			writeError(writer, storeErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	bond, err := store.GetBondInfo(sec)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	bData := bondData{
+		Id:        sec.Id(),
+		Type:      string(sec.SType()),
+		FaceValue: fmt.Sprintf("%f", bond.FaceValue),
+		Payments:  make([]bondPaymentData, 0, len(bond.Payments)),
+	}
+
+	for _, p := range bond.Payments {
+		payment := bondPaymentData{
+			Date:         p.Date.Format("2006-01-02"),
+			Coupon:       fmt.Sprintf("%f", p.Coupon),
+			Amortization: fmt.Sprintf("%f", p.Amortization),
+		}
+		if !p.Start.IsZero() {
+			payment.Start = p.Start.Format("2006-01-02")
+		}
+
+		bData.Payments = append(bData.Payments, payment)
+	}
+
+	res, err := json.Marshal(bData)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
+
+// getAlertInfo converts price alert to json data
+func getAlertInfo(a *alerts.Alert) alertInfo {
+	return alertInfo{
+		Id:        a.Id,
+		Security:  a.SecurityId,
+		Type:      string(a.Type),
+		Direction: string(a.Direction),
+		Threshold: a.Threshold,
+		Enabled:   a.Enabled,
+		URL:       a.URL,
+	}
+}
+
+// writeAlertJSON sends json of alert data with the given HTTP status code
+func writeAlertJSON(writer http.ResponseWriter, status int, data any) {
+	res, err := json.Marshal(data)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	writer.Write(res)
+}
+
+// alertsHandler gets the list of all price alerts (GET) or adds a new alert from json body (POST)
+func alertsHandler(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		getAlerts(writer)
+	case http.MethodPost:
+		addAlert(writer, request)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+	}
+}
+
+// getAlerts gets all price alerts
+func getAlerts(writer http.ResponseWriter) {
+	list, err := alertStore.GetAllAlerts()
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	infoList := make([]alertInfo, 0, len(list))
+	for _, a := range list {
+		infoList = append(infoList, getAlertInfo(a))
+	}
+
+	writeAlertJSON(writer, http.StatusOK, infoList)
+}
+
+// addAlert adds a new price alert from json body, the alert with its new id is returned
+// Alert is enabled if the body doesn't tell otherwise, firings are sent to its url if it's set
+func addAlert(writer http.ResponseWriter, request *http.Request) {
+	if rejectWrite(writer, request) {
+		return
+	}
+
+	info := alertInfo{Enabled: true}
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&info)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
+		return
+	}
+
+	a, err := alerts.New(info.Security, securities.GetSecurityTypeFromString(info.Type), alerts.Direction(info.Direction), info.Threshold)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.Enabled = info.Enabled
+	a.URL = info.URL
+
+	err = a.Check()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = alertStore.AddAlert(a)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	writeAlertJSON(writer, http.StatusCreated, getAlertInfo(a))
+}
+
+// alertResourceHandler gets price alert /alerts/{id} with its firings (GET), changes it from json body (PUT) or deletes it (DELETE)
+func alertResourceHandler(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(request.URL.Path, "/alerts/"), 10, 64)
+	if err != nil {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("wrong path %s", request.URL.Path))
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		getAlert(writer, id)
+	case http.MethodPut:
+		updateAlert(writer, request, id)
+	case http.MethodDelete:
+		deleteAlert(writer, request, id)
+	default:
+		writer.Header().Set("Allow", http.MethodGet+", "+http.MethodPut+", "+http.MethodDelete)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+	}
+}
+
+// getAlert gets price alert with its firings
+func getAlert(writer http.ResponseWriter, id int64) {
+	a, err := alertStore.GetAlert(id)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	firings, err := alertStore.GetAlertFirings(id)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
+
+	details := alertDetailsInfo{
+		alertInfo: getAlertInfo(a),
+		Firings:   make([]firingInfo, 0, len(firings)),
+	}
+
+	for _, f := range firings {
+		details.Firings = append(details.Firings, firingInfo{
+			Close:         f.Close,
+			Date:          f.Date.Format("2006-01-02 15:04:05"),
+			FiredAt:       f.FiredAt.Format(time.RFC3339),
+			Delivery:      string(f.Delivery),
+			DeliveryError: f.DeliveryError,
+		})
+	}
+
+	writeAlertJSON(writer, http.StatusOK, details)
+}
+
+// updateAlert changes direction, threshold, enabled flag and webhook URL of price alert from json body, missing fields are not changed
+// Security of alert can't be changed
+func updateAlert(writer http.ResponseWriter, request *http.Request, id int64) {
+	if rejectWrite(writer, request) {
+		return
 	}
 
-	res, err := json.Marshal(allSecData)
+	a, err := alertStore.GetAlert(id)
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		writeError(writer, storeErrorStatus(err), err.Error())
 		return
 	}
 
-	writer.Write(res)
-}
+	info := getAlertInfo(a)
 
-// addSecurityHandler adds new security to database
-func addSecurityHandler(writer http.ResponseWriter, request *http.Request) {
-	id := request.URL.Query().Get("id")
-	name := request.URL.Query().Get("name")
-	typeName := request.URL.Query().Get("type")
-	currencyName := request.URL.Query().Get("currency")
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
 
-	if id == "" || name == "" || typeName == "" || currencyName == "" {
-		writer.Header().Set("err", "not enough values")
-		writer.WriteHeader(http.StatusNoContent)
+	err = decoder.Decode(&info)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong json body: %v", err))
 		return
 	}
 
-	sType := securities.GetSecurityTypeFromString(typeName)
-	if sType == securities.UnknownType {
-		writer.Header().Set("err", fmt.Sprintf("unknown type %s", typeName))
-		writer.WriteHeader(http.StatusNoContent)
+	if info.Id != a.Id || info.Security != a.SecurityId || info.Type != string(a.Type) {
+		writeError(writer, http.StatusBadRequest, "security of alert can't be changed")
 		return
 	}
 
-	cur := securities.GetSecurityCurrencyFromString(currencyName)
-	if cur == securities.UnknownCurrency {
-		writer.Header().Set("err", fmt.Sprintf("unknown currency %s", currencyName))
-		writer.WriteHeader(http.StatusNoContent)
+	a.Direction = alerts.Direction(strings.ToLower(info.Direction))
+	a.Threshold = info.Threshold
+	a.Enabled = info.Enabled
+	a.URL = info.URL
+
+	err = a.Check()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	sec := securities.GetSecurity(id, name, sType, cur)
-
-	err := securitiesSQL.AddSecurity(db, sec)
+	err = alertStore.UpdateAlert(a)
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		writeError(writer, storeErrorStatus(err), err.Error())
 		return
 	}
 
-	writer.WriteHeader(http.StatusOK)
-}
-
-// getLastQuotesHandler gets last quotes for all securities
-func getLastQuotesHandler(writer http.ResponseWriter, request *http.Request) {
-	securitiesSQL.UpdateAllSecuritiesLastQuotes(db, "", "")
+	writeAlertJSON(writer, http.StatusOK, getAlertInfo(a))
 }
 
-// getSecurityDataHandler gets security data and quotes
-func getSecurityDataHandler(writer http.ResponseWriter, request *http.Request) {
-	var err error
-
-	id := request.URL.Query().Get("id")
-	typeString := request.URL.Query().Get("type")
-	dateFromString := request.URL.Query().Get("dateFrom")
-	dateTillString := request.URL.Query().Get("dateTill")
-	intervalString := request.URL.Query().Get("interval")
-	updatePricesString := request.URL.Query().Get("updatePrices")
-
-	if id == "" || typeString == "" {
-		writer.Header().Set("err", "not enough values")
-		writer.WriteHeader(http.StatusNoContent)
+// deleteAlert deletes price alert with its firings
+func deleteAlert(writer http.ResponseWriter, request *http.Request, id int64) {
+	if rejectWrite(writer, request) {
 		return
 	}
 
-	sType := securities.GetSecurityTypeFromString(typeString)
-	if sType == securities.UnknownType {
-		writer.Header().Set("err", fmt.Sprintf("unknown type %s", typeString))
-		writer.WriteHeader(http.StatusNoContent)
+	err := alertStore.DeleteAlert(id)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
 		return
 	}
 
-	qInterval := securities.IntervalDay
-	if intervalString != "" {
-		qInterval, err = strconv.Atoi(intervalString)
-		if err != nil {
-			writer.Header().Set("err", err.Error())
-			writer.WriteHeader(http.StatusNoContent)
-			return
-		}
-	}
+	writer.WriteHeader(http.StatusNoContent)
+}
 
-	dateFrom := getDateFromString(dateFromString, time.Now().Truncate(time.Hour*24).AddDate(0, -1, 0)).UTC()
-	dateTill := getDateFromString(dateTillString, time.Now().Truncate(time.Hour*24)).Add(time.Second * (60*60*24 - 1)).UTC()
-	if dateFrom.After(dateTill) {
-		writer.Header().Set("err", "date from can't be after date till")
-		writer.WriteHeader(http.StatusNoContent)
+// searchSecuritiesHandler finds securities which id or name contains the given text
+func searchSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
+	q := strings.TrimSpace(request.URL.Query().Get("q"))
+	if q == "" {
+		writeError(writer, http.StatusBadRequest, "not enough values")
 		return
 	}
 
-	updatePrices := updatePricesString == "true"
-
-	if updatePrices {
-		sec := securities.GetQuickSecurity(id, sType)
+	secList, err := store.GetSecuritiesByQuery(q)
+	if err != nil {
+		writeError(writer, storeErrorStatus(err), err.Error())
+		return
+	}
 
-		err = securitiesSQL.UpdateSecurityQuotes(db, sec, dateFrom, dateTill, securities.QuotesInterval(qInterval))
-		if err != nil {
-			writer.Header().Set("err", err.Error())
-			writer.WriteHeader(http.StatusNoContent)
-			return
+	found := make([]securityInfo, len(secList))
+	for i, sec := range secList {
+		found[i] = securityInfo{
+			Id:       sec.Id(),
+			Name:     sec.Name(),
+			Type:     string(sec.SType()),
+			Currency: string(sec.Currency()),
 		}
 	}
 
-	sec := securities.GetQuickSecurity(id, sType)
-
-	err = securitiesSQL.GetSecurityData(db, sec)
+	res, err := json.Marshal(found)
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		writeError(writer, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	quotes := *sec.QuotesOfInterval(securities.QuotesInterval(qInterval))
-	expSeqQuotes := new([]expSecurityQuotes)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
+}
 
-	startPrice := 0.0
-	prevPrice := 0.0
-	for _, q := range quotes {
-		if dateFrom.After(q.End) || q.End.After(dateTill) {
-			continue
-		}
+// defaultMoversNumber is the number of securities returned by topMoversHandler if it's not set in request
+const defaultMoversNumber = 10
 
-		totalChange := 0.0
-		if startPrice != 0.0 {
-			totalChange = (q.Close - startPrice) / startPrice * 100
-		} else {
-			startPrice = q.Close
-		}
+// topMoversHandler gets the securities with the biggest change between the last two daily close prices (considering type and currency filters)
+// Securities with less than two daily quotes are skipped
+func topMoversHandler(writer http.ResponseWriter, request *http.Request) {
+	typeNameFilter := request.URL.Query().Get("type")
+	currencyNameFilter := request.URL.Query().Get("currency")
+	nString := request.URL.Query().Get("n")
+	dir := request.URL.Query().Get("dir")
 
-		change := 0.0
-		if prevPrice != 0.0 {
-			change = (q.Close - prevPrice) / prevPrice * 100
-		}
-		prevPrice = q.Close
+	if typeNameFilter != "" && securities.GetSecurityTypeFromString(typeNameFilter) == securities.UnknownType {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown type %s", typeNameFilter))
+		return
+	}
 
-		sQuotes := expSecurityQuotes{
-			Interval:    fmt.Sprint(qInterval),
-			Begin:       q.Begin.Format("02.01.2006 15:04:05"),
-			End:         q.End.Format("02.01.2006 15:04:05"),
-			Open:        fmt.Sprintf("%f", q.Open),
-			Close:       fmt.Sprintf("%f", q.Close),
-			High:        fmt.Sprintf("%f", q.High),
-			Low:         fmt.Sprintf("%f", q.Low),
-			Change:      fmt.Sprintf("%.2f", change),
-			TotalChange: fmt.Sprintf("%.2f", totalChange),
-		}
+	if currencyNameFilter != "" && securities.GetSecurityCurrencyFromString(currencyNameFilter) == securities.UnknownCurrency {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown currency %s", currencyNameFilter))
+		return
+	}
 
-		*expSeqQuotes = append(*expSeqQuotes, sQuotes)
+	n := defaultMoversNumber
+	if nString != "" {
+		var err error
+		n, err = strconv.Atoi(nString)
+		if err != nil || n <= 0 {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("wrong number of securities %s", nString))
+			return
+		}
 	}
 
-	secData := securityData{
-		Id:           sec.Id(),
-		Name:         sec.Name(),
-		Type:         string(sec.SType()),
-		Currency:     string(sec.Currency()),
-		DateFrom:     dateFrom.Format("2006-01-02"),
-		DateTill:     dateTill.Format("2006-01-02"),
-		Interval:     fmt.Sprint(qInterval),
-		UpdatePrices: updatePricesString,
-		ExpQuotes:    *expSeqQuotes,
+	if dir == "" {
+		dir = "gainers"
+	}
+	if dir != "gainers" && dir != "losers" {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown direction %s", dir))
+		return
 	}
 
-	res, err := json.Marshal(secData)
+	// only the last two day quotes are needed for the change
+	secList, err := store.GetAllSecuritiesLastQuotes(typeNameFilter, currencyNameFilter, securities.IntervalDay, 2)
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		writeError(writer, storeErrorStatus(err), err.Error())
 		return
 	}
 
-	writer.Write(res)
-}
-
-// deleteSecurityHandler deletes security from database
-func deleteSecurityHandler(writer http.ResponseWriter, request *http.Request) {
-	id := request.URL.Query().Get("id")
-	typeString := request.URL.Query().Get("type")
+	movers := make([]moverData, 0, len(secList))
+	for _, sec := range secList {
+		change, err := sec.LastChange(securities.IntervalDay)
+		if err != nil {
+			continue
+		}
 
-	if id == "" || typeString == "" {
-		writer.Header().Set("err", "not enough values")
-		writer.WriteHeader(http.StatusNoContent)
-		return
+		movers = append(movers, moverData{
+			securityInfo: securityInfo{
+				Id:       sec.Id(),
+				Name:     sec.Name(),
+				Type:     string(sec.SType()),
+				Currency: string(sec.Currency()),
+			},
+			LastClose: sec.LastQuotes(securities.IntervalDay).Close,
+			Change:    change,
+		})
 	}
 
-	sType := securities.GetSecurityTypeFromString(typeString)
-	if sType == securities.UnknownType {
-		writer.Header().Set("err", fmt.Sprintf("unknown type %s", typeString))
-		writer.WriteHeader(http.StatusNoContent)
-		return
-	}
+	sort.SliceStable(movers, func(i, j int) bool {
+		if dir == "losers" {
+			return movers[i].Change < movers[j].Change
+		}
 
-	sec := securities.GetQuickSecurity(id, sType)
+		return movers[i].Change > movers[j].Change
+	})
+
+	if len(movers) > n {
+		movers = movers[:n]
+	}
 
-	err := securitiesSQL.DeleteSecurity(db, sec)
+	res, err := json.Marshal(movers)
 	if err != nil {
-		writer.Header().Set("err", err.Error())
-		writer.WriteHeader(http.StatusNoContent)
+		writeError(writer, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	http.Redirect(writer, request, "/securities", http.StatusPermanentRedirect)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Write(res)
 }
 
 /////////////////////////
@@ -478,7 +3993,7 @@ func deleteSecurityHandler(writer http.ResponseWriter, request *http.Request) {
 
 // enterHandler opens main page to choose next activity
 func enterHandler(writer http.ResponseWriter, request *http.Request) {
-	html, err := template.ParseFiles(htmlDir + "mainPage.html")
+	html, err := getTemplate("mainPage.html")
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
@@ -493,7 +4008,7 @@ func enterHandler(writer http.ResponseWriter, request *http.Request) {
 
 // allSecuritiesHandler opens the list of all existing in database securities
 func allSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
-	html, err := template.ParseFiles(htmlDir + "allSecurities.html")
+	html, err := getTemplate("allSecurities.html")
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
@@ -501,23 +4016,77 @@ func allSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
 
 	typeNameFilter := request.FormValue("typeFilter")
 	currencyNameFilter := request.FormValue("currencyFilter")
+	search := strings.TrimSpace(request.FormValue("search"))
+
+	if search != "" {
+		searchSecurities(writer, request, html, search)
+		return
+	}
 
 	req := httpPath + "/securities/getAllSecuritiesLastQuotes"
-	if typeNameFilter != "" || currencyNameFilter != "" {
-		params := url.Values{}
-		if typeNameFilter != "" {
-			params.Add("type", typeNameFilter)
-		}
-		if currencyNameFilter != "" {
-			params.Add("currency", currencyNameFilter)
-		}
+	params := url.Values{}
+	if typeNameFilter != "" {
+		params.Add("type", typeNameFilter)
+	}
+	if currencyNameFilter != "" {
+		params.Add("currency", currencyNameFilter)
+	}
+	if sortString := request.FormValue("sort"); sortString != "" {
+		params.Add("sort", sortString)
+	}
+	if request.FormValue("desc") == "true" {
+		params.Add("desc", "true")
+	}
+	if offsetString := request.FormValue("offset"); offsetString != "" {
+		params.Add("offset", offsetString)
+	}
+	if len(params) > 0 {
 		req = req + "?" + params.Encode()
 	}
 
 	resStruct := &AllSecuritiesData{}
-	executeRequest(writer, req, resStruct)
+	if !executeRequest(writer, request, req, resStruct) {
+		return
+	}
 
-	err = html.Execute(writer, *resStruct)
+	page := allSecuritiesPage{
+		AllSecuritiesData: *resStruct,
+		HasPrev:           resStruct.Offset > 0,
+		PrevOffset:        resStruct.Offset - resStruct.Limit,
+		HasNext:           resStruct.Offset+resStruct.Limit < resStruct.Total,
+		NextOffset:        resStruct.Offset + resStruct.Limit,
+	}
+	if page.PrevOffset < 0 {
+		page.PrevOffset = 0
+	}
+
+	err = html.Execute(writer, page)
+	if err != nil {
+		showErrorPage(writer, err.Error())
+		return
+	}
+}
+
+// searchSecurities shows the page with securities which id or name contains the given text (without prices)
+func searchSecurities(writer http.ResponseWriter, request *http.Request, html *template.Template, search string) {
+	req := httpPath + "/securities/search?" + url.Values{"q": {search}}.Encode()
+
+	var found []securityInfo
+	if !executeRequest(writer, request, req, &found) {
+		return
+	}
+
+	allSecData := AllSecuritiesData{Search: search}
+	for _, sec := range found {
+		allSecData.Securities = append(allSecData.Securities, generalSecurityData{
+			ID:       sec.Id,
+			Name:     sec.Name,
+			Type:     sec.Type,
+			Currency: sec.Currency,
+		})
+	}
+
+	err := html.Execute(writer, allSecuritiesPage{AllSecuritiesData: allSecData})
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
@@ -526,7 +4095,7 @@ func allSecuritiesHandler(writer http.ResponseWriter, request *http.Request) {
 
 // addSecurityPageHandler opens the page to add new security to database
 func addSecurityPageHandler(writer http.ResponseWriter, request *http.Request) {
-	html, err := template.ParseFiles(htmlDir + "addSecurity.html")
+	html, err := getTemplate("addSecurity.html")
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
@@ -537,7 +4106,8 @@ func addSecurityPageHandler(writer http.ResponseWriter, request *http.Request) {
 	typeName := request.FormValue("type")
 	currencyName := request.FormValue("currency")
 
-	if id == "" || name == "" || typeName == "" || currencyName == "" {
+	// name may be empty, it's taken from Moscow Exchange then
+	if id == "" || typeName == "" || currencyName == "" {
 		err = html.Execute(writer, struct {
 			Id       string
 			Name     string
@@ -562,7 +4132,7 @@ func addSecurityPageHandler(writer http.ResponseWriter, request *http.Request) {
 	params.Add("currency", currencyName)
 	req = req + "?" + params.Encode()
 
-	resp, err := http.Get(req)
+	resp, err := apiGet(request, req)
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
@@ -570,7 +4140,7 @@ func addSecurityPageHandler(writer http.ResponseWriter, request *http.Request) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		showErrorPage(writer, resp.Header[http.CanonicalHeaderKey("err")][0])
+		showErrorPage(writer, responseError(resp).Error())
 		return
 	}
 
@@ -581,20 +4151,27 @@ func addSecurityPageHandler(writer http.ResponseWriter, request *http.Request) {
 func getQuotesPageHandler(writer http.ResponseWriter, request *http.Request) {
 	req := httpPath + "/securities/getLastQuotes"
 
-	_, err := http.Get(req)
+	resp, err := apiGet(request, req)
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		showErrorPage(writer, responseError(resp).Error())
+		return
+	}
 
 	http.Redirect(writer, request, "/securities/all", http.StatusPermanentRedirect)
 }
 
 // securityHandler shows prices of the given security for the given period
 func securityHandler(writer http.ResponseWriter, request *http.Request) {
-	html, err := template.ParseFiles(htmlDir + "securityData.html")
+	html, err := getTemplate("securityData.html")
 	if err != nil {
-		log.Fatal(err)
+		showErrorPage(writer, err.Error())
+		return
 	}
 
 	id := request.FormValue("id")
@@ -602,23 +4179,27 @@ func securityHandler(writer http.ResponseWriter, request *http.Request) {
 	dateFromString := request.FormValue("dateFrom")
 	dateTillString := request.FormValue("dateTill")
 	updatePrices := request.FormValue("updatePrices")
+	smaString := request.FormValue("sma")
+	rsiString := request.FormValue("rsi")
+	bbString := request.FormValue("bb")
+	bbDevString := request.FormValue("bbdev")
+	displayCurrency := request.FormValue("displayCurrency")
+	riskFreeString := request.FormValue("riskFree")
 
 	if id == "" || typeString == "" {
-		err := html.Execute(writer, struct {
-			Id           string
-			Name         string
-			Type         string
-			DateFrom     string
-			DateTill     string
-			UpdatePrices string
-			ExpQuotes    []expSecurityQuotes
-		}{Id: id,
-			Name:         "",
-			Type:         typeString,
-			DateFrom:     dateFromString,
-			DateTill:     dateTillString,
-			UpdatePrices: updatePrices,
-			ExpQuotes:    *new([]expSecurityQuotes)})
+		err := html.Execute(writer, securityData{Id: id,
+			Name:            "",
+			Type:            typeString,
+			DateFrom:        dateFromString,
+			DateTill:        dateTillString,
+			UpdatePrices:    updatePrices,
+			SMA:             smaString,
+			RSI:             rsiString,
+			BB:              bbString,
+			BBDev:           bbDevString,
+			DisplayCurrency: displayCurrency,
+			RiskFree:        riskFreeString,
+			ExpQuotes:       *new([]expSecurityQuotes)})
 
 		if err != nil {
 			showErrorPage(writer, err.Error())
@@ -640,55 +4221,341 @@ func securityHandler(writer http.ResponseWriter, request *http.Request) {
 	if updatePrices != "" {
 		params.Add("updatePrices", "true")
 	}
+	if smaString != "" {
+		params.Add("sma", smaString)
+	}
+	if rsiString != "" {
+		params.Add("rsi", rsiString)
+	}
+	if bbString != "" {
+		params.Add("bb", bbString)
+	}
+	if bbDevString != "" {
+		params.Add("bbdev", bbDevString)
+	}
+	if displayCurrency != "" {
+		params.Add("displayCurrency", displayCurrency)
+	}
+	if riskFreeString != "" {
+		params.Add("riskFree", riskFreeString)
+	}
 	req = req + "?" + params.Encode()
 
-	resStruct := &securityData{}
-	executeRequest(writer, req, resStruct)
+	resStruct := &securityData{}
+	if !executeRequest(writer, request, req, resStruct) {
+		return
+	}
+
+	err = html.Execute(writer, *resStruct)
+	if err != nil {
+		showErrorPage(writer, err.Error())
+		return
+	}
+}
+
+// compSeries contains id and type of compared security
+type compSeries struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// compValue contains close price of compared security for the date, its change (%) from the first common date
+// and its indexed value which is 100 on the first common date (string)
+// Numbers are kept for export, they are nil if there is no value
+type compValue struct {
+	Price  string
+	Change string
+	Index  string
+
+	close       *float64
+	dayChange   *float64
+	totalChange *float64
+}
+
+// compRow contains values of all compared securities for the date
+type compRow struct {
+	Date   string
+	Values []compValue
+
+	date time.Time
+}
+
+// compExportValue contains values of compared security for the date to export
+type compExportValue struct {
+	Close       *float64 `json:"close"`
+	DayChange   *float64 `json:"dayChange"`
+	TotalChange *float64 `json:"totalChange"`
+}
+
+// compExportRow contains values of all compared securities for the date to export
+type compExportRow struct {
+	Date   string            `json:"date"`
+	Values []compExportValue `json:"values"`
+}
+
+// compExportData contains comparison table to export
+type compExportData struct {
+	Securities []compSeries    `json:"securities"`
+	Rows       []compExportRow `json:"rows"`
+}
+
+// compareFormSlots is the minimum number of securities fields in the comparison form
+const compareFormSlots = 4
+
+// compareSeriesFromRequest gets the list of compared securities from request
+// Securities are set by repeated id and type parameters, the first type is used if the type of security is not set
+// The old parameters id1, id2, type and type2 are supported too
+func compareSeriesFromRequest(request *http.Request) []compSeries {
+	err := request.ParseForm()
+	if err != nil {
+		return nil
+	}
+
+	ids := request.Form["id"]
+	types := request.Form["type"]
+
+	id1 := request.Form.Get("id1")
+	id2 := request.Form.Get("id2")
+	if id1 != "" || id2 != "" {
+		ids = []string{id1, id2}
+		types = []string{request.Form.Get("type"), request.Form.Get("type2")}
+	}
+
+	var series []compSeries
+	for i, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		typeString := ""
+		if i < len(types) {
+			typeString = types[i]
+		}
+		if typeString == "" && len(types) > 0 {
+			typeString = types[0]
+		}
+
+		series = append(series, compSeries{Id: id, Type: typeString})
+	}
+
+	return series
+}
+
+// closesByDate converts close prices of security quotes to the map with dates (without time) as keys
+func closesByDate(quotes []expSecurityQuotes) (map[time.Time]float64, error) {
+	closes := make(map[time.Time]float64)
+	for _, q := range quotes {
+		if q.Close == "" {
+			continue
+		}
+
+		date, err := time.Parse("02.01.2006 15:04:05", q.End)
+		if err != nil {
+			return nil, err
+		}
+
+		price, err := strconv.ParseFloat(q.Close, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		closes[date.Truncate(time.Hour*24)] = price
+	}
+
+	return closes, nil
+}
+
+// compareRows makes rows of comparison table for all dates when at least one security has close price
+// Changes and indexed values are calculated from close prices of the first date when all securities have close prices
+func compareRows(closes []map[time.Time]float64) []compRow {
+	datesSet := make(map[time.Time]bool)
+	for _, c := range closes {
+		for date := range c {
+			datesSet[date] = true
+		}
+	}
+
+	dates := make([]time.Time, 0, len(datesSet))
+	for date := range datesSet {
+		dates = append(dates, date)
+	}
+
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	var basePrices []float64
+	prevPrices := make([]float64, len(closes))
+	rows := make([]compRow, 0, len(dates))
+	for _, date := range dates {
+		row := compRow{Date: date.Format("02.01.2006"), Values: make([]compValue, len(closes)), date: date}
+
+		common := true
+		for i, c := range closes {
+			price, ok := c[date]
+			if !ok {
+				common = false
+				continue
+			}
+
+			row.Values[i].Price = fmt.Sprintf("%f", price)
+			row.Values[i].close = &price
+
+			// day change is calculated from the previous close price of the same security
+			if prevPrices[i] != 0.0 {
+				dayChange := (price - prevPrices[i]) / prevPrices[i] * 100
+				row.Values[i].dayChange = &dayChange
+			}
+			prevPrices[i] = price
+		}
+
+		if basePrices == nil && common {
+			basePrices = make([]float64, len(closes))
+			for i, c := range closes {
+				basePrices[i] = c[date]
+			}
+		}
+
+		if basePrices != nil {
+			for i, c := range closes {
+				price, ok := c[date]
+				if ok && basePrices[i] != 0.0 {
+					totalChange := (price - basePrices[i]) / basePrices[i] * 100
+					row.Values[i].Change = fmt.Sprintf("%.2f", totalChange)
+					row.Values[i].Index = fmt.Sprintf("%.2f", price/basePrices[i]*100)
+					row.Values[i].totalChange = &totalChange
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// writeCompareExport writes comparison table as csv or json
+// Every security has close price, day change (%) and total change (%) from the first common date, dates are in ISO format
+func writeCompareExport(writer http.ResponseWriter, format string, series []compSeries, rows []compRow) {
+	exportData := compExportData{Securities: series, Rows: make([]compExportRow, len(rows))}
+	for i, row := range rows {
+		exportData.Rows[i] = compExportRow{Date: row.date.Format("2006-01-02"), Values: make([]compExportValue, len(row.Values))}
+		for j, v := range row.Values {
+			exportData.Rows[i].Values[j] = compExportValue{Close: v.close, DayChange: v.dayChange, TotalChange: v.totalChange}
+		}
+	}
+
+	if format == "json" {
+		res, err := json.Marshal(exportData)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(res)
+		return
+	}
+
+	// formatValue converts value to string, empty string is used if there is no value
+	formatValue := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+
+	writer.Header().Set("Content-Type", "text/csv")
+	writer.Header().Set("Content-Disposition", `attachment; filename="comparison.csv"`)
+
+	csvWriter := csv.NewWriter(writer)
+
+	header := []string{"date"}
+	for _, ser := range series {
+		header = append(header, ser.Id+" close", ser.Id+" day change", ser.Id+" total change")
+	}
 
-	err = html.Execute(writer, *resStruct)
+	err := csvWriter.Write(header)
 	if err != nil {
-		showErrorPage(writer, err.Error())
+		logger.Error("writing comparison csv", "error", err)
 		return
 	}
+
+	for _, row := range exportData.Rows {
+		record := []string{row.Date}
+		for _, v := range row.Values {
+			record = append(record, formatValue(v.Close), formatValue(v.DayChange), formatValue(v.TotalChange))
+		}
+
+		err = csvWriter.Write(record)
+		if err != nil {
+			logger.Error("writing comparison csv", "error", err)
+			return
+		}
+	}
+
+	csvWriter.Flush()
+	if err = csvWriter.Error(); err != nil {
+		logger.Error("writing comparison csv", "error", err)
+	}
 }
 
-// compareHandler shows comparison of two given securities for the given period
+// compareHandler shows comparison of the given securities for the given period
+// The comparison table is exported as csv or json instead of the page if format is set
 func compareHandler(writer http.ResponseWriter, request *http.Request) {
-	html, err := template.ParseFiles(htmlDir + "compareSecurities.html")
+	html, err := getTemplate("compareSecurities.html")
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	type compQuotes struct {
-		Date        string
-		Price1      string
-		Price2      string
-		DayProfit   string
-		TotalProfit string
+		showErrorPage(writer, err.Error())
+		return
 	}
 
-	id1 := request.FormValue("id1")
-	id2 := request.FormValue("id2")
-	typeString := request.FormValue("type")
+	series := compareSeriesFromRequest(request)
 	dateFromString := request.FormValue("dateFrom")
 	dateTillString := request.FormValue("dateTill")
+	mode := request.FormValue("mode")
+	format := request.FormValue("format")
+
+	if format != "" && format != "csv" && format != "json" {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown format %s", format))
+		return
+	}
+
+	// absolute prices are shown by default, indexed values (all securities start at 100) are shown in indexed mode
+	if mode != "" && mode != "absolute" && mode != "indexed" {
+		showErrorPage(writer, fmt.Sprintf("unknown mode %s", mode))
+		return
+	}
 
 	htmlData := struct {
-		Id1       string
-		Id2       string
-		Type      string
-		DateFrom  string
-		DateTill  string
-		ExpQuotes map[time.Time]*compQuotes
-	}{}
+		Series      []compSeries
+		Slots       []compSeries
+		DateFrom    string
+		DateTill    string
+		Indexed     bool
+		ExportURL   template.URL
+		Correlation string
+		Rows        []compRow
+	}{
+		Series:   series,
+		Slots:    append([]compSeries{}, series...),
+		DateFrom: dateFromString,
+		DateTill: dateTillString,
+		Indexed:  mode == "indexed",
+	}
 
-	if id1 == "" || id2 == "" || typeString == "" {
-		htmlData.Id1 = id1
-		htmlData.Id2 = id2
-		htmlData.Type = typeString
-		htmlData.DateFrom = dateFromString
-		htmlData.DateTill = dateTillString
-		htmlData.ExpQuotes = *new(map[time.Time]*compQuotes)
+	for len(htmlData.Slots) < compareFormSlots || len(htmlData.Slots) == len(series) {
+		htmlData.Slots = append(htmlData.Slots, compSeries{})
+	}
+
+	if len(series) < 2 {
+		if format != "" {
+			writeError(writer, http.StatusBadRequest, "not enough securities to compare")
+			return
+		}
+
+		htmlData.Series = nil
 
 		err := html.Execute(writer, htmlData)
 		if err != nil {
@@ -700,7 +4567,7 @@ func compareHandler(writer http.ResponseWriter, request *http.Request) {
 
 	// it would be probably better to make new request here
 
-	reqResult := func(id string) *securityData {
+	reqResult := func(id string, typeString string) *securityData {
 		req := httpPath + "/securities/getSecurityData"
 		params := url.Values{}
 		params.Add("id", id)
@@ -714,113 +4581,70 @@ func compareHandler(writer http.ResponseWriter, request *http.Request) {
 		req = req + "?" + params.Encode()
 
 		resStruct := &securityData{}
-		executeRequest(writer, req, resStruct)
+		if !executeRequest(writer, request, req, resStruct) {
+			return nil
+		}
 
 		return resStruct
 	}
 
-	quotes1 := *reqResult(id1)
-	quotes2 := *reqResult(id2)
-
-	result := make(map[time.Time]*compQuotes)
-
-	for _, q := range quotes1.ExpQuotes {
-		date, err := time.Parse("02.01.2006 15:04:05", q.End)
-		if err != nil {
-			showErrorPage(writer, err.Error())
+	closes := make([]map[time.Time]float64, len(series))
+	for i, ser := range series {
+		quotes := reqResult(ser.Id, ser.Type)
+		if quotes == nil {
 			return
 		}
 
-		date = date.Truncate(time.Hour * 24)
-		if _, ok := result[date]; !ok {
-			result[date] = new(compQuotes)
-		}
-
-		result[date].Date = date.Format("02.01.2006")
-		result[date].Price1 = q.Close
-	}
-
-	for _, q := range quotes2.ExpQuotes {
-		date, err := time.Parse("02.01.2006 15:04:05", q.End)
+		closes[i], err = closesByDate(quotes.ExpQuotes)
 		if err != nil {
 			showErrorPage(writer, err.Error())
 			return
 		}
-
-		date = date.Truncate(time.Hour * 24)
-		if _, ok := result[date]; !ok {
-			result[date] = new(compQuotes)
-		}
-
-		result[date].Date = date.Format("02.01.2006")
-		result[date].Price2 = q.Close
 	}
 
-	dateFrom := getDateFromString(dateFromString, time.Now().Truncate(time.Hour*24).AddDate(0, -1, 0)).UTC()
-	dateTill := getDateFromString(dateTillString, time.Now().Truncate(time.Hour*24)).Add(time.Second * (60*60*24 - 1)).UTC()
-	startPrice1 := 0.0
-	prevPrice1 := 0.0
-	startPrice2 := 0.0
-	prevPrice2 := 0.0
-	for date := dateFrom; !date.After(dateTill); date = date.AddDate(0, 0, 1) {
-		q, ok := result[date]
-		if !ok {
-			continue
-		}
-
-		if q.Price1 == "" || q.Price2 == "" {
-			continue
-		}
-
-		pr1, err := strconv.ParseFloat(q.Price1, 64)
-		if err != nil {
-			showErrorPage(writer, err.Error())
-			return
-		}
-
-		dayChange1 := 0.0
-		if prevPrice1 > 0.0 {
-			dayChange1 = (pr1 - prevPrice1) / prevPrice1 * 100
-		}
-		prevPrice1 = pr1
+	htmlData.Rows = compareRows(closes)
 
-		totalChange1 := 0.0
-		if startPrice1 > 0.0 {
-			totalChange1 = (pr1 - startPrice1) / startPrice1 * 100
-		} else {
-			startPrice1 = pr1
-		}
+	if format != "" {
+		writeCompareExport(writer, format, series, htmlData.Rows)
+		return
+	}
 
-		pr2, err := strconv.ParseFloat(q.Price2, 64)
-		if err != nil {
-			showErrorPage(writer, err.Error())
-			return
+	exportParams := url.Values{}
+	for _, ser := range series {
+		exportParams.Add("id", ser.Id)
+		exportParams.Add("type", ser.Type)
+	}
+	if dateFromString != "" {
+		exportParams.Add("dateFrom", dateFromString)
+	}
+	if dateTillString != "" {
+		exportParams.Add("dateTill", dateTillString)
+	}
+	htmlData.ExportURL = template.URL("/securities/compare?" + exportParams.Encode())
+
+	// correlation is just additional information, so we don't show error page if it can't be calculated
+	if len(series) == 2 {
+		corrReq := httpPath + "/securities/getCorrelation"
+		corrParams := url.Values{}
+		corrParams.Add("id1", series[0].Id)
+		corrParams.Add("id2", series[1].Id)
+		corrParams.Add("type", series[0].Type)
+		corrParams.Add("type2", series[1].Type)
+		if dateFromString != "" {
+			corrParams.Add("dateFrom", dateFromString)
 		}
-
-		dayChange2 := 0.0
-		if prevPrice2 > 0.0 {
-			dayChange2 = (pr2 - prevPrice2) / prevPrice2 * 100
+		if dateTillString != "" {
+			corrParams.Add("dateTill", dateTillString)
 		}
-		prevPrice2 = pr2
+		corrReq = corrReq + "?" + corrParams.Encode()
 
-		totalChange2 := 0.0
-		if startPrice2 > 0.0 {
-			totalChange2 = (pr2 - startPrice2) / startPrice2 * 100
-		} else {
-			startPrice2 = pr2
+		corrStruct := &correlationData{}
+		err = requestData(request, corrReq, corrStruct)
+		if err == nil {
+			htmlData.Correlation = corrStruct.Correlation
 		}
-
-		result[date].DayProfit = fmt.Sprintf("%.2f", dayChange1-dayChange2)
-		result[date].TotalProfit = fmt.Sprintf("%.2f", totalChange1-totalChange2)
 	}
 
-	htmlData.Id1 = id1
-	htmlData.Id2 = id2
-	htmlData.Type = typeString
-	htmlData.DateFrom = dateFromString
-	htmlData.DateTill = dateTillString
-	htmlData.ExpQuotes = result
-
 	err = html.Execute(writer, htmlData)
 	if err != nil {
 		showErrorPage(writer, err.Error())
@@ -832,38 +4656,45 @@ func compareHandler(writer http.ResponseWriter, request *http.Request) {
 // Then the list of securities with begin and end quotes is written down to another file sorted by change %
 func securityListHandler(writer http.ResponseWriter, request *http.Request) {
 	// TODO: add currency and security names
-	// TODO: add some more checks about file content
 
-	html, err := template.ParseFiles(htmlDir + "securityList.html")
+	html, err := getTemplate("securityList.html")
 	if err != nil {
-		log.Fatal(err)
+		showErrorPage(writer, err.Error())
+		return
 	}
 
-	type secPrices struct {
-		id         string
-		priceBegin float64
-		priceEnd   float64
-		change     float64
+	// the form is sent with the file, so the whole request is limited
+	request.Body = http.MaxBytesReader(writer, request.Body, maxListFileSize+maxListFormSize)
+	err = request.ParseMultipartForm(maxListFileSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		showErrorPage(writer, err.Error())
+		return
 	}
 
-	var secSlice []*securities.Security
-	var secQuotes []secPrices
-
 	typeString := request.FormValue("type")
 	dateFromString := request.FormValue("dateFrom")
 	dateTillString := request.FormValue("dateTill")
-	fileName := request.FormValue("fileName")
+	format := request.FormValue("format")
 
-	if typeString == "" || fileName == "" {
-		err := html.Execute(writer, struct {
-			Type     string
-			DateFrom string
-			DateTill string
-			FileName string
-		}{Type: typeString,
+	type pageData struct {
+		Type     string
+		DateFrom string
+		DateTill string
+		Format   string
+		JobId    int64
+	}
+
+	file, header, err := request.FormFile("file")
+	if err != nil && !errors.Is(err, http.ErrMissingFile) && !errors.Is(err, http.ErrNotMultipart) {
+		showErrorPage(writer, err.Error())
+		return
+	}
+
+	if typeString == "" || file == nil {
+		err := html.Execute(writer, pageData{Type: typeString,
 			DateFrom: dateFromString,
 			DateTill: dateTillString,
-			FileName: fileName})
+			Format:   format})
 
 		if err != nil {
 			showErrorPage(writer, err.Error())
@@ -871,6 +4702,24 @@ func securityListHandler(writer http.ResponseWriter, request *http.Request) {
 		}
 		return
 	}
+	defer file.Close()
+
+	if len(apiKeys) > 0 && !validAPIKey(request.Header.Get(apiKeyHeader)) {
+		showErrorPage(writer, "valid API key is required")
+		return
+	}
+
+	if readOnly {
+		showErrorPage(writer, errReadOnly)
+		return
+	}
+
+	if ok, retryAfter := updateLimiter.Allow(request); !ok {
+		writer.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(retryAfter)))
+		writer.WriteHeader(http.StatusTooManyRequests)
+		showErrorPage(writer, "too many requests, try again later")
+		return
+	}
 
 	sType := securities.GetSecurityTypeFromString(typeString)
 	if sType == securities.UnknownType {
@@ -878,55 +4727,165 @@ func securityListHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	file, err := os.Open(fileName)
+	if format != "" && format != "text" && format != "json" {
+		showErrorPage(writer, fmt.Sprintf("unknown format %s", format))
+		return
+	}
+
+	ids, err := readSecurityList(file)
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
 	}
-	if os.IsNotExist(err) {
-		showErrorPage(writer, "file not found")
-		return
+
+	var secSlice []*securities.Security
+	for _, id := range ids {
+		secSlice = append(secSlice, securities.GetQuickSecurity(id, sType))
 	}
+
+	dateFrom, dateTill, err := getPeriodFromStrings(dateFromString, dateTillString)
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		secSlice = append(secSlice, securities.GetQuickSecurity(scanner.Text(), sType))
+	// securities which are not checked on Moscow Exchange are not added, they are reported in the result
+	total := len(secSlice)
+	var verifyErrors []securityListError
+	if verifyOnAdd {
+		secSlice, verifyErrors = verifySecurityList(request.Context(), secSlice)
 	}
-	if scanner.Err() != nil {
+
+	err = store.AddSecurities(secSlice)
+	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
 	}
 
-	dateFrom := getDateFromString(dateFromString, time.Now().Truncate(time.Hour*24).AddDate(0, -1, 0)).UTC()
-	dateTill := getDateFromString(dateTillString, time.Now().Truncate(time.Hour*24)).Add(time.Second * (60*60*24 - 1)).UTC()
-	if dateFrom.After(dateTill) {
-		showErrorPage(writer, "date from can't be after date till")
+	// quotes are updated in background, the client checks the job and gets the result when it's done
+	fileName := strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	job := listJobs.Start(total, func(ctx context.Context, job *jobs.Job[securityListData]) (securityListData, error) {
+		return processSecurityList(ctx, job, secSlice, verifyErrors, dateFrom, dateTill, fileName), nil
+	})
+	jobId := job.State().Id
+
+	if format == "json" {
+		res, err := json.Marshal(getJobData(job.State()))
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Location", fmt.Sprintf("/securities/jobs/%d", jobId))
+		writer.WriteHeader(http.StatusAccepted)
+		writer.Write(res)
 		return
 	}
 
-	err = securitiesSQL.AddSecurities(db, secSlice)
+	err = html.Execute(writer, pageData{Type: typeString,
+		DateFrom: dateFromString,
+		DateTill: dateTillString,
+		Format:   format,
+		JobId:    jobId})
+
 	if err != nil {
 		showErrorPage(writer, err.Error())
 		return
 	}
+}
+
+// verifySecurityList checks securities from the list on Moscow Exchange the same way as a single security is checked before adding
+// It returns the securities which passed the check and errors of the others
+func verifySecurityList(ctx context.Context, secSlice []*securities.Security) ([]*securities.Security, []securityListError) {
+	verified := make([]bool, len(secSlice))
+	var secErrors []securityListError
+
+	wg := new(sync.WaitGroup)
+	mu := new(sync.Mutex)
+
+	// the same limit of concurrent requests to Moscow Exchange as for quotes update of the list
+	semaphore := make(chan struct{}, listConcurrency)
+
+	for i, sec := range secSlice {
+		wg.Add(1)
+
+		go func(i int, sec *securities.Security) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			desc, err := moex.GetSecurityDescription(ctx, sec.Id())
+			if err == nil {
+				err = desc.Check(sec.SType())
+			}
+			if err != nil {
+				logger.Warn("security from list failed the check", "id", sec.Id(), "type", sec.SType(), "error", err)
+				mu.Lock()
+				secErrors = append(secErrors, securityListError{Id: sec.Id(), Error: err.Error()})
+				mu.Unlock()
+				return
+			}
+
+			verified[i] = true
+		}(i, sec)
+	}
+
+	wg.Wait()
+
+	res := make([]*securities.Security, 0, len(secSlice))
+	for i, sec := range secSlice {
+		if verified[i] {
+			res = append(res, sec)
+		}
+	}
+
+	return res, secErrors
+}
+
+// processSecurityList updates daily quotes of securities from the list for the period and returns their prices sorted by change
+// Wrong securities are reported in the job and in the result, other securities are processed anyway
+// Errors of securities which failed the check before adding are reported the same way
+func processSecurityList(ctx context.Context, job *jobs.Job[securityListData], secSlice []*securities.Security, verifyErrors []securityListError, dateFrom time.Time, dateTill time.Time, fileName string) securityListData {
+	type secPrices struct {
+		id         string
+		priceBegin float64
+		priceEnd   float64
+		change     float64
+	}
+
+	var secQuotes []secPrices
+	secErrors := append([]securityListError(nil), verifyErrors...)
+
+	for _, e := range verifyErrors {
+		job.Step(e.Id, errors.New(e.Error))
+	}
 
 	wg := new(sync.WaitGroup)
 	mu := new(sync.Mutex)
 
+	// we shouldn't send too many requests to Moscow Exchange at once - we may be blocked for this
+	semaphore := make(chan struct{}, listConcurrency)
+
 	for _, sec := range secSlice {
 		wg.Add(1)
 
 		go func(sec *securities.Security) {
 			defer wg.Done()
 
-			err = securitiesSQL.UpdateSecurityQuotes(db, sec, dateFrom, dateTill, securities.IntervalDay)
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			err := store.UpdateSecurityQuotes(ctx, sec, dateFrom, dateTill, securities.IntervalDay)
+			job.Step(sec.Id(), err)
 			if err != nil {
-				return // we will just ignore wrong securities for now
+				logger.Warn("quotes update of security from list failed", "file", fileName, "id", sec.Id(), "type", sec.SType(),
+					"dateFrom", dateFrom.Format("2006-01-02"), "dateTill", dateTill.Format("2006-01-02"), "error", err)
+				mu.Lock()
+				secErrors = append(secErrors, securityListError{Id: sec.Id(), Error: err.Error()})
+				mu.Unlock()
+				return
 			}
 
 			priceBegin := sec.QuotesForDate(securities.IntervalDay, dateFrom.Truncate(time.Hour*24).AddDate(0, 0, 1)).Open
@@ -951,38 +4910,198 @@ func securityListHandler(writer http.ResponseWriter, request *http.Request) {
 
 	wg.Wait()
 
+	listCache.Clear()
+
 	sort.Slice(secQuotes, func(i, j int) bool {
 		return secQuotes[i].change < secQuotes[j].change || (secQuotes[i].change == secQuotes[j].change && secQuotes[i].id < secQuotes[j].id)
 	})
 
-	options := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
-	fileRes, err := os.OpenFile(strings.Split(fileName, ".")[0]+"_result.txt", options, os.FileMode(0600))
+	sort.Slice(secErrors, func(i, j int) bool {
+		return secErrors[i].Id < secErrors[j].Id
+	})
+
+	res := securityListData{
+		File:       fileName,
+		Securities: make([]securityListPrice, 0, len(secQuotes)),
+		Errors:     make([]securityListError, 0, len(secErrors)),
+	}
+
+	for _, secListPrice := range secQuotes {
+		res.Securities = append(res.Securities, securityListPrice{
+			Id:         secListPrice.id,
+			PriceBegin: fmt.Sprintf("%f", secListPrice.priceBegin),
+			PriceEnd:   fmt.Sprintf("%f", secListPrice.priceEnd),
+			Change:     fmt.Sprintf("%.2f", secListPrice.change),
+		})
+	}
+	res.Errors = append(res.Errors, secErrors...)
+
+	return res
+}
+
+// getJobData converts state of the job processing the list of securities
+func getJobData(state jobs.State[securityListData]) jobData {
+	res := jobData{
+		Id:        state.Id,
+		Done:      state.Done,
+		Total:     state.Total,
+		Processed: state.Processed,
+		Errors:    make([]securityListError, 0, len(state.Errors)),
+	}
+
+	for _, e := range state.Errors {
+		res.Errors = append(res.Errors, securityListError{Id: e.Item, Error: e.Error})
+	}
+
+	if state.Done {
+		if state.Err != nil {
+			res.Error = state.Err.Error()
+		} else {
+			result := state.Result
+			res.Result = &result
+		}
+	}
+
+	return res
+}
+
+// jobResourceHandler gets progress of the job processing the list of securities (/securities/jobs/{id})
+// The result of the done job is sent as a file (/securities/jobs/{id}/result?format=text|json)
+func jobResourceHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writer.Header().Set("Allow", http.MethodGet)
+		writeError(writer, http.StatusMethodNotAllowed, fmt.Sprintf("method %s is not allowed", request.Method))
+		return
+	}
+
+	idString := strings.TrimPrefix(request.URL.Path, "/securities/jobs/")
+	result := strings.HasSuffix(idString, "/result")
+	idString = strings.TrimSuffix(idString, "/result")
+	id, err := strconv.ParseInt(idString, 10, 64)
 	if err != nil {
-		showErrorPage(writer, err.Error())
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("wrong path %s", request.URL.Path))
 		return
 	}
-	defer fileRes.Close()
 
-	for _, secListPrice := range secQuotes {
-		_, err = fmt.Fprintf(fileRes, "%s\t - %f\t - %f\t - %.2f\n", secListPrice.id, secListPrice.priceBegin, secListPrice.priceEnd, secListPrice.change)
+	job, ok := listJobs.Get(id)
+	if !ok {
+		writeError(writer, http.StatusNotFound, fmt.Sprintf("job %d does not exist", id))
+		return
+	}
+
+	state := job.State()
+
+	if !result {
+		res, err := json.Marshal(getJobData(state))
 		if err != nil {
-			showErrorPage(writer, err.Error())
+			writeError(writer, http.StatusInternalServerError, err.Error())
 			return
 		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write(res)
+		return
 	}
 
-	err = html.Execute(writer, struct {
-		Type     string
-		DateFrom string
-		DateTill string
-		FileName string
-	}{Type: typeString,
-		DateFrom: dateFromString,
-		DateTill: dateTillString,
-		FileName: fileName})
+	format := request.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "json" {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("unknown format %s", format))
+		return
+	}
 
-	if err != nil {
-		showErrorPage(writer, err.Error())
+	if !state.Done {
+		writeError(writer, http.StatusConflict, fmt.Sprintf("job %d is not done yet", id))
+		return
+	}
+
+	if state.Err != nil {
+		writeError(writer, http.StatusInternalServerError, state.Err.Error())
+		return
+	}
+
+	writeSecurityListResult(writer, state.Result, format)
+}
+
+// writeSecurityListResult sends the result of processing the list of securities as a file named after the uploaded one
+func writeSecurityListResult(writer http.ResponseWriter, listData securityListData, format string) {
+	if format == "json" {
+		res, err := json.Marshal(listData)
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", listData.File+"_result.json"))
+		writer.Write(res)
 		return
 	}
+
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", listData.File+"_result.txt"))
+
+	for _, secListPrice := range listData.Securities {
+		_, err := fmt.Fprintf(writer, "%s\t - %s\t - %s\t - %s\n", secListPrice.Id, secListPrice.PriceBegin, secListPrice.PriceEnd, secListPrice.Change)
+		if err != nil {
+			logger.Error("writing security list result", "file", listData.File, "error", err)
+			return
+		}
+	}
+
+	if len(listData.Errors) > 0 {
+		_, err := fmt.Fprintf(writer, "\nErrors:\n")
+		if err != nil {
+			logger.Error("writing security list result", "file", listData.File, "error", err)
+			return
+		}
+
+		for _, secError := range listData.Errors {
+			_, err = fmt.Fprintf(writer, "%s\t - %s\n", secError.Id, secError.Error)
+			if err != nil {
+				logger.Error("writing security list result", "file", listData.File, "error", err)
+				return
+			}
+		}
+	}
+}
+
+// readSecurityList reads ids of securities from the uploaded text file, one id on a line
+// Empty lines are skipped, the file must be a UTF-8 text not larger than maxListFileSize with ids not longer than maxSecurityIdLength
+func readSecurityList(file io.Reader) ([]string, error) {
+	data, err := io.ReadAll(io.LimitReader(file, maxListFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxListFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxListFileSize)
+	}
+
+	if !utf8.Valid(data) || !strings.HasPrefix(http.DetectContentType(data), "text/plain") {
+		return nil, errors.New("file is not a text file")
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+
+		if len(id) > maxSecurityIdLength || strings.ContainsAny(id, " \t") {
+			return nil, fmt.Errorf("line %d is not a security id: %q", line, id)
+		}
+
+		ids = append(ids, id)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	if len(ids) == 0 {
+		return nil, errors.New("file has no securities")
+	}
+
+	return ids, nil
 }
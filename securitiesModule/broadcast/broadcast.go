@@ -0,0 +1,73 @@
+// Package broadcast sends values to all current subscribers, it's used to push updates to long-lived client connections
+package broadcast
+
+import "sync"
+
+// Broadcaster sends published values to all subscribers
+// Publish doesn't wait for slow subscribers, values which don't fit into the buffer of subscriber are dropped
+type Broadcaster[T any] struct {
+	buffer int
+
+	mu          sync.Mutex // guards the fields below
+	subscribers map[chan T]struct{}
+	closed      bool
+}
+
+// New creates a new broadcaster, every subscriber gets the channel with the given buffer size
+func New[T any](buffer int) *Broadcaster[T] {
+	return &Broadcaster[T]{
+		buffer:      buffer,
+		subscribers: make(map[chan T]struct{}),
+	}
+}
+
+// Subscribe returns the channel of published values and the function to unsubscribe
+// The channel is closed when subscriber unsubscribes or broadcaster is closed
+func (b *Broadcaster[T]) Subscribe() (<-chan T, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan T, b.buffer)
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends the value to all subscribers without waiting
+func (b *Broadcaster[T]) Publish(value T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- value:
+		default:
+		}
+	}
+}
+
+// Close closes channels of all subscribers, so they stop waiting for values
+// Later subscribers get closed channels at once
+func (b *Broadcaster[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		close(ch)
+	}
+	b.subscribers = make(map[chan T]struct{})
+	b.closed = true
+}
@@ -0,0 +1,61 @@
+package broadcast
+
+import "testing"
+
+func TestBroadcaster(t *testing.T) {
+	b := New[int](1)
+
+	first, unsubscribeFirst := b.Subscribe()
+	second, unsubscribeSecond := b.Subscribe()
+	defer unsubscribeSecond()
+
+	b.Publish(1)
+
+	if got := <-first; got != 1 {
+		t.Errorf("wrong value of the first subscriber - want 1, got %d", got)
+	}
+	if got := <-second; got != 1 {
+		t.Errorf("wrong value of the second subscriber - want 1, got %d", got)
+	}
+
+	// the last value doesn't fit into the buffers of subscribers, so it's dropped
+	b.Publish(2)
+	b.Publish(3)
+
+	if got := <-second; got != 2 {
+		t.Errorf("wrong buffered value - want 2, got %d", got)
+	}
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+
+	<-first // the value published before unsubscription
+	if _, ok := <-first; ok {
+		t.Error("channel of unsubscribed subscriber isn't closed")
+	}
+
+	b.Publish(4)
+	if got := <-second; got != 4 {
+		t.Errorf("wrong value after unsubscription of other subscriber - want 4, got %d", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := New[int](1)
+
+	ch, unsubscribe := b.Subscribe()
+	b.Close()
+	unsubscribe()
+
+	if _, ok := <-ch; ok {
+		t.Error("channel isn't closed with broadcaster")
+	}
+
+	late, _ := b.Subscribe()
+	if _, ok := <-late; ok {
+		t.Error("channel of subscriber after closing isn't closed")
+	}
+
+	// publishing after closing does nothing
+	b.Publish(1)
+}
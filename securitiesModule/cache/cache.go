@@ -0,0 +1,95 @@
+// Package cache contains a simple in-memory cache with time to live for the results of heavy requests
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// entry is a cached value with its expiration time
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// call is a running load of value which other requests of the same key wait for
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Cache keeps values by string keys for the given time
+// Concurrent requests of the same missing key share one load of value (single-flight)
+type Cache[V any] struct {
+	ttl time.Duration
+
+	mu         sync.Mutex // guards the fields below
+	entries    map[string]entry[V]
+	calls      map[string]*call[V]
+	generation int // is increased by Clear, so loads started before Clear don't put old values into cache
+}
+
+// New creates a new cache with the given time to live of values
+// Values are not kept at all if ttl is not positive, but concurrent loads are still shared
+func New[V any](ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		ttl:     ttl,
+		entries: make(map[string]entry[V]),
+		calls:   make(map[string]*call[V]),
+	}
+}
+
+// Get returns the cached value of the key or loads it with the given function
+// Errors of load are returned to all waiting requests, but they are not cached
+func (c *Cache[V]) Get(key string, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+
+	if e, ok := c.entries[key]; ok {
+		if time.Now().Before(e.expires) {
+			c.mu.Unlock()
+			return e.value, nil
+		}
+
+		delete(c.entries, key)
+	}
+
+	if cl, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+
+		<-cl.done
+		return cl.value, cl.err
+	}
+
+	cl := &call[V]{done: make(chan struct{})}
+	c.calls[key] = cl
+	generation := c.generation
+
+	c.mu.Unlock()
+
+	cl.value, cl.err = load()
+
+	c.mu.Lock()
+	if c.calls[key] == cl {
+		delete(c.calls, key)
+	}
+	if cl.err == nil && c.ttl > 0 && generation == c.generation {
+		c.entries[key] = entry[V]{value: cl.value, expires: time.Now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+
+	close(cl.done)
+
+	return cl.value, cl.err
+}
+
+// Clear removes all values from cache
+// Loads which are running now return their values, but the values are not cached
+func (c *Cache[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]entry[V])
+	c.calls = make(map[string]*call[V])
+	c.generation++
+}
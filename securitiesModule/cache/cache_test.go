@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	c := New[int](time.Minute)
+
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		v, err := c.Get("key", load)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != 1 {
+			t.Errorf("wrong cached value - want 1, got %d", v)
+		}
+	}
+
+	v, err := c.Get("other", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 2 {
+		t.Errorf("wrong value of another key - want 2, got %d", v)
+	}
+
+	c.Clear()
+
+	v, err = c.Get("key", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 {
+		t.Errorf("wrong value after clear - want 3, got %d", v)
+	}
+}
+
+func TestGetExpired(t *testing.T) {
+	c := New[int](time.Millisecond)
+
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	c.Get("key", load)
+	time.Sleep(5 * time.Millisecond)
+
+	v, _ := c.Get("key", load)
+	if v != 2 {
+		t.Errorf("expired value is returned - want 2, got %d", v)
+	}
+}
+
+func TestGetError(t *testing.T) {
+	c := New[int](time.Minute)
+
+	_, err := c.Get("key", func() (int, error) { return 0, errors.New("load error") })
+	if err == nil {
+		t.Fatal("no error from load")
+	}
+
+	v, err := c.Get("key", func() (int, error) { return 5, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 5 {
+		t.Errorf("error is cached - want 5, got %d", v)
+	}
+}
+
+func TestGetSingleFlight(t *testing.T) {
+	c := New[int](time.Minute)
+
+	var loads int32
+	release := make(chan struct{})
+	load := func() (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return 7, nil
+	}
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			v, err := c.Get("key", load)
+			if err != nil || v != 7 {
+				t.Errorf("wrong shared value - want 7, got %d (%v)", v, err)
+			}
+		}()
+	}
+
+	// let all requests wait for the first load
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("wrong number of loads - want 1, got %d", n)
+	}
+}
+
+func TestClearDuringLoad(t *testing.T) {
+	c := New[int](time.Minute)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Get("key", func() (int, error) {
+			<-release
+			return 1, nil
+		})
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	c.Clear()
+	close(release)
+	<-done
+
+	v, _ := c.Get("key", func() (int, error) { return 2, nil })
+	if v != 2 {
+		t.Errorf("value loaded before clear is cached - want 2, got %d", v)
+	}
+}
@@ -0,0 +1,178 @@
+// Package compress contains http middleware which compresses responses with gzip for clients which accept it
+package compress
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MinSize is the minimum size of response body which is compressed, smaller bodies are sent as they are
+const MinSize = 1024
+
+// writers keeps gzip writers for reuse, every writer allocates large buffers
+var writers = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// Gzip compresses responses of handler if the client accepts gzip encoding
+// Responses shorter than MinSize, responses with their own encoding, server-sent events and connection upgrades are not compressed
+func Gzip(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("Vary", "Accept-Encoding")
+
+		if !acceptsGzip(request) || request.Method == http.MethodHead || request.Header.Get("Upgrade") != "" {
+			handler(writer, request)
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: writer}
+		defer gw.close()
+
+		handler(gw, request)
+	}
+}
+
+// acceptsGzip checks if gzip is listed in Accept-Encoding header of request and isn't refused with zero quality
+func acceptsGzip(request *http.Request) bool {
+	for _, part := range strings.Split(request.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimSpace(params), "=")
+		if ok && strings.TrimSpace(name) == "q" {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q > 0
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// gzipWriter keeps the beginning of response until it's clear whether the response is compressed
+// The decision is made when the body reaches MinSize, when handler flushes or when it finishes
+type gzipWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer // nil if the response isn't compressed
+}
+
+// WriteHeader keeps the status code, it's written when the response is started
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+
+	w.status = status
+}
+
+// Write keeps the body until it reaches MinSize and then sends it compressed or as it is
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < MinSize {
+			return len(b), nil
+		}
+
+		err := w.start(true)
+		return len(b), err
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the kept and compressed data to the client
+// If the response isn't started yet it's sent as it is, so streaming responses are not delayed
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.start(false)
+	}
+
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the original writer, so http.ResponseController can reach it
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start writes the header and the kept body, the body is compressed if compress is true and the response may be compressed
+func (w *gzipWriter) start(compress bool) error {
+	w.decided = true
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	header := w.Header()
+	if compress && compressible(w.status, header) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+
+		w.gz = writers.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// compressible checks if the response with the given status and header may be compressed
+func compressible(status int, header http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	return !strings.HasPrefix(header.Get("Content-Type"), "text/event-stream")
+}
+
+// close finishes the response when handler returns, short responses are sent as they are
+func (w *gzipWriter) close() {
+	if !w.decided {
+		w.start(false)
+	}
+
+	if w.gz != nil {
+		w.gz.Close()
+		w.gz.Reset(nil)
+		writers.Put(w.gz)
+		w.gz = nil
+	}
+}
@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzip(t *testing.T) {
+	long := strings.Repeat("quotes ", MinSize)
+
+	handler := Gzip(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusCreated)
+
+		if request.URL.Query().Get("short") == "true" {
+			writer.Write([]byte("ok"))
+			return
+		}
+
+		// the body is written in parts, the first of them is shorter than MinSize
+		writer.Write([]byte(long[:10]))
+		writer.Write([]byte(long[10:]))
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+
+	if recorder.Code != http.StatusCreated || recorder.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("response isn't compressed - got status %d and encoding %q", recorder.Code, recorder.Header().Get("Content-Encoding"))
+	}
+
+	reader, err := gzip.NewReader(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != long {
+		t.Errorf("wrong uncompressed body - want %d bytes, got %d", len(long), len(body))
+	}
+
+	tests := map[string]struct {
+		url            string
+		acceptEncoding string
+	}{
+		"short body":   {"/?short=true", "gzip"},
+		"no gzip":      {"/", "deflate"},
+		"gzip refused": {"/", "gzip;q=0"},
+		"no header":    {"/", ""},
+	}
+
+	for name, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.url, nil)
+		request.Header.Set("Accept-Encoding", test.acceptEncoding)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+
+		if recorder.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: response is compressed", name)
+		}
+
+		if recorder.Code != http.StatusCreated {
+			t.Errorf("%s: wrong status - want %d, got %d", name, http.StatusCreated, recorder.Code)
+		}
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	long := strings.Repeat("event ", MinSize)
+
+	handler := Gzip(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/event-stream")
+		writer.Write([]byte(long))
+		writer.(http.Flusher).Flush()
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+
+	if recorder.Header().Get("Content-Encoding") != "" || recorder.Body.String() != long {
+		t.Error("event stream is compressed")
+	}
+
+	if !recorder.Flushed {
+		t.Error("event stream isn't flushed")
+	}
+}
@@ -0,0 +1,417 @@
+// Package config loads settings of securities service from json file and environment variables
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultListenAddr is used if listen address is not set
+const DefaultListenAddr = "localhost:8080"
+
+// DefaultListConcurrency is used if list concurrency is not set
+const DefaultListConcurrency = 8
+
+// DefaultListCacheTTL is used if time to live (in seconds) of cached securities listing is not set
+const DefaultListCacheTTL = 60
+
+// DefaultMaxOpenConns is used if the maximum number of open MySQL connections is not set
+const DefaultMaxOpenConns = 50
+
+// DefaultMaxIdleConns is used if the maximum number of idle MySQL connections is not set
+const DefaultMaxIdleConns = 10
+
+// DefaultRequestTimeout is used if the maximum time (in seconds) of serving one http request is not set
+const DefaultRequestTimeout = 60
+
+// DefaultConnMaxLifetime is used if the maximum time (in seconds) a MySQL connection may be reused is not set
+const DefaultConnMaxLifetime = 300
+
+// DefaultAutoUpdateTime is used if the time of day (Moscow time) for scheduled update of last quotes is not set
+// Main trading session of Moscow Exchange is closed at 18:40
+const DefaultAutoUpdateTime = "19:00"
+
+// DefaultLogLevel is used if the level of logging is not set
+const DefaultLogLevel = "info"
+
+// DefaultRateLimit is used if the number of requests a minute of one client is not set
+const DefaultRateLimit = 600
+
+// DefaultRateBurst is used if the number of requests of one client at once is not set
+const DefaultRateBurst = 60
+
+// DefaultUpdateRateLimit is used if the number of requests a minute of one client which update quotes on Moscow Exchange is not set
+const DefaultUpdateRateLimit = 10
+
+// DefaultUpdateRateBurst is used if the number of requests of one client at once which update quotes on Moscow Exchange is not set
+const DefaultUpdateRateBurst = 5
+
+// DefaultCORSMethods is used if methods of cross-origin requests are not set (comma-separated)
+const DefaultCORSMethods = "GET,HEAD,POST,PUT,DELETE"
+
+// DefaultCORSHeaders is used if headers of cross-origin requests are not set (comma-separated)
+const DefaultCORSHeaders = "Content-Type,X-API-Key"
+
+// Config contains settings of securities service
+type Config struct {
+	HtmlDir         string
+	HttpPath        string
+	ListenAddr      string
+	Backend         string
+	MySQL           string
+	MainDB          string
+	TestDB          string
+	SQLiteFile      string
+	DemoData        bool
+	ReadOnly        bool
+	ListConcurrency int
+	DevMode         bool
+	ListCacheTTL    int      // seconds, negative value disables cache
+	MaxOpenConns    int      // negative value means no limit
+	MaxIdleConns    int      // negative value means idle connections are not kept
+	ConnMaxLifetime int      // seconds, negative value means connections are reused forever
+	VerifyOnAdd     bool     // check on Moscow Exchange that security is traded before adding it
+	AutoUpdate      bool     // update last quotes of all securities every trading day
+	AutoUpdateTime  string   // time of day (HH:MM, Moscow time) for scheduled update of last quotes
+	LogLevel        string   // the lowest level of logged messages - debug, info, warn or error
+	CORSOrigins     []string // origins (scheme://host[:port] or *) which may call json api from browsers, only the same origin if it's empty
+	CORSMethods     []string // methods of cross-origin requests
+	CORSHeaders     []string // request headers of cross-origin requests
+	APIKeys         []string // keys (X-API-Key header) which allow requests to change data, keys are not checked if it's empty
+	APIKeysForReads bool     // require API key for all requests of json api, not only for requests which change data
+	RateLimit       int      // requests a minute of one client (API key or IP address), negative value means no limit
+	RateBurst       int      // requests of one client at once
+	UpdateRateLimit int      // requests a minute of one client which update quotes or add securities on Moscow Exchange, negative value means no limit
+	UpdateRateBurst int      // requests of one client at once which update quotes or add securities on Moscow Exchange
+	RequestTimeout  int      // seconds, negative value means no time limit, streams are never limited
+}
+
+// envPrefix is the prefix of environment variables with settings
+const envPrefix = "SECURITIES_"
+
+// Load reads settings for the service from json file and environment variables
+// Environment variables (SECURITIES_HTML_DIR, SECURITIES_MYSQL etc) take precedence over the file, lists are comma-separated in them
+// The result is checked - all values required for the service must be set
+func Load(fileName string) (*Config, error) {
+	conf, err := read(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.HtmlDir == "" {
+		return nil, missingError("HtmlDir", "HTML_DIR")
+	}
+
+	if conf.HttpPath == "" {
+		return nil, missingError("HttpPath", "HTTP_PATH")
+	}
+
+	switch conf.Backend {
+	case "mysql":
+		if conf.MainDB == "" {
+			return nil, missingError("MainDB", "MAIN_DB")
+		}
+	case "sqlite":
+		if conf.SQLiteFile == "" {
+			return nil, missingError("SQLiteFile", "SQLITE_FILE")
+		}
+	}
+
+	return conf, nil
+}
+
+// LoadTest reads settings for database tests from json file and environment variables
+// The same environment variables as for Load are used, but only MySQL and TestDB values are required
+func LoadTest(fileName string) (*Config, error) {
+	conf, err := read(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.TestDB == "" {
+		return nil, missingError("TestDB", "TEST_DB")
+	}
+
+	return conf, nil
+}
+
+// read reads settings from json file (if the name is not empty), applies environment variables and default values and checks common values
+func read(fileName string) (*Config, error) {
+	conf := &Config{}
+
+	if fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("settings file not found: %w", err)
+		}
+
+		err = json.Unmarshal(data, conf)
+		if err != nil {
+			return nil, fmt.Errorf("wrong settings file %s: %w", fileName, err)
+		}
+	}
+
+	err := conf.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	conf.Backend = strings.ToLower(conf.Backend)
+	if conf.Backend == "" {
+		conf.Backend = "mysql"
+	}
+
+	switch conf.Backend {
+	case "mysql":
+		if conf.MySQL == "" {
+			return nil, missingError("MySQL", "MYSQL")
+		}
+	case "sqlite":
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", conf.Backend)
+	}
+
+	if conf.ListenAddr == "" {
+		conf.ListenAddr = DefaultListenAddr
+	}
+
+	err = checkListenAddr(conf.ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.ListConcurrency <= 0 {
+		conf.ListConcurrency = DefaultListConcurrency
+	}
+
+	if conf.AutoUpdateTime == "" {
+		conf.AutoUpdateTime = DefaultAutoUpdateTime
+	}
+
+	_, err = time.Parse("15:04", conf.AutoUpdateTime)
+	if err != nil {
+		return nil, fmt.Errorf("wrong time of scheduled update %s: %w", conf.AutoUpdateTime, err)
+	}
+
+	if conf.LogLevel == "" {
+		conf.LogLevel = DefaultLogLevel
+	}
+
+	_, err = ParseLogLevel(conf.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, origin := range conf.CORSOrigins {
+		err = checkOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.APIKeysForReads && len(conf.APIKeys) == 0 {
+		return nil, errors.New("API keys are required for reads, but no keys are set")
+	}
+
+	if len(conf.CORSMethods) == 0 {
+		conf.CORSMethods = splitList(DefaultCORSMethods)
+	}
+
+	if len(conf.CORSHeaders) == 0 {
+		conf.CORSHeaders = splitList(DefaultCORSHeaders)
+	}
+
+	if conf.ListCacheTTL == 0 {
+		conf.ListCacheTTL = DefaultListCacheTTL
+	}
+
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = DefaultRequestTimeout
+	}
+
+	// after loading 0 means no limit for rates as for connection pool settings
+	rateValues := map[*int]int{
+		&conf.RateLimit:       DefaultRateLimit,
+		&conf.UpdateRateLimit: DefaultUpdateRateLimit,
+	}
+
+	for value, def := range rateValues {
+		switch {
+		case *value == 0:
+			*value = def
+		case *value < 0:
+			*value = 0
+		}
+	}
+
+	if conf.RateBurst <= 0 {
+		conf.RateBurst = DefaultRateBurst
+	}
+
+	if conf.UpdateRateBurst <= 0 {
+		conf.UpdateRateBurst = DefaultUpdateRateBurst
+	}
+
+	// after loading 0 means no limit for connection pool settings as for database/sql
+	poolValues := map[*int]int{
+		&conf.MaxOpenConns:    DefaultMaxOpenConns,
+		&conf.MaxIdleConns:    DefaultMaxIdleConns,
+		&conf.ConnMaxLifetime: DefaultConnMaxLifetime,
+	}
+
+	for value, def := range poolValues {
+		switch {
+		case *value == 0:
+			*value = def
+		case *value < 0:
+			*value = 0
+		}
+	}
+
+	return conf, nil
+}
+
+// applyEnv sets values from environment variables
+func (c *Config) applyEnv() error {
+	strValues := map[string]*string{
+		"HTML_DIR":         &c.HtmlDir,
+		"HTTP_PATH":        &c.HttpPath,
+		"LISTEN_ADDR":      &c.ListenAddr,
+		"BACKEND":          &c.Backend,
+		"MYSQL":            &c.MySQL,
+		"MAIN_DB":          &c.MainDB,
+		"TEST_DB":          &c.TestDB,
+		"SQLITE_FILE":      &c.SQLiteFile,
+		"AUTO_UPDATE_TIME": &c.AutoUpdateTime,
+		"LOG_LEVEL":        &c.LogLevel,
+	}
+
+	for name, value := range strValues {
+		if env, ok := os.LookupEnv(envPrefix + name); ok {
+			*value = env
+		}
+	}
+
+	boolValues := map[string]*bool{
+		"DEMO_DATA":          &c.DemoData,
+		"READ_ONLY":          &c.ReadOnly,
+		"DEV_MODE":           &c.DevMode,
+		"VERIFY_ON_ADD":      &c.VerifyOnAdd,
+		"AUTO_UPDATE":        &c.AutoUpdate,
+		"API_KEYS_FOR_READS": &c.APIKeysForReads,
+	}
+
+	for name, value := range boolValues {
+		if env, ok := os.LookupEnv(envPrefix + name); ok {
+			b, err := strconv.ParseBool(env)
+			if err != nil {
+				return fmt.Errorf("wrong value of %s%s: %s", envPrefix, name, env)
+			}
+			*value = b
+		}
+	}
+
+	intValues := map[string]*int{
+		"LIST_CONCURRENCY":  &c.ListConcurrency,
+		"LIST_CACHE_TTL":    &c.ListCacheTTL,
+		"MAX_OPEN_CONNS":    &c.MaxOpenConns,
+		"MAX_IDLE_CONNS":    &c.MaxIdleConns,
+		"CONN_MAX_LIFETIME": &c.ConnMaxLifetime,
+		"RATE_LIMIT":        &c.RateLimit,
+		"RATE_BURST":        &c.RateBurst,
+		"UPDATE_RATE_LIMIT": &c.UpdateRateLimit,
+		"UPDATE_RATE_BURST": &c.UpdateRateBurst,
+		"REQUEST_TIMEOUT":   &c.RequestTimeout,
+	}
+
+	for name, value := range intValues {
+		if env, ok := os.LookupEnv(envPrefix + name); ok {
+			n, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("wrong value of %s%s: %s", envPrefix, name, env)
+			}
+			*value = n
+		}
+	}
+
+	listValues := map[string]*[]string{
+		"CORS_ORIGINS": &c.CORSOrigins,
+		"CORS_METHODS": &c.CORSMethods,
+		"CORS_HEADERS": &c.CORSHeaders,
+		"API_KEYS":     &c.APIKeys,
+	}
+
+	for name, value := range listValues {
+		if env, ok := os.LookupEnv(envPrefix + name); ok {
+			*value = splitList(env)
+		}
+	}
+
+	return nil
+}
+
+// splitList returns non-empty values of comma-separated list without spaces around them
+func splitList(list string) []string {
+	var res []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			res = append(res, value)
+		}
+	}
+
+	return res
+}
+
+// ParseLogLevel converts the name of logging level (debug, info, warn or error in any case) to slog.Level
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	err := level.UnmarshalText([]byte(name))
+	if err != nil {
+		return 0, fmt.Errorf("wrong log level %s", name)
+	}
+
+	return level, nil
+}
+
+// checkListenAddr checks that listen address is host:port with correct port
+func checkListenAddr(addr string) error {
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("wrong listen address %s: %w", addr, err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("wrong port in listen address %s", addr)
+	}
+
+	return nil
+}
+
+// checkOrigin checks that allowed origin is * or http(s) URL with host and without path
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		return fmt.Errorf("wrong CORS origin %s", origin)
+	}
+
+	return nil
+}
+
+// missingError returns error about missing required setting
+func missingError(name string, envName string) error {
+	return fmt.Errorf("required setting %s is not set (neither in settings file nor in %s%s environment variable)", name, envPrefix, envName)
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes settings file to temporary directory and returns its name
+func writeConfig(t *testing.T, data string) string {
+	fileName := filepath.Join(t.TempDir(), "conf.json")
+
+	err := os.WriteFile(fileName, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fileName
+}
+
+func TestLoad(t *testing.T) {
+	fileName := writeConfig(t, `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "MySQL": "root:pass@tcp(127.0.0.1:3306)", "MainDB": "securities", "DemoData": true}`)
+
+	conf, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Backend != "mysql" || conf.ListenAddr != DefaultListenAddr || conf.ListConcurrency != DefaultListConcurrency || conf.ListCacheTTL != DefaultListCacheTTL {
+		t.Errorf("wrong default values - got %s, %s, %d, %d", conf.Backend, conf.ListenAddr, conf.ListConcurrency, conf.ListCacheTTL)
+	}
+
+	if conf.MaxOpenConns != DefaultMaxOpenConns || conf.MaxIdleConns != DefaultMaxIdleConns || conf.ConnMaxLifetime != DefaultConnMaxLifetime {
+		t.Errorf("wrong default pool values - got %d, %d, %d", conf.MaxOpenConns, conf.MaxIdleConns, conf.ConnMaxLifetime)
+	}
+
+	if conf.AutoUpdate || conf.AutoUpdateTime != DefaultAutoUpdateTime {
+		t.Errorf("wrong default scheduled update values - got %v, %s", conf.AutoUpdate, conf.AutoUpdateTime)
+	}
+
+	if conf.LogLevel != DefaultLogLevel {
+		t.Errorf("wrong default log level - want %s, got %s", DefaultLogLevel, conf.LogLevel)
+	}
+
+	if conf.RequestTimeout != DefaultRequestTimeout {
+		t.Errorf("wrong default request timeout - want %d, got %d", DefaultRequestTimeout, conf.RequestTimeout)
+	}
+
+	if conf.RateLimit != DefaultRateLimit || conf.RateBurst != DefaultRateBurst || conf.UpdateRateLimit != DefaultUpdateRateLimit || conf.UpdateRateBurst != DefaultUpdateRateBurst {
+		t.Errorf("wrong default rate limits - got %d, %d, %d, %d", conf.RateLimit, conf.RateBurst, conf.UpdateRateLimit, conf.UpdateRateBurst)
+	}
+
+	if len(conf.CORSOrigins) != 0 || strings.Join(conf.CORSMethods, ",") != DefaultCORSMethods || strings.Join(conf.CORSHeaders, ",") != DefaultCORSHeaders {
+		t.Errorf("wrong default CORS values - got %v, %v, %v", conf.CORSOrigins, conf.CORSMethods, conf.CORSHeaders)
+	}
+
+	if conf.MainDB != "securities" || !conf.DemoData {
+		t.Errorf("wrong values from file - got %s, %v", conf.MainDB, conf.DemoData)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	fileName := writeConfig(t, `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "MySQL": "root:pass@tcp(127.0.0.1:3306)", "MainDB": "securities", "DemoData": true}`)
+
+	t.Setenv("SECURITIES_MAIN_DB", "securities_env")
+	t.Setenv("SECURITIES_DEMO_DATA", "false")
+	t.Setenv("SECURITIES_LISTEN_ADDR", "0.0.0.0:9090")
+	t.Setenv("SECURITIES_LIST_CONCURRENCY", "3")
+	t.Setenv("SECURITIES_DEV_MODE", "true")
+	t.Setenv("SECURITIES_LIST_CACHE_TTL", "-1")
+	t.Setenv("SECURITIES_MAX_OPEN_CONNS", "-1")
+	t.Setenv("SECURITIES_MAX_IDLE_CONNS", "5")
+	t.Setenv("SECURITIES_VERIFY_ON_ADD", "true")
+	t.Setenv("SECURITIES_AUTO_UPDATE", "true")
+	t.Setenv("SECURITIES_AUTO_UPDATE_TIME", "20:30")
+	t.Setenv("SECURITIES_LOG_LEVEL", "DEBUG")
+	t.Setenv("SECURITIES_CORS_ORIGINS", "https://ui.example.com, http://localhost:3000")
+	t.Setenv("SECURITIES_API_KEYS", "first,second")
+	t.Setenv("SECURITIES_RATE_LIMIT", "-1")
+	t.Setenv("SECURITIES_REQUEST_TIMEOUT", "15")
+	t.Setenv("SECURITIES_UPDATE_RATE_LIMIT", "2")
+	t.Setenv("SECURITIES_API_KEYS_FOR_READS", "true")
+
+	conf, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.MainDB != "securities_env" || conf.DemoData || conf.ListenAddr != "0.0.0.0:9090" || conf.ListConcurrency != 3 || !conf.DevMode || conf.ListCacheTTL != -1 {
+		t.Errorf("environment variables don't take precedence - got %s, %v, %s, %d, %v, %d", conf.MainDB, conf.DemoData, conf.ListenAddr, conf.ListConcurrency, conf.DevMode, conf.ListCacheTTL)
+	}
+
+	if conf.MaxOpenConns != 0 || conf.MaxIdleConns != 5 || !conf.VerifyOnAdd {
+		t.Errorf("wrong pool and verification values from environment - want 0 (no limit), 5, true, got %d, %d, %v", conf.MaxOpenConns, conf.MaxIdleConns, conf.VerifyOnAdd)
+	}
+
+	if !conf.AutoUpdate || conf.AutoUpdateTime != "20:30" {
+		t.Errorf("wrong scheduled update values from environment - want true, 20:30, got %v, %s", conf.AutoUpdate, conf.AutoUpdateTime)
+	}
+
+	if len(conf.CORSOrigins) != 2 || conf.CORSOrigins[1] != "http://localhost:3000" {
+		t.Errorf("wrong CORS origins from environment - got %v", conf.CORSOrigins)
+	}
+
+	if conf.RequestTimeout != 15 {
+		t.Errorf("wrong request timeout from environment - want 15, got %d", conf.RequestTimeout)
+	}
+
+	if conf.RateLimit != 0 || conf.UpdateRateLimit != 2 {
+		t.Errorf("wrong rate limits from environment - want 0 (no limit), 2, got %d, %d", conf.RateLimit, conf.UpdateRateLimit)
+	}
+
+	if len(conf.APIKeys) != 2 || conf.APIKeys[0] != "first" || !conf.APIKeysForReads {
+		t.Errorf("wrong API keys from environment - got %v, %v", conf.APIKeys, conf.APIKeysForReads)
+	}
+
+	level, err := ParseLogLevel(conf.LogLevel)
+	if err != nil || level != slog.LevelDebug {
+		t.Errorf("wrong log level from environment - want %v, got %v (%v)", slog.LevelDebug, level, err)
+	}
+
+	// only environment variables, no file
+	t.Setenv("SECURITIES_HTML_DIR", "html")
+	t.Setenv("SECURITIES_HTTP_PATH", "http://localhost:9090")
+	t.Setenv("SECURITIES_BACKEND", "SQLite")
+	t.Setenv("SECURITIES_SQLITE_FILE", "securities.db")
+
+	conf, err = Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Backend != "sqlite" || conf.SQLiteFile != "securities.db" {
+		t.Errorf("wrong values from environment - got %s, %s", conf.Backend, conf.SQLiteFile)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]string{
+		"no MySQL":       `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "MainDB": "securities"}`,
+		"no MainDB":      `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "MySQL": "root:pass@tcp(127.0.0.1:3306)"}`,
+		"no HtmlDir":     `{"HttpPath": "http://localhost:8080", "MySQL": "root:pass@tcp(127.0.0.1:3306)", "MainDB": "securities"}`,
+		"no SQLite file": `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite"}`,
+		"wrong backend":  `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "oracle"}`,
+		"wrong address":  `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "ListenAddr": "localhost"}`,
+		"wrong port":     `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "ListenAddr": ":99999"}`,
+		"wrong json":     `{"HtmlDir": `,
+		"wrong update":   `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "AutoUpdateTime": "7pm"}`,
+		"wrong log":      `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "LogLevel": "verbose"}`,
+		"no API keys":    `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "APIKeysForReads": true}`,
+		"wrong origin":   `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db", "CORSOrigins": ["https://ui.example.com/app"]}`,
+	}
+
+	for name, data := range tests {
+		_, err := Load(writeConfig(t, data))
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	t.Setenv("SECURITIES_READ_ONLY", "maybe")
+	_, err := Load(writeConfig(t, `{"HtmlDir": "src/html", "HttpPath": "http://localhost:8080", "Backend": "sqlite", "SQLiteFile": "s.db"}`))
+	if err == nil {
+		t.Error("no error for wrong boolean environment variable")
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "absent.json"))
+	if err == nil {
+		t.Error("no error for absent settings file")
+	}
+}
+
+func TestLoadTest(t *testing.T) {
+	conf, err := LoadTest(writeConfig(t, `{"MySQL": "root:pass@tcp(127.0.0.1:3306)", "TestDB": "securities_test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.TestDB != "securities_test" {
+		t.Errorf("wrong test database - want securities_test, got %s", conf.TestDB)
+	}
+
+	_, err = LoadTest(writeConfig(t, `{"MySQL": "root:pass@tcp(127.0.0.1:3306)"}`))
+	if err == nil {
+		t.Error("no error without test database")
+	}
+}
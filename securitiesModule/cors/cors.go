@@ -0,0 +1,101 @@
+// Package cors contains http middleware which allows cross-origin requests from the given origins (CORS)
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxAge is the time (in seconds) browsers may keep the result of preflight request
+const maxAge = 600
+
+// Policy tells which origins may send cross-origin requests and which methods and headers they may use
+// Policy without origins allows only same-origin requests, it doesn't add any headers
+type Policy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	headers   string
+}
+
+// New creates a new policy for the given origins (scheme://host[:port]), "*" allows any origin
+func New(origins []string, methods []string, headers []string) *Policy {
+	p := &Policy{
+		origins: make(map[string]bool, len(origins)),
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+	}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+
+		p.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return p
+}
+
+// Allowed checks if cross-origin requests from the origin are allowed
+func (p *Policy) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	return p.anyOrigin || p.origins[strings.ToLower(origin)]
+}
+
+// enabled checks if the policy allows any cross-origin requests
+func (p *Policy) enabled() bool {
+	return p.anyOrigin || len(p.origins) > 0
+}
+
+// Handler adds CORS headers to responses of handler for allowed origins and answers preflight requests itself
+// Preflight requests from other origins are forbidden, other requests are passed to handler without CORS headers, so browsers block them
+func (p *Policy) Handler(handler http.HandlerFunc) http.HandlerFunc {
+	if !p.enabled() {
+		return handler
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		preflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+
+		header := writer.Header()
+		header.Add("Vary", "Origin")
+
+		if !p.Allowed(origin) {
+			if preflight {
+				writer.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			handler(writer, request)
+			return
+		}
+
+		if p.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			handler(writer, request)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", p.methods)
+		if p.headers != "" {
+			header.Set("Access-Control-Allow-Headers", p.headers)
+		}
+		header.Set("Access-Control-Max-Age", strconv.Itoa(maxAge))
+
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,88 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	called := false
+	handler := func(writer http.ResponseWriter, request *http.Request) {
+		called = true
+		writer.Write([]byte("ok"))
+	}
+
+	policy := New([]string{"https://ui.example.com/"}, []string{http.MethodGet, http.MethodPost}, []string{"Content-Type"})
+	wrapped := policy.Handler(handler)
+
+	// preflight of allowed origin is answered without calling handler
+	request := httptest.NewRequest(http.MethodOptions, "/securities/getSecurityData", nil)
+	request.Header.Set("Origin", "https://UI.example.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	recorder := httptest.NewRecorder()
+	wrapped(recorder, request)
+
+	if called || recorder.Code != http.StatusNoContent {
+		t.Errorf("wrong preflight answer - want %d without handler, got %d (handler called: %v)", http.StatusNoContent, recorder.Code, called)
+	}
+
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "https://UI.example.com" {
+		t.Errorf("wrong allowed origin - got %q", got)
+	}
+
+	if got := recorder.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("wrong allowed methods - want GET, POST, got %q", got)
+	}
+
+	// request of allowed origin gets the header
+	request = httptest.NewRequest(http.MethodGet, "/securities/getSecurityData", nil)
+	request.Header.Set("Origin", "https://ui.example.com")
+	recorder = httptest.NewRecorder()
+	wrapped(recorder, request)
+
+	if !called || recorder.Header().Get("Access-Control-Allow-Origin") != "https://ui.example.com" {
+		t.Error("request of allowed origin isn't passed to handler with CORS header")
+	}
+
+	// request of other origin is passed without the header, its preflight is forbidden
+	called = false
+	request.Header.Set("Origin", "https://evil.example.com")
+	recorder = httptest.NewRecorder()
+	wrapped(recorder, request)
+
+	if !called || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("request of other origin has CORS header")
+	}
+
+	request = httptest.NewRequest(http.MethodOptions, "/securities/getSecurityData", nil)
+	request.Header.Set("Origin", "https://evil.example.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	recorder = httptest.NewRecorder()
+	wrapped(recorder, request)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("wrong status of preflight of other origin - want %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
+
+func TestAnyOrigin(t *testing.T) {
+	wrapped := New([]string{"*"}, []string{http.MethodGet}, nil).Handler(func(writer http.ResponseWriter, request *http.Request) {})
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Origin", "https://any.example.com")
+	recorder := httptest.NewRecorder()
+	wrapped(recorder, request)
+
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("wrong allowed origin - want *, got %q", got)
+	}
+
+	// same-origin policy doesn't change responses
+	recorder = httptest.NewRecorder()
+	New(nil, []string{http.MethodGet}, nil).Handler(func(writer http.ResponseWriter, request *http.Request) {})(recorder, request)
+
+	if len(recorder.Header()) != 0 {
+		t.Errorf("same-origin policy adds headers: %v", recorder.Header())
+	}
+}
@@ -0,0 +1,137 @@
+// Package jobs keeps long background jobs in memory, so clients can check their progress and get the result later
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ItemError is the error of one item of job, job goes on with other items
+type ItemError struct {
+	Item  string
+	Error string
+}
+
+// State is a copy of job state at some moment
+type State[R any] struct {
+	Id        int64
+	Done      bool
+	Total     int
+	Processed int
+	Errors    []ItemError
+	Result    R     // it's set when job is done
+	Err       error // error of the whole job, it's set when job is done
+	Started   time.Time
+	Finished  time.Time
+}
+
+// Job is a background job which processes some number of items and gives the result of type R
+type Job[R any] struct {
+	mu    sync.Mutex // guards state
+	state State[R]
+}
+
+// Step marks one more item as processed, the error of the item is kept if it's not nil
+// It's safe to call Step from several goroutines at once
+func (j *Job[R]) Step(item string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.state.Processed++
+	if err != nil {
+		j.state.Errors = append(j.state.Errors, ItemError{Item: item, Error: err.Error()})
+	}
+}
+
+// State returns the copy of the current job state
+func (j *Job[R]) State() State[R] {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	res := j.state
+	res.Errors = make([]ItemError, len(j.state.Errors))
+	copy(res.Errors, j.state.Errors)
+
+	return res
+}
+
+// finish sets the result of job
+func (j *Job[R]) finish(result R, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.state.Done = true
+	j.state.Result = result
+	j.state.Err = err
+	j.state.Finished = time.Now()
+}
+
+// Manager runs jobs and keeps them until some time after they are done
+type Manager[R any] struct {
+	ctx context.Context
+	ttl time.Duration
+	wg  sync.WaitGroup
+
+	mu     sync.Mutex // guards the fields below
+	lastId int64
+	jobs   map[int64]*Job[R]
+}
+
+// New creates a new manager of jobs, finished jobs are kept for ttl
+// Jobs get the given context, so they are cancelled with it
+func New[R any](ctx context.Context, ttl time.Duration) *Manager[R] {
+	return &Manager[R]{
+		ctx:  ctx,
+		ttl:  ttl,
+		jobs: make(map[int64]*Job[R]),
+	}
+}
+
+// Start runs the job of total items in background and returns it at once
+// The result and the error of run are kept in the job when it returns
+func (m *Manager[R]) Start(total int, run func(ctx context.Context, job *Job[R]) (R, error)) *Job[R] {
+	m.mu.Lock()
+	m.removeExpired()
+
+	m.lastId++
+	job := &Job[R]{state: State[R]{Id: m.lastId, Total: total, Errors: []ItemError{}, Started: time.Now()}}
+	m.jobs[job.state.Id] = job
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		job.finish(run(m.ctx, job))
+	}()
+
+	return job
+}
+
+// Get returns the job with the given id, false is returned if there is no such job or it's expired
+func (m *Manager[R]) Get(id int64) (*Job[R], bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeExpired()
+
+	job, ok := m.jobs[id]
+
+	return job, ok
+}
+
+// Wait waits for all running jobs to be done
+func (m *Manager[R]) Wait() {
+	m.wg.Wait()
+}
+
+// removeExpired removes jobs finished more than ttl ago, m.mu must be locked
+func (m *Manager[R]) removeExpired() {
+	for id, job := range m.jobs {
+		state := job.State()
+		if state.Done && time.Since(state.Finished) > m.ttl {
+			delete(m.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJob(t *testing.T) {
+	m := New[int](context.Background(), time.Minute)
+
+	release := make(chan struct{})
+	job := m.Start(3, func(ctx context.Context, job *Job[int]) (int, error) {
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				var err error
+				if i == 1 {
+					err = errors.New("wrong item")
+				}
+				job.Step(fmt.Sprint(i), err)
+			}(i)
+		}
+		wg.Wait()
+
+		<-release
+		return 42, nil
+	})
+
+	got, ok := m.Get(job.State().Id)
+	if !ok || got != job {
+		t.Fatal("started job is not found")
+	}
+
+	// job isn't done until run returns
+	for job.State().Processed < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	state := job.State()
+	if state.Done || state.Total != 3 || len(state.Errors) != 1 || state.Errors[0].Item != "1" {
+		t.Errorf("wrong state of running job - got %+v", state)
+	}
+
+	close(release)
+	m.Wait()
+
+	state = job.State()
+	if !state.Done || state.Result != 42 || state.Err != nil || state.Finished.IsZero() {
+		t.Errorf("wrong state of done job - got %+v", state)
+	}
+
+	if _, ok := m.Get(state.Id + 1); ok {
+		t.Error("absent job is found")
+	}
+}
+
+func TestExpiredJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := New[int](ctx, time.Millisecond)
+
+	// jobs get the context of manager
+	job := m.Start(1, func(ctx context.Context, job *Job[int]) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := m.Get(job.State().Id); !ok {
+		t.Fatal("running job is expired")
+	}
+
+	cancel()
+	m.Wait()
+
+	if !errors.Is(job.State().Err, context.Canceled) {
+		t.Errorf("wrong error of cancelled job - want %v, got %v", context.Canceled, job.State().Err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := m.Get(job.State().Id); ok {
+		t.Error("finished job isn't expired")
+	}
+}
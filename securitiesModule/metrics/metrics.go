@@ -0,0 +1,164 @@
+// Package metrics contains Prometheus metrics of Moscow Exchange requests, storage operations and http handlers
+// Metrics are registered in the default Prometheus registry, so promhttp.Handler() exposes them
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	moexRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "securities_moex_requests_total",
+		Help: "Number of Moscow Exchange requests (every attempt) by http status, error is for requests without answer.",
+	}, []string{"status"})
+
+	moexRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "securities_moex_request_duration_seconds",
+		Help:    "Latency of Moscow Exchange requests (every attempt).",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	storageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "securities_storage_operation_duration_seconds",
+		Help:    "Latency of storage operations by operation, operations which update quotes include Moscow Exchange requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "securities_http_requests_total",
+		Help: "Number of http requests by handler and status code.",
+	}, []string{"handler", "code"})
+
+	httpErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "securities_http_errors_total",
+		Help: "Number of http requests answered with 4xx or 5xx status by handler.",
+	}, []string{"handler"})
+)
+
+func init() {
+	prometheus.MustRegister(moexRequests, moexRequestDuration, storageDuration, httpRequests, httpErrors)
+}
+
+// ObserveMoexRequest counts Moscow Exchange request which began at start, status is 0 if there is no answer
+func ObserveMoexRequest(start time.Time, status int) {
+	moexRequestDuration.Observe(time.Since(start).Seconds())
+
+	label := "error"
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	moexRequests.WithLabelValues(label).Inc()
+}
+
+// ObserveStorage observes the latency of storage operation which began at start, it's called with defer
+func ObserveStorage(operation string, start time.Time) {
+	storageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// StorageStats gives the number of stored securities and quotes
+type StorageStats func() (securities int, quotes int, err error)
+
+var (
+	securitiesDesc = prometheus.NewDesc("securities_stored_securities", "Number of stored securities (not deleted).", nil, nil)
+	quotesDesc     = prometheus.NewDesc("securities_stored_quotes", "Number of stored quotes of all intervals.", nil, nil)
+)
+
+// storageCollector reports the number of stored securities and quotes on every scrape
+type storageCollector struct {
+	stats      StorageStats
+	securities *prometheus.Desc
+	quotes     *prometheus.Desc
+}
+
+// Describe sends descriptions of metrics
+func (c *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.securities
+	ch <- c.quotes
+}
+
+// Collect gets stats from storage and sends metrics, the error is sent instead if storage fails
+func (c *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	securities, quotes, err := c.stats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.securities, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.securities, prometheus.GaugeValue, float64(securities))
+	ch <- prometheus.MustNewConstMetric(c.quotes, prometheus.GaugeValue, float64(quotes))
+}
+
+// RegisterStorageStats registers metrics of the number of stored securities and quotes which are got from stats on every scrape
+func RegisterStorageStats(stats StorageStats) error {
+	return prometheus.Register(&storageCollector{
+		stats:      stats,
+		securities: securitiesDesc,
+		quotes:     quotesDesc,
+	})
+}
+
+// statusRecorder keeps the status code written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader keeps the status code and writes it
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the body, status is 200 if it wasn't written before
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client if the original writer can do it
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets handler take over the connection if the original writer can do it
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection can't be hijacked")
+	}
+
+	// the status of taken over connection is written by handler itself
+	r.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// InstrumentHandler counts requests of handler by status codes and its errors
+func InstrumentHandler(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: writer}
+		handler(recorder, request)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(name, strconv.Itoa(status)).Inc()
+		if status >= http.StatusBadRequest {
+			httpErrors.WithLabelValues(name).Inc()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentHandler(t *testing.T) {
+	handler := InstrumentHandler("test", func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("fail") == "true" {
+			http.Error(writer, "wrong request", http.StatusBadRequest)
+			return
+		}
+
+		writer.Write([]byte("ok"))
+	})
+
+	for _, url := range []string{"/", "/", "/?fail=true"} {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("test", "200")); got != 2 {
+		t.Errorf("wrong number of successful requests - want 2, got %f", got)
+	}
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("test", "400")); got != 1 {
+		t.Errorf("wrong number of bad requests - want 1, got %f", got)
+	}
+
+	if got := testutil.ToFloat64(httpErrors.WithLabelValues("test")); got != 1 {
+		t.Errorf("wrong number of errors - want 1, got %f", got)
+	}
+}
+
+func TestObserveStorage(t *testing.T) {
+	ObserveStorage("TestOperation", time.Now())
+
+	if got := testutil.CollectAndCount(storageDuration, "securities_storage_operation_duration_seconds"); got == 0 {
+		t.Error("storage operations are not observed")
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	collector := &storageCollector{
+		stats: func() (int, int, error) {
+			return 3, 100, nil
+		},
+		securities: securitiesDesc,
+		quotes:     quotesDesc,
+	}
+
+	if got := testutil.CollectAndCount(collector); got != 2 {
+		t.Errorf("wrong number of storage metrics - want 2, got %d", got)
+	}
+}
@@ -0,0 +1,144 @@
+// Package ratelimit contains http middleware which limits the rate of requests of every client
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTTL is the time after which limiters of clients without requests are forgotten
+const idleTTL = 10 * time.Minute
+
+// client is the limiter of one client and the time of its last request
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter limits the rate of requests of every client, clients are told apart by the key function
+// Requests with empty key are not limited
+type Limiter struct {
+	limit rate.Limit
+	burst int
+	key   func(*http.Request) string
+
+	mu        sync.Mutex // guards the fields below
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+// New creates a new limiter which lets every client send perMinute requests a minute with bursts up to burst requests
+// Requests are not limited if perMinute isn't positive
+func New(perMinute int, burst int, key func(*http.Request) string) *Limiter {
+	limit := rate.Inf
+	if perMinute > 0 {
+		limit = rate.Limit(float64(perMinute) / 60)
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		limit:     limit,
+		burst:     burst,
+		key:       key,
+		clients:   make(map[string]*client),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow checks if the request may be served now, otherwise it returns the time after which the client may repeat it
+func (l *Limiter) Allow(request *http.Request) (bool, time.Duration) {
+	if l.limit == rate.Inf {
+		return true, 0
+	}
+
+	key := l.key(request)
+	if key == "" {
+		return true, 0
+	}
+
+	now := time.Now()
+	reservation := l.clientLimiter(key, now).ReserveN(now, 1)
+
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		// the request isn't served, so it doesn't take the token
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// clientLimiter returns the limiter of client with the given key, limiters of idle clients are forgotten from time to time
+func (l *Limiter) clientLimiter(key string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > idleTTL {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > idleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+
+	return c.limiter
+}
+
+// Reject sends 429 error with json body {"error": "..."} and Retry-After header (whole seconds)
+func Reject(writer http.ResponseWriter, retryAfter time.Duration) {
+	res, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{Error: "too many requests"})
+
+	writer.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(retryAfter)))
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusTooManyRequests)
+	writer.Write(res)
+}
+
+// RetryAfterSeconds returns the delay in whole seconds (at least one) for Retry-After header
+func RetryAfterSeconds(retryAfter time.Duration) int {
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds())))
+}
+
+// Handler rejects requests of clients which exceed the rate with 429 error
+func (l *Limiter) Handler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ok, retryAfter := l.Allow(request)
+		if !ok {
+			Reject(writer, retryAfter)
+			return
+		}
+
+		handler(writer, request)
+	}
+}
+
+// RemoteIP returns IP address of the client which sent the request
+func RemoteIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
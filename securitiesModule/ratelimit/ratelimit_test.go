@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	// clients are told apart by the header, requests without it are not limited
+	limiter := New(60, 2, func(request *http.Request) string {
+		return request.Header.Get("Client")
+	})
+
+	handler := limiter.Handler(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("ok"))
+	})
+
+	send := func(clientName string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if clientName != "" {
+			request.Header.Set("Client", clientName)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if recorder := send("first"); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d within burst is rejected with status %d", i+1, recorder.Code)
+		}
+	}
+
+	recorder := send("first")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("wrong status of request over the limit - want %d, got %d", http.StatusTooManyRequests, recorder.Code)
+	}
+
+	// one request a second is allowed, so the client may repeat the request in a second
+	if got := recorder.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("wrong Retry-After - want 1, got %q", got)
+	}
+
+	if recorder := send("second"); recorder.Code != http.StatusOK {
+		t.Errorf("request of other client is rejected with status %d", recorder.Code)
+	}
+
+	for i := 0; i < 5; i++ {
+		if recorder := send(""); recorder.Code != http.StatusOK {
+			t.Fatalf("request without key is rejected with status %d", recorder.Code)
+		}
+	}
+}
+
+func TestNoLimit(t *testing.T) {
+	limiter := New(0, 1, RemoteIP)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 10; i++ {
+		if ok, _ := limiter.Allow(request); !ok {
+			t.Fatal("request is rejected without limit")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package retry contains the loop which repeats failed attempts of an operation with exponential backoff
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Do calls attempt (not more than maxAttempts times) until it succeeds or fails with an error which can't be retried
+// attempt returns true with its error if it failed but may be retried
+// The delay before the second attempt is baseDelay, every next delay is twice as long plus random jitter up to its half,
+// so clients retrying at the same time don't come back at once
+// onRetry (if it's set) is called after every failed attempt which may be retried, the number of attempt starts from 1
+// The error of the last attempt is returned, or the context error if the context is done while waiting
+func Do(ctx context.Context, maxAttempts int, baseDelay time.Duration, attempt func() (bool, error), onRetry func(n int, err error)) error {
+	var err error
+
+	for n := 0; n < maxAttempts; n++ {
+		if n > 0 {
+			delay := baseDelay << (n - 1)
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		var again bool
+		again, err = attempt()
+		if err == nil || !again {
+			return err
+		}
+
+		if onRetry != nil {
+			onRetry(n+1, err)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,60 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	calls, retries := 0, 0
+	err := Do(context.Background(), 3, time.Millisecond, func() (bool, error) {
+		calls++
+		if calls < 3 {
+			return true, errors.New("temporary")
+		}
+		return false, nil
+	}, func(n int, err error) {
+		retries++
+	})
+
+	if err != nil || calls != 3 || retries != 2 {
+		t.Errorf("wrong result of successful third attempt - want nil after 3 calls and 2 retries, got %v after %d calls and %d retries", err, calls, retries)
+	}
+
+	calls = 0
+	err = Do(context.Background(), 3, time.Millisecond, func() (bool, error) {
+		calls++
+		return true, errors.New("temporary")
+	}, nil)
+
+	if err == nil || calls != 3 {
+		t.Errorf("wrong result of failed attempts - want error after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = Do(context.Background(), 3, time.Millisecond, func() (bool, error) {
+		calls++
+		return false, errors.New("permanent")
+	}, nil)
+
+	if err == nil || calls != 1 {
+		t.Errorf("wrong result of error which can't be retried - want error after 1 call, got %v after %d calls", err, calls)
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := Do(ctx, 3, time.Hour, func() (bool, error) {
+		calls++
+		cancel()
+		return true, errors.New("temporary")
+	}, nil)
+
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("wrong result of cancelled waiting - want context.Canceled after 1 call, got %v after %d calls", err, calls)
+	}
+}
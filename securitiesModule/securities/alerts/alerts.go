@@ -0,0 +1,190 @@
+// Package alerts contains price alerts of securities and the check of alerts by last quotes
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"securitiesModule/securities"
+	"strings"
+	"time"
+)
+
+// ErrAlertNotExist is returned if there is no alert with the given id in storage
+var ErrAlertNotExist = errors.New("alert does not exist")
+
+// Direction tells on which side of the threshold price alert fires
+type Direction string
+
+const (
+	Above Direction = "above" // alert fires when close price is at or above the threshold
+	Below Direction = "below" // alert fires when close price is at or below the threshold
+)
+
+// GetDirectionFromString returns direction by its name, empty direction is returned for unknown names
+func GetDirectionFromString(name string) Direction {
+	switch Direction(strings.ToLower(name)) {
+	case Above:
+		return Above
+	case Below:
+		return Below
+	default:
+		return ""
+	}
+}
+
+// Alert is a rule to notice that close price of security crosses the threshold
+// Only enabled alerts are checked, alert is disabled when it fires, so it fires once until it's enabled again
+type Alert struct {
+	Id         int64 // it's set by storage
+	SecurityId string
+	Type       securities.SecurityType
+	Direction  Direction
+	Threshold  float64
+	Enabled    bool
+	URL        string // webhook which gets firings of alert, it's empty if firings are only recorded
+}
+
+// maxURLLength is the maximum length of webhook URL, it's the size of url column in storage
+const maxURLLength = 500
+
+// DeliveryStatus is the status of webhook delivery of firing
+type DeliveryStatus string
+
+const (
+	NoDelivery      DeliveryStatus = ""          // alert has no webhook
+	DeliveryPending DeliveryStatus = "pending"   // firing isn't delivered yet
+	Delivered       DeliveryStatus = "delivered" // webhook accepted firing
+	DeliveryFailed  DeliveryStatus = "failed"    // all attempts to deliver firing failed
+)
+
+// Firing is a record of fired alert
+type Firing struct {
+	Id            int64 // it's set by storage
+	AlertId       int64
+	Close         float64   // close price which fired alert
+	Date          time.Time // end of quotes with this close price
+	FiredAt       time.Time
+	Delivery      DeliveryStatus
+	DeliveryError string // error of the last delivery attempt if delivery failed
+}
+
+// Store keeps alerts and their firings
+type Store interface {
+	// AddAlert adds alert to storage and sets its id, security of alert must exist in storage
+	AddAlert(a *Alert) error
+	// GetAlert returns alert with the given id, ErrAlertNotExist is returned if there is no such alert
+	GetAlert(id int64) (*Alert, error)
+	// GetAllAlerts returns all alerts sorted by id
+	GetAllAlerts() ([]*Alert, error)
+	// UpdateAlert changes direction, threshold, enabled flag and webhook of existing alert, its security isn't changed
+	UpdateAlert(a *Alert) error
+	// DeleteAlert removes alert with its firings from storage
+	DeleteAlert(id int64) error
+	// FireAlerts records firings, sets their ids and disables fired alerts at once (all or nothing)
+	FireAlerts(firings []Firing) error
+	// GetAlertFirings returns firings of alert sorted by time
+	GetAlertFirings(id int64) ([]Firing, error)
+	// SetFiringDelivery records the result of webhook delivery of firing with the given id
+	SetFiringDelivery(id int64, status DeliveryStatus, deliveryError string) error
+}
+
+// New creates a new enabled alert and checks it
+// Security id is converted to upper case as in securities package, direction is converted to lower case
+func New(securityId string, sType securities.SecurityType, direction Direction, threshold float64) (*Alert, error) {
+	a := &Alert{
+		SecurityId: strings.ToUpper(strings.TrimSpace(securityId)),
+		Type:       sType,
+		Direction:  Direction(strings.ToLower(string(direction))),
+		Threshold:  threshold,
+		Enabled:    true,
+	}
+
+	err := a.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Check checks that alert has security, known direction, positive threshold and http(s) webhook URL if it's set
+func (a *Alert) Check() error {
+	if a.SecurityId == "" {
+		return errors.New("alert has no security id")
+	}
+
+	if securities.GetSecurityTypeFromString(string(a.Type)) == securities.UnknownType {
+		return fmt.Errorf("alert of %s has unknown type %s", a.SecurityId, a.Type)
+	}
+
+	if a.Direction != Above && a.Direction != Below {
+		return fmt.Errorf("alert of %s has unknown direction %s", a.SecurityId, a.Direction)
+	}
+
+	if a.Threshold <= 0 {
+		return fmt.Errorf("alert of %s has wrong threshold %f", a.SecurityId, a.Threshold)
+	}
+
+	if a.URL != "" {
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(a.URL) > maxURLLength {
+			return fmt.Errorf("alert of %s has wrong webhook URL %s", a.SecurityId, a.URL)
+		}
+	}
+
+	return nil
+}
+
+// Fires checks if the close price is on the side of the threshold given by direction
+func (a *Alert) Fires(close float64) bool {
+	switch a.Direction {
+	case Above:
+		return close >= a.Threshold
+	case Below:
+		return close <= a.Threshold
+	default:
+		return false
+	}
+}
+
+// Evaluate checks enabled alerts by the last daily quotes of securities and returns firings of alerts which fire
+// Alerts of securities which are not in the list or have no daily quotes don't fire
+// Firings of alerts with webhooks are pending for delivery
+func Evaluate(alerts []*Alert, secList []*securities.Security, now time.Time) []Firing {
+	type key struct {
+		id    string
+		sType securities.SecurityType
+	}
+
+	byKey := make(map[key]*securities.Security, len(secList))
+	for _, sec := range secList {
+		byKey[key{sec.Id(), sec.SType()}] = sec
+	}
+
+	var res []Firing
+	for _, a := range alerts {
+		if !a.Enabled {
+			continue
+		}
+
+		sec, ok := byKey[key{a.SecurityId, a.Type}]
+		if !ok {
+			continue
+		}
+
+		q := sec.LastQuotes(securities.IntervalDay)
+		if q.Interval == securities.IntervalUnknown || !a.Fires(q.Close) {
+			continue
+		}
+
+		f := Firing{AlertId: a.Id, Close: q.Close, Date: q.End, FiredAt: now}
+		if a.URL != "" {
+			f.Delivery = DeliveryPending
+		}
+
+		res = append(res, f)
+	}
+
+	return res
+}
@@ -0,0 +1,67 @@
+package alerts
+
+import (
+	"securitiesModule/securities"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	a, err := New(" gazp ", securities.Share, "ABOVE", 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.SecurityId != "GAZP" || a.Direction != Above || !a.Enabled {
+		t.Errorf("wrong alert - want enabled alert of GAZP, got %+v", a)
+	}
+
+	tests := map[string]*Alert{
+		"no id":             {Type: securities.Share, Direction: Above, Threshold: 1},
+		"unknown type":      {SecurityId: "GAZP", Type: "stock", Direction: Above, Threshold: 1},
+		"unknown direction": {SecurityId: "GAZP", Type: securities.Share, Direction: "across", Threshold: 1},
+		"zero threshold":    {SecurityId: "GAZP", Type: securities.Share, Direction: Below},
+		"wrong webhook":     {SecurityId: "GAZP", Type: securities.Share, Direction: Below, Threshold: 1, URL: "ftp://example.com"},
+	}
+
+	for name, wrong := range tests {
+		if wrong.Check() == nil {
+			t.Errorf("%s: wrong alert is accepted", name)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	date := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	gazp := securities.GetSecurity("GAZP", "Gazprom", securities.Share, securities.RUB)
+	gazp.SetQuotes(securities.SecurityQuotes{Interval: securities.IntervalDay, Begin: date, End: date.Add(24*time.Hour - time.Second), Close: 160})
+
+	// no daily quotes
+	sber := securities.GetSecurity("SBER", "Sberbank", securities.Share, securities.RUB)
+
+	alertList := []*Alert{
+		{Id: 1, SecurityId: "GAZP", Type: securities.Share, Direction: Above, Threshold: 150, Enabled: true},
+		{Id: 2, SecurityId: "GAZP", Type: securities.Share, Direction: Below, Threshold: 150, Enabled: true},
+		{Id: 3, SecurityId: "GAZP", Type: securities.Share, Direction: Below, Threshold: 160, Enabled: true},
+		{Id: 4, SecurityId: "GAZP", Type: securities.Share, Direction: Above, Threshold: 100, Enabled: false},
+		{Id: 5, SecurityId: "GAZP", Type: securities.Bond, Direction: Above, Threshold: 100, Enabled: true},
+		{Id: 6, SecurityId: "SBER", Type: securities.Share, Direction: Above, Threshold: 100, Enabled: true},
+		{Id: 7, SecurityId: "GAZP", Type: securities.Share, Direction: Above, Threshold: 100, Enabled: true, URL: "https://example.com/hook"},
+	}
+
+	now := time.Now()
+	firings := Evaluate(alertList, []*securities.Security{gazp, sber}, now)
+
+	if len(firings) != 3 || firings[0].AlertId != 1 || firings[1].AlertId != 3 || firings[2].AlertId != 7 {
+		t.Fatalf("wrong fired alerts - want 1, 3 and 7, got %+v", firings)
+	}
+
+	if firings[0].Delivery != NoDelivery || firings[2].Delivery != DeliveryPending {
+		t.Errorf("wrong delivery of firings - want none and pending, got %s and %s", firings[0].Delivery, firings[2].Delivery)
+	}
+
+	if f := firings[0]; f.Close != 160 || !f.Date.Equal(date.Add(24*time.Hour-time.Second)) || !f.FiredAt.Equal(now) {
+		t.Errorf("wrong firing - got %+v", f)
+	}
+}
@@ -0,0 +1,123 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"securitiesModule/retry"
+	"strings"
+	"time"
+)
+
+// HTTPClient is the client for all webhook requests (it may be changed for testing)
+// Alerts usually post to a few targets, so only a couple of idle connections are kept for every target
+// Receivers should answer quickly, a slow one mustn't hold the delivery of other alerts for long
+var HTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// MaxAttempts is the maximum number of attempts to deliver one firing, the firing keeps the error of the last attempt
+var MaxAttempts = 3
+
+// RetryBaseDelay is the delay before the second attempt of delivery, it gives a restarting receiver time to come back
+var RetryBaseDelay = time.Second
+
+// maxDeliveryErrorLength limits the length of delivery error kept in storage
+const maxDeliveryErrorLength = 500
+
+// Payload is the json body of webhook sent when alert fires
+type Payload struct {
+	AlertId   int64   `json:"alertId"`
+	Security  string  `json:"security"`
+	Type      string  `json:"type"`
+	Direction string  `json:"direction"`
+	Threshold float64 `json:"threshold"`
+	Price     float64 `json:"price"`     // close price which fired alert
+	Date      string  `json:"date"`      // end of quotes with this price
+	Timestamp string  `json:"timestamp"` // time of firing
+}
+
+// NewPayload returns webhook body of the firing of alert
+func NewPayload(a *Alert, f Firing) Payload {
+	return Payload{
+		AlertId:   a.Id,
+		Security:  a.SecurityId,
+		Type:      string(a.Type),
+		Direction: string(a.Direction),
+		Threshold: a.Threshold,
+		Price:     f.Close,
+		Date:      f.Date.UTC().Format("2006-01-02 15:04:05"),
+		Timestamp: f.FiredAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// Deliver posts the firing of alert to its URL as json
+// Delivery is repeated (see retry.Do) while the receiver is unreachable or answers that it's busy or broken (429 or 5xx),
+// other answers except 2xx mean that the receiver rejects the payload, so it isn't sent again
+func Deliver(ctx context.Context, a *Alert, f Firing) error {
+	if a.URL == "" {
+		return fmt.Errorf("alert %d has no webhook URL", a.Id)
+	}
+
+	body, err := json.Marshal(NewPayload(a, f))
+	if err != nil {
+		return err
+	}
+
+	return retry.Do(ctx, MaxAttempts, RetryBaseDelay, func() (bool, error) {
+		return deliverOnce(ctx, a.URL, body)
+	}, nil)
+}
+
+// deliverOnce posts json body to the URL once
+// Returns true if the receiver may accept the same body later
+func deliverOnce(ctx context.Context, url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		// the firing isn't sent again if delivery is cancelled (the service is stopping for example)
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	// the answer of receiver isn't used, it's only drained (up to 64 KB) to keep the connection alive
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return true, fmt.Errorf("webhook answered with status %s", resp.Status)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("webhook answered with status %s", resp.Status)
+	}
+
+	return false, nil
+}
+
+// DeliveryError returns the text of delivery error to keep in storage
+func DeliveryError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	text := err.Error()
+	if len(text) > maxDeliveryErrorLength {
+		text = strings.ToValidUTF8(text[:maxDeliveryErrorLength], "")
+	}
+
+	return text
+}
@@ -0,0 +1,88 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"securitiesModule/securities"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliver(t *testing.T) {
+	retryBaseDelay := RetryBaseDelay
+	RetryBaseDelay = time.Millisecond
+	defer func() { RetryBaseDelay = retryBaseDelay }()
+
+	var calls atomic.Int32
+	var got Payload
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		// the first attempt fails, so the webhook is retried
+		if calls.Add(1) == 1 {
+			http.Error(writer, "busy", http.StatusServiceUnavailable)
+			return
+		}
+
+		if request.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("wrong content type %s", request.Header.Get("Content-Type"))
+		}
+
+		err := json.NewDecoder(request.Body).Decode(&got)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	a := &Alert{Id: 7, SecurityId: "GAZP", Type: securities.Share, Direction: Above, Threshold: 150, URL: server.URL}
+	f := Firing{AlertId: 7, Close: 160, Date: time.Date(2023, 1, 2, 23, 59, 59, 0, time.UTC), FiredAt: time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC)}
+
+	err := Deliver(context.Background(), a, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls.Load() != 2 {
+		t.Errorf("wrong number of attempts - want 2, got %d", calls.Load())
+	}
+
+	want := Payload{AlertId: 7, Security: "GAZP", Type: "share", Direction: "above", Threshold: 150, Price: 160, Date: "2023-01-02 23:59:59", Timestamp: "2023-01-03T10:00:00Z"}
+	if got != want {
+		t.Errorf("wrong payload - want %+v, got %+v", want, got)
+	}
+}
+
+func TestDeliverRejected(t *testing.T) {
+	retryBaseDelay := RetryBaseDelay
+	RetryBaseDelay = time.Millisecond
+	defer func() { RetryBaseDelay = retryBaseDelay }()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		calls.Add(1)
+		http.Error(writer, "unknown hook", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	a := &Alert{Id: 7, SecurityId: "GAZP", Type: securities.Share, Direction: Above, Threshold: 150, URL: server.URL}
+
+	err := Deliver(context.Background(), a, Firing{AlertId: 7, Close: 160})
+	if err == nil {
+		t.Fatal("rejected webhook is delivered")
+	}
+
+	// client errors are not retried
+	if calls.Load() != 1 {
+		t.Errorf("wrong number of attempts - want 1, got %d", calls.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = Deliver(ctx, a, Firing{AlertId: 7, Close: 160})
+	if err == nil {
+		t.Error("webhook is delivered with cancelled context")
+	}
+}
@@ -0,0 +1,134 @@
+package securities
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrNoBondInfo is returned by storage if there is no stored face value and payments of bond
+var ErrNoBondInfo = errors.New("bond has no stored info")
+
+// BondPayment is a payment of bond on the date - coupon and (or) amortization (repayment of a part of face value)
+// Redemption of bond at maturity is the last amortization
+type BondPayment struct {
+	Date         time.Time
+	Start        time.Time // beginning of coupon period, it's zero if there is no coupon
+	Coupon       float64
+	Amortization float64
+}
+
+// BondInfo is face value and schedule of payments of bond sorted by date
+// Prices of bonds are in percents of face value, payments are in the currency of face value
+type BondInfo struct {
+	FaceValue float64 // initial face value
+	Payments  []BondPayment
+}
+
+// FaceValueAt returns face value of bond at the date - initial face value without amortizations paid before or on the date
+func (b *BondInfo) FaceValueAt(date time.Time) float64 {
+	res := b.FaceValue
+	for _, p := range b.Payments {
+		if !p.Date.After(date) {
+			res -= p.Amortization
+		}
+	}
+
+	return res
+}
+
+// nextCoupon returns the first payment with coupon after the date
+func (b *BondInfo) nextCoupon(date time.Time) (BondPayment, bool) {
+	for _, p := range b.Payments {
+		if p.Date.After(date) && p.Coupon > 0 {
+			return p, true
+		}
+	}
+
+	return BondPayment{}, false
+}
+
+// AccruedInterest returns the part of the next coupon earned by the date
+// Zero is returned if there is no next coupon or its period is unknown
+func (b *BondInfo) AccruedInterest(date time.Time) float64 {
+	next, ok := b.nextCoupon(date)
+	if !ok || next.Start.IsZero() || !next.Date.After(next.Start) || date.Before(next.Start) {
+		return 0
+	}
+
+	return next.Coupon * date.Sub(next.Start).Hours() / next.Date.Sub(next.Start).Hours()
+}
+
+// CurrentYield returns the annual yield (%) of the next coupon to the clean price (in percents of face value) at the date
+func (b *BondInfo) CurrentYield(price float64, date time.Time) (float64, error) {
+	next, ok := b.nextCoupon(date)
+	if !ok {
+		return 0, errors.New("bond has no coupons after the date")
+	}
+
+	if next.Start.IsZero() || !next.Date.After(next.Start) {
+		return 0, errors.New("unknown coupon period")
+	}
+
+	cost := price / 100 * b.FaceValueAt(date)
+	if cost <= 0 {
+		return 0, fmt.Errorf("wrong bond price %f", price)
+	}
+
+	periodsPerYear := 365 * 24 / next.Date.Sub(next.Start).Hours()
+
+	return next.Coupon * periodsPerYear / cost * 100, nil
+}
+
+// ytmMaxIterations limits the search of yield to maturity, the precision is much better than needed after it
+const ytmMaxIterations = 200
+
+// YieldToMaturity returns the effective annual yield (%) of bond bought at the clean price (in percents of face value) at the date and held to maturity
+// The yield discounts all payments after the date to the price with accrued interest, years are counted as 365 days
+func YieldToMaturity(bond *BondInfo, price float64, date time.Time) (float64, error) {
+	cost := price/100*bond.FaceValueAt(date) + bond.AccruedInterest(date)
+	if cost <= 0 {
+		return 0, fmt.Errorf("wrong bond price %f", price)
+	}
+
+	var times, flows []float64
+	for _, p := range bond.Payments {
+		if !p.Date.After(date) {
+			continue
+		}
+
+		times = append(times, p.Date.Sub(date).Hours()/24/365)
+		flows = append(flows, p.Coupon+p.Amortization)
+	}
+
+	if len(flows) == 0 {
+		return 0, errors.New("bond has no payments after the date")
+	}
+
+	// present value decreases when yield grows, so the yield is found by bisection
+	presentValue := func(y float64) float64 {
+		res := 0.0
+		for i, f := range flows {
+			res += f / math.Pow(1+y, times[i])
+		}
+
+		return res
+	}
+
+	low, high := -0.99, 100.0
+	if presentValue(low) < cost || presentValue(high) > cost {
+		return 0, errors.New("yield to maturity is out of range")
+	}
+
+	for i := 0; i < ytmMaxIterations; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > cost {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2 * 100, nil
+}
@@ -0,0 +1,623 @@
+package securities
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// sortedQuotesOfInterval returns security quotes of the given interval sorted by begin date
+func (s *Security) sortedQuotesOfInterval(interval QuotesInterval) []SecurityQuotes {
+	quotes := *s.QuotesOfInterval(interval)
+
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Begin.Before(quotes[j].Begin)
+	})
+
+	return quotes
+}
+
+// closePrices returns close prices of the given quotes
+func closePrices(quotes []SecurityQuotes) []float64 {
+	closes := make([]float64, len(quotes))
+	for i, q := range quotes {
+		closes[i] = q.Close
+	}
+
+	return closes
+}
+
+// sma returns simple moving average of the given values for the given window
+// The i-th element of result is the average of values from i to i+window-1, so the result is shorter than values by window-1
+func sma(values []float64, window int) []float64 {
+	if window <= 0 || len(values) < window {
+		return []float64{}
+	}
+
+	res := make([]float64, 0, len(values)-window+1)
+
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= window {
+			sum -= values[i-window]
+		}
+
+		if i >= window-1 {
+			res = append(res, sum/float64(window))
+		}
+	}
+
+	return res
+}
+
+// IndicatorValue is a value of indicator (moving average etc) calculated for the given period
+type IndicatorValue struct {
+	Begin time.Time
+	End   time.Time
+	Value float64
+}
+
+// SMA returns simple moving average of close prices of the given interval quotes for the given period
+// The first value is calculated for the first period quotes, so periods without enough quotes before them are skipped
+func (s *Security) SMA(interval QuotesInterval, period int) []IndicatorValue {
+	if period <= 0 {
+		return []IndicatorValue{}
+	}
+
+	quotes := s.sortedQuotesOfInterval(interval)
+	averages := sma(closePrices(quotes), period)
+
+	res := make([]IndicatorValue, len(averages))
+	for i, avg := range averages {
+		q := quotes[i+period-1]
+		res[i] = IndicatorValue{Begin: q.Begin, End: q.End, Value: avg}
+	}
+
+	return res
+}
+
+// ema returns exponential moving average of the given values for the given period with smoothing factor 2/(period+1)
+// The first value is the simple moving average of the first period values, so the result is shorter than values by period-1
+func ema(values []float64, period int) []float64 {
+	if period <= 0 || len(values) < period {
+		return []float64{}
+	}
+
+	k := 2 / float64(period+1)
+
+	res := make([]float64, 0, len(values)-period+1)
+	res = append(res, sma(values[:period], period)[0])
+
+	for _, v := range values[period:] {
+		prev := res[len(res)-1]
+		res = append(res, v*k+prev*(1-k))
+	}
+
+	return res
+}
+
+// EMA returns exponential moving average of close prices of the given interval quotes (sorted by begin date) for the given period
+// The i-th value corresponds to the (i+period-1)-th quotes. The result is empty if there are fewer quotes than period
+func (s *Security) EMA(interval QuotesInterval, period int) []float64 {
+	return ema(closePrices(s.sortedQuotesOfInterval(interval)), period)
+}
+
+// RSI returns relative strength index of close prices of the given interval quotes (sorted by begin date) for the given period
+// Average gains and losses are smoothed by Wilder's method. The i-th value corresponds to the (i+period)-th quotes
+// RSI is 100 if there are only gains in the period, 0 if there are only losses and 50 if price doesn't change at all
+func (s *Security) RSI(interval QuotesInterval, period int) []float64 {
+	closes := closePrices(s.sortedQuotesOfInterval(interval))
+	if period <= 0 || len(closes) <= period {
+		return []float64{}
+	}
+
+	rsi := func(avgGain float64, avgLoss float64) float64 {
+		switch {
+		case avgLoss == 0 && avgGain == 0:
+			return 50
+		case avgLoss == 0:
+			return 100
+		default:
+			return 100 - 100/(1+avgGain/avgLoss)
+		}
+	}
+
+	avgGain, avgLoss := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			avgGain += change
+		} else {
+			avgLoss -= change
+		}
+	}
+	avgGain /= float64(period)
+	avgLoss /= float64(period)
+
+	res := make([]float64, 0, len(closes)-period)
+	res = append(res, rsi(avgGain, avgLoss))
+
+	for i := period + 1; i < len(closes); i++ {
+		gain, loss := 0.0, 0.0
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gain = change
+		} else {
+			loss = -change
+		}
+
+		avgGain = (avgGain*float64(period-1) + gain) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + loss) / float64(period)
+
+		res = append(res, rsi(avgGain, avgLoss))
+	}
+
+	return res
+}
+
+// MACD returns moving average convergence/divergence of close prices of the given interval quotes (sorted by begin date):
+// MACD line (difference of fast and slow EMA), signal line (EMA of MACD line) and histogram (difference of MACD and signal lines)
+// All the series are aligned to the last quotes, so they have different length: the last values correspond to the last quotes
+func (s *Security) MACD(interval QuotesInterval, fast, slow, signal int) (macd, signalLine, histogram []float64, err error) {
+	if fast <= 0 || slow <= 0 || signal <= 0 {
+		return nil, nil, nil, fmt.Errorf("wrong MACD periods: %d, %d, %d", fast, slow, signal)
+	}
+
+	if fast >= slow {
+		return nil, nil, nil, fmt.Errorf("fast period %d must be less than slow period %d", fast, slow)
+	}
+
+	closes := closePrices(s.sortedQuotesOfInterval(interval))
+
+	fastEMA := ema(closes, fast)
+	slowEMA := ema(closes, slow)
+
+	macd = make([]float64, len(slowEMA))
+	for i, v := range slowEMA {
+		macd[i] = fastEMA[i+slow-fast] - v
+	}
+
+	signalLine = ema(macd, signal)
+
+	histogram = make([]float64, len(signalLine))
+	for i, v := range signalLine {
+		histogram[i] = macd[i+signal-1] - v
+	}
+
+	return macd, signalLine, histogram, nil
+}
+
+// BollingerBands returns Bollinger bands of close prices of the given interval quotes (sorted by begin date):
+// middle band is the simple moving average for the given period, upper and lower bands are stdDevs population standard deviations
+// of close prices in the same window above and below it. The i-th value corresponds to the (i+period-1)-th quotes
+func (s *Security) BollingerBands(interval QuotesInterval, period int, stdDevs float64) (middle, upper, lower []float64) {
+	closes := closePrices(s.sortedQuotesOfInterval(interval))
+
+	middle = sma(closes, period)
+	upper = make([]float64, len(middle))
+	lower = make([]float64, len(middle))
+
+	for i, avg := range middle {
+		variance := 0.0
+		for _, c := range closes[i : i+period] {
+			variance += (c - avg) * (c - avg)
+		}
+		dev := math.Sqrt(variance/float64(period)) * stdDevs
+
+		upper[i] = avg + dev
+		lower[i] = avg - dev
+	}
+
+	return middle, upper, lower
+}
+
+// overlappingCloses returns close prices of the given interval quotes of two securities for the dates when both of them have quotes
+func overlappingCloses(a, b *Security, interval QuotesInterval) (closesA, closesB []float64) {
+	quotesB := make(map[time.Time]float64)
+	for _, q := range b.sortedQuotesOfInterval(interval) {
+		quotesB[q.Begin.UTC()] = q.Close
+	}
+
+	for _, q := range a.sortedQuotesOfInterval(interval) {
+		if c, ok := quotesB[q.Begin.UTC()]; ok {
+			closesA = append(closesA, q.Close)
+			closesB = append(closesB, c)
+		}
+	}
+
+	return closesA, closesB
+}
+
+// simpleReturns returns relative changes of the given prices (the result is shorter than prices by one)
+func simpleReturns(prices []float64) []float64 {
+	if len(prices) < 2 {
+		return []float64{}
+	}
+
+	res := make([]float64, 0, len(prices)-1)
+	for i := 1; i < len(prices); i++ {
+		change := 0.0
+		if prices[i-1] != 0.0 {
+			change = prices[i]/prices[i-1] - 1
+		}
+		res = append(res, change)
+	}
+
+	return res
+}
+
+// mean returns the average of the given values
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+// Correlation returns Pearson correlation of close price returns of the given interval quotes of two securities
+// Only the dates when both securities have quotes are taken into account
+func Correlation(a, b *Security, interval QuotesInterval) (float64, error) {
+	closesA, closesB := overlappingCloses(a, b, interval)
+
+	returnsA := simpleReturns(closesA)
+	returnsB := simpleReturns(closesB)
+	if len(returnsA) < 2 {
+		return 0, fmt.Errorf("not enough overlapping quotes of %s and %s: %d", a.Id(), b.Id(), len(closesA))
+	}
+
+	meanA := mean(returnsA)
+	meanB := mean(returnsB)
+
+	cov, varA, varB := 0.0, 0.0, 0.0
+	for i := range returnsA {
+		dA := returnsA[i] - meanA
+		dB := returnsB[i] - meanB
+
+		cov += dA * dB
+		varA += dA * dA
+		varB += dB * dB
+	}
+
+	if varA == 0 || varB == 0 {
+		return 0, fmt.Errorf("price of %s or %s doesn't change, correlation can't be calculated", a.Id(), b.Id())
+	}
+
+	return cov / math.Sqrt(varA*varB), nil
+}
+
+// Beta returns beta of security versus the benchmark - covariance of close price returns of the given interval quotes of security and benchmark
+// divided by variance of benchmark returns. Only the dates when both of them have quotes are taken into account
+func Beta(sec, benchmark *Security, interval QuotesInterval) (float64, error) {
+	closesSec, closesBench := overlappingCloses(sec, benchmark, interval)
+
+	returnsSec := simpleReturns(closesSec)
+	returnsBench := simpleReturns(closesBench)
+	if len(returnsSec) < 2 {
+		return 0, fmt.Errorf("not enough overlapping quotes of %s and %s: %d", sec.Id(), benchmark.Id(), len(closesSec))
+	}
+
+	meanSec := mean(returnsSec)
+	meanBench := mean(returnsBench)
+
+	cov, varBench := 0.0, 0.0
+	for i := range returnsSec {
+		dBench := returnsBench[i] - meanBench
+
+		cov += (returnsSec[i] - meanSec) * dBench
+		varBench += dBench * dBench
+	}
+
+	if varBench == 0 {
+		return 0, fmt.Errorf("price of %s doesn't change, beta can't be calculated", benchmark.Id())
+	}
+
+	return cov / varBench, nil
+}
+
+// MaxDrawdown returns the largest decline (%, negative or zero) of close price of the given interval quotes from its running maximum
+// and the dates (end of quotes) of the peak and the trough of this decline
+func (s *Security) MaxDrawdown(interval QuotesInterval) (float64, time.Time, time.Time) {
+	peak, maxDrawdown := 0.0, 0.0
+	var peakDate, maxPeakDate, maxTroughDate time.Time
+
+	for _, q := range s.sortedQuotesOfInterval(interval) {
+		if q.Close > peak {
+			peak = q.Close
+			peakDate = q.End
+			continue
+		}
+
+		if peak == 0.0 {
+			continue
+		}
+
+		drawdown := (q.Close - peak) / peak * 100
+		if drawdown < maxDrawdown {
+			maxDrawdown = drawdown
+			maxPeakDate = peakDate
+			maxTroughDate = q.End
+		}
+	}
+
+	return maxDrawdown, maxPeakDate, maxTroughDate
+}
+
+// HighLow returns the highest and the lowest prices of the given interval quotes in the trailing window before the end of the last quotes
+// and the dates (end of quotes) when they were reached. High and low prices of quotes are used, close price is used if they are not set
+// All quotes are used if they cover less than the window, zeros are returned if there are no quotes
+func (s *Security) HighLow(interval QuotesInterval, window time.Duration) (high, low float64, highDate, lowDate time.Time) {
+	quotes := s.sortedQuotesOfInterval(interval)
+	if len(quotes) == 0 {
+		return
+	}
+
+	start := quotes[len(quotes)-1].End.Add(-window)
+	for _, q := range quotes {
+		if !q.End.After(start) {
+			continue
+		}
+
+		qHigh, qLow := q.High, q.Low
+		if qHigh == 0.0 {
+			qHigh = q.Close
+		}
+		if qLow == 0.0 {
+			qLow = q.Close
+		}
+
+		if highDate.IsZero() || qHigh > high {
+			high, highDate = qHigh, q.End
+		}
+		if lowDate.IsZero() || qLow < low {
+			low, lowDate = qLow, q.End
+		}
+	}
+
+	return
+}
+
+// AverageVolume returns the mean traded volume of the last period quotes of the given interval
+// All quotes are used if there are fewer of them, zero is returned if there are no quotes or no volume data
+func (s *Security) AverageVolume(interval QuotesInterval, period int) float64 {
+	if period <= 0 {
+		return 0
+	}
+
+	quotes := s.sortedQuotesOfInterval(interval)
+	if len(quotes) > period {
+		quotes = quotes[len(quotes)-period:]
+	}
+
+	if len(quotes) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, q := range quotes {
+		sum += q.Volume
+	}
+
+	return sum / float64(len(quotes))
+}
+
+// TotalReturn returns the return (%) of holding security from close price of the first quotes of the given interval to close price of the last quotes
+// with dividends reinvested at close price of the last quotes beginning not later than the dividend date
+// Only dividends after the day of the first quotes and not later than the day of the last quotes are counted, they must be in the currency of prices
+// Zero is returned if there are no quotes
+func (s *Security) TotalReturn(interval QuotesInterval, dividends []Dividend) float64 {
+	quotes := s.sortedQuotesOfInterval(interval)
+	if len(quotes) == 0 || quotes[0].Close == 0.0 {
+		return 0
+	}
+
+	firstDay := periodStart(IntervalDay, quotes[0].Begin)
+	lastDay := periodStart(IntervalDay, quotes[len(quotes)-1].Begin)
+
+	shares := 1.0
+	for _, d := range dividends {
+		if !d.Date.After(firstDay) || d.Date.After(lastDay) {
+			continue
+		}
+
+		// the last quotes which begin before the next day
+		i := sort.Search(len(quotes), func(i int) bool {
+			return !quotes[i].Begin.Before(d.Date.AddDate(0, 0, 1))
+		}) - 1
+
+		if quotes[i].Close > 0 {
+			shares *= 1 + d.Value/quotes[i].Close
+		}
+	}
+
+	return (shares*quotes[len(quotes)-1].Close/quotes[0].Close - 1) * 100
+}
+
+// periodsPerYear returns the number of periods of the given interval in a year which is used for annualization:
+// 252 trading days, 52 weeks, 12 months or 4 quarters. Intraday intervals can't be annualized
+func periodsPerYear(interval QuotesInterval) (float64, error) {
+	switch interval {
+	case IntervalDay:
+		return 252, nil
+	case IntervalWeek:
+		return 52, nil
+	case IntervalMonth:
+		return 12, nil
+	case IntervalQuarter:
+		return 4, nil
+	default:
+		return 0, fmt.Errorf("interval %d can't be annualized", interval)
+	}
+}
+
+// Volatility returns standard deviation (population) of logarithmic returns of close prices of the given interval quotes
+// If annualize is true the result is multiplied by square root of the number of periods in a year (see periodsPerYear)
+func (s *Security) Volatility(interval QuotesInterval, annualize bool) (float64, error) {
+	closes := closePrices(s.sortedQuotesOfInterval(interval))
+	if len(closes) < 2 {
+		return 0, fmt.Errorf("not enough quotes to calculate volatility: %d", len(closes))
+	}
+
+	returns := make([]float64, 0, len(closes)-1)
+	for i := 1; i < len(closes); i++ {
+		if closes[i] <= 0 || closes[i-1] <= 0 {
+			return 0, fmt.Errorf("wrong price for volatility calculation: %f", math.Min(closes[i], closes[i-1]))
+		}
+
+		returns = append(returns, math.Log(closes[i]/closes[i-1]))
+	}
+
+	avg := mean(returns)
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - avg) * (r - avg)
+	}
+	res := math.Sqrt(variance / float64(len(returns)))
+
+	if annualize {
+		periods, err := periodsPerYear(interval)
+		if err != nil {
+			return 0, err
+		}
+
+		res *= math.Sqrt(periods)
+	}
+
+	return res, nil
+}
+
+// excessReturns returns simple returns of close prices of the given interval quotes minus the risk-free return of one period
+// and the number of periods in a year. The risk-free rate is annual (0.1 is 10%)
+func (s *Security) excessReturns(interval QuotesInterval, riskFreeRate float64) ([]float64, float64, error) {
+	periods, err := periodsPerYear(interval)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	returns := simpleReturns(closePrices(s.sortedQuotesOfInterval(interval)))
+	if len(returns) < 2 {
+		return nil, 0, fmt.Errorf("not enough quotes: %d returns", len(returns))
+	}
+
+	periodRate := riskFreeRate / periods
+	for i := range returns {
+		returns[i] -= periodRate
+	}
+
+	return returns, periods, nil
+}
+
+// Sharpe returns annualized Sharpe ratio of security - the average return of close price of the given interval quotes over the risk-free rate
+// divided by standard deviation of these returns. The risk-free rate is annual (0.1 is 10%)
+// Zero is returned if there are fewer than three quotes, the interval can't be annualized or returns don't change
+func (s *Security) Sharpe(interval QuotesInterval, riskFreeRate float64) float64 {
+	returns, periods, err := s.excessReturns(interval, riskFreeRate)
+	if err != nil {
+		return 0
+	}
+
+	avg := mean(returns)
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - avg) * (r - avg)
+	}
+
+	deviation := math.Sqrt(variance / float64(len(returns)))
+	if deviation == 0 {
+		return 0
+	}
+
+	return avg / deviation * math.Sqrt(periods)
+}
+
+// Sortino returns annualized Sortino ratio of security - the same as Sharpe ratio, but only returns below the risk-free rate
+// are taken into account in deviation (downside deviation)
+// Zero is returned if there are fewer than three quotes, the interval can't be annualized or there are no returns below the risk-free rate
+func (s *Security) Sortino(interval QuotesInterval, riskFreeRate float64) float64 {
+	returns, periods, err := s.excessReturns(interval, riskFreeRate)
+	if err != nil {
+		return 0
+	}
+
+	downside := 0.0
+	for _, r := range returns {
+		if r < 0 {
+			downside += r * r
+		}
+	}
+
+	deviation := math.Sqrt(downside / float64(len(returns)))
+	if deviation == 0 {
+		return 0
+	}
+
+	return mean(returns) / deviation * math.Sqrt(periods)
+}
+
+// TimeAboveSMA returns the fraction (from 0 to 1) of periods when close price of security was above its simple moving average of the given window
+func (s *Security) TimeAboveSMA(interval QuotesInterval, window int) (float64, error) {
+	if window <= 0 {
+		return 0, fmt.Errorf("wrong window: %d", window)
+	}
+
+	closes := closePrices(s.sortedQuotesOfInterval(interval))
+	if len(closes) < window {
+		return 0, fmt.Errorf("not enough quotes for window %d: %d", window, len(closes))
+	}
+
+	averages := sma(closes, window)
+
+	above := 0
+	for i, avg := range averages {
+		if closes[i+window-1] > avg {
+			above++
+		}
+	}
+
+	return float64(above) / float64(len(averages)), nil
+}
+
+// ForwardReturn returns the return (%) from close price of the first quotes of the given interval ending on or after fromDate
+// to close price of quotes nDays periods later
+func (s *Security) ForwardReturn(interval QuotesInterval, fromDate time.Time, nDays int) (float64, error) {
+	if nDays <= 0 {
+		return 0, fmt.Errorf("wrong number of days: %d", nDays)
+	}
+
+	quotes := s.sortedQuotesOfInterval(interval)
+
+	start := sort.Search(len(quotes), func(i int) bool {
+		return !quotes[i].End.Before(fromDate)
+	})
+
+	if start+nDays >= len(quotes) {
+		return 0, fmt.Errorf("not enough data: no quotes %d periods after %s", nDays, fromDate.Format("02.01.2006"))
+	}
+
+	startPrice := quotes[start].Close
+	if startPrice == 0.0 {
+		return 0, fmt.Errorf("zero price on %s", quotes[start].End.Format("02.01.2006"))
+	}
+
+	return (quotes[start+nDays].Close - startPrice) / startPrice * 100, nil
+}
+
+// LastChange returns the change (%) between close prices of the last two quotes of the given interval
+func (s *Security) LastChange(interval QuotesInterval) (float64, error) {
+	quotes := s.sortedQuotesOfInterval(interval)
+	if len(quotes) < 2 {
+		return 0, fmt.Errorf("not enough data: %d quotes", len(quotes))
+	}
+
+	prev := quotes[len(quotes)-2]
+	if prev.Close == 0.0 {
+		return 0, fmt.Errorf("zero price on %s", prev.End.Format("02.01.2006"))
+	}
+
+	return (quotes[len(quotes)-1].Close - prev.Close) / prev.Close * 100, nil
+}
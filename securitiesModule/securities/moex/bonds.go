@@ -0,0 +1,132 @@
+package moex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"securitiesModule/securities"
+	"sort"
+	"time"
+)
+
+// moexBondization is a type to parse Moscow Exchange json
+type moexBondization struct {
+	Coupons       moexTable `json:"coupons"`
+	Amortizations moexTable `json:"amortizations"`
+}
+
+// GetBondInfo gets face value and schedule of coupons and amortizations of bond from Moscow Exchange
+// Values of future coupons which are not known yet are taken equal to the last known coupon
+func GetBondInfo(ctx context.Context, sec *securities.Security) (*securities.BondInfo, error) {
+	if sec.Id() == "" {
+		return nil, errors.New("security has no id")
+	}
+
+	request := fmt.Sprintf("%s/securities/%s/bondization.json?iss.meta=off&iss.only=coupons,amortizations&limit=unlimited", BaseURL, url.PathEscape(sec.Id()))
+
+	moexBond := moexBondization{}
+	err := getJSON(ctx, request, &moexBond)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(moexBond.Coupons.Data) == 0 && len(moexBond.Amortizations.Data) == 0 {
+		return nil, fmt.Errorf("%w: %s has no bond payments", ErrUnknownSecurity, sec.Id())
+	}
+
+	res := &securities.BondInfo{}
+	payments := map[time.Time]*securities.BondPayment{}
+	payment := func(date time.Time) *securities.BondPayment {
+		if p, ok := payments[date]; ok {
+			return p
+		}
+
+		payments[date] = &securities.BondPayment{Date: date}
+		return payments[date]
+	}
+
+	coupons := moexBond.Coupons
+	dateCol, startCol, valueCol, faceCol := coupons.column("coupondate"), coupons.column("startdate"), coupons.column("value"), coupons.column("initialfacevalue")
+	if len(coupons.Data) > 0 && (dateCol < 0 || startCol < 0 || valueCol < 0 || faceCol < 0) {
+		return nil, errors.New("wrong Moscow Exchange coupons table")
+	}
+
+	lastCoupon := 0.0
+	for _, data := range coupons.Data {
+		if len(data) <= dateCol || len(data) <= startCol || len(data) <= valueCol || len(data) <= faceCol {
+			return nil, errors.New("wrong Moscow Exchange coupons row")
+		}
+
+		date, err := tableDate(data[dateCol])
+		if err != nil {
+			return nil, err
+		}
+
+		// the beginning of coupon period may be unknown
+		start, _ := tableDate(data[startCol])
+
+		if value, ok := floatValue(data[valueCol]); ok {
+			lastCoupon = value
+		}
+
+		if face, ok := floatValue(data[faceCol]); ok && res.FaceValue == 0 {
+			res.FaceValue = face
+		}
+
+		p := payment(date)
+		p.Start = start
+		p.Coupon = lastCoupon
+	}
+
+	amort := moexBond.Amortizations
+	dateCol, valueCol, faceCol = amort.column("amortdate"), amort.column("value"), amort.column("initialfacevalue")
+	if len(amort.Data) > 0 && (dateCol < 0 || valueCol < 0 || faceCol < 0) {
+		return nil, errors.New("wrong Moscow Exchange amortizations table")
+	}
+
+	for _, data := range amort.Data {
+		if len(data) <= dateCol || len(data) <= valueCol || len(data) <= faceCol {
+			return nil, errors.New("wrong Moscow Exchange amortizations row")
+		}
+
+		date, err := tableDate(data[dateCol])
+		if err != nil {
+			return nil, err
+		}
+
+		value, ok := floatValue(data[valueCol])
+		if !ok {
+			return nil, fmt.Errorf("wrong Moscow Exchange amortization value %v", data[valueCol])
+		}
+
+		if face, ok := floatValue(data[faceCol]); ok && res.FaceValue == 0 {
+			res.FaceValue = face
+		}
+
+		payment(date).Amortization = value
+	}
+
+	res.Payments = make([]securities.BondPayment, 0, len(payments))
+	for _, p := range payments {
+		res.Payments = append(res.Payments, *p)
+	}
+
+	sort.Slice(res.Payments, func(i, j int) bool {
+		return res.Payments[i].Date.Before(res.Payments[j].Date)
+	})
+
+	return res, nil
+}
+
+// tableDate converts date of Moscow Exchange table to time
+func tableDate(value any) (time.Time, error) {
+	dateStr, _ := value.(string)
+
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("wrong Moscow Exchange date %v", value)
+	}
+
+	return date, nil
+}
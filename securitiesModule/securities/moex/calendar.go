@@ -0,0 +1,73 @@
+package moex
+
+import (
+	"securitiesModule/securities"
+	"time"
+)
+
+// Holidays are the days (month-day) when Moscow Exchange doesn't trade every year
+// They may be changed if the exchange changes its calendar
+var Holidays = map[string]bool{
+	"01-01": true,
+	"01-02": true,
+	"02-23": true,
+	"03-08": true,
+	"05-01": true,
+	"05-09": true,
+	"06-12": true,
+	"11-04": true,
+	"12-31": true,
+}
+
+// ExtraHolidays are the dates (year-month-day) of the other weekdays when Moscow Exchange doesn't trade
+var ExtraHolidays = map[string]bool{}
+
+// TradingWeekends are the dates (year-month-day) of Saturdays and Sundays when Moscow Exchange trades
+var TradingWeekends = map[string]bool{}
+
+// Calendar is the trading calendar of Moscow Exchange, it implements securities.TradingCalendar
+type Calendar struct{}
+
+var _ securities.TradingCalendar = Calendar{}
+
+// IsTradingDay checks if Moscow Exchange trades on the date
+func (Calendar) IsTradingDay(date time.Time) bool {
+	return IsTradingDay(date)
+}
+
+// maxCalendarDaysBack limits the search of previous trading day, it only protects from endless loop with wrong calendar
+const maxCalendarDaysBack = 366
+
+// IsTradingDay checks if Moscow Exchange trades on the date (the date is taken in its own location)
+func IsTradingDay(date time.Time) bool {
+	dateStr := date.Format("2006-01-02")
+
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return TradingWeekends[dateStr]
+	}
+
+	return !Holidays[date.Format("01-02")] && !ExtraHolidays[dateStr]
+}
+
+// PreviousTradingDay returns the beginning of the last trading day before the date
+func PreviousTradingDay(date time.Time) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	for i := 0; i < maxCalendarDaysBack; i++ {
+		day = day.AddDate(0, 0, -1)
+		if IsTradingDay(day) {
+			return day
+		}
+	}
+
+	return day
+}
+
+// LastTradingDay returns the beginning of the date if it's a trading day and the beginning of the previous trading day otherwise
+func LastTradingDay(date time.Time) time.Time {
+	if IsTradingDay(date) {
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	}
+
+	return PreviousTradingDay(date)
+}
@@ -0,0 +1,167 @@
+package moex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"securitiesModule/securities"
+	"strings"
+)
+
+// ErrUnknownSecurity is returned if Moscow Exchange has no security with the given id
+var ErrUnknownSecurity = errors.New("unknown security on exchange")
+
+// ErrSecurityNotTraded is returned if security is not traded on Moscow Exchange now
+var ErrSecurityNotTraded = errors.New("security is not traded on exchange")
+
+// SecurityDescription is the general information about security from Moscow Exchange
+type SecurityDescription struct {
+	Id       string
+	Name     string // short name
+	Type     securities.SecurityType
+	Currency securities.SecurityCurrency
+	Traded   bool // the security is traded on any board now
+}
+
+// moexTable is a type to parse Moscow Exchange json table with columns
+type moexTable struct {
+	Columns []string `json:"columns"`
+	Data    [][]any  `json:"data"`
+}
+
+// moexDescription is a type to parse Moscow Exchange json
+type moexDescription struct {
+	Description moexTable `json:"description"`
+	Boards      moexTable `json:"boards"`
+}
+
+// column returns the index of column with the given name or -1 if there is no such column
+func (t moexTable) column(name string) int {
+	for i, c := range t.Columns {
+		if c == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// groupTypes contains security types by Moscow Exchange security groups
+var groupTypes = map[string]securities.SecurityType{
+	"stock_shares":     securities.Share,
+	"stock_dr":         securities.Share,
+	"stock_bonds":      securities.Bond,
+	"stock_eurobond":   securities.Bond,
+	"stock_etf":        securities.ETF,
+	"stock_ppif":       securities.ETF,
+	"stock_index":      securities.Index,
+	"currency_indices": securities.Currency,
+}
+
+// currencyFromMoex converts Moscow Exchange currency code to security currency
+// Moscow Exchange uses old code SUR for roubles
+func currencyFromMoex(code string) securities.SecurityCurrency {
+	if strings.ToUpper(code) == "SUR" {
+		return securities.RUB
+	}
+
+	return securities.GetSecurityCurrencyFromString(code)
+}
+
+// GetSecurityDescription gets short name, type and currency of security from Moscow Exchange
+// ErrUnknownSecurity is returned if there is no such security on the exchange
+// Type and currency are unknown if they can't be used by securities package
+func GetSecurityDescription(ctx context.Context, id string) (*SecurityDescription, error) {
+	if id == "" {
+		return nil, errors.New("security has no id")
+	}
+
+	request := fmt.Sprintf("%s/securities/%s.json?iss.meta=off&iss.only=description,boards", BaseURL, url.PathEscape(strings.ToUpper(id)))
+
+	moexDesc := moexDescription{}
+	err := getJSON(ctx, request, &moexDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(moexDesc.Description.Data) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSecurity, id)
+	}
+
+	res := &SecurityDescription{
+		Id:       strings.ToUpper(id),
+		Type:     securities.UnknownType,
+		Currency: securities.UnknownCurrency,
+	}
+
+	// description is a list of name-value pairs
+	nameCol, valueCol := moexDesc.Description.column("name"), moexDesc.Description.column("value")
+	if nameCol < 0 || valueCol < 0 {
+		return nil, errors.New("wrong Moscow Exchange security description")
+	}
+
+	values := make(map[string]string, len(moexDesc.Description.Data))
+	for _, data := range moexDesc.Description.Data {
+		if len(data) <= nameCol || len(data) <= valueCol {
+			continue
+		}
+
+		name, _ := data[nameCol].(string)
+		value, _ := data[valueCol].(string)
+		values[name] = value
+	}
+
+	res.Name = values["SHORTNAME"]
+	if res.Name == "" {
+		res.Name = values["NAME"]
+	}
+
+	if sType, ok := groupTypes[values["GROUP"]]; ok {
+		res.Type = sType
+	}
+
+	// currency is taken from the primary board, it's not always in description
+	tradedCol, primaryCol, currencyCol := moexDesc.Boards.column("is_traded"), moexDesc.Boards.column("is_primary"), moexDesc.Boards.column("currencyid")
+	for _, data := range moexDesc.Boards.Data {
+		if tradedCol >= 0 && tradedCol < len(data) {
+			if traded, _ := floatValue(data[tradedCol]); traded == 1 {
+				res.Traded = true
+			}
+		}
+
+		if primaryCol < 0 || primaryCol >= len(data) || currencyCol < 0 || currencyCol >= len(data) {
+			continue
+		}
+
+		if primary, _ := floatValue(data[primaryCol]); primary == 1 {
+			code, _ := data[currencyCol].(string)
+			res.Currency = currencyFromMoex(code)
+		}
+	}
+
+	if res.Currency == securities.UnknownCurrency {
+		for _, name := range []string{"CURRENCYID", "FACEUNIT"} {
+			if values[name] != "" {
+				res.Currency = currencyFromMoex(values[name])
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Check checks that the security is traded on Moscow Exchange and has the given type
+// Type isn't checked if it's unknown from the description
+func (d *SecurityDescription) Check(sType securities.SecurityType) error {
+	if !d.Traded {
+		return fmt.Errorf("%w: %s", ErrSecurityNotTraded, d.Id)
+	}
+
+	if d.Type != securities.UnknownType && d.Type != sType {
+		return fmt.Errorf("security %s is %s on exchange, not %s", d.Id, d.Type, sType)
+	}
+
+	return nil
+}
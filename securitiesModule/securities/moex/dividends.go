@@ -0,0 +1,69 @@
+package moex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"securitiesModule/securities"
+	"sort"
+	"time"
+)
+
+// moexDividends is a type to parse Moscow Exchange json
+type moexDividends struct {
+	Dividends moexTable `json:"dividends"`
+}
+
+// GetDividends gets the history of dividends of security from Moscow Exchange sorted by date
+// Dividends in currencies which can't be used by securities package are skipped
+func GetDividends(ctx context.Context, sec *securities.Security) ([]securities.Dividend, error) {
+	if sec.Id() == "" {
+		return nil, errors.New("security has no id")
+	}
+
+	request := fmt.Sprintf("%s/securities/%s/dividends.json?iss.meta=off", BaseURL, url.PathEscape(sec.Id()))
+
+	moexDiv := moexDividends{}
+	err := getJSON(ctx, request, &moexDiv)
+	if err != nil {
+		return nil, err
+	}
+
+	dateCol, valueCol, currencyCol := moexDiv.Dividends.column("registryclosedate"), moexDiv.Dividends.column("value"), moexDiv.Dividends.column("currencyid")
+	if len(moexDiv.Dividends.Data) > 0 && (dateCol < 0 || valueCol < 0 || currencyCol < 0) {
+		return nil, errors.New("wrong Moscow Exchange dividends table")
+	}
+
+	res := make([]securities.Dividend, 0, len(moexDiv.Dividends.Data))
+	for _, data := range moexDiv.Dividends.Data {
+		if len(data) <= dateCol || len(data) <= valueCol || len(data) <= currencyCol {
+			return nil, errors.New("wrong Moscow Exchange dividends row")
+		}
+
+		dateStr, _ := data[dateCol].(string)
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("wrong Moscow Exchange dividend date %v", data[dateCol])
+		}
+
+		value, ok := floatValue(data[valueCol])
+		if !ok {
+			return nil, fmt.Errorf("wrong Moscow Exchange dividend value %v", data[valueCol])
+		}
+
+		code, _ := data[currencyCol].(string)
+		cur := currencyFromMoex(code)
+		if cur == securities.UnknownCurrency {
+			continue
+		}
+
+		res = append(res, securities.Dividend{Date: date, Value: value, Currency: cur})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Date.Before(res[j].Date)
+	})
+
+	return res, nil
+}
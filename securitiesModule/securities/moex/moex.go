@@ -2,18 +2,71 @@
 package moex
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"securitiesModule/metrics"
+	"securitiesModule/retry"
 	"securitiesModule/securities"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// BaseURL is the address of Moscow Exchange api (it may be changed for testing)
+var BaseURL = "https://iss.moex.com/iss"
+
+// HTTPClient is the client for all Moscow Exchange requests (it may be changed for testing)
+// Connections are kept alive between requests, and a stalled request is cancelled after timeout
+var HTTPClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// Logger is the logger of skipped data and retried requests (it may be changed by the service)
+var Logger = slog.Default()
+
+// MaxAttempts is the maximum number of attempts of one Moscow Exchange request
+var MaxAttempts = 3
+
+// RetryBaseDelay is the delay before the second attempt of Moscow Exchange request, every next delay is twice as long (plus random jitter)
+var RetryBaseDelay = 500 * time.Millisecond
+
+// PageWorkers is the maximum number of Moscow Exchange history pages requested at once
+// We shouldn't send too many requests at once - we may be blocked for this
+var PageWorkers = 2
+
+// RequestDelay is the delay after every Moscow Exchange history page request of every worker
+var RequestDelay = 200 * time.Millisecond
+
+// MaxDaysBack is the maximum number of days before the given date to look for trading data if there is no data for the date
+var MaxDaysBack = 30
+
+// CurrencyRateIds are ids of Moscow Exchange currency fixings which give rates of currencies in rubles
+var CurrencyRateIds = map[securities.SecurityCurrency]string{
+	securities.USD: "USDFIXME",
+	securities.EUR: "EURFIXME",
+	securities.CNY: "CNYFIXME",
+}
+
+// historyPageSize is the number of records on one Moscow Exchange history page
+const historyPageSize = 100
+
+// historyMaxRecords is the limit of Moscow Exchange history records for one type of securities
+// It only protects from endless paging, real number of records is much smaller
+const historyMaxRecords = 100000
+
 // moexCandle is a type to parse Moscow Exchange json
 type moexCandle struct {
 	CandleData [][]any `json:"data"`
@@ -24,14 +77,10 @@ type moexCandles struct {
 	Candles moexCandle `json:"candles"`
 }
 
-// moexHistoryRecord is a type to parse Moscow Exchange json
-type moexHistoryRecord struct {
-	HistoryRecordData [][]any `json:"data"`
-}
-
 // moexHistory is a type to parse Moscow Exchange json
+// Markets have different columns of history (indexes have no trades for example), so values are found by column names
 type moexHistory struct {
-	History moexHistoryRecord `json:"history"`
+	History moexTable `json:"history"`
 }
 
 // getEngineAndMarket returns engine and market of security type to use in Moscow Exchange api request
@@ -53,6 +102,10 @@ func getEngineAndMarket(sType securities.SecurityType) (engine string, market st
 		engine = "currency"
 		market = "index"
 		board = ""
+	case securities.Index:
+		engine = "stock"
+		market = "index"
+		board = ""
 	default:
 		err = fmt.Errorf("unknown security type: %s", sType)
 	}
@@ -60,8 +113,53 @@ func getEngineAndMarket(sType securities.SecurityType) (engine string, market st
 	return
 }
 
+// getJSON sends the request to Moscow Exchange and parses json answer into res
+// The request is retried (not more than MaxAttempts times) with exponential backoff on network errors and 5xx or 429 answers
+func getJSON(ctx context.Context, request string, res any) error {
+	return retry.Do(ctx, MaxAttempts, RetryBaseDelay, func() (bool, error) {
+		return getJSONOnce(ctx, request, res)
+	}, func(n int, err error) {
+		Logger.Warn("Moscow Exchange request failed", "request", request, "attempt", n, "error", err)
+	})
+}
+
+// getJSONOnce sends the request to Moscow Exchange once and parses json answer into res
+// Returns true if the request failed but may be retried
+func getJSONOnce(ctx context.Context, request string, res any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request, nil)
+	if err != nil {
+		return false, err
+	}
+
+	start := time.Now()
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		metrics.ObserveMoexRequest(start, 0)
+
+		// there is no sense to retry the request if it was cancelled
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	metrics.ObserveMoexRequest(start, resp.StatusCode)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return true, fmt.Errorf("Moscow Exchange answered with status %s", resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Moscow Exchange answered with status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+
+	return false, json.Unmarshal(body, res)
+}
+
 // GetSecurityQuotes gets quotes of the given security of the given interval for the given period from Moscow Exchange
-func GetSecurityQuotes(sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+func GetSecurityQuotes(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
 	engine, market, board, err := getEngineAndMarket(sec.SType())
 	if err != nil {
 		return err
@@ -72,78 +170,168 @@ func GetSecurityQuotes(sec *securities.Security, dateFrom time.Time, dateTill ti
 		boardStr = "/boards/" + board
 	}
 
-	request := fmt.Sprintf("https://iss.moex.com/iss/engines/%s/markets/%s%s/securities/%s/candles.json?from=%s&till=%s&interval=%s",
-		engine, market, boardStr, sec.Id(), dateFrom.Format("2006-01-02"), dateTill.Format("2006-01-02"), fmt.Sprint(interval))
+	request := fmt.Sprintf("%s/engines/%s/markets/%s%s/securities/%s/candles.json?from=%s&till=%s&interval=%s",
+		BaseURL, engine, market, boardStr, sec.Id(), dateFrom.Format("2006-01-02"), dateTill.Format("2006-01-02"), fmt.Sprint(interval))
 
-	resp, err := http.Get(request)
+	moexCandles := moexCandles{}
+	err = getJSON(ctx, request, &moexCandles)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// parsing of candle is cheap, so there is no need in concurrency here
+	quotes := make([]securities.SecurityQuotes, 0, len(moexCandles.Candles.CandleData))
+	for _, candle := range moexCandles.Candles.CandleData {
+		quote, ok, err := candleQuotes(candle, interval)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			Logger.Warn("skipping bad Moscow Exchange candle", "id", sec.Id(), "interval", interval, "candle", candle)
+			continue
+		}
+
+		quotes = append(quotes, quote)
+	}
+
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[j].Begin.After(quotes[i].Begin)
+	})
+
+	sec.AddQuotes(quotes)
+
+	return nil
+}
+
+// candleQuotes converts Moscow Exchange candle to quotes of the given interval
+// It returns false if the candle has no prices or dates and error if the dates can't be parsed
+func candleQuotes(candle []any, interval securities.QuotesInterval) (securities.SecurityQuotes, bool, error) {
+	if len(candle) < 8 {
+		return securities.SecurityQuotes{}, false, nil
+	}
+
+	beginStr, okBegin := candle[6].(string)
+	endStr, okEnd := candle[7].(string)
+	if !okBegin || !okEnd {
+		return securities.SecurityQuotes{}, false, nil
+	}
+
+	begin, err := time.Parse("2006-01-02 15:04:05", beginStr)
 	if err != nil {
-		return err
+		return securities.SecurityQuotes{}, false, errors.New("can't convert Moscow Exchange date format: " + beginStr)
 	}
 
-	moexCandles := moexCandles{}
-	err = json.Unmarshal(body, &moexCandles)
+	end, err := time.Parse("2006-01-02 15:04:05", endStr)
 	if err != nil {
-		return err
+		return securities.SecurityQuotes{}, false, errors.New("can't convert Moscow Exchange date format: " + endStr)
 	}
 
-	wg := new(sync.WaitGroup)
-	mu := new(sync.Mutex)
+	open, okOpen := floatValue(candle[0])
+	closePrice, okClose := floatValue(candle[1])
+	high, okHigh := floatValue(candle[2])
+	low, okLow := floatValue(candle[3])
+	if !okOpen || !okClose || !okHigh || !okLow {
+		return securities.SecurityQuotes{}, false, nil
+	}
 
-	var quotes []securities.SecurityQuotes
-	for _, candle := range moexCandles.Candles.CandleData {
-		wg.Add(1)
+	// volume may be absent (for indices for example)
+	volume, _ := floatValue(candle[5])
+
+	return securities.SecurityQuotes{
+		Interval: interval,
+		Begin:    begin,
+		End:      end,
+		Open:     open,
+		Close:    closePrice,
+		High:     high,
+		Low:      low,
+		Volume:   volume,
+	}, true, nil
+}
 
-		go func(candle []any) {
-			defer wg.Done()
+// floatValue converts number from Moscow Exchange json to float64
+// Numbers may come as strings, null values are not converted
+func floatValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
 
-			begin, err := time.Parse("2006-01-02 15:04:05", candle[6].(string))
-			if err != nil {
-				log.Fatal("can't convert Moscow Exchange date format: " + candle[6].(string))
-			}
+// setHistoryQuotes sets day quotes for the given date from Moscow Exchange history records to securities with the same ids
+// Only records of the given board are used (records of any board if it's empty), records without prices (illiquid securities) are skipped
+func setHistoryQuotes(history moexTable, board string, sIds map[string]*securities.Security, date time.Time) {
+	if len(history.Data) == 0 {
+		return
+	}
 
-			end, err := time.Parse("2006-01-02 15:04:05", candle[7].(string))
-			if err != nil {
-				log.Fatal("can't convert Moscow Exchange date format: " + candle[6].(string))
-			}
+	boardCol, idCol := history.column("BOARDID"), history.column("SECID")
+	openCol, closeCol, highCol, lowCol := history.column("OPEN"), history.column("CLOSE"), history.column("HIGH"), history.column("LOW")
+	volumeCol := history.column("VOLUME")
+	if boardCol < 0 || idCol < 0 || openCol < 0 || closeCol < 0 || highCol < 0 || lowCol < 0 {
+		Logger.Warn("skipping Moscow Exchange history without price columns", "date", date.Format("2006-01-02"), "columns", history.Columns)
+		return
+	}
 
-			secQuotes := securities.SecurityQuotes{
-				Interval: interval,
-				Begin:    begin,
-				End:      end,
-				Open:     candle[0].(float64),
-				Close:    candle[1].(float64),
-				High:     candle[2].(float64),
-				Low:      candle[3].(float64),
-			}
+	for _, data := range history.Data {
+		if len(data) < len(history.Columns) {
+			Logger.Warn("skipping bad Moscow Exchange history record", "date", date.Format("2006-01-02"), "record", data)
+			continue
+		}
 
-			mu.Lock()
-			quotes = append(quotes, secQuotes)
-			mu.Unlock()
-		}(candle)
-	}
+		recordBoard, _ := data[boardCol].(string)
+		id, _ := data[idCol].(string)
+		if (board != "" && recordBoard != board) || id == "" {
+			continue
+		}
 
-	wg.Wait()
+		s, ok := sIds[strings.ToUpper(id)]
+		if !ok {
+			continue
+		}
 
-	sort.Slice(quotes, func(i, j int) bool {
-		return quotes[j].Begin.After(quotes[i].Begin)
-	})
+		open, okOpen := floatValue(data[openCol])
+		closePrice, okClose := floatValue(data[closeCol])
+		high, okHigh := floatValue(data[highCol])
+		low, okLow := floatValue(data[lowCol])
+		if !okOpen || !okClose || !okHigh || !okLow {
+			Logger.Debug("skipping Moscow Exchange history record without prices", "id", id, "date", date.Format("2006-01-02"))
+			continue
+		}
 
-	sec.SetQuotesList(&quotes)
+		var volume float64
+		if volumeCol >= 0 {
+			volume, _ = floatValue(data[volumeCol])
+		}
 
-	return nil
+		s.SetQuotes(securities.SecurityQuotes{
+			Interval: securities.IntervalDay,
+			Begin:    date.Truncate(24 * time.Hour),
+			End:      date.AddDate(0, 0, 1).Truncate(24 * time.Hour),
+			Open:     open,
+			Close:    closePrice,
+			High:     high,
+			Low:      low,
+			Volume:   volume,
+		})
+	}
 }
 
 // GetQuotesForDate gets quotes for the given list of securities on the given date from Moscow Exchange
-func GetQuotesForDate(sec []*securities.Security, date time.Time) error {
-	// No concurrency for Moscow Exchange requests - we may be blocked for this
-	wg := new(sync.WaitGroup)
+// If there is no trading data for the date the previous days are checked (not more than MaxDaysBack days)
+func GetQuotesForDate(ctx context.Context, sec []*securities.Security, date time.Time) error {
+	return getQuotesForDate(ctx, sec, date, 0)
+}
 
+// getQuotesForDate gets quotes for the given list of securities on the given date from Moscow Exchange
+// daysBack is the number of days already checked before the date
+func getQuotesForDate(ctx context.Context, sec []*securities.Security, date time.Time, daysBack int) error {
 	sTypes := make(map[securities.SecurityType]bool)
 	sIds := make(map[string]*securities.Security)
 	for _, s := range sec {
@@ -162,67 +350,113 @@ func GetQuotesForDate(sec []*securities.Security, date time.Time) error {
 			boardStr = "/boards/" + board
 		}
 
-		for start := 0; start < 1000; start += 100 {
-			request := fmt.Sprintf("https://iss.moex.com/iss/history/engines/%s/markets/%s%s/securities.json?date=%s&start=%s",
-				engine, market, boardStr, date.Format("2006-01-02"), fmt.Sprint(start))
+		// shares are traded on several boards, their main board is used
+		// indexes and other securities are traded on one board each (IMOEX on SNDX and RTSI on RTSI for example), so they are found by id only
+		boardToCheck := board
+		if board == "" && sType == securities.Share {
+			boardToCheck = "TQBR"
+		}
 
-			resp, err := http.Get(request)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
+		getPage := func(start int) (moexTable, error) {
+			request := fmt.Sprintf("%s/history/engines/%s/markets/%s%s/securities.json?date=%s&start=%s",
+				BaseURL, engine, market, boardStr, date.Format("2006-01-02"), fmt.Sprint(start))
 
-			body, err := io.ReadAll(resp.Body)
+			moexHistory := moexHistory{}
+			err := getJSON(ctx, request, &moexHistory)
 			if err != nil {
-				return err
+				return moexTable{}, err
 			}
 
-			moexHistory := moexHistory{}
-			err = json.Unmarshal(body, &moexHistory)
-			if err != nil {
-				return err
+			return moexHistory.History, nil
+		}
+
+		// the first page shows if there is any data for this day
+		records, err := getPage(0)
+		if err != nil {
+			return err
+		}
+
+		if len(records.Data) == 0 {
+			if daysBack >= MaxDaysBack {
+				return fmt.Errorf("no trading data found within %d days", MaxDaysBack)
 			}
 
-			if len(moexHistory.History.HistoryRecordData) == 0 {
-				if start == 0 {
-					// no data for this day - let's look on previous day
-					return GetQuotesForDate(sec, date.AddDate(0, 0, -1))
+			// no data for this day - let's look on previous day
+			return getQuotesForDate(ctx, sec, date.AddDate(0, 0, -1), daysBack+1)
+		}
+
+		setHistoryQuotes(records, boardToCheck, sIds, date)
+
+		if len(records.Data) < historyPageSize {
+			continue
+		}
+
+		// the other pages are requested by limited number of workers
+		wg := new(sync.WaitGroup)
+		mu := new(sync.Mutex)
+		starts := make(chan int)
+
+		var pagesErr error
+		lastStart := historyMaxRecords // start of the last page with data, we don't know it yet
+
+		for w := 0; w < PageWorkers; w++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for start := range starts {
+					mu.Lock()
+					skip := start > lastStart || pagesErr != nil
+					mu.Unlock()
+
+					if skip {
+						continue
+					}
+
+					records, err := getPage(start)
+
+					mu.Lock()
+					if err != nil && pagesErr == nil {
+						pagesErr = err
+					}
+					if err == nil && len(records.Data) < historyPageSize && start < lastStart {
+						lastStart = start
+					}
+					mu.Unlock()
+
+					setHistoryQuotes(records, boardToCheck, sIds, date)
+
+					time.Sleep(RequestDelay)
 				}
+			}()
+		}
 
+		// pages are requested until the last page is found
+		for start := historyPageSize; ; start += historyPageSize {
+			mu.Lock()
+			done := start > lastStart || pagesErr != nil
+			mu.Unlock()
+
+			if done {
 				break
 			}
 
-			boardToCheck := "TQBR"
-			if board != "" {
-				boardToCheck = board
+			if start >= historyMaxRecords {
+				mu.Lock()
+				pagesErr = fmt.Errorf("too many Moscow Exchange history records (more than %d)", historyMaxRecords)
+				mu.Unlock()
+				break
 			}
 
-			for _, data := range moexHistory.History.HistoryRecordData {
-				wg.Add(1)
-
-				go func(data []any) {
-					defer wg.Done()
-
-					if data[0].(string) == boardToCheck && data[3] != nil && data[11] != nil {
-						s, ok := sIds[strings.ToUpper(data[3].(string))]
-						if !ok {
-							return
-						}
-
-						s.SetQuotes(securities.SecurityQuotes{
-							Interval: securities.IntervalDay,
-							Begin:    date.Truncate(24 * time.Hour),
-							End:      date.AddDate(0, 0, 1).Truncate(24 * time.Hour),
-							Open:     data[6].(float64),
-							Close:    data[11].(float64),
-							High:     data[8].(float64),
-							Low:      data[7].(float64),
-						})
-					}
-				}(data)
-			}
+			starts <- start
+		}
+		close(starts)
+
+		wg.Wait()
 
-			wg.Wait()
+		if pagesErr != nil {
+			return pagesErr
 		}
 	}
 
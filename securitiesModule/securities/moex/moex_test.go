@@ -1,15 +1,74 @@
 package moex
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"securitiesModule/securities"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// useTestServer makes the package send requests to the test server with the given handler while the test is running
+func useTestServer(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+
+	baseURL, httpClient, requestDelay := BaseURL, HTTPClient, RequestDelay
+	BaseURL, HTTPClient, RequestDelay = server.URL, server.Client(), 0
+
+	t.Cleanup(func() {
+		server.Close()
+		BaseURL, HTTPClient, RequestDelay = baseURL, httpClient, requestDelay
+	})
+}
+
+// fixtureHandler answers with Moscow Exchange json captured in src directory
+// There are GAZP and IMOEX day candles for January 2022, shares and indexes history for 04.02.2022, GAZP description, SBER dividends and SU26240RMFS0 bond payments
+func fixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	fileName := ""
+
+	switch request.URL.Path {
+	case "/engines/stock/markets/shares/securities/GAZP/candles.json":
+		fileName = "GAZP_candles.json"
+	case "/engines/stock/markets/index/securities/IMOEX/candles.json":
+		fileName = "IMOEX_candles.json"
+	case "/securities/GAZP.json":
+		fileName = "GAZP_description.json"
+	case "/securities/SBER/dividends.json":
+		fileName = "SBER_dividends.json"
+	case "/securities/SU26240RMFS0/bondization.json":
+		fileName = "SU26240_bondization.json"
+	case "/history/engines/stock/markets/shares/securities.json":
+		if request.URL.Query().Get("date") == "2022-02-04" && request.URL.Query().Get("start") == "0" {
+			fileName = "history_2022-02-04.json"
+		}
+	case "/history/engines/stock/markets/index/securities.json":
+		if request.URL.Query().Get("date") == "2022-02-04" && request.URL.Query().Get("start") == "0" {
+			fileName = "history_index_2022-02-04.json"
+		}
+	}
+
+	if fileName == "" {
+		writer.Write([]byte(`{"candles": {"data": []}, "history": {"data": []}, "description": {"columns": ["name", "title", "value"], "data": []}, "boards": {"columns": [], "data": []}, "dividends": {"columns": [], "data": []}, "coupons": {"columns": [], "data": []}, "amortizations": {"columns": [], "data": []}}`))
+		return
+	}
+
+	http.ServeFile(writer, request, filepath.Join("src", fileName))
+}
+
 func TestGetSecurityQuotes(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
 	secGAZP := securities.GetQuickSecurity("GAZP", securities.Share)
 
-	err := GetSecurityQuotes(secGAZP, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
+	err := GetSecurityQuotes(context.Background(), secGAZP, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -27,12 +86,41 @@ func TestGetSecurityQuotes(t *testing.T) {
 	}
 }
 
+func TestGetSecurityQuotesIndex(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
+	secIMOEX := securities.GetQuickSecurity("IMOEX", securities.Index)
+
+	err := GetSecurityQuotes(context.Background(), secIMOEX, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quotes := *secIMOEX.QuotesOfInterval(securities.IntervalDay)
+	if len(quotes) == 0 {
+		t.Fatal("no quotes for IMOEX in January 2022")
+	}
+
+	for _, q := range quotes {
+		if q.Close <= 0.0 {
+			t.Errorf("wrong price for IMOEX on %s - %f", q.End.Format("02.01.2006"), q.Close)
+		}
+	}
+
+	lastPrice := secIMOEX.LastQuotes(securities.IntervalDay)
+	if lastPrice.Close != 3531.08 {
+		t.Errorf("wrong last price (IMOEX on 31.01.2022) - want 3531.08, got %f", lastPrice.Close)
+	}
+}
+
 func TestGetQuotesForDate(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
 	secGAZP := securities.GetQuickSecurity("GAZP", securities.Share)
 	secLKOH := securities.GetQuickSecurity("LKOH", securities.Share)
 
 	securitiesList := []*securities.Security{secGAZP, secLKOH}
-	err := GetQuotesForDate(securitiesList, time.Date(2022, 2, 4, 0, 0, 0, 0, time.UTC))
+	err := GetQuotesForDate(context.Background(), securitiesList, time.Date(2022, 2, 4, 0, 0, 0, 0, time.UTC))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -47,3 +135,380 @@ func TestGetQuotesForDate(t *testing.T) {
 		t.Errorf("wrong last price (LKOH on 4.02.2022) - want 7010, got %f", lastPr2.Close)
 	}
 }
+
+func TestGetQuotesForDateIndex(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
+	// indexes are on their own boards, not on the main board of shares
+	secIMOEX := securities.GetQuickSecurity("IMOEX", securities.Index)
+	secRTSI := securities.GetQuickSecurity("RTSI", securities.Index)
+
+	err := GetQuotesForDate(context.Background(), []*securities.Security{secIMOEX, secRTSI}, time.Date(2022, 2, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := secIMOEX.LastQuotes(securities.IntervalDay); q.Close != 3507.17 {
+		t.Errorf("wrong last price (IMOEX on 4.02.2022) - want 3507.17, got %f", q.Close)
+	}
+
+	if q := secRTSI.LastQuotes(securities.IntervalDay); q.Close != 1436.65 {
+		t.Errorf("wrong last price (RTSI on 4.02.2022) - want 1436.65, got %f", q.Close)
+	}
+}
+
+// historyColumns are the columns of Moscow Exchange shares history
+var historyColumns = []string{"BOARDID", "TRADEDATE", "SHORTNAME", "SECID", "NUMTRADES", "VALUE", "OPEN", "LOW", "HIGH", "LEGALCLOSEPRICE", "WAPRICE", "CLOSE", "VOLUME"}
+
+// historyRecord returns Moscow Exchange history record for the given security and close price
+func historyRecord(board string, id string, price float64) []any {
+	return []any{board, "2022-02-04", id, id, 100.0, 1000.0, price, price, price, price, price, price, 10.0}
+}
+
+func TestGetQuotesForDatePages(t *testing.T) {
+	// 250 records on 04.02.2022 (three pages), LKOH is on the last page and there are no records on 05.02.2022
+	var requests int32
+
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		start, _ := strconv.Atoi(request.URL.Query().Get("start"))
+
+		records := [][]any{}
+		if request.URL.Query().Get("date") == "2022-02-04" {
+			for i := start; i < start+100 && i < 250; i++ {
+				switch i {
+				case 5:
+					records = append(records, historyRecord("TQBR", "GAZP", 324.6))
+				case 6:
+					records = append(records, historyRecord("SMAL", "GAZP", 1.0))
+				case 220:
+					records = append(records, historyRecord("TQBR", "LKOH", 7010.0))
+				default:
+					records = append(records, historyRecord("TQBR", fmt.Sprintf("SEC%d", i), 1.0))
+				}
+			}
+		}
+
+		res, _ := json.Marshal(map[string]any{"history": map[string]any{"columns": historyColumns, "data": records}})
+		writer.Write(res)
+	})
+
+	secGAZP := securities.GetQuickSecurity("GAZP", securities.Share)
+	secLKOH := securities.GetQuickSecurity("LKOH", securities.Share)
+
+	err := GetQuotesForDate(context.Background(), []*securities.Security{secGAZP, secLKOH}, time.Date(2022, 2, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastPr1 := secGAZP.LastQuotes(securities.IntervalDay)
+	if lastPr1.Close != 324.6 {
+		t.Errorf("wrong last price (GAZP on 4.02.2022) - want 324.6, got %f", lastPr1.Close)
+	}
+
+	lastPr2 := secLKOH.LastQuotes(securities.IntervalDay)
+	if lastPr2.Close != 7010.0 {
+		t.Errorf("wrong last price (LKOH on 4.02.2022) - want 7010, got %f", lastPr2.Close)
+	}
+
+	// one request for 05.02.2022 and three pages for 04.02.2022 plus maybe some extra pages requested by workers at once
+	if n := atomic.LoadInt32(&requests); n < 4 || n > 4+int32(PageWorkers) {
+		t.Errorf("wrong number of requests - want 4, got %d", n)
+	}
+}
+
+func TestGetQuotesForDateManyRecords(t *testing.T) {
+	// 1500 records (more than the old limit of 1000), LKOH is on the last page
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		start, _ := strconv.Atoi(request.URL.Query().Get("start"))
+
+		records := [][]any{}
+		for i := start; i < start+100 && i < 1500; i++ {
+			id := fmt.Sprintf("SEC%d", i)
+			if i == 1450 {
+				id = "LKOH"
+			}
+			records = append(records, historyRecord("TQBR", id, float64(i)))
+		}
+
+		res, _ := json.Marshal(map[string]any{"history": map[string]any{"columns": historyColumns, "data": records}})
+		writer.Write(res)
+	})
+
+	secLKOH := securities.GetQuickSecurity("LKOH", securities.Share)
+
+	err := GetQuotesForDate(context.Background(), []*securities.Security{secLKOH}, time.Date(2022, 2, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := secLKOH.LastQuotes(securities.IntervalDay); q.Close != 1450 {
+		t.Errorf("wrong last price of LKOH - want 1450, got %f", q.Close)
+	}
+}
+
+func TestGetQuotesForDateNoData(t *testing.T) {
+	var requests int32
+
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writer.Write([]byte(`{"history": {"data": []}}`))
+	})
+
+	maxDaysBack := MaxDaysBack
+	MaxDaysBack = 5
+	defer func() { MaxDaysBack = maxDaysBack }()
+
+	secGAZP := securities.GetQuickSecurity("GAZP", securities.Share)
+
+	err := GetQuotesForDate(context.Background(), []*securities.Security{secGAZP}, time.Date(2022, 2, 5, 0, 0, 0, 0, time.UTC))
+	if err == nil {
+		t.Fatal("no error when there is no trading data at all")
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 6 {
+		t.Errorf("wrong number of requests - want 6, got %d", n)
+	}
+}
+
+func TestGetJSONRetry(t *testing.T) {
+	var requests int32
+
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		switch {
+		case request.URL.Path == "/missing":
+			writer.WriteHeader(http.StatusNotFound)
+		case n < 3:
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			writer.Write([]byte(`{"history": {"data": [["TQBR"]]}}`))
+		}
+	})
+
+	retryBaseDelay := RetryBaseDelay
+	RetryBaseDelay = time.Millisecond
+	defer func() { RetryBaseDelay = retryBaseDelay }()
+
+	res := moexHistory{}
+	err := getJSON(context.Background(), BaseURL+"/data", &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("wrong number of requests - want 3, got %d", n)
+	}
+
+	if len(res.History.Data) != 1 {
+		t.Errorf("wrong answer after retries - want 1 record, got %d", len(res.History.Data))
+	}
+
+	// client errors are not retried
+	atomic.StoreInt32(&requests, 0)
+
+	err = getJSON(context.Background(), BaseURL+"/missing", &res)
+	if err == nil {
+		t.Error("no error for not found answer")
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("wrong number of requests for not found answer - want 1, got %d", n)
+	}
+}
+
+func TestBadRows(t *testing.T) {
+	// rows with nulls, strings and missing columns must be skipped or zero-filled without panic
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		file := "src/bad_candles.json"
+		if strings.Contains(request.URL.Path, "/history/") {
+			file = "src/history_bad.json"
+			if request.URL.Query().Get("start") != "0" {
+				file = ""
+			}
+		}
+
+		if file == "" {
+			writer.Write([]byte(`{"history": {"data": []}}`))
+			return
+		}
+
+		http.ServeFile(writer, request, file)
+	})
+
+	sec := securities.GetQuickSecurity("SBER", securities.Share)
+
+	err := GetSecurityQuotes(context.Background(), sec, time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 1, 14, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quotes := *sec.QuotesOfInterval(securities.IntervalDay)
+	if len(quotes) != 3 {
+		t.Fatalf("wrong number of quotes - want 3, got %d", len(quotes))
+	}
+
+	if quotes[1].Close != 102.5 || quotes[1].Volume != 0 {
+		t.Errorf("wrong quotes with null volume - want close 102.5 and volume 0, got %f and %f", quotes[1].Close, quotes[1].Volume)
+	}
+
+	if quotes[2].Close != 103 || quotes[2].Volume != 10000 {
+		t.Errorf("wrong quotes with string prices - want close 103 and volume 10000, got %f and %f", quotes[2].Close, quotes[2].Volume)
+	}
+
+	secGAZP := securities.GetQuickSecurity("GAZP", securities.Share)
+	secLKOH := securities.GetQuickSecurity("LKOH", securities.Share)
+	secSBER := securities.GetQuickSecurity("SBER", securities.Share)
+
+	err = GetQuotesForDate(context.Background(), []*securities.Security{secGAZP, secLKOH, secSBER}, time.Date(2022, 2, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := secGAZP.LastQuotes(securities.IntervalDay); q.Close != 324.6 || q.Volume != 0 {
+		t.Errorf("wrong GAZP quotes - want close 324.6 and volume 0, got %f and %f", q.Close, q.Volume)
+	}
+
+	if q := *secLKOH.QuotesOfInterval(securities.IntervalDay); len(q) != 0 {
+		t.Errorf("LKOH record without prices is not skipped - got %d quotes", len(q))
+	}
+
+	if q := secSBER.LastQuotes(securities.IntervalDay); q.Close != 261.5 || q.Volume != 5000 {
+		t.Errorf("wrong SBER quotes - want close 261.5 and volume 5000, got %f and %f", q.Close, q.Volume)
+	}
+}
+
+func TestBadCandleDate(t *testing.T) {
+	useTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(`{"candles": {"data": [[100, 101, 102, 99, 1000, 10, "10.01.2022", "2022-01-10 23:59:59"]]}}`))
+	})
+
+	sec := securities.GetQuickSecurity("SBER", securities.Share)
+
+	err := GetSecurityQuotes(context.Background(), sec, time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 1, 14, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
+	if err == nil {
+		t.Error("no error for malformed candle date")
+	}
+}
+
+func TestTradingCalendar(t *testing.T) {
+	days := map[time.Time]bool{
+		time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC):  true,  // Thursday
+		time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC):  false, // holiday
+		time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC):  false, // Saturday
+		time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC): false, // Sunday
+		time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC): true,  // Monday
+	}
+
+	for date, want := range days {
+		if got := IsTradingDay(date); got != want {
+			t.Errorf("wrong trading day check for %s - want %v, got %v", date.Format("02.01.2006"), want, got)
+		}
+	}
+
+	monday := time.Date(2024, 3, 11, 15, 30, 0, 0, time.UTC)
+	if got := PreviousTradingDay(monday); !got.Equal(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong previous trading day for 11.03.2024 - want 07.03.2024, got %s", got.Format("02.01.2006"))
+	}
+	if got := LastTradingDay(monday); !got.Equal(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong last trading day for 11.03.2024 - want 11.03.2024, got %s", got.Format("02.01.2006"))
+	}
+
+	TradingWeekends["2024-03-09"] = true
+	ExtraHolidays["2024-03-07"] = true
+	defer func() {
+		delete(TradingWeekends, "2024-03-09")
+		delete(ExtraHolidays, "2024-03-07")
+	}()
+
+	if got := LastTradingDay(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)); !got.Equal(time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("trading Saturday is skipped - got %s", got.Format("02.01.2006"))
+	}
+	if IsTradingDay(time.Date(2024, 3, 7, 0, 0, 0, 0, time.UTC)) {
+		t.Error("extra holiday is a trading day")
+	}
+}
+
+func TestGetSecurityDescription(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
+	desc, err := GetSecurityDescription(context.Background(), "gazp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if desc.Id != "GAZP" || desc.Name != "ГАЗПРОМ ао" || desc.Type != securities.Share || desc.Currency != securities.RUB || !desc.Traded {
+		t.Errorf("wrong GAZP description - got %+v", *desc)
+	}
+
+	if err := desc.Check(securities.Share); err != nil {
+		t.Errorf("GAZP share check failed: %v", err)
+	}
+	if err := desc.Check(securities.Bond); err == nil {
+		t.Error("no error for GAZP bond check")
+	}
+
+	desc.Traded = false
+	if err := desc.Check(securities.Share); !errors.Is(err, ErrSecurityNotTraded) {
+		t.Errorf("wrong error for not traded security - want %v, got %v", ErrSecurityNotTraded, err)
+	}
+
+	_, err = GetSecurityDescription(context.Background(), "NOSUCH")
+	if !errors.Is(err, ErrUnknownSecurity) {
+		t.Errorf("wrong error for unknown security - want %v, got %v", ErrUnknownSecurity, err)
+	}
+}
+
+func TestGetDividends(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
+	div, err := GetDividends(context.Background(), securities.GetQuickSecurity("sber", securities.Share))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(div) != 5 {
+		t.Fatalf("wrong number of SBER dividends - want 5, got %d", len(div))
+	}
+
+	if !div[3].Date.Equal(time.Date(2023, 5, 11, 0, 0, 0, 0, time.UTC)) || div[3].Value != 25 || div[3].Currency != securities.RUB {
+		t.Errorf("wrong SBER dividend of 2023 - got %+v", div[3])
+	}
+
+	div, err = GetDividends(context.Background(), securities.GetQuickSecurity("GAZP", securities.Share))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(div) != 0 {
+		t.Errorf("wrong number of GAZP dividends - want 0, got %d", len(div))
+	}
+}
+
+func TestGetBondInfo(t *testing.T) {
+	useTestServer(t, fixtureHandler)
+
+	bond, err := GetBondInfo(context.Background(), securities.GetQuickSecurity("SU26240RMFS0", securities.Bond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bond.FaceValue != 1000 || len(bond.Payments) != 3 {
+		t.Fatalf("wrong bond info - want face value 1000 and 3 payments, got %f and %d", bond.FaceValue, len(bond.Payments))
+	}
+
+	// the last coupon is unknown, it's equal to the previous one, and it's paid with the redemption
+	last := bond.Payments[2]
+	if last.Coupon != 34.9 || last.Amortization != 1000 || !last.Start.Equal(time.Date(2036, 1, 30, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong the last payment - got %+v", last)
+	}
+
+	_, err = GetBondInfo(context.Background(), securities.GetQuickSecurity("GAZP", securities.Bond))
+	if !errors.Is(err, ErrUnknownSecurity) {
+		t.Errorf("wrong error for security without payments - want %v, got %v", ErrUnknownSecurity, err)
+	}
+}
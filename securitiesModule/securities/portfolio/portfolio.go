@@ -0,0 +1,318 @@
+// Package portfolio contains the type Portfolio with positions of securities and methods to value it by stored quotes
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"securitiesModule/securities"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrPortfolioNotExist is returned if there is no portfolio with the given id in storage
+var ErrPortfolioNotExist = errors.New("portfolio does not exist")
+
+// ErrNoQuotes is returned if security of position has no stored quotes to value it
+var ErrNoQuotes = errors.New("security has no quotes")
+
+// Position is a quantity of security bought at the average price
+type Position struct {
+	Id       string
+	Type     securities.SecurityType
+	Quantity float64
+	AvgPrice float64 // average buy price
+}
+
+// Portfolio is a named list of positions
+type Portfolio struct {
+	Id        int64 // it's set by storage
+	Name      string
+	Positions []Position
+}
+
+// Store keeps portfolios
+type Store interface {
+	// AddPortfolio adds portfolio with its positions to storage and sets its id
+	// Securities of positions must exist in storage
+	AddPortfolio(p *Portfolio) error
+	// GetPortfolio returns portfolio with the given id, ErrPortfolioNotExist is returned if there is no such portfolio
+	GetPortfolio(id int64) (*Portfolio, error)
+	// GetAllPortfolios returns all portfolios sorted by id
+	GetAllPortfolios() ([]*Portfolio, error)
+	// DeletePortfolio removes portfolio with its positions from storage
+	DeletePortfolio(id int64) error
+}
+
+// QuotesSource gives stored securities data with quotes and currency rates, securities.Store is used usually
+type QuotesSource interface {
+	GetSecuritiesData(sec []*securities.Security) error
+	GetCurrencyRate(ctx context.Context, currency securities.SecurityCurrency, date time.Time) (float64, error)
+}
+
+// PositionValue is the value of position by close price of some date
+// Close price is in the currency of security, value and profit are in the base currency of valuation
+type PositionValue struct {
+	Position
+	Currency securities.SecurityCurrency
+	Close    float64
+	Rate     float64 // the rate of security currency in the base currency
+	Value    float64 // quantity * close price * rate
+	PL       float64 // unrealized profit or loss - the difference between value and buy cost
+}
+
+// Valuation is the value of portfolio by close prices of some date in the base currency
+type Valuation struct {
+	Date      time.Time
+	Currency  securities.SecurityCurrency
+	Value     float64
+	Cost      float64 // buy cost of all positions
+	PL        float64
+	Positions []PositionValue
+}
+
+// PortfolioPoint is the value of portfolio in the base currency by close prices of quotes which begin at the date
+type PortfolioPoint struct {
+	Date  time.Time
+	Value float64
+	PL    float64 // unrealized profit or loss
+}
+
+// New creates a new portfolio and checks it
+// Ids of securities are converted to upper case as in securities package
+func New(name string, positions []Position) (*Portfolio, error) {
+	p := &Portfolio{
+		Name:      strings.TrimSpace(name),
+		Positions: make([]Position, 0, len(positions)),
+	}
+
+	for _, pos := range positions {
+		pos.Id = strings.ToUpper(strings.TrimSpace(pos.Id))
+		p.Positions = append(p.Positions, pos)
+	}
+
+	err := p.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Check checks that portfolio has a name and its positions are correct (every security is only once)
+func (p *Portfolio) Check() error {
+	if p.Name == "" {
+		return errors.New("portfolio has no name")
+	}
+
+	seen := make(map[string]bool, len(p.Positions))
+	for _, pos := range p.Positions {
+		if pos.Id == "" {
+			return errors.New("position has no security id")
+		}
+
+		if securities.GetSecurityTypeFromString(string(pos.Type)) == securities.UnknownType {
+			return fmt.Errorf("position %s has unknown type %s", pos.Id, pos.Type)
+		}
+
+		if pos.Quantity <= 0 || pos.AvgPrice < 0 {
+			return fmt.Errorf("position %s has wrong quantity %f or average price %f", pos.Id, pos.Quantity, pos.AvgPrice)
+		}
+
+		if seen[pos.Id] {
+			return fmt.Errorf("security %s is in portfolio twice", pos.Id)
+		}
+		seen[pos.Id] = true
+	}
+
+	return nil
+}
+
+// quickSecurities returns securities of positions without data
+func (p *Portfolio) quickSecurities() []*securities.Security {
+	res := make([]*securities.Security, 0, len(p.Positions))
+	for _, pos := range p.Positions {
+		res = append(res, securities.GetQuickSecurity(pos.Id, pos.Type))
+	}
+
+	return res
+}
+
+// Value values portfolio by close prices of the given date in the base currency
+// The last daily quotes which end not later than the end of the date are used, so the prices of the previous trading day are used for holidays
+// Values of positions are converted by currency rates of the date, buy cost is converted by the same rates
+// ErrNoQuotes is returned if any security has no daily quotes by the date, securities.ErrNoRate is returned if a rate is missing
+func (p *Portfolio) Value(ctx context.Context, source QuotesSource, date time.Time, base securities.SecurityCurrency) (*Valuation, error) {
+	if base == securities.UnknownCurrency {
+		return nil, errors.New("unknown base currency")
+	}
+
+	secList := p.quickSecurities()
+
+	err := source.GetSecuritiesData(secList)
+	if err != nil {
+		return nil, err
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := day.AddDate(0, 0, 1).Add(-time.Second)
+
+	baseRate, err := source.GetCurrencyRate(ctx, base, day)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Valuation{
+		Date:      day,
+		Currency:  base,
+		Positions: make([]PositionValue, 0, len(p.Positions)),
+	}
+
+	rates := map[securities.SecurityCurrency]float64{base: 1}
+	for i, pos := range p.Positions {
+		q := secList[i].QuotesForDate(securities.IntervalDay, dayEnd)
+		if q.Interval == securities.IntervalUnknown {
+			return nil, fmt.Errorf("%w: %s by %s", ErrNoQuotes, pos.Id, day.Format("2006-01-02"))
+		}
+
+		cur := secList[i].Currency()
+		rate, ok := rates[cur]
+		if !ok {
+			// rates are in rubles, so the rate in the base currency is the cross rate
+			rate, err = source.GetCurrencyRate(ctx, cur, day)
+			if err != nil {
+				return nil, err
+			}
+
+			rate /= baseRate
+			rates[cur] = rate
+		}
+
+		value := PositionValue{
+			Position: pos,
+			Currency: cur,
+			Close:    q.Close,
+			Rate:     rate,
+			Value:    pos.Quantity * q.Close * rate,
+		}
+		cost := pos.Quantity * pos.AvgPrice * rate
+		value.PL = value.Value - cost
+
+		res.Value += value.Value
+		res.Cost += cost
+		res.Positions = append(res.Positions, value)
+	}
+
+	res.PL = res.Value - res.Cost
+
+	return res, nil
+}
+
+// ValueSeries returns values of portfolio in the base currency for every date of quotes of the given interval which end in the period
+// If a security has no quotes for the date, its last known close price is used
+// Values of positions and buy cost are converted by currency rates of each date as in Value
+// Series begins from the date when prices of all securities are known
+// ErrNoQuotes is returned if any security has no quotes in the period, securities.ErrNoRate is returned if a rate is missing
+func (p *Portfolio) ValueSeries(ctx context.Context, source QuotesSource, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval, base securities.SecurityCurrency) ([]PortfolioPoint, error) {
+	if base == securities.UnknownCurrency {
+		return nil, errors.New("unknown base currency")
+	}
+
+	secList := p.quickSecurities()
+
+	err := source.GetSecuritiesData(secList)
+	if err != nil {
+		return nil, err
+	}
+
+	quotesList := make([][]securities.SecurityQuotes, len(secList))
+	dateSet := map[time.Time]bool{}
+	for i, sec := range secList {
+		quotes := *sec.QuotesOfInterval(interval)
+		sort.Slice(quotes, func(i, j int) bool {
+			return quotes[i].Begin.Before(quotes[j].Begin)
+		})
+		quotesList[i] = quotes
+
+		inPeriod := false
+		for _, q := range quotes {
+			if dateFrom.After(q.End) || q.End.After(dateTill) {
+				continue
+			}
+
+			inPeriod = true
+			dateSet[q.Begin] = true
+		}
+
+		if !inPeriod {
+			return nil, fmt.Errorf("%w: %s from %s till %s", ErrNoQuotes, sec.Id(), dateFrom.Format("2006-01-02"), dateTill.Format("2006-01-02"))
+		}
+	}
+
+	dates := make([]time.Time, 0, len(dateSet))
+	for date := range dateSet {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j])
+	})
+
+	// prices are carried forward, the quotes before the period give the prices for its beginning
+	closes := make([]float64, len(secList))
+	known := make([]bool, len(secList))
+	next := make([]int, len(secList))
+
+	res := make([]PortfolioPoint, 0, len(dates))
+	for _, date := range dates {
+		allKnown := true
+		for i, quotes := range quotesList {
+			for next[i] < len(quotes) && !quotes[next[i]].Begin.After(date) {
+				closes[i] = quotes[next[i]].Close
+				known[i] = true
+				next[i]++
+			}
+
+			allKnown = allKnown && known[i]
+		}
+
+		if !allKnown {
+			continue
+		}
+
+		day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+		baseRate, err := source.GetCurrencyRate(ctx, base, day)
+		if err != nil {
+			return nil, err
+		}
+
+		var value, cost float64
+		rates := map[securities.SecurityCurrency]float64{base: 1}
+		for i, pos := range p.Positions {
+			cur := secList[i].Currency()
+			rate, ok := rates[cur]
+			if !ok {
+				// rates are in rubles, so the rate in the base currency is the cross rate
+				rate, err = source.GetCurrencyRate(ctx, cur, day)
+				if err != nil {
+					return nil, err
+				}
+
+				rate /= baseRate
+				rates[cur] = rate
+			}
+
+			value += pos.Quantity * closes[i] * rate
+			cost += pos.Quantity * pos.AvgPrice * rate
+		}
+
+		res = append(res, PortfolioPoint{
+			Date:  date,
+			Value: value,
+			PL:    value - cost,
+		})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,210 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"math"
+	"securitiesModule/securities"
+	"testing"
+	"time"
+)
+
+// testSource gives daily close prices of securities starting from 02.01.2023
+// Securities are in rubles except AAPL which is in dollars, the rate of dollar is always 70 rubles
+type testSource map[string][]float64
+
+func (s testSource) GetCurrencyRate(ctx context.Context, currency securities.SecurityCurrency, date time.Time) (float64, error) {
+	switch currency {
+	case securities.RUB:
+		return 1, nil
+	case securities.USD:
+		return 70, nil
+	default:
+		return 0, securities.ErrNoRate
+	}
+}
+
+func (s testSource) GetSecuritiesData(sec []*securities.Security) error {
+	for _, one := range sec {
+		closes, ok := s[one.Id()]
+		if !ok {
+			return securities.ErrSecurityNotExist
+		}
+
+		one.SetCurrency(securities.RUB)
+		if one.Id() == "AAPL" {
+			one.SetCurrency(securities.USD)
+		}
+
+		date := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+		for i, c := range closes {
+			begin := date.AddDate(0, 0, i)
+			one.SetQuotes(securities.SecurityQuotes{Interval: securities.IntervalDay, Begin: begin, End: begin.Add(24*time.Hour - time.Second), Close: c})
+		}
+	}
+
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(" Main ", []Position{{Id: "gazp", Type: securities.Share, Quantity: 10, AvgPrice: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Name != "Main" || p.Positions[0].Id != "GAZP" {
+		t.Errorf("wrong portfolio - want Main with GAZP, got %s with %s", p.Name, p.Positions[0].Id)
+	}
+
+	tests := map[string][]Position{
+		"no id":          {{Type: securities.Share, Quantity: 1}},
+		"unknown type":   {{Id: "GAZP", Type: securities.UnknownType, Quantity: 1}},
+		"zero quantity":  {{Id: "GAZP", Type: securities.Share}},
+		"negative price": {{Id: "GAZP", Type: securities.Share, Quantity: 1, AvgPrice: -1}},
+		"twice":          {{Id: "GAZP", Type: securities.Share, Quantity: 1}, {Id: "gazp", Type: securities.Share, Quantity: 2}},
+	}
+
+	for name, positions := range tests {
+		_, err := New("Main", positions)
+		if err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	_, err = New(" ", nil)
+	if err == nil {
+		t.Error("no error for portfolio without name")
+	}
+}
+
+func TestValue(t *testing.T) {
+	source := testSource{"GAZP": {100, 110, 120}, "SBER": {10, 12}}
+
+	p, err := New("Main", []Position{{Id: "GAZP", Type: securities.Share, Quantity: 10, AvgPrice: 105}, {Id: "SBER", Type: securities.Share, Quantity: 100, AvgPrice: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SBER has no quotes for 04.01.2023, so its price of 03.01.2023 is used
+	res, err := p.Value(context.Background(), source, time.Date(2023, 1, 4, 15, 0, 0, 0, time.UTC), securities.RUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Value != 10*120+100*12 || res.Cost != 10*105+100*10 || math.Abs(res.PL-350) > 1e-9 {
+		t.Errorf("wrong portfolio valuation - want 2400/2050/350, got %f/%f/%f", res.Value, res.Cost, res.PL)
+	}
+
+	if len(res.Positions) != 2 || res.Positions[1].Close != 12 || res.Positions[1].PL != 200 {
+		t.Errorf("wrong SBER position valuation - %v", res.Positions)
+	}
+
+	_, err = p.Value(context.Background(), source, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), securities.RUB)
+	if !errors.Is(err, ErrNoQuotes) {
+		t.Errorf("wrong error for date before quotes - want ErrNoQuotes, got %v", err)
+	}
+}
+
+func TestValueInCurrency(t *testing.T) {
+	source := testSource{"AAPL": {2}, "SBER": {140}}
+
+	p, err := New("Main", []Position{{Id: "AAPL", Type: securities.Share, Quantity: 10, AvgPrice: 1}, {Id: "SBER", Type: securities.Share, Quantity: 1, AvgPrice: 140}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	res, err := p.Value(context.Background(), source, date, securities.RUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Value != 10*2*70+140 || res.PL != 10*70 || res.Positions[0].Rate != 70 {
+		t.Errorf("wrong valuation in rubles - want 1540 with P/L 700, got %f with P/L %f", res.Value, res.PL)
+	}
+
+	res, err = p.Value(context.Background(), source, date, securities.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res.Value-22) > 1e-9 || res.Currency != securities.USD || math.Abs(res.Positions[1].Value-2) > 1e-9 {
+		t.Errorf("wrong valuation in dollars - want 22, got %f", res.Value)
+	}
+
+	_, err = p.Value(context.Background(), source, date, securities.EUR)
+	if !errors.Is(err, securities.ErrNoRate) {
+		t.Errorf("wrong error for missing rate - want ErrNoRate, got %v", err)
+	}
+}
+
+func TestValueSeries(t *testing.T) {
+	// GAZP has no quotes from 04.01.2023
+	source := testSource{"GAZP": {100, 110}, "SBER": {10, 12, 13, 14}}
+
+	p, err := New("Main", []Position{{Id: "GAZP", Type: securities.Share, Quantity: 10, AvgPrice: 100}, {Id: "SBER", Type: securities.Share, Quantity: 100, AvgPrice: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.ValueSeries(context.Background(), source, time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 4, 23, 59, 59, 0, time.UTC), securities.IntervalDay, securities.RUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the price of GAZP for 04.01.2023 is carried forward from 03.01.2023
+	want := []float64{10*110 + 100*12, 10*110 + 100*13}
+	if len(res) != len(want) {
+		t.Fatalf("wrong number of points - want %d, got %d", len(want), len(res))
+	}
+
+	for i, value := range want {
+		if res[i].Value != value || res[i].PL != value-2000 {
+			t.Errorf("wrong value for %s - want %f, got %f with P/L %f", res[i].Date.Format("02.01.2006"), value, res[i].Value, res[i].PL)
+		}
+	}
+
+	if !res[1].Date.Equal(time.Date(2023, 1, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong date of the last point - want 04.01.2023, got %s", res[1].Date.Format("02.01.2006"))
+	}
+
+	_, err = p.ValueSeries(context.Background(), source, time.Date(2023, 1, 5, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 6, 0, 0, 0, 0, time.UTC), securities.IntervalDay, securities.RUB)
+	if !errors.Is(err, ErrNoQuotes) {
+		t.Errorf("wrong error for period without quotes - want ErrNoQuotes, got %v", err)
+	}
+}
+
+func TestValueSeriesInCurrency(t *testing.T) {
+	source := testSource{"AAPL": {2, 3}, "SBER": {140, 210}}
+
+	p, err := New("Main", []Position{{Id: "AAPL", Type: securities.Share, Quantity: 10, AvgPrice: 1}, {Id: "SBER", Type: securities.Share, Quantity: 1, AvgPrice: 140}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dateFrom, dateTill := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 3, 23, 59, 59, 0, time.UTC)
+
+	res, err := p.ValueSeries(context.Background(), source, dateFrom, dateTill, securities.IntervalDay, securities.RUB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 2 || res[1].Value != 10*3*70+210 || res[1].PL != 10*2*70+70 {
+		t.Errorf("wrong series in rubles - want 2310 with P/L 1470 at the end, got %v", res)
+	}
+
+	res, err = p.ValueSeries(context.Background(), source, dateFrom, dateTill, securities.IntervalDay, securities.USD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 2 || math.Abs(res[0].Value-22) > 1e-9 || math.Abs(res[1].Value-33) > 1e-9 {
+		t.Errorf("wrong series in dollars - want 22 and 33, got %v", res)
+	}
+
+	_, err = p.ValueSeries(context.Background(), source, dateFrom, dateTill, securities.IntervalDay, securities.EUR)
+	if !errors.Is(err, securities.ErrNoRate) {
+		t.Errorf("wrong error for missing rate - want ErrNoRate, got %v", err)
+	}
+}
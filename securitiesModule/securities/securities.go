@@ -2,7 +2,11 @@
 package securities
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +19,7 @@ const (
 	ETF         SecurityType = "etf"
 	Bond        SecurityType = "bond"
 	Currency    SecurityType = "currency"
+	Index       SecurityType = "index"
 )
 
 // SecurityCurrency is a currency of security - RUB, USD etc
@@ -52,6 +57,14 @@ type SecurityQuotes struct {
 	Close    float64
 	High     float64
 	Low      float64
+	Volume   float64
+}
+
+// Dividend is a dividend paid for one security to holders registered on the date
+type Dividend struct {
+	Date     time.Time
+	Value    float64
+	Currency SecurityCurrency
 }
 
 // Security is a struct with information about security
@@ -60,7 +73,9 @@ type Security struct {
 	name     string
 	sType    SecurityType
 	currency SecurityCurrency
+	updated  time.Time // the last time of quotes update, zero if quotes were never updated
 	quotes   *[]SecurityQuotes
+	mu       sync.RWMutex // guards quotes
 }
 
 // GetSecurity creates a new security with no quotes
@@ -89,20 +104,40 @@ func (s *Security) SetCurrency(currency SecurityCurrency) {
 	s.currency = currency
 }
 
+// SetLastUpdated sets the last time of quotes update
+func (s *Security) SetLastUpdated(updated time.Time) {
+	s.updated = updated
+}
+
 // SetQuotes sets the quotes of security (without clearing existing quotes)
 func (s *Security) SetQuotes(quotes SecurityQuotes) {
-	*s.quotes = append(*s.quotes, quotes)
+	s.AddQuotes([]SecurityQuotes{quotes})
+}
+
+// AddQuotes appends the batch of quotes to security quotes (without clearing existing quotes) and returns the new number of quotes
+// It's safe to call AddQuotes from several goroutines at once
+func (s *Security) AddQuotes(quotes []SecurityQuotes) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*s.quotes = append(*s.quotes, quotes...)
+
+	return len(*s.quotes)
 }
 
 // SetQuotesList sets the list of security quotes (without clearing existing quotes)
 func (s *Security) SetQuotesList(quotes *[]SecurityQuotes) {
-	*s.quotes = append(*s.quotes, *quotes...)
+	s.AddQuotes(*quotes)
 }
 
 // ClearAndSetQuotesList clears and sets the list of security quotes
 func (s *Security) ClearAndSetQuotesList(quotes *[]SecurityQuotes) {
-	s.quotes = new([]SecurityQuotes)
-	s.SetQuotesList(quotes)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newQuotes := make([]SecurityQuotes, len(*quotes))
+	copy(newQuotes, *quotes)
+	s.quotes = &newQuotes
 }
 
 // Id returns the id of security
@@ -125,13 +160,27 @@ func (s *Security) Currency() SecurityCurrency {
 	return s.currency
 }
 
-// Quotes returns all security quotes
+// LastUpdated returns the last time of quotes update (zero time if quotes were never updated)
+func (s *Security) LastUpdated() time.Time {
+	return s.updated
+}
+
+// Quotes returns the copy of all security quotes
 func (s *Security) Quotes() *[]SecurityQuotes {
-	return s.quotes
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	quotes := make([]SecurityQuotes, len(*s.quotes))
+	copy(quotes, *s.quotes)
+
+	return &quotes
 }
 
 // QuotesOfInterval returns all security quotes of the given interval
 func (s *Security) QuotesOfInterval(interval QuotesInterval) *[]SecurityQuotes {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	quotes := new([]SecurityQuotes)
 
 	for _, q := range *s.quotes {
@@ -145,6 +194,9 @@ func (s *Security) QuotesOfInterval(interval QuotesInterval) *[]SecurityQuotes {
 
 // QuotesForDate returns the last quotes of the given interval of security for the given date
 func (s *Security) QuotesForDate(interval QuotesInterval, date time.Time) SecurityQuotes {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	var quotes SecurityQuotes
 
 	for _, q := range *s.quotes {
@@ -163,6 +215,143 @@ func (s *Security) LastQuotes(interval QuotesInterval) SecurityQuotes {
 	return s.QuotesForDate(interval, time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
 }
 
+// intervalRanks contains the order of quotes intervals from the finest to the coarsest
+var intervalRanks = map[QuotesInterval]int{
+	IntervalMinute:  1,
+	IntervalTenMin:  2,
+	IntervalHour:    3,
+	IntervalDay:     4,
+	IntervalWeek:    5,
+	IntervalMonth:   6,
+	IntervalQuarter: 7,
+}
+
+// periodStart returns the beginning of the period of the given interval which contains the given date
+// Weeks begin on Monday
+func periodStart(interval QuotesInterval, date time.Time) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+
+	switch interval {
+	case IntervalTenMin:
+		return date.Truncate(10 * time.Minute)
+	case IntervalHour:
+		return date.Truncate(time.Hour)
+	case IntervalDay:
+		return day
+	case IntervalWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+	case IntervalQuarter:
+		return time.Date(date.Year(), date.Month()-(date.Month()-1)%3, 1, 0, 0, 0, 0, date.Location())
+	default:
+		return date.Truncate(time.Minute)
+	}
+}
+
+// Resample aggregates quotes of interval from into quotes of the coarser interval to (daily quotes into weekly for example)
+// Open price is the first open, close price is the last close, high and low prices are the extremes and volume is the sum
+// Begin and end dates of aggregated quotes are dates of the first and the last source quotes
+func (s *Security) Resample(from QuotesInterval, to QuotesInterval) ([]SecurityQuotes, error) {
+	fromRank, ok := intervalRanks[from]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %d", from)
+	}
+
+	toRank, ok := intervalRanks[to]
+	if !ok {
+		return nil, fmt.Errorf("unknown interval %d", to)
+	}
+
+	if toRank <= fromRank {
+		return nil, fmt.Errorf("interval %d is not coarser than interval %d", to, from)
+	}
+
+	quotes := *s.QuotesOfInterval(from)
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return quotes[i].Begin.Before(quotes[j].Begin)
+	})
+
+	res := []SecurityQuotes{}
+	var start time.Time
+	for _, q := range quotes {
+		qStart := periodStart(to, q.Begin)
+
+		if len(res) == 0 || !qStart.Equal(start) {
+			start = qStart
+			res = append(res, SecurityQuotes{
+				Interval: to,
+				Begin:    q.Begin,
+				End:      q.End,
+				Open:     q.Open,
+				Close:    q.Close,
+				High:     q.High,
+				Low:      q.Low,
+				Volume:   q.Volume,
+			})
+			continue
+		}
+
+		last := &res[len(res)-1]
+		last.End = q.End
+		last.Close = q.Close
+		last.High = math.Max(last.High, q.High)
+		last.Low = math.Min(last.Low, q.Low)
+		last.Volume += q.Volume
+	}
+
+	return res, nil
+}
+
+// TradingCalendar tells the days when the exchange trades
+type TradingCalendar interface {
+	IsTradingDay(date time.Time) bool
+}
+
+// MissingDates returns the trading days between the first and the last loaded quotes of interval which have no quote
+// For intervals finer than day a day is missing if it has no quotes at all
+// For coarser intervals the beginnings of periods which contain trading days but have no quote are returned
+func (s *Security) MissingDates(interval QuotesInterval, calendar TradingCalendar) []time.Time {
+	quotes := *s.QuotesOfInterval(interval)
+	if len(quotes) == 0 {
+		return []time.Time{}
+	}
+
+	// finer intervals are checked by days
+	keyInterval := interval
+	if intervalRanks[interval] < intervalRanks[IntervalDay] {
+		keyInterval = IntervalDay
+	}
+
+	present := make(map[time.Time]bool, len(quotes))
+	first, last := quotes[0].Begin, quotes[0].Begin
+	for _, q := range quotes {
+		present[periodStart(keyInterval, q.Begin)] = true
+
+		if q.Begin.Before(first) {
+			first = q.Begin
+		}
+		if q.Begin.After(last) {
+			last = q.Begin
+		}
+	}
+
+	res := []time.Time{}
+	reported := map[time.Time]bool{}
+	day := periodStart(IntervalDay, first)
+	for !day.After(last) {
+		key := periodStart(keyInterval, day)
+		if !present[key] && !reported[key] && calendar.IsTradingDay(day) {
+			reported[key] = true
+			res = append(res, key)
+		}
+
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return res
+}
+
 // GetSecurityTypeFromString converts string type of security to SecurityType
 func GetSecurityTypeFromString(typeName string) SecurityType {
 	switch strings.ToLower(typeName) {
@@ -174,6 +363,8 @@ func GetSecurityTypeFromString(typeName string) SecurityType {
 		return Bond
 	case "currency":
 		return Currency
+	case "index":
+		return Index
 	default:
 		return UnknownType
 	}
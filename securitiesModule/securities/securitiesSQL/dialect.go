@@ -0,0 +1,38 @@
+package securitiesSQL
+
+import "database/sql"
+
+// Dialect is the SQL which differs between database engines, the rest of the package is common for them
+// Creating and opening of database are made by the packages of engines (CreateDatabase for MySQL, securitiesSQLite for SQLite)
+type Dialect struct {
+	// InsertIgnore starts INSERT statement which skips rows with existing keys
+	InsertIgnore string
+
+	// UpsertSecurities ends INSERT statement of securities
+	// Existing security is kept and isn't counted in affected rows, deleted security is restored and gets new name, type and currency
+	UpsertSecurities string
+
+	// UpsertQuotes ends INSERT statement of quotes, existing quotes with the same security, begin date and interval are updated
+	UpsertQuotes string
+}
+
+// MySQL is the dialect of MySQL databases
+// Assignments of ON DUPLICATE KEY UPDATE are made from left to right, so deletion mark is cleared after it's checked
+// Existing security gets the same values, and MySQL doesn't count such rows as affected
+var MySQL = &Dialect{
+	InsertIgnore: "INSERT IGNORE",
+	UpsertSecurities: " ON DUPLICATE KEY UPDATE name = IF(deleted_at IS NULL, name, VALUES(name)), type = IF(deleted_at IS NULL, type, VALUES(type)), " +
+		"currency = IF(deleted_at IS NULL, currency, VALUES(currency)), deleted_at = NULL",
+	UpsertQuotes: " ON DUPLICATE KEY UPDATE end = VALUES(end), open = VALUES(open), close = VALUES(close), high = VALUES(high), low = VALUES(low), volume = VALUES(volume)",
+}
+
+// DB is the database with the dialect of its engine, it's used by all functions of the package
+type DB struct {
+	*sql.DB
+	Dialect *Dialect
+}
+
+// NewDB returns the database which is worked with in the given dialect
+func NewDB(db *sql.DB, dialect *Dialect) *DB {
+	return &DB{DB: db, Dialect: dialect}
+}
@@ -0,0 +1,195 @@
+package securitiesSQL
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Logger is the logger of applied migrations (it may be changed by the service)
+var Logger = slog.Default()
+
+// Migration is one change of database structure
+// Migrations check the structure before changing it, so they may be applied to databases which already have the change
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(db *sql.DB) error
+}
+
+// migrations are the changes of MySQL database structure made after it had appeared, they are applied in order of versions
+// New changes are added to the end of the list with the next version, migrations which are already released must not be changed
+// CreateDatabase makes the latest structure at once, so a new change must be added there too
+var migrations = []Migration{
+	{1, "volume of security quotes", addColumns([][3]string{{"security_quotes", "volume", "DECIMAL(20,2)"}})},
+	{2, "deletion mark of securities", addColumns([][3]string{{"securities", "deleted_at", "DATETIME NULL"}})},
+	{3, "time of the last quotes update of securities", addColumns([][3]string{{"securities", "last_updated", "DATETIME NULL"}})},
+	{4, "secondary indexes of security quotes", addQuotesIndexes},
+	{5, "portfolios, dividends, bonds and alerts tables", addTables(append(append(append(portfolioTables, dividendsTable), bondTables...), alertTables...))},
+	{6, "webhooks of alerts and their delivery", addColumns(alertColumns)},
+}
+
+// migrationsTable is the statement to create the table of applied migrations, it's the same for all dialects
+const migrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations(
+			version INT NOT NULL,
+			description VARCHAR(150) NOT NULL,
+			applied_at DATETIME NOT NULL,
+			PRIMARY KEY (version)
+		);`
+
+// UpgradeDatabase applies to existing MySQL database the migrations which haven't been applied to it yet
+func UpgradeDatabase(db *DB) error {
+	return ApplyMigrations(db, migrations)
+}
+
+// ApplyMigrations applies to database the migrations which haven't been applied to it yet
+// Applied migrations are recorded in schema_migrations table, so every migration is applied once
+func ApplyMigrations(db *DB, migrations []Migration) error {
+	_, err := db.Exec(migrationsTable)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		Logger.Info("applying database migration", "version", m.Version, "description", m.Description)
+
+		err = m.Apply(db.DB)
+		if err != nil {
+			return fmt.Errorf("database migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		err = recordMigration(db, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarkMigrationsApplied records all migrations as applied, it's used for new database which has the latest structure
+func MarkMigrationsApplied(db *DB, migrations []Migration) error {
+	_, err := db.Exec(migrationsTable)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		err = recordMigration(db, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the versions of migrations recorded in database
+func appliedMigrations(db *DB) (map[int]bool, error) {
+	resDB, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer resDB.Close()
+
+	applied := make(map[int]bool)
+	for resDB.Next() {
+		var version int
+		err = resDB.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, resDB.Err()
+}
+
+// recordMigration marks the migration as applied
+// Other instance of the service may apply the same migration at the same time, so the existing record is kept
+func recordMigration(db *DB, m Migration) error {
+	_, err := db.Exec(db.Dialect.InsertIgnore+" INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Description, time.Now().UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+// addColumns returns the migration which adds the columns (table, column and its definition) if they don't exist
+func addColumns(columns [][3]string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		queryText := "SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+
+		for _, column := range columns {
+			var columnExists int
+			err := db.QueryRow(queryText, column[0], column[1]).Scan(&columnExists)
+			if err != nil {
+				return err
+			}
+
+			if columnExists == 0 {
+				_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column[0], column[1], column[2]))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// addTables returns the migration which creates the tables (name and statement to create it) if they don't exist
+func addTables(tables [][2]string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		queryText := "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+
+		for _, table := range tables {
+			var tableExists int
+			err := db.QueryRow(queryText, table[0]).Scan(&tableExists)
+			if err != nil {
+				return err
+			}
+
+			if tableExists == 0 {
+				_, err = db.Exec(table[1])
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// addQuotesIndexes creates secondary indexes of security quotes if they don't exist
+func addQuotesIndexes(db *sql.DB) error {
+	queryText := "SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'security_quotes' AND INDEX_NAME = ?"
+
+	for _, index := range quotesIndexes {
+		var indexExists int
+		err := db.QueryRow(queryText, index[0]).Scan(&indexExists)
+		if err != nil {
+			return err
+		}
+
+		if indexExists == 0 {
+			_, err = db.Exec(fmt.Sprintf("CREATE INDEX %s ON security_quotes (%s)", index[0], index[1]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,45 +1,36 @@
 // Package securitiesSQL contains functions to work with securities data in SQL database
+// The functions are common for MySQL and SQLite databases, the differences of their SQL are kept in Dialect
 package securitiesSQL
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"regexp"
 	"securitiesModule/securities"
+	"securitiesModule/securities/alerts"
 	"securitiesModule/securities/moex"
+	"securitiesModule/securities/portfolio"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
-// collectErrors collects errors from error channel and send the result into final error channel
-// Not the best place for this function and not the best way to deal with errors but let it be so for now
-func collectErrors(quitChan chan bool, finErrChan chan error, errChan chan error) {
-	var err, finErr error
-
-	for {
-		select {
-		case err = <-errChan:
-			if finErr == nil {
-				finErr = err
-			} else {
-				finErr = errors.New(finErr.Error() + "\n" + err.Error())
-			}
-		case <-quitChan:
-			{
-				close(errChan)
-				close(quitChan)
-				finErrChan <- finErr
-				return
-			}
-		}
-	}
-}
+// InsertChunkSize is the maximum number of rows in one INSERT statement
+// Databases limit the number of placeholders and the size of packet, so big sets of quotes are inserted by chunks
+var InsertChunkSize = 500
 
-// SecurityExists checks if security with given id and type exists in database
-func SecurityExists(db *sql.DB, id string, sType securities.SecurityType) (bool, error) {
+// ReadConcurrency is the maximum number of securities read from database at once by GetSecuritiesData
+// If it's 0 the limit of open connections of database is used (and there is no limit if database has no limit too)
+var ReadConcurrency = 0
+
+// SecurityExists checks if security with given id and type exists in database (and it isn't deleted)
+func SecurityExists(db *DB, id string, sType securities.SecurityType) (bool, error) {
 	if id == "" {
 		return false, errors.New("security has no id")
 	}
@@ -48,19 +39,21 @@ func SecurityExists(db *sql.DB, id string, sType securities.SecurityType) (bool,
 		return false, errors.New("security has no type or type is unknown")
 	}
 
-	queryText := "SELECT id FROM securities WHERE id = ? AND type = ?"
+	queryText := "SELECT id FROM securities WHERE id = ? AND type = ? AND deleted_at IS NULL"
 	resDB, err := db.Query(queryText, id, sType)
 	if err != nil {
 		return false, err
 	}
+	defer resDB.Close()
+
 	if resDB.Next() {
 		return true, nil
 	}
-	return false, nil
+	return false, resDB.Err()
 }
 
 // SecurityQuotesExist checks if security quotes for the given begin date and the given interval exist in database
-func SecurityQuotesExist(db *sql.DB, sec *securities.Security, date time.Time, interval securities.QuotesInterval) (bool, error) {
+func SecurityQuotesExist(db *DB, sec *securities.Security, date time.Time, interval securities.QuotesInterval) (bool, error) {
 	queryText := "SELECT * FROM security_quotes WHERE security = ? AND begin = ? AND interv = ?"
 
 	res, err := db.Query(queryText, sec.Id(), date.UTC().Format("2006-01-02 15:04:05"), interval)
@@ -77,25 +70,26 @@ func SecurityQuotesExist(db *sql.DB, sec *securities.Security, date time.Time, i
 }
 
 // GetSecurityData fills in security data from database
-func GetSecurityData(db *sql.DB, sec *securities.Security) error {
+func GetSecurityData(db *DB, sec *securities.Security) error {
 	seqExists, err := SecurityExists(db, sec.Id(), sec.SType())
 	if err != nil {
 		return err
 	}
 
 	if !seqExists {
-		return fmt.Errorf("security %s does not exist", sec.Id())
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
 	}
 
-	sQueryText := "SELECT name, currency FROM securities WHERE id = ?"
+	sQueryText := "SELECT name, currency, last_updated FROM securities WHERE id = ?"
 	sResDB := db.QueryRow(sQueryText, sec.Id())
 
 	var sResDBRow struct {
 		name     string
 		currency string
+		updated  []uint8
 	}
 
-	err = sResDB.Scan(&sResDBRow.name, &sResDBRow.currency)
+	err = sResDB.Scan(&sResDBRow.name, &sResDBRow.currency, &sResDBRow.updated)
 	if err != nil {
 		return err
 	}
@@ -103,11 +97,17 @@ func GetSecurityData(db *sql.DB, sec *securities.Security) error {
 	sec.SetName(sResDBRow.name)
 	sec.SetCurrency(securities.GetSecurityCurrencyFromString(sResDBRow.currency))
 
-	sqQueryText := "SELECT interv, begin, end, open, close, high, low FROM security_quotes WHERE security = ?"
+	err = setLastUpdatedFromDB(sec, sResDBRow.updated)
+	if err != nil {
+		return err
+	}
+
+	sqQueryText := "SELECT interv, begin, end, open, close, high, low, IFNULL(volume, 0) FROM security_quotes WHERE security = ?"
 	sqResDB, err := db.Query(sqQueryText, sec.Id())
 	if err != nil {
 		return err
 	}
+	defer sqResDB.Close()
 
 	type sqResDBRow struct {
 		interval int
@@ -117,35 +117,33 @@ func GetSecurityData(db *sql.DB, sec *securities.Security) error {
 		close    float64
 		high     float64
 		low      float64
+		volume   float64
 	}
 
-	wg := new(sync.WaitGroup)
-	mu := new(sync.Mutex)
+	g := new(errgroup.Group)
+
+	var scanErr error
 
 	for sqResDB.Next() {
 		var sqResDBRowOne sqResDBRow
 
-		err = sqResDB.Scan(&sqResDBRowOne.interval, &sqResDBRowOne.begin, &sqResDBRowOne.end, &sqResDBRowOne.open, &sqResDBRowOne.close, &sqResDBRowOne.high, &sqResDBRowOne.low)
-		if err != nil {
-			return err
+		scanErr = sqResDB.Scan(&sqResDBRowOne.interval, &sqResDBRowOne.begin, &sqResDBRowOne.end, &sqResDBRowOne.open, &sqResDBRowOne.close, &sqResDBRowOne.high, &sqResDBRowOne.low, &sqResDBRowOne.volume)
+		if scanErr != nil {
+			break
 		}
 
-		wg.Add(1)
-
-		go func(sqResDBRowOne sqResDBRow) {
-			defer wg.Done()
-
+		g.Go(func() error {
 			strBeginDate := string(sqResDBRowOne.begin)
 			strEndDate := string(sqResDBRowOne.end)
 			if strBeginDate != "" && strEndDate != "" {
 				beginDate, err := time.Parse("2006-01-02 15:04:05", strBeginDate)
 				if err != nil {
-					log.Fatal("can't convert database date format: " + strBeginDate)
+					return errors.New("can't convert database date format: " + strBeginDate)
 				}
 
 				endDate, err := time.Parse("2006-01-02 15:04:05", strEndDate)
 				if err != nil {
-					log.Fatal("can't convert database date format: " + strEndDate)
+					return errors.New("can't convert database date format: " + strEndDate)
 				}
 
 				sQuotes := securities.SecurityQuotes{
@@ -156,16 +154,26 @@ func GetSecurityData(db *sql.DB, sec *securities.Security) error {
 					Close:    sqResDBRowOne.close,
 					High:     sqResDBRowOne.high,
 					Low:      sqResDBRowOne.low,
+					Volume:   sqResDBRowOne.volume,
 				}
 
-				mu.Lock()
-				sec.SetQuotes(sQuotes)
-				mu.Unlock()
+				sec.AddQuotes([]securities.SecurityQuotes{sQuotes})
 			}
-		}(sqResDBRowOne)
+
+			return nil
+		})
 	}
 
-	wg.Wait()
+	err = g.Wait()
+	if scanErr != nil {
+		return scanErr
+	}
+	if err == nil {
+		err = sqResDB.Err()
+	}
+	if err != nil {
+		return err
+	}
 
 	q := sec.Quotes()
 
@@ -178,56 +186,75 @@ func GetSecurityData(db *sql.DB, sec *securities.Security) error {
 	return nil
 }
 
-// GetSecuritiesData fills in data for a list of securities from database
-func GetSecuritiesData(db *sql.DB, sec []*securities.Security) error {
-	wg := new(sync.WaitGroup)
-	quitChan := make(chan bool)
-	finErrChan := make(chan error)
-	errChan := make(chan error)
+// setLastUpdatedFromDB sets the time of the last quotes update of security from database value (NULL if quotes were never updated)
+func setLastUpdatedFromDB(sec *securities.Security, updated []uint8) error {
+	if len(updated) == 0 {
+		return nil
+	}
 
-	go collectErrors(quitChan, finErrChan, errChan)
+	updatedDate, err := time.Parse("2006-01-02 15:04:05", string(updated))
+	if err != nil {
+		return errors.New("can't convert database date format: " + string(updated))
+	}
 
-	for _, s := range sec {
-		wg.Add(1)
+	sec.SetLastUpdated(updatedDate)
 
-		go func(s *securities.Security, errChan chan error) {
-			defer wg.Done()
+	return nil
+}
 
-			err := GetSecurityData(db, s)
+// GetSecuritiesData fills in data for a list of securities from database
+// Securities are read concurrently (not more than ReadConcurrency at once), the first error is returned after all of them are read
+func GetSecuritiesData(db *DB, sec []*securities.Security) error {
+	g := new(errgroup.Group)
 
-			if err != nil {
-				errChan <- err
-			}
-		}(s, errChan)
+	limit := ReadConcurrency
+	if limit <= 0 {
+		limit = db.Stats().MaxOpenConnections
+	}
+	if limit > 0 {
+		g.SetLimit(limit)
 	}
 
-	wg.Wait()
-
-	quitChan <- true
+	for _, s := range sec {
+		s := s
 
-	err := <-finErrChan
-	close(finErrChan)
-	if err != nil {
-		return err
+		g.Go(func() error {
+			return GetSecurityData(db, s)
+		})
 	}
 
-	return nil
+	return g.Wait()
+}
+
+// sortExpressions contains SQL expressions to sort securities by the given field (for grouped securities and for securities joined with last quotes)
+var sortExpressions = map[securities.SortField][2]string{
+	securities.SortByID:        {"s.id", "pd.id"},
+	securities.SortByName:      {"s.name", "pd.name"},
+	securities.SortByLastDate:  {"max(sq.end)", "pd.end"},
+	securities.SortByLastPrice: {"(SELECT sq2.close FROM security_quotes AS sq2 WHERE sq2.security = s.id ORDER BY sq2.end DESC LIMIT 1)", "sq.close"},
 }
 
 // GetAllSecuritiesData fills in data for all existing in database securities (considering type and currency filters) with only last quotes for each security
-func GetAllSecuritiesData(db *sql.DB, typeNameFilter string, currencyNameFilter string) ([]*securities.Security, error) {
-	if typeNameFilter != "" {
-		sType := securities.GetSecurityTypeFromString(typeNameFilter)
-		if sType == securities.UnknownType {
-			return nil, fmt.Errorf("wrong type name: %s", typeNameFilter)
-		}
+// Only limit securities (sorted by the given field and then by id) starting from offset are returned, all securities are returned if limit is 0
+// The total number of securities considering filters is returned too, deleted securities are considered only if includeDeleted is set
+func GetAllSecuritiesData(db *DB, typeNameFilter string, currencyNameFilter string, sortField securities.SortField, desc bool, limit int, offset int, includeDeleted bool) ([]*securities.Security, int, error) {
+	if limit < 0 || offset < 0 {
+		return nil, 0, fmt.Errorf("wrong limit %d or offset %d", limit, offset)
 	}
 
-	if currencyNameFilter != "" {
-		currency := securities.GetSecurityCurrencyFromString(currencyNameFilter)
-		if currency == securities.UnknownCurrency {
-			return nil, fmt.Errorf("wrong currency name: %s", currencyNameFilter)
-		}
+	sortExpr, ok := sortExpressions[sortField]
+	if !ok {
+		return nil, 0, fmt.Errorf("wrong sort field: %s", sortField)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+
+	err := checkFilters(typeNameFilter, currencyNameFilter)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	queryText := `
@@ -237,6 +264,7 @@ func GetAllSecuritiesData(db *sql.DB, typeNameFilter string, currencyNameFilter
 					s.name,
 					s.type,
 					s.currency,
+					s.last_updated,
 					max(sq.end) AS end
 				FROM
 					securities AS s
@@ -245,42 +273,69 @@ func GetAllSecuritiesData(db *sql.DB, typeNameFilter string, currencyNameFilter
 				WHERE
 					(s.type = ? OR ?)
 					AND (s.currency = ? OR ?)
+					AND (s.deleted_at IS NULL OR ?)
 				GROUP BY
 					s.id,
 					s.name,
 					s.type,
-					s.currency
+					s.currency,
+					s.last_updated
+				ORDER BY
+					%[1]s %[3]s,
+					s.id
+				%[4]s
 				)
 				SELECT
 					pd.id,
 					pd.name,
 					pd.type,
 					pd.currency,
+					pd.last_updated,
 					IFNULL(sq.interv, 0) AS interv,
 					sq.begin,
 					sq.end,
 					IFNULL(sq.open, 0.0) AS open,
 					IFNULL(sq.close, 0.0) AS close,
 					IFNULL(sq.high, 0.0) AS high,
-					IFNULL(sq.low, 0.0) AS low
+					IFNULL(sq.low, 0.0) AS low,
+					IFNULL(sq.volume, 0.0) AS volume
 				FROM
 					LastPricesDates AS pd
 						LEFT OUTER JOIN security_quotes AS sq
 						ON pd.id = sq.security
 							AND pd.end = sq.end
 				ORDER BY
-				id`
+					%[2]s %[3]s,
+					pd.id`
 
-	securitiesDB, err := db.Query(queryText, strings.ToLower(typeNameFilter), typeNameFilter == "", strings.ToUpper(currencyNameFilter), currencyNameFilter == "")
+	filterArgs := []any{strings.ToLower(typeNameFilter), typeNameFilter == "", strings.ToUpper(currencyNameFilter), currencyNameFilter == "", includeDeleted}
+
+	var total int
+	countQueryText := "SELECT COUNT(*) FROM securities AS s WHERE (s.type = ? OR ?) AND (s.currency = ? OR ?) AND (s.deleted_at IS NULL OR ?)"
+	err = db.QueryRow(countQueryText, filterArgs...).Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	args := filterArgs
+	pageText := ""
+	if limit > 0 {
+		pageText = "LIMIT ? OFFSET ?"
+		args = append(args, limit, offset)
 	}
 
+	securitiesDB, err := db.Query(fmt.Sprintf(queryText, sortExpr[0], sortExpr[1], direction, pageText), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer securitiesDB.Close()
+
 	type securitiesDBRow struct {
 		id       string
 		name     string
 		sType    string
 		currency string
+		updated  []uint8
 		interval int
 		begin    []uint8
 		end      []uint8
@@ -288,42 +343,50 @@ func GetAllSecuritiesData(db *sql.DB, typeNameFilter string, currencyNameFilter
 		close    float64
 		high     float64
 		low      float64
+		volume   float64
 	}
 
-	var res []*securities.Security
+	// securities are processed concurrently, so they are put in the map by row number to keep the order of rows
+	secByRow := make(map[int]*securities.Security)
+	rowCount := 0
 
-	wg := new(sync.WaitGroup)
+	g := new(errgroup.Group)
 	mu := new(sync.Mutex)
 
+	var scanErr error
+
 	for securitiesDB.Next() {
 		var securitiesDBRowOne securitiesDBRow
 
-		err = securitiesDB.Scan(&securitiesDBRowOne.id, &securitiesDBRowOne.name, &securitiesDBRowOne.sType, &securitiesDBRowOne.currency, &securitiesDBRowOne.interval, &securitiesDBRowOne.begin, &securitiesDBRowOne.end, &securitiesDBRowOne.open, &securitiesDBRowOne.close, &securitiesDBRowOne.high, &securitiesDBRowOne.low)
-		if err != nil {
-			return nil, err
+		scanErr = securitiesDB.Scan(&securitiesDBRowOne.id, &securitiesDBRowOne.name, &securitiesDBRowOne.sType, &securitiesDBRowOne.currency, &securitiesDBRowOne.updated, &securitiesDBRowOne.interval, &securitiesDBRowOne.begin, &securitiesDBRowOne.end, &securitiesDBRowOne.open, &securitiesDBRowOne.close, &securitiesDBRowOne.high, &securitiesDBRowOne.low, &securitiesDBRowOne.volume)
+		if scanErr != nil {
+			break
 		}
 
-		wg.Add(1)
-
-		go func(securitiesDBRowOne securitiesDBRow) {
-			defer wg.Done()
+		row := rowCount
 
+		g.Go(func() error {
 			sType := securities.GetSecurityTypeFromString(securitiesDBRowOne.sType)
 			cur := securities.GetSecurityCurrencyFromString(securitiesDBRowOne.currency)
 
 			sec := securities.GetSecurity(securitiesDBRowOne.id, securitiesDBRowOne.name, sType, cur)
 
+			err := setLastUpdatedFromDB(sec, securitiesDBRowOne.updated)
+			if err != nil {
+				return err
+			}
+
 			strBeginDate := string(securitiesDBRowOne.begin)
 			strEndDate := string(securitiesDBRowOne.end)
 			if strBeginDate != "" && strEndDate != "" {
 				beginDate, err := time.Parse("2006-01-02 15:04:05", strBeginDate)
 				if err != nil {
-					log.Fatal("can't convert database date format: " + strBeginDate)
+					return errors.New("can't convert database date format: " + strBeginDate)
 				}
 
 				endDate, err := time.Parse("2006-01-02 15:04:05", strEndDate)
 				if err != nil {
-					log.Fatal("can't convert database date format: " + strEndDate)
+					return errors.New("can't convert database date format: " + strEndDate)
 				}
 
 				sQuotes := securities.SecurityQuotes{
@@ -334,233 +397,1905 @@ func GetAllSecuritiesData(db *sql.DB, typeNameFilter string, currencyNameFilter
 					Close:    securitiesDBRowOne.close,
 					High:     securitiesDBRowOne.high,
 					Low:      securitiesDBRowOne.low,
+					Volume:   securitiesDBRowOne.volume,
 				}
 
 				sec.SetQuotes(sQuotes)
 			}
 
 			mu.Lock()
-			res = append(res, sec)
+			secByRow[row] = sec
 			mu.Unlock()
-		}(securitiesDBRowOne)
+
+			return nil
+		})
+
+		rowCount++
 	}
 
-	wg.Wait()
+	err = g.Wait()
+	if scanErr != nil {
+		return nil, 0, scanErr
+	}
+	if err == nil {
+		err = securitiesDB.Err()
+	}
+	if err != nil {
+		return nil, 0, err
+	}
 
-	sort.Slice(res, func(i, j int) bool {
-		return res[j].Id() > res[i].Id()
-	})
+	res := make([]*securities.Security, 0, rowCount)
+	for row := 0; row < rowCount; row++ {
+		res = append(res, secByRow[row])
+	}
 
-	return res, nil
+	return res, total, nil
 }
 
-// AddSecurity adds new security to database
-func AddSecurity(db *sql.DB, sec *securities.Security) error {
-	return AddSecurities(db, []*securities.Security{sec})
+// checkFilters returns an error if type or currency filter (if set) is unknown
+func checkFilters(typeNameFilter string, currencyNameFilter string) error {
+	if typeNameFilter != "" {
+		sType := securities.GetSecurityTypeFromString(typeNameFilter)
+		if sType == securities.UnknownType {
+			return fmt.Errorf("wrong type name: %s", typeNameFilter)
+		}
+	}
+
+	if currencyNameFilter != "" {
+		currency := securities.GetSecurityCurrencyFromString(currencyNameFilter)
+		if currency == securities.UnknownCurrency {
+			return fmt.Errorf("wrong currency name: %s", currencyNameFilter)
+		}
+	}
+
+	return nil
 }
 
-// AddSecurities adds a list of securities to database
-func AddSecurities(db *sql.DB, sec []*securities.Security) error {
-	queryText := "INSERT INTO securities (id, name, type, currency) VALUES"
-	var args []any
-	noData := true
+// GetAllSecuritiesLastQuotes returns securities from database (not deleted, considering type and currency filters) with only the last count quotes of the interval for each security
+// Securities without quotes of the interval are not returned, quotes are ranked by a window over the index of security, interval and end date
+func GetAllSecuritiesLastQuotes(db *DB, typeNameFilter string, currencyNameFilter string, interval securities.QuotesInterval, count int) ([]*securities.Security, error) {
+	if count <= 0 {
+		return nil, fmt.Errorf("wrong number of quotes: %d", count)
+	}
 
-	for _, s := range sec {
-		secExists, err := SecurityExists(db, s.Id(), s.SType())
+	err := checkFilters(typeNameFilter, currencyNameFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	queryText := `
+			WITH RankedQuotes AS (
+				SELECT
+					sq.security,
+					sq.begin,
+					sq.end,
+					sq.open,
+					sq.close,
+					sq.high,
+					sq.low,
+					sq.volume,
+					ROW_NUMBER() OVER (PARTITION BY sq.security ORDER BY sq.end DESC) AS rn
+				FROM
+					security_quotes AS sq
+				WHERE
+					sq.interv = ?
+				)
+				SELECT
+					s.id,
+					s.name,
+					s.type,
+					s.currency,
+					rq.begin,
+					rq.end,
+					rq.open,
+					rq.close,
+					rq.high,
+					rq.low,
+					rq.volume
+				FROM
+					securities AS s
+						INNER JOIN RankedQuotes AS rq
+						ON s.id = rq.security
+				WHERE
+					rq.rn <= ?
+					AND (s.type = ? OR ?)
+					AND (s.currency = ? OR ?)
+					AND s.deleted_at IS NULL
+				ORDER BY
+					s.id,
+					rq.end`
+
+	quotesDB, err := db.Query(queryText, int(interval), count, strings.ToLower(typeNameFilter), typeNameFilter == "", strings.ToUpper(currencyNameFilter), currencyNameFilter == "")
+	if err != nil {
+		return nil, err
+	}
+	defer quotesDB.Close()
+
+	var res []*securities.Security
+	var sec *securities.Security
+
+	for quotesDB.Next() {
+		var id, name, sType, currency string
+		var begin, end []uint8
+		var open, close, high, low, volume float64
+
+		err = quotesDB.Scan(&id, &name, &sType, &currency, &begin, &end, &open, &close, &high, &low, &volume)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if secExists {
-			continue
+		// rows of one security go together, so a new security starts when id changes
+		if sec == nil || sec.Id() != id {
+			sec = securities.GetSecurity(id, name, securities.GetSecurityTypeFromString(sType), securities.GetSecurityCurrencyFromString(currency))
+			res = append(res, sec)
 		}
 
-		cur := s.Currency()
-		if cur == securities.UnknownCurrency {
-			cur = securities.RUB
+		beginDate, err := time.Parse("2006-01-02 15:04:05", string(begin))
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + string(begin))
 		}
 
-		if !noData {
-			queryText += ","
+		endDate, err := time.Parse("2006-01-02 15:04:05", string(end))
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + string(end))
 		}
-		queryText += " (?, ?, ?, ?)"
-		args = append(args, s.Id(), s.Name(), s.SType(), cur)
-		noData = false
-	}
 
-	if noData {
-		return nil
+		sec.SetQuotes(securities.SecurityQuotes{
+			Interval: interval,
+			Begin:    beginDate,
+			End:      endDate,
+			Open:     open,
+			Close:    close,
+			High:     high,
+			Low:      low,
+			Volume:   volume,
+		})
 	}
 
-	_, err := db.Exec(queryText, args...)
+	err = quotesDB.Err()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return res, nil
 }
 
-// UpdateSecurityQuotes gets security quotes from Moscow Exchange and writes them down to database
-func UpdateSecurityQuotes(db *sql.DB, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
-	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+// likeEscaper escapes special symbols of LIKE pattern with '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// GetStats returns the number of securities (not deleted) and quotes in database
+func GetStats(db *DB) (int, int, error) {
+	var secCount, quotesCount int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM securities WHERE deleted_at IS NULL").Scan(&secCount)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	if !secExists {
-		return fmt.Errorf("security %s does not exist", sec.Id())
+	err = db.QueryRow("SELECT COUNT(*) FROM security_quotes").Scan(&quotesCount)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	err = moex.GetSecurityQuotes(sec, dateFrom, dateTill, interval)
+	return secCount, quotesCount, nil
+}
+
+// Ping checks connection to database and runs a trivial query
+func Ping(ctx context.Context, db *DB) error {
+	err := db.PingContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	quotes := sec.QuotesOfInterval(interval)
-	if len(*quotes) == 0 {
-		return nil
-	}
+	var one int
+	return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
 
-	form := "2006-01-02 15:04:05"
+// GetSecuritiesByQuery returns securities which id or name contains the given text (case-insensitive) without quotes
+func GetSecuritiesByQuery(db *DB, q string) ([]*securities.Security, error) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(q)) + "%"
 
-	// we need to delete old quotes and add new one
-	// for example, yesterday we've got day quotes in the middle of the day - it looks ok but actually it's not really day quotes
-	// so today we need to update it to get real day quotes for the previous day
-	queryText := "DELETE FROM security_quotes WHERE security = ? AND begin >= ? AND begin <= ? AND interv = ?"
-	_, err = db.Exec(queryText, sec.Id(), dateFrom.UTC().Format(form), dateTill.UTC().Format(form), interval)
+	queryText := "SELECT id, name, type, currency FROM securities WHERE (LOWER(id) LIKE ? ESCAPE '!' OR LOWER(name) LIKE ? ESCAPE '!') AND deleted_at IS NULL ORDER BY id"
+	resDB, err := db.Query(queryText, pattern, pattern)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer resDB.Close()
 
-	//TODO:
-	// this will not work if we have > 1000 quotes
-	// actually that doesn't seem to really happen
-	queryText = "INSERT INTO security_quotes (security, begin, end, interv, open, close, high, low) VALUES"
-	var args []any
-	for i, q := range *quotes {
-		if i > 0 {
-			queryText += ","
+	res := []*securities.Security{}
+	for resDB.Next() {
+		var id, name, sType, currency string
+
+		err = resDB.Scan(&id, &name, &sType, &currency)
+		if err != nil {
+			return nil, err
 		}
-		queryText += " (?, ?, ?, ?, ?, ?, ?, ?)"
-		args = append(args, sec.Id(), q.Begin.UTC().Format(form), q.End.UTC().Format(form), interval, q.Open, q.Close, q.High, q.Low)
+
+		res = append(res, securities.GetSecurity(id, name, securities.GetSecurityTypeFromString(sType), securities.GetSecurityCurrencyFromString(currency)))
 	}
 
-	_, err = db.Exec(queryText, args...)
+	return res, resDB.Err()
+}
+
+// AddSecurity adds new security to database, deleted security is restored with new name, type and currency
+// ErrSecurityExists is returned if the security already exists, it's found out by the result of adding without checking it first
+func AddSecurity(db *DB, sec *securities.Security) error {
+	added, err := addSecurities(db, []*securities.Security{sec})
 	if err != nil {
 		return err
 	}
 
+	if added == 0 {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityExists, sec.Id())
+	}
+
 	return nil
 }
 
-// UpdateAllSecuritiesLastQuotes gets last quotes from Moscow Exchange for all existing in database securities (considering type and currency filters) for the day interval and writes them down to database
-func UpdateAllSecuritiesLastQuotes(db *sql.DB, typeNameFilter string, currencyNameFilter string) error {
-	secList, err := GetAllSecuritiesData(db, typeNameFilter, currencyNameFilter)
-	if err != nil {
-		return err
+// AddSecurities adds a list of securities to database
+// Existing securities are skipped, deleted securities are restored with new name, type and currency
+// Every security is added by one statement without checking it first, so concurrent adds of the same security don't conflict
+func AddSecurities(db *DB, sec []*securities.Security) error {
+	_, err := addSecurities(db, sec)
+	return err
+}
+
+// addSecurities adds a list of securities to database and returns the number of affected rows
+// Upsert of any dialect doesn't change existing securities, so the number is 0 if all securities already exist
+func addSecurities(db *DB, sec []*securities.Security) (int64, error) {
+	for _, s := range sec {
+		if s.Id() == "" {
+			return 0, errors.New("security has no id")
+		}
+
+		if s.SType() == "" || s.SType() == securities.UnknownType {
+			return 0, errors.New("security has no type or type is unknown")
+		}
+	}
+
+	// rows are locked in order of the statement, so concurrent adds lock them in the same order and don't deadlock
+	sorted := make([]*securities.Security, len(sec))
+	copy(sorted, sec)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Id() != sorted[j].Id() {
+			return sorted[i].Id() < sorted[j].Id()
+		}
+		return sorted[i].SType() < sorted[j].SType()
+	})
+
+	sec = make([]*securities.Security, 0, len(sorted))
+	for _, s := range sorted {
+		if len(sec) > 0 && s.Id() == sec[len(sec)-1].Id() && s.SType() == sec[len(sec)-1].SType() {
+			continue
+		}
+		sec = append(sec, s)
+	}
+
+	chunkSize := InsertChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 500
 	}
 
-	err = moex.GetQuotesForDate(secList, time.Now().UTC())
+	tx, err := db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer tx.Rollback()
 
-	form := "2006-01-02 15:04:05"
+	var added int64
 
-	//TODO:
-	// this will not work if we have > 1000 securities
-	// actually that absolutely doesn't seem to really happen
-	queryText := "INSERT INTO security_quotes (security, begin, end, interv, open, close, high, low) VALUES"
-	var args []any
-	noData := true
-	for _, s := range secList {
-		q := s.LastQuotes(securities.IntervalDay)
+	for len(sec) > 0 {
+		chunk := sec
+		if len(chunk) > chunkSize {
+			chunk = sec[:chunkSize]
+		}
+		sec = sec[len(chunk):]
+
+		queryText := "INSERT INTO securities (id, name, type, currency) VALUES"
+		args := make([]any, 0, len(chunk)*4)
+		for i, s := range chunk {
+			cur := s.Currency()
+			if cur == securities.UnknownCurrency {
+				cur = securities.RUB
+			}
 
-		qExist, err := SecurityQuotesExist(db, s, q.Begin, securities.IntervalDay)
-		if err != nil {
-			return err
+			if i > 0 {
+				queryText += ","
+			}
+			queryText += " (?, ?, ?, ?)"
+			args = append(args, s.Id(), s.Name(), s.SType(), cur)
 		}
 
-		if qExist {
-			// TODO: if security quotes exist we should also check end date and probably need to update quotes in database
-			continue
+		// existing security is kept, deleted security is restored with its quotes and gets new name, type and currency
+		queryText += db.Dialect.UpsertSecurities
+
+		res, err := tx.Exec(queryText, args...)
+		if err != nil {
+			return 0, err
 		}
 
-		if !noData {
-			queryText += ","
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
 		}
-		queryText += " (?, ?, ?, ?, ?, ?, ?, ?)"
-		args = append(args, s.Id(), q.Begin.UTC().Format(form), q.End.UTC().Format(form), securities.IntervalDay, q.Open, q.Close, q.High, q.Low)
-		noData = false
+		added += n
 	}
 
-	if noData {
-		return nil
+	return added, tx.Commit()
+}
+
+// updateGroup joins concurrent updates of the same quotes, so they share one Moscow Exchange request and one database write
+var updateGroup singleflight.Group
+
+// SharedUpdateTimeout is the maximum time of update shared by concurrent callers
+// The shared update doesn't stop when the caller which has started it goes away, so it's limited by this time only
+var SharedUpdateTimeout = 10 * time.Minute
+
+// sharedUpdate makes the update once for all concurrent callers with the same key and returns its result
+// The update gets the context of the first caller without its cancellation and with SharedUpdateTimeout deadline
+// Every caller waits for the result while its own context is alive, so cancelled caller doesn't fail the others
+func sharedUpdate(ctx context.Context, key string, update func(ctx context.Context) (any, error)) (any, error) {
+	resChan := updateGroup.DoChan(key, func() (any, error) {
+		updCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), SharedUpdateTimeout)
+		defer cancel()
+
+		return update(updCtx)
+	})
+
+	select {
+	case res := <-resChan:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
+
+// UpdateSecurityQuotes gets security quotes from Moscow Exchange and writes them down to database
+// Old quotes of the period are replaced with the new ones in one transaction, so if anything goes wrong the old quotes are kept
+// Concurrent updates of the same security, interval and period are made once, all callers get the same quotes
+func UpdateSecurityQuotes(ctx context.Context, db *DB, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	key := fmt.Sprintf("%p|%s|%s|%d|%s|%s", db, sec.Id(), sec.SType(), interval, dateFrom.Format(time.RFC3339), dateTill.Format(time.RFC3339))
+
+	quotes, err := sharedUpdate(ctx, key, func(ctx context.Context) (any, error) {
+		updSec := securities.GetQuickSecurity(sec.Id(), sec.SType())
 
-	_, err = db.Exec(queryText, args...)
+		err := updateSecurityQuotes(ctx, db, updSec, dateFrom, dateTill, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		return updSec.QuotesOfInterval(interval), nil
+	})
 	if err != nil {
 		return err
 	}
 
+	sec.SetQuotesList(quotes.(*[]securities.SecurityQuotes))
+
 	return nil
 }
 
-// DeleteSecurity removes security from database
-func DeleteSecurity(db *sql.DB, sec *securities.Security) error {
-	seqExists, err := SecurityExists(db, sec.Id(), sec.SType())
+// updateSecurityQuotes gets security quotes from Moscow Exchange and replaces quotes of the period in database with them
+func updateSecurityQuotes(ctx context.Context, db *DB, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
 	if err != nil {
 		return err
 	}
 
-	if !seqExists {
-		return nil
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
 	}
 
-	queryText := "DELETE FROM security_quotes WHERE security = ?"
-	_, err = db.Exec(queryText, sec.Id())
+	err = moex.GetSecurityQuotes(ctx, sec, dateFrom, dateTill, interval)
 	if err != nil {
 		return err
 	}
 
-	queryText = "DELETE FROM securities WHERE id = ?"
-	_, err = db.Exec(queryText, sec.Id())
+	quotes := sec.QuotesOfInterval(interval)
+	if len(*quotes) == 0 {
+		return nil
+	}
+
+	form := "2006-01-02 15:04:05"
+
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
-}
-
-// CreateDatabase creates new database to work with securities
-func CreateDatabase(sqlParam string, dbName string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", sqlParam+"/")
+	// we need to delete old quotes and add new one
+	// for example, yesterday we've got day quotes in the middle of the day - it looks ok but actually it's not really day quotes
+	// so today we need to update it to get real day quotes for the previous day
+	queryText := "DELETE FROM security_quotes WHERE security = ? AND begin >= ? AND begin <= ? AND interv = ?"
+	_, err = tx.ExecContext(ctx, queryText, sec.Id(), dateFrom.UTC().Format(form), dateTill.UTC().Format(form), interval)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// We should already know that database doesn't exist
-	// Also we should be already sure that dbname is a good value
-	_, err = db.Exec("CREATE DATABASE " + dbName)
+	rows := make([]quotesRow, 0, len(*quotes))
+	for _, q := range *quotes {
+		rows = append(rows, quotesRow{security: sec.Id(), quotes: q})
+	}
+
+	err = insertQuotes(ctx, tx, db.Dialect, rows, false)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	db.Close()
 
-	// It's better to close and reopen database
-	db, err = sql.Open("mysql", sqlParam+"/"+dbName)
+	err = setLastUpdated(ctx, tx, []string{sec.Id()}, time.Now())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	//db.SetMaxOpenConns(150)
 
-	// Creating Securities table - where we keep general information about securities
-	_, err = db.Exec(`
-		CREATE TABLE securities(
-			id VARCHAR(20) NOT NULL,
+	return tx.Commit()
+}
+
+// quotesRow is a row of security quotes table
+type quotesRow struct {
+	security string
+	quotes   securities.SecurityQuotes
+}
+
+// UpdateSecurityQuotesIncremental gets security quotes from Moscow Exchange only from the last stored quotes of the interval till dateTill
+// and merges them with stored quotes (the last stored quotes are replaced because they may be not final)
+// If there are no stored quotes of the interval after dateFrom the whole period is updated with UpdateSecurityQuotes
+func UpdateSecurityQuotesIncremental(ctx context.Context, db *DB, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	var lastBeginStr sql.NullString
+	queryText := "SELECT MAX(begin) FROM security_quotes WHERE security = ? AND interv = ?"
+	err = db.QueryRowContext(ctx, queryText, sec.Id(), interval).Scan(&lastBeginStr)
+	if err != nil {
+		return err
+	}
+
+	if !lastBeginStr.Valid {
+		return UpdateSecurityQuotes(ctx, db, sec, dateFrom, dateTill, interval)
+	}
+
+	lastBegin, err := time.Parse("2006-01-02 15:04:05", lastBeginStr.String)
+	if err != nil {
+		return errors.New("can't convert database date format: " + lastBeginStr.String)
+	}
+
+	if lastBegin.Before(dateFrom) {
+		return UpdateSecurityQuotes(ctx, db, sec, dateFrom, dateTill, interval)
+	}
+
+	updSec := securities.GetQuickSecurity(sec.Id(), sec.SType())
+
+	err = moex.GetSecurityQuotes(ctx, updSec, lastBegin, dateTill, interval)
+	if err != nil {
+		return err
+	}
+
+	quotes := updSec.QuotesOfInterval(interval)
+	if len(*quotes) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows := make([]quotesRow, 0, len(*quotes))
+	for _, q := range *quotes {
+		rows = append(rows, quotesRow{security: sec.Id(), quotes: q})
+	}
+
+	err = insertQuotes(ctx, tx, db.Dialect, rows, true)
+	if err != nil {
+		return err
+	}
+
+	err = setLastUpdated(ctx, tx, []string{sec.Id()}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	sec.SetQuotesList(quotes)
+
+	return nil
+}
+
+// BackfillSecurityQuotes gets from Moscow Exchange only quotes of the trading days which are missing between the first and the last stored quotes of the period
+// Adjacent missing days are got by one request, stored quotes are not changed
+// The number of added quotes is returned
+func BackfillSecurityQuotes(ctx context.Context, db *DB, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) (int, error) {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return 0, err
+	}
+
+	if !secExists {
+		return 0, fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	form := "2006-01-02 15:04:05"
+
+	queryText := "SELECT begin FROM security_quotes WHERE security = ? AND interv = ? AND begin >= ? AND begin <= ? ORDER BY begin"
+	rows, err := db.QueryContext(ctx, queryText, sec.Id(), interval, dateFrom.UTC().Format(form), dateTill.UTC().Format(form))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	stored := securities.GetQuickSecurity(sec.Id(), sec.SType())
+	var begins []time.Time
+	for rows.Next() {
+		var beginStr string
+		err = rows.Scan(&beginStr)
+		if err != nil {
+			return 0, err
+		}
+
+		begin, err := time.Parse(form, beginStr)
+		if err != nil {
+			return 0, errors.New("can't convert database date format: " + beginStr)
+		}
+
+		begins = append(begins, begin)
+		stored.SetQuotes(securities.SecurityQuotes{Interval: interval, Begin: begin, End: begin})
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	missing := stored.MissingDates(interval, moex.Calendar{})
+	if len(missing) == 0 {
+		return 0, nil
+	}
+
+	// missing dates without stored quotes between them are joined into one period
+	type period struct {
+		from time.Time
+		till time.Time
+	}
+
+	var periods []period
+	next := 0
+	for _, date := range missing {
+		for next < len(begins) && begins[next].Before(date) {
+			next++
+		}
+
+		if len(periods) > 0 && (next == 0 || !begins[next-1].After(periods[len(periods)-1].till)) {
+			periods[len(periods)-1].till = date
+			continue
+		}
+
+		periods = append(periods, period{from: date, till: date})
+	}
+
+	present := make(map[time.Time]bool, len(begins))
+	for _, begin := range begins {
+		present[begin] = true
+	}
+
+	var newRows []quotesRow
+	var added []securities.SecurityQuotes
+	for _, p := range periods {
+		updSec := securities.GetQuickSecurity(sec.Id(), sec.SType())
+
+		err = moex.GetSecurityQuotes(ctx, updSec, p.from, periodEnd(interval, p.till), interval)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, q := range *updSec.QuotesOfInterval(interval) {
+			if present[q.Begin] {
+				continue
+			}
+
+			present[q.Begin] = true
+			newRows = append(newRows, quotesRow{security: sec.Id(), quotes: q})
+			added = append(added, q)
+		}
+	}
+
+	if len(newRows) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = insertQuotes(ctx, tx, db.Dialect, newRows, false)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	sec.AddQuotes(added)
+
+	return len(added), nil
+}
+
+// periodEnd returns the last second of the day (or the coarser period of interval) which begins at the given date
+func periodEnd(interval securities.QuotesInterval, date time.Time) time.Time {
+	switch interval {
+	case securities.IntervalWeek:
+		date = date.AddDate(0, 0, 7)
+	case securities.IntervalMonth:
+		date = date.AddDate(0, 1, 0)
+	case securities.IntervalQuarter:
+		date = date.AddDate(0, 3, 0)
+	default:
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date.Add(-time.Second)
+}
+
+// insertQuotes adds quotes rows to database by chunks of InsertChunkSize rows
+// If upsert is true the existing quotes with the same begin date and interval are updated
+func insertQuotes(ctx context.Context, tx *sql.Tx, dialect *Dialect, rows []quotesRow, upsert bool) error {
+	chunkSize := InsertChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+
+	form := "2006-01-02 15:04:05"
+
+	for len(rows) > 0 {
+		chunk := rows
+		if len(chunk) > chunkSize {
+			chunk = rows[:chunkSize]
+		}
+		rows = rows[len(chunk):]
+
+		queryText := "INSERT INTO security_quotes (security, begin, end, interv, open, close, high, low, volume) VALUES"
+		args := make([]any, 0, len(chunk)*9)
+		for i, r := range chunk {
+			if i > 0 {
+				queryText += ","
+			}
+			queryText += " (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			q := r.quotes
+			args = append(args, r.security, q.Begin.UTC().Format(form), q.End.UTC().Format(form), q.Interval, q.Open, q.Close, q.High, q.Low, q.Volume)
+		}
+
+		if upsert {
+			queryText += dialect.UpsertQuotes
+		}
+
+		_, err := tx.ExecContext(ctx, queryText, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLastUpdated sets the time of the last quotes update for securities with the given ids
+func setLastUpdated(ctx context.Context, tx *sql.Tx, ids []string, updated time.Time) error {
+	chunkSize := InsertChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+
+	for len(ids) > 0 {
+		chunk := ids
+		if len(chunk) > chunkSize {
+			chunk = ids[:chunkSize]
+		}
+		ids = ids[len(chunk):]
+
+		args := make([]any, 0, len(chunk)+1)
+		args = append(args, updated.UTC().Format("2006-01-02 15:04:05"))
+		for _, id := range chunk {
+			args = append(args, id)
+		}
+
+		queryText := "UPDATE securities SET last_updated = ? WHERE id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ") + ")"
+		_, err := tx.ExecContext(ctx, queryText, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefetchSecurityQuotesForDate gets security quotes for the given date from Moscow Exchange again and replaces stored quotes of this date with them
+// Quotes are refetched for every interval which has stored quotes beginning on this date (or for the day interval if there are no such quotes)
+// Quotes of longer intervals (week, month and quarter) begin before the date as a rule, so they aren't refetched
+func RefetchSecurityQuotesForDate(ctx context.Context, db *DB, sec *securities.Security, date time.Time) error {
+	dateFrom := date.UTC().Truncate(24 * time.Hour)
+	dateTill := dateFrom.Add(24*time.Hour - time.Second)
+
+	form := "2006-01-02 15:04:05"
+
+	queryText := "SELECT DISTINCT interv FROM security_quotes WHERE security = ? AND begin >= ? AND begin <= ?"
+	resDB, err := db.QueryContext(ctx, queryText, sec.Id(), dateFrom.Format(form), dateTill.Format(form))
+	if err != nil {
+		return err
+	}
+	defer resDB.Close()
+
+	var intervals []securities.QuotesInterval
+	for resDB.Next() {
+		var interval int
+
+		err = resDB.Scan(&interval)
+		if err != nil {
+			return err
+		}
+
+		intervals = append(intervals, securities.QuotesInterval(interval))
+	}
+
+	err = resDB.Err()
+	if err != nil {
+		return err
+	}
+
+	if len(intervals) == 0 {
+		intervals = append(intervals, securities.IntervalDay)
+	}
+
+	for _, interval := range intervals {
+		err = UpdateSecurityQuotes(ctx, db, sec, dateFrom, dateTill, interval)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateAllSecuritiesLastQuotes gets last quotes from Moscow Exchange for all existing in database securities (considering type and currency filters) for the day interval and writes them down to database
+// Concurrent updates with the same filters (manual and scheduled ones for example) are made once
+func UpdateAllSecuritiesLastQuotes(ctx context.Context, db *DB, typeNameFilter string, currencyNameFilter string) error {
+	key := fmt.Sprintf("%p|lastQuotes|%s|%s", db, typeNameFilter, currencyNameFilter)
+
+	_, err := sharedUpdate(ctx, key, func(ctx context.Context) (any, error) {
+		return nil, updateAllSecuritiesLastQuotes(ctx, db, typeNameFilter, currencyNameFilter)
+	})
+
+	return err
+}
+
+// updateAllSecuritiesLastQuotes gets last quotes from Moscow Exchange for all securities in database and writes them down to database
+func updateAllSecuritiesLastQuotes(ctx context.Context, db *DB, typeNameFilter string, currencyNameFilter string) error {
+	secList, _, err := GetAllSecuritiesData(db, typeNameFilter, currencyNameFilter, securities.SortByID, false, 0, 0, false)
+	if err != nil {
+		return err
+	}
+
+	// weekends and holidays are skipped, there is no trading data for them
+	err = moex.GetQuotesForDate(ctx, secList, moex.LastTradingDay(time.Now().UTC()))
+	if err != nil {
+		return err
+	}
+
+	var rows []quotesRow
+	var ids []string
+	for _, s := range secList {
+		q := s.LastQuotes(securities.IntervalDay)
+		if q.Interval == securities.IntervalUnknown {
+			// there were no trading of this security
+			continue
+		}
+
+		rows = append(rows, quotesRow{security: s.Id(), quotes: q})
+		ids = append(ids, s.Id())
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// quotes got in the middle of the day are updated with the new ones
+	err = insertQuotes(ctx, tx, db.Dialect, rows, true)
+	if err != nil {
+		return err
+	}
+
+	err = setLastUpdated(ctx, tx, ids, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateSecurityDividends gets dividends of security from Moscow Exchange and replaces stored dividends with them in one transaction
+func UpdateSecurityDividends(ctx context.Context, db *DB, sec *securities.Security) error {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	dividends, err := moex.GetDividends(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM dividends WHERE security = ?", sec.Id())
+	if err != nil {
+		return err
+	}
+
+	if len(dividends) > 0 {
+		queryText := "INSERT INTO dividends (security, registry_date, value, currency) VALUES"
+		args := make([]any, 0, len(dividends)*4)
+		for i, d := range dividends {
+			if i > 0 {
+				queryText += ","
+			}
+			queryText += " (?, ?, ?, ?)"
+			args = append(args, sec.Id(), d.Date.Format("2006-01-02"), d.Value, d.Currency)
+		}
+
+		_, err = tx.ExecContext(ctx, queryText, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetSecurityDividends returns stored dividends of security sorted by date
+func GetSecurityDividends(db *DB, sec *securities.Security) ([]securities.Dividend, error) {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return nil, err
+	}
+
+	if !secExists {
+		return nil, fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	resDB, err := db.Query("SELECT registry_date, value, currency FROM dividends WHERE security = ? ORDER BY registry_date", sec.Id())
+	if err != nil {
+		return nil, err
+	}
+	defer resDB.Close()
+
+	res := []securities.Dividend{}
+	for resDB.Next() {
+		var dateStr, currency string
+		var value float64
+
+		err = resDB.Scan(&dateStr, &value, &currency)
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + dateStr)
+		}
+
+		res = append(res, securities.Dividend{Date: date, Value: value, Currency: securities.GetSecurityCurrencyFromString(currency)})
+	}
+
+	return res, resDB.Err()
+}
+
+// UpdateBondInfo gets face value and payments of bond from Moscow Exchange and replaces stored bond info with them in one transaction
+func UpdateBondInfo(ctx context.Context, db *DB, sec *securities.Security) error {
+	if sec.SType() != securities.Bond {
+		return fmt.Errorf("security %s is not a bond", sec.Id())
+	}
+
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	bond, err := moex.GetBondInfo(ctx, sec)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM bond_payments WHERE security = ?", sec.Id())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM bonds WHERE security = ?", sec.Id())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO bonds (security, face_value) VALUES (?, ?)", sec.Id(), bond.FaceValue)
+	if err != nil {
+		return err
+	}
+
+	if len(bond.Payments) > 0 {
+		queryText := "INSERT INTO bond_payments (security, payment_date, start_date, coupon, amortization) VALUES"
+		args := make([]any, 0, len(bond.Payments)*5)
+		for i, p := range bond.Payments {
+			if i > 0 {
+				queryText += ","
+			}
+			queryText += " (?, ?, ?, ?, ?)"
+
+			var start any
+			if !p.Start.IsZero() {
+				start = p.Start.Format("2006-01-02")
+			}
+			args = append(args, sec.Id(), p.Date.Format("2006-01-02"), start, p.Coupon, p.Amortization)
+		}
+
+		_, err = tx.ExecContext(ctx, queryText, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBondInfo returns stored face value and payments of bond sorted by date
+// ErrNoBondInfo is returned if bond info was never stored
+func GetBondInfo(db *DB, sec *securities.Security) (*securities.BondInfo, error) {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return nil, err
+	}
+
+	if !secExists {
+		return nil, fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	res := &securities.BondInfo{Payments: []securities.BondPayment{}}
+	err = db.QueryRow("SELECT face_value FROM bonds WHERE security = ?", sec.Id()).Scan(&res.FaceValue)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", securities.ErrNoBondInfo, sec.Id())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resDB, err := db.Query("SELECT payment_date, start_date, coupon, amortization FROM bond_payments WHERE security = ? ORDER BY payment_date", sec.Id())
+	if err != nil {
+		return nil, err
+	}
+	defer resDB.Close()
+
+	for resDB.Next() {
+		var dateStr string
+		var startStr sql.NullString
+		var p securities.BondPayment
+
+		err = resDB.Scan(&dateStr, &startStr, &p.Coupon, &p.Amortization)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Date, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + dateStr)
+		}
+
+		if startStr.Valid {
+			p.Start, err = time.Parse("2006-01-02", startStr.String)
+			if err != nil {
+				return nil, errors.New("can't convert database date format: " + startStr.String)
+			}
+		}
+
+		res.Payments = append(res.Payments, p)
+	}
+
+	return res, resDB.Err()
+}
+
+// GetCurrencyRate returns the rate of currency in rubles for the date - the close price of Moscow Exchange currency fixing
+// Fixings are stored as securities of Currency type, the last daily quotes not older than moex.MaxDaysBack days are used
+// If there is no stored rate for the last trading day by the date, rates are got from Moscow Exchange and stored
+// The stored rate is used if Moscow Exchange can't give the new one
+// ErrNoRate is returned if there is no rate for the date
+func GetCurrencyRate(ctx context.Context, db *DB, currency securities.SecurityCurrency, date time.Time) (float64, error) {
+	if currency == securities.RUB {
+		return 1, nil
+	}
+
+	id, ok := moex.CurrencyRateIds[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", securities.ErrNoRate, currency)
+	}
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	dateFrom := day.AddDate(0, 0, -moex.MaxDaysBack)
+	dateTill := day.AddDate(0, 0, 1).Add(-time.Second)
+
+	rate, rateDay, err := storedCurrencyRate(ctx, db, id, dateFrom, dateTill)
+	if err != nil {
+		return 0, err
+	}
+
+	if rate > 0 && !rateDay.Before(moex.LastTradingDay(day)) {
+		return rate, nil
+	}
+
+	key := fmt.Sprintf("%p|rate|%s|%s", db, id, day.Format("2006-01-02"))
+	_, fetchErr := sharedUpdate(ctx, key, func(ctx context.Context) (any, error) {
+		return nil, fetchCurrencyRates(ctx, db, currency, id, dateFrom, dateTill)
+	})
+
+	if fetchErr == nil {
+		rate, _, err = storedCurrencyRate(ctx, db, id, dateFrom, dateTill)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if rate > 0 {
+		return rate, nil
+	}
+
+	if fetchErr != nil {
+		return 0, fmt.Errorf("%w: %s for %s (%v)", securities.ErrNoRate, currency, day.Format("2006-01-02"), fetchErr)
+	}
+
+	return 0, fmt.Errorf("%w: %s for %s", securities.ErrNoRate, currency, day.Format("2006-01-02"))
+}
+
+// ConvertPrice converts amount from one currency to another by rates of the date
+// Rates are in rubles, so cross rates (dollars to yuans for example) are got through rubles
+// ErrNoRate is returned if there is no rate of any of currencies for the date
+func ConvertPrice(ctx context.Context, db *DB, amount float64, from securities.SecurityCurrency, to securities.SecurityCurrency, date time.Time) (float64, error) {
+	if from == to && from != securities.UnknownCurrency {
+		return amount, nil
+	}
+
+	fromRate, err := GetCurrencyRate(ctx, db, from, date)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %s to %s: %w", from, to, err)
+	}
+
+	toRate, err := GetCurrencyRate(ctx, db, to, date)
+	if err != nil {
+		return 0, fmt.Errorf("can't convert %s to %s: %w", from, to, err)
+	}
+
+	return amount * fromRate / toRate, nil
+}
+
+// storedCurrencyRate returns the close price and the day of the last stored daily quotes of currency fixing in the period
+// Zero rate is returned if there are no quotes
+func storedCurrencyRate(ctx context.Context, db *DB, id string, dateFrom time.Time, dateTill time.Time) (float64, time.Time, error) {
+	form := "2006-01-02 15:04:05"
+
+	var beginStr string
+	var rate float64
+
+	queryText := "SELECT begin, close FROM security_quotes WHERE security = ? AND interv = ? AND begin >= ? AND begin <= ? ORDER BY begin DESC LIMIT 1"
+	err := db.QueryRowContext(ctx, queryText, id, securities.IntervalDay, dateFrom.UTC().Format(form), dateTill.UTC().Format(form)).Scan(&beginStr, &rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, nil
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	begin, err := time.Parse(form, beginStr)
+	if err != nil {
+		return 0, time.Time{}, errors.New("can't convert database date format: " + beginStr)
+	}
+
+	return rate, time.Date(begin.Year(), begin.Month(), begin.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// fetchCurrencyRates gets daily quotes of currency fixing for the period from Moscow Exchange and stores them
+// The fixing is added to database as a security of Currency type if it doesn't exist
+func fetchCurrencyRates(ctx context.Context, db *DB, currency securities.SecurityCurrency, id string, dateFrom time.Time, dateTill time.Time) error {
+	err := AddSecurity(db, securities.GetSecurity(id, string(currency)+"/RUB", securities.Currency, securities.RUB))
+	if err != nil && !errors.Is(err, securities.ErrSecurityExists) {
+		return err
+	}
+
+	sec := securities.GetQuickSecurity(id, securities.Currency)
+
+	err = moex.GetSecurityQuotes(ctx, sec, dateFrom, dateTill, securities.IntervalDay)
+	if err != nil {
+		return err
+	}
+
+	quotes := sec.QuotesOfInterval(securities.IntervalDay)
+	if len(*quotes) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows := make([]quotesRow, 0, len(*quotes))
+	for _, q := range *quotes {
+		rows = append(rows, quotesRow{security: id, quotes: q})
+	}
+
+	err = insertQuotes(ctx, tx, db.Dialect, rows, true)
+	if err != nil {
+		return err
+	}
+
+	err = setLastUpdated(ctx, tx, []string{id}, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateSecurity changes name and currency of existing security in database, quotes are kept
+func UpdateSecurity(db *DB, sec *securities.Security) error {
+	secExists, err := SecurityExists(db, sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	if sec.Currency() == securities.UnknownCurrency {
+		return errors.New("security currency is unknown")
+	}
+
+	queryText := "UPDATE securities SET name = ?, currency = ? WHERE id = ?"
+	_, err = db.Exec(queryText, sec.Name(), sec.Currency(), sec.Id())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteSecurity marks security as deleted in database, its quotes are kept
+// ErrSecurityNotExist is returned if there is no such security or it's already deleted
+func DeleteSecurity(db *DB, sec *securities.Security) error {
+	res, err := db.Exec("UPDATE securities SET deleted_at = ? WHERE id = ? AND type = ? AND deleted_at IS NULL",
+		time.Now().UTC().Format("2006-01-02 15:04:05"), sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	return nil
+}
+
+// DeleteSecurities marks a list of securities as deleted in database at once, their quotes are kept
+// Securities which don't exist are skipped
+func DeleteSecurities(db *DB, sec []*securities.Security) error {
+	deletedAt := time.Now().UTC().Format("2006-01-02 15:04:05")
+
+	return changeSecurities(db, sec, false, func(tx *sql.Tx, placeholders string, ids []any) error {
+		_, err := tx.Exec("UPDATE securities SET deleted_at = ? WHERE id IN ("+placeholders+")", append([]any{deletedAt}, ids...)...)
+		return err
+	})
+}
+
+// PurgeSecurities removes a list of securities (deleted or not) with their quotes, dividends and bond info from database in one transaction
+// Securities which don't exist are skipped, it can't be undone
+func PurgeSecurities(db *DB, sec []*securities.Security) error {
+	return changeSecurities(db, sec, true, func(tx *sql.Tx, placeholders string, ids []any) error {
+		_, err := tx.Exec("DELETE FROM security_quotes WHERE security IN ("+placeholders+")", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM dividends WHERE security IN ("+placeholders+")", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM bond_payments WHERE security IN ("+placeholders+")", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM bonds WHERE security IN ("+placeholders+")", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM alert_firings WHERE alert IN (SELECT id FROM alerts WHERE security IN ("+placeholders+"))", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM alerts WHERE security IN ("+placeholders+")", ids...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM securities WHERE id IN ("+placeholders+")", ids...)
+		return err
+	})
+}
+
+// changeSecurities calls change function for existing securities from the list by chunks in one transaction
+// Deleted securities are considered existing if includeDeleted is set
+func changeSecurities(db *DB, sec []*securities.Security, includeDeleted bool, change func(tx *sql.Tx, placeholders string, ids []any) error) error {
+	queryText := "SELECT id FROM securities WHERE id = ? AND type = ? AND (deleted_at IS NULL OR ?)"
+
+	var ids []any
+	for _, s := range sec {
+		var id string
+		err := db.QueryRow(queryText, s.Id(), s.SType(), includeDeleted).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// the number of placeholders is limited, so securities are changed by chunks of the same size as for inserting
+	chunkSize := InsertChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 500
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for len(ids) > 0 {
+		chunk := ids
+		if len(chunk) > chunkSize {
+			chunk = ids[:chunkSize]
+		}
+		ids = ids[len(chunk):]
+
+		err = change(tx, strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", "), chunk)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RestoreSecurity removes deleted mark from security in database
+func RestoreSecurity(db *DB, sec *securities.Security) error {
+	res, err := db.Exec("UPDATE securities SET deleted_at = NULL WHERE id = ? AND type = ? AND deleted_at IS NOT NULL", sec.Id(), sec.SType())
+	if err != nil {
+		return err
+	}
+
+	restored, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if restored == 0 {
+		return fmt.Errorf("%w: there is no deleted security %s", securities.ErrSecurityNotExist, sec.Id())
+	}
+
+	return nil
+}
+
+// identifierRegexp matches names of databases and tables which may be put into SQL query text
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// AddPortfolio adds portfolio with its positions to database and sets its id
+// Securities of positions must exist in database
+func AddPortfolio(db *DB, p *portfolio.Portfolio) error {
+	err := p.Check()
+	if err != nil {
+		return err
+	}
+
+	for _, pos := range p.Positions {
+		secExists, err := SecurityExists(db, pos.Id, pos.Type)
+		if err != nil {
+			return err
+		}
+
+		if !secExists {
+			return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, pos.Id)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO portfolios (name) VALUES (?)", p.Name)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, pos := range p.Positions {
+		queryText := "INSERT INTO portfolio_positions (portfolio, security, type, quantity, avg_price) VALUES (?, ?, ?, ?, ?)"
+		_, err = tx.Exec(queryText, id, pos.Id, pos.Type, pos.Quantity, pos.AvgPrice)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	p.Id = id
+
+	return nil
+}
+
+// GetPortfolio returns portfolio with the given id from database
+func GetPortfolio(db *DB, id int64) (*portfolio.Portfolio, error) {
+	p := &portfolio.Portfolio{Id: id}
+
+	err := db.QueryRow("SELECT name FROM portfolios WHERE id = ?", id).Scan(&p.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", portfolio.ErrPortfolioNotExist, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byId, err := getPortfolioPositions(db, "WHERE portfolio = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Positions = byId[id]
+
+	return p, nil
+}
+
+// GetAllPortfolios returns all portfolios from database sorted by id
+func GetAllPortfolios(db *DB) ([]*portfolio.Portfolio, error) {
+	rows, err := db.Query("SELECT id, name FROM portfolios ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []*portfolio.Portfolio{}
+	for rows.Next() {
+		p := &portfolio.Portfolio{}
+		err = rows.Scan(&p.Id, &p.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	byId, err := getPortfolioPositions(db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range res {
+		p.Positions = byId[p.Id]
+	}
+
+	return res, nil
+}
+
+// getPortfolioPositions returns positions of portfolios by portfolio id considering the given condition
+// Positions of every portfolio are sorted by security id
+func getPortfolioPositions(db *DB, condition string, args ...any) (map[int64][]portfolio.Position, error) {
+	rows, err := db.Query("SELECT portfolio, security, type, quantity, avg_price FROM portfolio_positions "+condition+" ORDER BY portfolio, security", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int64][]portfolio.Position)
+	for rows.Next() {
+		var id int64
+		var pos portfolio.Position
+		var sType string
+
+		err = rows.Scan(&id, &pos.Id, &sType, &pos.Quantity, &pos.AvgPrice)
+		if err != nil {
+			return nil, err
+		}
+
+		pos.Type = securities.GetSecurityTypeFromString(sType)
+		res[id] = append(res[id], pos)
+	}
+
+	return res, rows.Err()
+}
+
+// DeletePortfolio removes portfolio with its positions from database
+func DeletePortfolio(db *DB, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM portfolio_positions WHERE portfolio = ?", id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM portfolios WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: %d", portfolio.ErrPortfolioNotExist, id)
+	}
+
+	return tx.Commit()
+}
+
+// AddAlert adds alert to database and sets its id
+// Security of alert must exist in database
+func AddAlert(db *DB, a *alerts.Alert) error {
+	err := a.Check()
+	if err != nil {
+		return err
+	}
+
+	secExists, err := SecurityExists(db, a.SecurityId, a.Type)
+	if err != nil {
+		return err
+	}
+
+	if !secExists {
+		return fmt.Errorf("%w: %s", securities.ErrSecurityNotExist, a.SecurityId)
+	}
+
+	queryText := "INSERT INTO alerts (security, type, direction, threshold, enabled, url) VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := db.Exec(queryText, a.SecurityId, a.Type, a.Direction, a.Threshold, a.Enabled, a.URL)
+	if err != nil {
+		return err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	a.Id = id
+
+	return nil
+}
+
+// GetAlert returns alert with the given id from database
+func GetAlert(db *DB, id int64) (*alerts.Alert, error) {
+	list, err := getAlerts(db, "WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: %d", alerts.ErrAlertNotExist, id)
+	}
+
+	return list[0], nil
+}
+
+// GetAllAlerts returns all alerts from database sorted by id
+func GetAllAlerts(db *DB) ([]*alerts.Alert, error) {
+	return getAlerts(db, "")
+}
+
+// getAlerts returns alerts from database considering the given condition sorted by id
+func getAlerts(db *DB, condition string, args ...any) ([]*alerts.Alert, error) {
+	rows, err := db.Query("SELECT id, security, type, direction, threshold, enabled, url FROM alerts "+condition+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []*alerts.Alert{}
+	for rows.Next() {
+		a := &alerts.Alert{}
+		var sType, direction string
+
+		err = rows.Scan(&a.Id, &a.SecurityId, &sType, &direction, &a.Threshold, &a.Enabled, &a.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Type = securities.GetSecurityTypeFromString(sType)
+		a.Direction = alerts.GetDirectionFromString(direction)
+		res = append(res, a)
+	}
+
+	return res, rows.Err()
+}
+
+// UpdateAlert changes direction, threshold, enabled flag and webhook of existing alert in database
+func UpdateAlert(db *DB, a *alerts.Alert) error {
+	err := a.Check()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the number of changed rows is zero if values are the same, so existence is checked separately
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM alerts WHERE id = ?", a.Id).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return fmt.Errorf("%w: %d", alerts.ErrAlertNotExist, a.Id)
+	}
+
+	_, err = tx.Exec("UPDATE alerts SET direction = ?, threshold = ?, enabled = ?, url = ? WHERE id = ?", a.Direction, a.Threshold, a.Enabled, a.URL, a.Id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAlert removes alert with its firings from database
+func DeleteAlert(db *DB, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM alert_firings WHERE alert = ?", id)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec("DELETE FROM alerts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: %d", alerts.ErrAlertNotExist, id)
+	}
+
+	return tx.Commit()
+}
+
+// FireAlerts records firings of alerts, sets their ids and disables fired alerts in one transaction
+func FireAlerts(db *DB, firings []alerts.Firing) error {
+	if len(firings) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ids := make([]int64, 0, len(firings))
+	for _, f := range firings {
+		queryText := "INSERT INTO alert_firings (alert, close, quotes_end, fired_at, delivery, delivery_error) VALUES (?, ?, ?, ?, ?, ?)"
+		res, err := tx.Exec(queryText, f.AlertId, f.Close, f.Date.UTC().Format("2006-01-02 15:04:05"), f.FiredAt.UTC().Format("2006-01-02 15:04:05"), f.Delivery, f.DeliveryError)
+		if err != nil {
+			return err
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+
+		_, err = tx.Exec("UPDATE alerts SET enabled = ? WHERE id = ?", false, f.AlertId)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for i := range firings {
+		firings[i].Id = ids[i]
+	}
+
+	return nil
+}
+
+// GetAlertFirings returns firings of alert from database sorted by time
+func GetAlertFirings(db *DB, id int64) ([]alerts.Firing, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM alerts WHERE id = ?", id).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count == 0 {
+		return nil, fmt.Errorf("%w: %d", alerts.ErrAlertNotExist, id)
+	}
+
+	rows, err := db.Query("SELECT id, close, quotes_end, fired_at, delivery, delivery_error FROM alert_firings WHERE alert = ? ORDER BY fired_at, id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []alerts.Firing{}
+	for rows.Next() {
+		f := alerts.Firing{AlertId: id}
+		var date, firedAt []uint8
+		var delivery string
+
+		err = rows.Scan(&f.Id, &f.Close, &date, &firedAt, &delivery, &f.DeliveryError)
+		if err != nil {
+			return nil, err
+		}
+
+		f.Date, err = time.Parse("2006-01-02 15:04:05", string(date))
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + string(date))
+		}
+
+		f.FiredAt, err = time.Parse("2006-01-02 15:04:05", string(firedAt))
+		if err != nil {
+			return nil, errors.New("can't convert database date format: " + string(firedAt))
+		}
+
+		f.Delivery = alerts.DeliveryStatus(delivery)
+		res = append(res, f)
+	}
+
+	return res, rows.Err()
+}
+
+// SetFiringDelivery records the result of webhook delivery of firing in database
+func SetFiringDelivery(db *DB, id int64, status alerts.DeliveryStatus, deliveryError string) error {
+	_, err := db.Exec("UPDATE alert_firings SET delivery = ?, delivery_error = ? WHERE id = ?", status, deliveryError, id)
+	return err
+}
+
+// quoteIdentifier checks the name of database or table and quotes it to put into SQL query text
+func quoteIdentifier(name string) (string, error) {
+	if !identifierRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid database identifier: %q", name)
+	}
+
+	return "`" + name + "`", nil
+}
+
+// portfolioTables are tables of portfolios (name and statement to create it), they are created in new and existing databases
+var portfolioTables = [][2]string{
+	{"portfolios", `CREATE TABLE portfolios(
+			id BIGINT NOT NULL AUTO_INCREMENT,
+			name VARCHAR(150) NOT NULL,
+			PRIMARY KEY (id)
+		);`},
+	{"portfolio_positions", `CREATE TABLE portfolio_positions(
+			portfolio BIGINT NOT NULL,
+			security VARCHAR(20) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			quantity DECIMAL(20,6) NOT NULL,
+			avg_price DECIMAL(14,6) NOT NULL,
+			PRIMARY KEY (portfolio, security),
+			CONSTRAINT FK_PortfolioPositions FOREIGN KEY (portfolio) REFERENCES portfolios(id)
+		);`},
+}
+
+// dividendsTable is the table of dividends (name and statement to create it), it's created in new and existing databases
+var dividendsTable = [2]string{"dividends", `CREATE TABLE dividends(
+			security VARCHAR(20) NOT NULL,
+			registry_date DATE NOT NULL,
+			value DECIMAL(14,6) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			PRIMARY KEY (security, registry_date),
+			CONSTRAINT FK_Dividends FOREIGN KEY (security) REFERENCES securities(id)
+		);`}
+
+// bondTables are tables of bonds face values and payments (name and statement to create it), they are created in new and existing databases
+var bondTables = [][2]string{
+	{"bonds", `CREATE TABLE bonds(
+			security VARCHAR(20) NOT NULL PRIMARY KEY,
+			face_value DECIMAL(14,6) NOT NULL,
+			CONSTRAINT FK_Bonds FOREIGN KEY (security) REFERENCES securities(id)
+		);`},
+	{"bond_payments", `CREATE TABLE bond_payments(
+			security VARCHAR(20) NOT NULL,
+			payment_date DATE NOT NULL,
+			start_date DATE NULL,
+			coupon DECIMAL(14,6) NOT NULL,
+			amortization DECIMAL(14,6) NOT NULL,
+			PRIMARY KEY (security, payment_date),
+			CONSTRAINT FK_BondPayments FOREIGN KEY (security) REFERENCES securities(id)
+		);`},
+}
+
+// alertTables are tables of price alerts and their firings (name and statement to create it), they are created in new and existing databases
+var alertTables = [][2]string{
+	{"alerts", `CREATE TABLE alerts(
+			id BIGINT NOT NULL AUTO_INCREMENT,
+			security VARCHAR(20) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			direction VARCHAR(10) NOT NULL,
+			threshold DECIMAL(14,6) NOT NULL,
+			enabled BOOLEAN NOT NULL,
+			url VARCHAR(500) NOT NULL DEFAULT '',
+			PRIMARY KEY (id),
+			CONSTRAINT FK_Alerts FOREIGN KEY (security) REFERENCES securities(id)
+		);`},
+	{"alert_firings", `CREATE TABLE alert_firings(
+			id BIGINT NOT NULL AUTO_INCREMENT,
+			alert BIGINT NOT NULL,
+			close DECIMAL(14,6) NOT NULL,
+			quotes_end DATETIME NOT NULL,
+			fired_at DATETIME NOT NULL,
+			delivery VARCHAR(10) NOT NULL DEFAULT '',
+			delivery_error VARCHAR(500) NOT NULL DEFAULT '',
+			PRIMARY KEY (id),
+			CONSTRAINT FK_AlertFirings FOREIGN KEY (alert) REFERENCES alerts(id)
+		);`},
+}
+
+// alertColumns are columns of alerts tables which were added after the tables had appeared (table, column and its definition)
+var alertColumns = [][3]string{
+	{"alerts", "url", "VARCHAR(500) NOT NULL DEFAULT ''"},
+	{"alert_firings", "delivery", "VARCHAR(10) NOT NULL DEFAULT ''"},
+	{"alert_firings", "delivery_error", "VARCHAR(500) NOT NULL DEFAULT ''"},
+}
+
+// quotesIndexes are secondary indexes of security quotes table (name and columns)
+// They speed up searching of last quotes, the primary key is not enough for it
+var quotesIndexes = [][2]string{
+	{"idx_security_quotes_end", "end"},
+	{"idx_security_quotes_security_interv_end", "security, interv, end"},
+}
+
+// PoolSettings are settings of database connection pool (zero values mean no limit as for database/sql)
+type PoolSettings struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Pool is the connection pool settings of databases created by CreateDatabase
+// Every query of concurrent updates takes a connection, so the number of connections should be limited for MySQL not to refuse them
+var Pool = PoolSettings{MaxOpenConns: 50, MaxIdleConns: 10, ConnMaxLifetime: 5 * time.Minute}
+
+// Apply sets connection pool settings to database
+func (p PoolSettings) Apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	db.SetMaxIdleConns(p.MaxIdleConns)
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+}
+
+// CreateDatabase creates new database to work with securities
+// Database name may contain only latin letters, digits and underscores
+func CreateDatabase(sqlParam string, dbName string) (*DB, error) {
+	quotedName, err := quoteIdentifier(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := sql.Open("mysql", sqlParam+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	// We should already know that database doesn't exist
+	_, err = server.Exec("CREATE DATABASE " + quotedName)
+	server.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// It's better to close and reopen database
+	sqlDB, err := sql.Open("mysql", sqlParam+"/"+dbName)
+	if err != nil {
+		return nil, err
+	}
+	Pool.Apply(sqlDB)
+	db := NewDB(sqlDB, MySQL)
+
+	// Creating Securities table - where we keep general information about securities
+	_, err = db.Exec(`
+		CREATE TABLE securities(
+			id VARCHAR(20) NOT NULL,
 			name VARCHAR(150),
 			type VARCHAR(20) NOT NULL,
 			currency CHAR(3) NOT NULL,
+			deleted_at DATETIME NULL,
+			last_updated DATETIME NULL,
 			PRIMARY KEY (id)
 		);`)
 	if err != nil {
@@ -577,6 +2312,7 @@ func CreateDatabase(sqlParam string, dbName string) (*sql.DB, error) {
 			close DECIMAL(14,6),
 			low DECIMAL(14,6),
 			high DECIMAL(14,6),
+			volume DECIMAL(20,2),
 			PRIMARY KEY (security, begin, interv),
 			CONSTRAINT FK_SecurityQuotes FOREIGN KEY (security) REFERENCES securities(id)
 		);`)
@@ -584,11 +2320,54 @@ func CreateDatabase(sqlParam string, dbName string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	for _, index := range quotesIndexes {
+		_, err = db.Exec(fmt.Sprintf("CREATE INDEX %s ON security_quotes (%s)", index[0], index[1]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Creating Dividends table - where we keep dividends of securities
+	_, err = db.Exec(dividendsTable[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// Creating Bonds tables - where we keep face values and payments of bonds
+	for _, table := range bondTables {
+		_, err = db.Exec(table[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Creating Portfolios tables - where we keep portfolios and their positions
+	for _, table := range portfolioTables {
+		_, err = db.Exec(table[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Creating Alerts tables - where we keep price alerts and their firings
+	for _, table := range alertTables {
+		_, err = db.Exec(table[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Creating Schema migrations table - new database has the latest structure, so all migrations are recorded as applied
+	err = MarkMigrationsApplied(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
 	return db, nil
 }
 
 // PutTestDataInDatabase adds some securities and quotes to database just for testing or demonstration
-func PutTestDataInDatabase(db *sql.DB) error {
+func PutTestDataInDatabase(db *DB) error {
 	var secSlice []*securities.Security
 
 	secSlice = append(secSlice, securities.GetSecurity("GAZP", "Gazprom shares", securities.Share, securities.RUB))
@@ -609,7 +2388,7 @@ func PutTestDataInDatabase(db *sql.DB) error {
 	dateFrom := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
 	interval := securities.QuotesInterval(securities.IntervalDay)
 	for _, sec := range secSlice {
-		err := UpdateSecurityQuotes(db, sec, dateFrom, dateTill, interval)
+		err := UpdateSecurityQuotes(context.Background(), db, sec, dateFrom, dateTill, interval)
 		if err != nil {
 			return err
 		}
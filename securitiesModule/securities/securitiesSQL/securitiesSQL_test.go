@@ -1,11 +1,20 @@
 package securitiesSQL
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"io"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"securitiesModule/config"
 	"securitiesModule/securities"
+	"securitiesModule/securities/moex"
+	"securitiesModule/securities/storetest"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,37 +22,26 @@ import (
 )
 
 // getDB returns SQL database
-func getDB(t *testing.T) *sql.DB {
-	settingsFileName := "src\\testConf.json"
-
-	file, err := os.Open(settingsFileName)
-	if err != nil {
-		t.Fatal("settings file not found")
+// Settings are read from src/testConf.json (or from the file in SECURITIES_TEST_CONFIG environment variable) and environment variables
+func getDB(t *testing.T) *DB {
+	settingsFileName := filepath.Join("src", "testConf.json")
+	if fileName := os.Getenv("SECURITIES_TEST_CONFIG"); fileName != "" {
+		settingsFileName = fileName
 	}
-	defer file.Close()
 
-	data, err := io.ReadAll(file)
+	conf, err := config.LoadTest(settingsFileName)
 	if err != nil {
-		t.Fatal(err.Error())
-	}
-
-	type settings struct {
-		MySQL  string
-		TestDB string
-	}
-	conf := settings{}
-	err = json.Unmarshal(data, &conf)
-	if err != nil {
-		t.Fatal(err.Error())
+		t.Fatal(err)
 	}
 
 	sqlParam := conf.MySQL
 	dbName := conf.TestDB
 
-	db, err := sql.Open("mysql", sqlParam+"/"+dbName)
+	sqlDB, err := sql.Open("mysql", sqlParam+"/"+dbName)
 	if err != nil {
 		t.Fatal(err)
 	}
+	db := NewDB(sqlDB, MySQL)
 
 	err = db.Ping()
 	if err != nil {
@@ -58,6 +56,11 @@ func getDB(t *testing.T) *sql.DB {
 		}
 	}
 
+	err = UpgradeDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	return db
 }
 
@@ -85,6 +88,23 @@ func TestSecurityExists(t *testing.T) {
 	if res {
 		t.Error("security AAAA found in database but it can't be true")
 	}
+
+	// connections are given back to the pool, so many checks don't hang with a small pool
+	db.SetMaxOpenConns(2)
+	for i := 0; i < 10; i++ {
+		res, err = SecurityExists(db, "GAZP", securities.Share)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res {
+			t.Fatal("security GAZP not found in database")
+		}
+	}
+
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Errorf("connections are kept after checks - %d in use", inUse)
+	}
 }
 
 func TestSecurityQuotesExist(t *testing.T) {
@@ -143,7 +163,7 @@ func TestGetAllSecuritiesData(t *testing.T) {
 
 	sec := securities.GetQuickSecurity("GAZP", securities.Share)
 
-	s, err := GetAllSecuritiesData(db, "share", "RUB")
+	s, _, err := GetAllSecuritiesData(db, "share", "RUB", securities.SortByID, false, 0, 0, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -198,7 +218,7 @@ func TestAddUpdateDeleteSecurity(t *testing.T) {
 		return
 	}
 
-	err = UpdateSecurityQuotes(db, sec, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+	err = UpdateSecurityQuotes(context.Background(), db, sec, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
 	if err != nil {
 		t.Errorf("failed to update BLNG quotes for February 2023")
 	} else {
@@ -236,7 +256,7 @@ func TestUpdateAllSecuritiesLastQuotes(t *testing.T) {
 	db := getDB(t)
 	defer db.Close()
 
-	err := UpdateAllSecuritiesLastQuotes(db, "share", "RUB")
+	err := UpdateAllSecuritiesLastQuotes(context.Background(), db, "share", "RUB")
 	if err != nil {
 		t.Errorf("failed to update all securities last quotes")
 	}
@@ -249,7 +269,386 @@ func TestUpdateAllSecuritiesLastQuotes(t *testing.T) {
 	}
 	q := sec.LastQuotes(securities.IntervalDay)
 
-	if time.Now().AddDate(0, 0, -1).Truncate(time.Hour * 24).After(q.Begin) {
-		t.Errorf("probably failed to update GAZP last quotes. Last quotes date - %s, want %s. Maybe it's not trade day?", q.End.Format("02.01.2006"), time.Now().AddDate(0, 0, -1).Format("02.01.2006"))
+	// today trading data may be not ready yet, so the previous trading day is fine too
+	prevDay := moex.PreviousTradingDay(time.Now().UTC())
+	if prevDay.After(q.Begin) {
+		t.Errorf("probably failed to update GAZP last quotes. Last quotes date - %s, want %s or later", q.Begin.Format("02.01.2006"), prevDay.Format("02.01.2006"))
+	}
+}
+
+func TestInsertQuotesChunks(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	sec := securities.GetQuickSecurity("TSTCHUNK", securities.Share)
+	err := AddSecurity(db, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer PurgeSecurities(db, []*securities.Security{sec})
+
+	// 2500 hour quotes - five chunks
+	var quotes []securities.SecurityQuotes
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2500; i++ {
+		begin := date.Add(time.Duration(i) * time.Hour)
+		quotes = append(quotes, securities.SecurityQuotes{Interval: securities.IntervalHour, Begin: begin, End: begin.Add(time.Hour - time.Second), Open: 1, Close: float64(i), High: 1, Low: 1})
+	}
+
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := make([]quotesRow, 0, len(quotes))
+	for _, q := range quotes {
+		rows = append(rows, quotesRow{security: sec.Id(), quotes: q})
+	}
+
+	err = insertQuotes(context.Background(), tx, db.Dialect, rows, false)
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM security_quotes WHERE security = ?", sec.Id()).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2500 {
+		t.Errorf("wrong number of inserted quotes - want 2500, got %d", n)
+	}
+}
+
+// useMoexTestServer makes moex package send requests to the test server with the given handler while the test is running
+func useMoexTestServer(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+
+	baseURL, requestDelay := moex.BaseURL, moex.RequestDelay
+	moex.BaseURL, moex.RequestDelay = server.URL, 0
+
+	t.Cleanup(func() {
+		moex.BaseURL, moex.RequestDelay = baseURL, requestDelay
+		server.Close()
+	})
+}
+
+// historyColumns are the columns of Moscow Exchange shares history
+var historyColumns = []string{"BOARDID", "TRADEDATE", "SHORTNAME", "SECID", "NUMTRADES", "VALUE", "OPEN", "LOW", "HIGH", "LEGALCLOSEPRICE", "WAPRICE", "CLOSE", "VOLUME"}
+
+// historyHandler returns the handler which answers with Moscow Exchange history records of the given number of test securities
+// All securities have the given close price
+func historyHandler(count int, price float64) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		start, _ := strconv.Atoi(request.URL.Query().Get("start"))
+		date := request.URL.Query().Get("date")
+
+		records := [][]any{}
+		for i := start; i < start+100 && i < count; i++ {
+			id := fmt.Sprintf("TSTLQ%04d", i)
+			records = append(records, []any{"TQBR", date, id, id, 100.0, 1000.0, price, price, price, price, price, price, 10.0})
+		}
+
+		res, _ := json.Marshal(map[string]any{"history": map[string]any{"columns": historyColumns, "data": records}})
+		writer.Write(res)
+	}
+}
+
+// addLastQuotesTestSecurities adds the given number of test securities (shares in CNY)
+func addLastQuotesTestSecurities(t *testing.T, db *DB, count int) {
+	var secList []*securities.Security
+	for i := 0; i < count; i++ {
+		secList = append(secList, securities.GetSecurity(fmt.Sprintf("TSTLQ%04d", i), "", securities.Share, securities.CNY))
+	}
+
+	err := AddSecurities(db, secList)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deleteLastQuotesTestSecurities removes test securities added by addLastQuotesTestSecurities
+func deleteLastQuotesTestSecurities(t *testing.T, db *DB) {
+	_, err := db.Exec("DELETE FROM security_quotes WHERE security LIKE 'TSTLQ%'")
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = db.Exec("DELETE FROM securities WHERE id LIKE 'TSTLQ%'")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateAllSecuritiesLastQuotesMany(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	addLastQuotesTestSecurities(t, db, 1500)
+	defer deleteLastQuotesTestSecurities(t, db)
+	useMoexTestServer(t, historyHandler(1500, 10))
+
+	err := UpdateAllSecuritiesLastQuotes(context.Background(), db, "share", "CNY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err = db.QueryRow("SELECT COUNT(DISTINCT security) FROM security_quotes WHERE security LIKE 'TSTLQ%'").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1500 {
+		t.Errorf("wrong number of securities with last quotes - want 1500, got %d", n)
+	}
+}
+
+func TestUpdateSecurityQuotesRollback(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	sec := securities.GetQuickSecurity("TSTROLLB", securities.Share)
+	err := AddSecurity(db, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer PurgeSecurities(db, []*securities.Security{sec})
+
+	// the second answer has the price which doesn't fit in database column, so the insert fails after the delete
+	price := 100.0
+	useMoexTestServer(t, func(writer http.ResponseWriter, request *http.Request) {
+		candles := [][]any{{price, price, price, price, 1000.0, 10.0, "2023-02-01 00:00:00", "2023-02-01 23:59:59"}}
+		res, _ := json.Marshal(map[string]any{"candles": map[string]any{"data": candles}})
+		writer.Write(res)
+	})
+
+	dateFrom := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	dateTill := time.Date(2023, 2, 1, 23, 59, 59, 0, time.UTC)
+
+	err = UpdateSecurityQuotes(context.Background(), db, sec, dateFrom, dateTill, securities.IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	price = 1e12
+	err = UpdateSecurityQuotes(context.Background(), db, securities.GetQuickSecurity("TSTROLLB", securities.Share), dateFrom, dateTill, securities.IntervalDay)
+	if err == nil {
+		t.Fatal("no error for the price which doesn't fit in database")
+	}
+
+	sec = securities.GetQuickSecurity("TSTROLLB", securities.Share)
+	err = GetSecurityData(db, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := sec.LastQuotes(securities.IntervalDay); q.Close != 100 {
+		t.Errorf("old quotes are lost after failed update - want close 100, got %f", q.Close)
+	}
+}
+
+func TestUpdateAllSecuritiesLastQuotesUpsert(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	addLastQuotesTestSecurities(t, db, 3)
+	defer deleteLastQuotesTestSecurities(t, db)
+
+	// provisional quotes got in the middle of the day
+	useMoexTestServer(t, historyHandler(3, 10))
+
+	err := UpdateAllSecuritiesLastQuotes(context.Background(), db, "share", "CNY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// final quotes of the same day
+	useMoexTestServer(t, historyHandler(3, 12))
+
+	err = UpdateAllSecuritiesLastQuotes(context.Background(), db, "share", "CNY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM security_quotes WHERE security LIKE 'TSTLQ%'").Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 3 {
+		t.Errorf("wrong number of last quotes rows - want 3, got %d", n)
+	}
+
+	sec := securities.GetQuickSecurity("TSTLQ0001", securities.Share)
+	err = GetSecurityData(db, sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q := sec.LastQuotes(securities.IntervalDay); q.Close != 12 {
+		t.Errorf("provisional last quotes are not overwritten - want close 12, got %f", q.Close)
+	}
+}
+
+func TestStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.Run(t, NewStore(db))
+}
+
+func TestPortfolioStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.RunPortfolios(t, NewStore(db))
+}
+
+func TestAlertStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.RunAlerts(t, NewStore(db))
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	for _, name := range []string{"securities_demo", "Securities2"} {
+		quoted, err := quoteIdentifier(name)
+		if err != nil {
+			t.Errorf("error for valid name %s: %v", name, err)
+		} else if quoted != "`"+name+"`" {
+			t.Errorf("wrong quoted name - want `%s`, got %s", name, quoted)
+		}
+	}
+
+	for _, name := range []string{"", "securities; DROP DATABASE mysql", "sec`urities", "sec-demo", "база"} {
+		_, err := quoteIdentifier(name)
+		if err == nil {
+			t.Errorf("no error for invalid name %q", name)
+		}
+	}
+
+	_, err := CreateDatabase("root:@tcp(127.0.0.1:1)", "securities; DROP DATABASE mysql")
+	if err == nil {
+		t.Error("no error for invalid database name in CreateDatabase")
+	}
+}
+
+func TestSharedUpdateCancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	updErr := make(chan error, 2)
+
+	// the second caller may come after the update is finished and start it again
+	var once sync.Once
+	update := func(ctx context.Context) (any, error) {
+		once.Do(func() { close(started) })
+		<-release
+		updErr <- ctx.Err()
+		return "updated", nil
+	}
+
+	// the first caller starts the update and goes away, the second one joins it
+	firstCtx, cancel := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := sharedUpdate(firstCtx, "TestSharedUpdateCancel", update)
+		firstDone <- err
+	}()
+	<-started
+
+	secondDone := make(chan any, 1)
+	go func() {
+		res, err := sharedUpdate(context.Background(), "TestSharedUpdateCancel", update)
+		if err != nil {
+			t.Errorf("error for the caller which has joined the update: %v", err)
+		}
+		secondDone <- res
+	}()
+
+	cancel()
+	if err := <-firstDone; err != context.Canceled {
+		t.Errorf("wrong error for cancelled caller - want %v, got %v", context.Canceled, err)
+	}
+
+	close(release)
+	if err := <-updErr; err != nil {
+		t.Errorf("shared update is cancelled with the first caller: %v", err)
+	}
+
+	if res := <-secondDone; res != "updated" {
+		t.Errorf("wrong result of shared update - want updated, got %v", res)
+	}
+}
+
+func TestUpgradeDatabase(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	countMigrations := func() int {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n := countMigrations(); n != len(migrations) {
+		t.Fatalf("wrong number of applied migrations - want %d, got %d", len(migrations), n)
+	}
+
+	indexExists := func(name string) bool {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'security_quotes' AND INDEX_NAME = ?", name).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n > 0
+	}
+
+	_, err := db.Exec("DROP INDEX idx_security_quotes_end ON security_quotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// applied migration isn't applied again
+	err = UpgradeDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if indexExists("idx_security_quotes_end") {
+		t.Error("applied migration of indexes is applied again")
+	}
+
+	// the database looks like it was created before secondary indexes appeared
+	_, err = db.Exec("DELETE FROM schema_migrations WHERE version = 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = UpgradeDatabase(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, index := range quotesIndexes {
+		if !indexExists(index[0]) {
+			t.Errorf("index %s is not added to database", index[0])
+		}
+	}
+
+	if n := countMigrations(); n != len(migrations) {
+		t.Errorf("wrong number of applied migrations after upgrade - want %d, got %d", len(migrations), n)
 	}
 }
@@ -0,0 +1,312 @@
+package securitiesSQL
+
+import (
+	"context"
+	"securitiesModule/metrics"
+	"securitiesModule/securities"
+	"securitiesModule/securities/alerts"
+	"securitiesModule/securities/portfolio"
+	"time"
+)
+
+// Store is SQL implementation of securities.Store, it works with MySQL or SQLite database depending on its dialect
+type Store struct {
+	db *DB
+}
+
+// check that Store implements securities.Store
+var _ securities.Store = (*Store)(nil)
+
+// check that Store implements portfolio.Store
+var _ portfolio.Store = (*Store)(nil)
+
+// check that Store implements alerts.Store
+var _ alerts.Store = (*Store)(nil)
+
+// NewStore creates a new store which works with the given database
+func NewStore(db *DB) *Store {
+	return &Store{db: db}
+}
+
+// DB returns the database of store
+func (s *Store) DB() *DB {
+	return s.db
+}
+
+// SecurityExists checks if security with given id and type exists in database
+func (s *Store) SecurityExists(id string, sType securities.SecurityType) (bool, error) {
+	defer metrics.ObserveStorage("SecurityExists", time.Now())
+
+	return SecurityExists(s.db, id, sType)
+}
+
+// SecurityQuotesExist checks if security quotes for the given date and interval exist in database
+func (s *Store) SecurityQuotesExist(sec *securities.Security, date time.Time, interval securities.QuotesInterval) (bool, error) {
+	defer metrics.ObserveStorage("SecurityQuotesExist", time.Now())
+
+	return SecurityQuotesExist(s.db, sec, date, interval)
+}
+
+// GetSecurityData fills in security data from database
+func (s *Store) GetSecurityData(sec *securities.Security) error {
+	defer metrics.ObserveStorage("GetSecurityData", time.Now())
+
+	return GetSecurityData(s.db, sec)
+}
+
+// GetSecuritiesData fills in data for a list of securities from database
+func (s *Store) GetSecuritiesData(sec []*securities.Security) error {
+	defer metrics.ObserveStorage("GetSecuritiesData", time.Now())
+
+	return GetSecuritiesData(s.db, sec)
+}
+
+// GetAllSecuritiesData returns the page of securities from database (considering type and currency filters) with only last quotes for each security and the total number of securities
+func (s *Store) GetAllSecuritiesData(typeNameFilter string, currencyNameFilter string, sortField securities.SortField, desc bool, limit int, offset int, includeDeleted bool) ([]*securities.Security, int, error) {
+	defer metrics.ObserveStorage("GetAllSecuritiesData", time.Now())
+
+	return GetAllSecuritiesData(s.db, typeNameFilter, currencyNameFilter, sortField, desc, limit, offset, includeDeleted)
+}
+
+// GetAllSecuritiesLastQuotes returns securities from database (not deleted, considering type and currency filters) with only the last count quotes of the interval for each security
+func (s *Store) GetAllSecuritiesLastQuotes(typeNameFilter string, currencyNameFilter string, interval securities.QuotesInterval, count int) ([]*securities.Security, error) {
+	defer metrics.ObserveStorage("GetAllSecuritiesLastQuotes", time.Now())
+
+	return GetAllSecuritiesLastQuotes(s.db, typeNameFilter, currencyNameFilter, interval, count)
+}
+
+// GetSecuritiesByQuery returns securities which id or name contains the given text (case-insensitive)
+func (s *Store) GetSecuritiesByQuery(q string) ([]*securities.Security, error) {
+	defer metrics.ObserveStorage("GetSecuritiesByQuery", time.Now())
+
+	return GetSecuritiesByQuery(s.db, q)
+}
+
+// AddSecurity adds new security to database
+func (s *Store) AddSecurity(sec *securities.Security) error {
+	defer metrics.ObserveStorage("AddSecurity", time.Now())
+
+	return AddSecurity(s.db, sec)
+}
+
+// AddSecurities adds a list of securities to database
+func (s *Store) AddSecurities(sec []*securities.Security) error {
+	defer metrics.ObserveStorage("AddSecurities", time.Now())
+
+	return AddSecurities(s.db, sec)
+}
+
+// UpdateSecurity changes name and currency of security in database
+func (s *Store) UpdateSecurity(sec *securities.Security) error {
+	defer metrics.ObserveStorage("UpdateSecurity", time.Now())
+
+	return UpdateSecurity(s.db, sec)
+}
+
+// DeleteSecurity marks security as deleted in database keeping its quotes
+func (s *Store) DeleteSecurity(sec *securities.Security) error {
+	defer metrics.ObserveStorage("DeleteSecurity", time.Now())
+
+	return DeleteSecurity(s.db, sec)
+}
+
+// DeleteSecurities marks a list of securities as deleted in database at once
+func (s *Store) DeleteSecurities(sec []*securities.Security) error {
+	defer metrics.ObserveStorage("DeleteSecurities", time.Now())
+
+	return DeleteSecurities(s.db, sec)
+}
+
+// RestoreSecurity removes deleted mark from security in database
+func (s *Store) RestoreSecurity(sec *securities.Security) error {
+	defer metrics.ObserveStorage("RestoreSecurity", time.Now())
+
+	return RestoreSecurity(s.db, sec)
+}
+
+// PurgeSecurities removes a list of securities and their quotes from database irreversibly
+func (s *Store) PurgeSecurities(sec []*securities.Security) error {
+	defer metrics.ObserveStorage("PurgeSecurities", time.Now())
+
+	return PurgeSecurities(s.db, sec)
+}
+
+// UpdateSecurityQuotes gets security quotes from Moscow Exchange and writes them down to database
+func (s *Store) UpdateSecurityQuotes(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	defer metrics.ObserveStorage("UpdateSecurityQuotes", time.Now())
+
+	return UpdateSecurityQuotes(ctx, s.db, sec, dateFrom, dateTill, interval)
+}
+
+// UpdateSecurityQuotesIncremental gets security quotes from Moscow Exchange only from the last stored quotes and merges them with stored quotes
+func (s *Store) UpdateSecurityQuotesIncremental(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) error {
+	defer metrics.ObserveStorage("UpdateSecurityQuotesIncremental", time.Now())
+
+	return UpdateSecurityQuotesIncremental(ctx, s.db, sec, dateFrom, dateTill, interval)
+}
+
+// BackfillSecurityQuotes gets from Moscow Exchange only quotes of the trading days which are missing in the stored period and adds them
+func (s *Store) BackfillSecurityQuotes(ctx context.Context, sec *securities.Security, dateFrom time.Time, dateTill time.Time, interval securities.QuotesInterval) (int, error) {
+	defer metrics.ObserveStorage("BackfillSecurityQuotes", time.Now())
+
+	return BackfillSecurityQuotes(ctx, s.db, sec, dateFrom, dateTill, interval)
+}
+
+// UpdateSecurityDividends gets dividends of security from Moscow Exchange and replaces stored dividends with them
+func (s *Store) UpdateSecurityDividends(ctx context.Context, sec *securities.Security) error {
+	defer metrics.ObserveStorage("UpdateSecurityDividends", time.Now())
+
+	return UpdateSecurityDividends(ctx, s.db, sec)
+}
+
+// GetSecurityDividends returns stored dividends of security sorted by date
+func (s *Store) GetSecurityDividends(sec *securities.Security) ([]securities.Dividend, error) {
+	defer metrics.ObserveStorage("GetSecurityDividends", time.Now())
+
+	return GetSecurityDividends(s.db, sec)
+}
+
+// UpdateBondInfo gets face value and payments of bond from Moscow Exchange and replaces stored bond info with them
+func (s *Store) UpdateBondInfo(ctx context.Context, sec *securities.Security) error {
+	defer metrics.ObserveStorage("UpdateBondInfo", time.Now())
+
+	return UpdateBondInfo(ctx, s.db, sec)
+}
+
+// GetBondInfo returns stored face value and payments of bond
+func (s *Store) GetBondInfo(sec *securities.Security) (*securities.BondInfo, error) {
+	defer metrics.ObserveStorage("GetBondInfo", time.Now())
+
+	return GetBondInfo(s.db, sec)
+}
+
+// GetCurrencyRate returns the rate of currency in rubles for the date, missing rates are got from Moscow Exchange and stored
+func (s *Store) GetCurrencyRate(ctx context.Context, currency securities.SecurityCurrency, date time.Time) (float64, error) {
+	defer metrics.ObserveStorage("GetCurrencyRate", time.Now())
+
+	return GetCurrencyRate(ctx, s.db, currency, date)
+}
+
+// ConvertPrice converts amount from one currency to another by rates of the date, cross rates are got through rubles
+func (s *Store) ConvertPrice(ctx context.Context, amount float64, from securities.SecurityCurrency, to securities.SecurityCurrency, date time.Time) (float64, error) {
+	defer metrics.ObserveStorage("ConvertPrice", time.Now())
+
+	return ConvertPrice(ctx, s.db, amount, from, to, date)
+}
+
+// RefetchSecurityQuotesForDate gets security quotes for the given date from Moscow Exchange again and replaces stored quotes of this date
+func (s *Store) RefetchSecurityQuotesForDate(ctx context.Context, sec *securities.Security, date time.Time) error {
+	defer metrics.ObserveStorage("RefetchSecurityQuotesForDate", time.Now())
+
+	return RefetchSecurityQuotesForDate(ctx, s.db, sec, date)
+}
+
+// UpdateAllSecuritiesLastQuotes gets last day quotes from Moscow Exchange for all securities in database and writes them down to database
+func (s *Store) UpdateAllSecuritiesLastQuotes(ctx context.Context, typeNameFilter string, currencyNameFilter string) error {
+	defer metrics.ObserveStorage("UpdateAllSecuritiesLastQuotes", time.Now())
+
+	return UpdateAllSecuritiesLastQuotes(ctx, s.db, typeNameFilter, currencyNameFilter)
+}
+
+// GetStats returns the number of stored securities (not deleted) and quotes
+func (s *Store) GetStats() (int, int, error) {
+	defer metrics.ObserveStorage("GetStats", time.Now())
+
+	return GetStats(s.db)
+}
+
+// Ping checks that database is reachable and answers queries
+func (s *Store) Ping(ctx context.Context) error {
+	defer metrics.ObserveStorage("Ping", time.Now())
+
+	return Ping(ctx, s.db)
+}
+
+// Close closes database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// AddPortfolio adds portfolio with its positions to database and sets its id
+func (s *Store) AddPortfolio(p *portfolio.Portfolio) error {
+	defer metrics.ObserveStorage("AddPortfolio", time.Now())
+
+	return AddPortfolio(s.db, p)
+}
+
+// GetPortfolio returns portfolio with the given id from database
+func (s *Store) GetPortfolio(id int64) (*portfolio.Portfolio, error) {
+	defer metrics.ObserveStorage("GetPortfolio", time.Now())
+
+	return GetPortfolio(s.db, id)
+}
+
+// GetAllPortfolios returns all portfolios from database sorted by id
+func (s *Store) GetAllPortfolios() ([]*portfolio.Portfolio, error) {
+	defer metrics.ObserveStorage("GetAllPortfolios", time.Now())
+
+	return GetAllPortfolios(s.db)
+}
+
+// DeletePortfolio removes portfolio with its positions from database
+func (s *Store) DeletePortfolio(id int64) error {
+	defer metrics.ObserveStorage("DeletePortfolio", time.Now())
+
+	return DeletePortfolio(s.db, id)
+}
+
+// AddAlert adds alert to database and sets its id
+func (s *Store) AddAlert(a *alerts.Alert) error {
+	defer metrics.ObserveStorage("AddAlert", time.Now())
+
+	return AddAlert(s.db, a)
+}
+
+// GetAlert returns alert with the given id from database
+func (s *Store) GetAlert(id int64) (*alerts.Alert, error) {
+	defer metrics.ObserveStorage("GetAlert", time.Now())
+
+	return GetAlert(s.db, id)
+}
+
+// GetAllAlerts returns all alerts from database sorted by id
+func (s *Store) GetAllAlerts() ([]*alerts.Alert, error) {
+	defer metrics.ObserveStorage("GetAllAlerts", time.Now())
+
+	return GetAllAlerts(s.db)
+}
+
+// UpdateAlert changes direction, threshold, enabled flag and webhook of existing alert in database
+func (s *Store) UpdateAlert(a *alerts.Alert) error {
+	defer metrics.ObserveStorage("UpdateAlert", time.Now())
+
+	return UpdateAlert(s.db, a)
+}
+
+// DeleteAlert removes alert with its firings from database
+func (s *Store) DeleteAlert(id int64) error {
+	defer metrics.ObserveStorage("DeleteAlert", time.Now())
+
+	return DeleteAlert(s.db, id)
+}
+
+// FireAlerts records firings of alerts, sets their ids and disables fired alerts in database
+func (s *Store) FireAlerts(firings []alerts.Firing) error {
+	defer metrics.ObserveStorage("FireAlerts", time.Now())
+
+	return FireAlerts(s.db, firings)
+}
+
+// GetAlertFirings returns firings of alert from database sorted by time
+func (s *Store) GetAlertFirings(id int64) ([]alerts.Firing, error) {
+	defer metrics.ObserveStorage("GetAlertFirings", time.Now())
+
+	return GetAlertFirings(s.db, id)
+}
+
+// SetFiringDelivery records the result of webhook delivery of firing in database
+func (s *Store) SetFiringDelivery(id int64, status alerts.DeliveryStatus, deliveryError string) error {
+	defer metrics.ObserveStorage("SetFiringDelivery", time.Now())
+
+	return SetFiringDelivery(s.db, id, status, deliveryError)
+}
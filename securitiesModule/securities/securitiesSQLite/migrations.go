@@ -0,0 +1,42 @@
+package securitiesSQLite
+
+import (
+	"database/sql"
+	"fmt"
+	"securitiesModule/securities/securitiesSQL"
+)
+
+// migrations are the changes of existing tables made after they had appeared, they are applied in order of versions
+// New changes are added to the end of the list with the next version, migrations which are already released must not be changed
+// OpenDatabase creates missing tables with the latest structure, so a new change must be added there too
+var migrations = []securitiesSQL.Migration{
+	{Version: 1, Description: "deletion mark of securities", Apply: addColumns([][3]string{{"securities", "deleted_at", "TEXT"}})},
+	{Version: 2, Description: "time of the last quotes update of securities", Apply: addColumns([][3]string{{"securities", "last_updated", "TEXT"}})},
+	{Version: 3, Description: "webhooks of alerts and their delivery", Apply: addColumns([][3]string{
+		{"alerts", "url", "TEXT NOT NULL DEFAULT ''"},
+		{"alert_firings", "delivery", "TEXT NOT NULL DEFAULT ''"},
+		{"alert_firings", "delivery_error", "TEXT NOT NULL DEFAULT ''"},
+	})},
+}
+
+// addColumns returns the migration which adds the columns (table, column and its definition) if they don't exist
+func addColumns(columns [][3]string) func(db *sql.DB) error {
+	return func(db *sql.DB) error {
+		for _, column := range columns {
+			var columnExists int
+			err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = ?", column[0]), column[1]).Scan(&columnExists)
+			if err != nil {
+				return err
+			}
+
+			if columnExists == 0 {
+				_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column[0], column[1], column[2]))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,193 @@
+// Package securitiesSQLite contains SQLite dialect of securitiesSQL package, so the service may be run locally without MySQL server
+// Here the database is created and migrated, all the work with securities data is made by securitiesSQL package
+package securitiesSQLite
+
+import (
+	"database/sql"
+	"securitiesModule/securities/securitiesSQL"
+)
+
+// Dialect is the dialect of SQLite databases
+// SQLite counts every row of ON CONFLICT DO UPDATE as affected, so only deleted security is updated
+var Dialect = &securitiesSQL.Dialect{
+	InsertIgnore: "INSERT OR IGNORE",
+	UpsertSecurities: " ON CONFLICT (id) DO UPDATE SET name = excluded.name, type = excluded.type, currency = excluded.currency, deleted_at = NULL " +
+		"WHERE securities.deleted_at IS NOT NULL",
+	UpsertQuotes: " ON CONFLICT (security, begin, interv) DO UPDATE SET end = excluded.end, open = excluded.open, close = excluded.close, high = excluded.high, low = excluded.low, volume = excluded.volume",
+}
+
+// OpenDatabase opens SQLite database in the given file and creates tables if they don't exist
+// In read-only mode the file is opened only for reading, so tables aren't created and migrations aren't applied
+func OpenDatabase(fileName string, readOnly bool) (*securitiesSQL.DB, error) {
+	dataSource := fileName
+	if readOnly {
+		dataSource = "file:" + fileName + "?mode=ro"
+	}
+
+	db, err := sql.Open("sqlite", dataSource)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer at once, so all requests go through one connection
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if readOnly {
+		return securitiesSQL.NewDB(db, Dialect), nil
+	}
+
+	// New database gets the latest structure at once, so migrations aren't applied to it
+	var securitiesExist int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'securities'").Scan(&securitiesExist)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Securities table - where we keep general information about securities
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS securities(
+			id TEXT NOT NULL,
+			name TEXT,
+			type TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			deleted_at TEXT,
+			last_updated TEXT,
+			PRIMARY KEY (id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Security quotes table - where we keep information about security quotes
+	// Dates are kept as text in the same format as in MySQL database
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS security_quotes(
+			security TEXT NOT NULL,
+			begin TEXT NOT NULL,
+			end TEXT NOT NULL,
+			interv INTEGER NOT NULL CHECK (interv >= 0 AND interv <= 255),
+			open REAL,
+			close REAL,
+			low REAL,
+			high REAL,
+			volume REAL,
+			PRIMARY KEY (security, begin, interv),
+			CONSTRAINT FK_SecurityQuotes FOREIGN KEY (security) REFERENCES securities(id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Dividends table - where we keep dividends of securities
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS dividends(
+			security TEXT NOT NULL,
+			registry_date TEXT NOT NULL,
+			value REAL NOT NULL,
+			currency TEXT NOT NULL,
+			PRIMARY KEY (security, registry_date),
+			CONSTRAINT FK_Dividends FOREIGN KEY (security) REFERENCES securities(id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Bonds tables - where we keep face values and payments of bonds
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bonds(
+			security TEXT PRIMARY KEY,
+			face_value REAL NOT NULL,
+			CONSTRAINT FK_Bonds FOREIGN KEY (security) REFERENCES securities(id)
+		);
+		CREATE TABLE IF NOT EXISTS bond_payments(
+			security TEXT NOT NULL,
+			payment_date TEXT NOT NULL,
+			start_date TEXT,
+			coupon REAL NOT NULL,
+			amortization REAL NOT NULL,
+			PRIMARY KEY (security, payment_date),
+			CONSTRAINT FK_BondPayments FOREIGN KEY (security) REFERENCES securities(id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Portfolios tables - where we keep portfolios and their positions
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS portfolios(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS portfolio_positions(
+			portfolio INTEGER NOT NULL,
+			security TEXT NOT NULL,
+			type TEXT NOT NULL,
+			quantity REAL NOT NULL,
+			avg_price REAL NOT NULL,
+			PRIMARY KEY (portfolio, security),
+			CONSTRAINT FK_PortfolioPositions FOREIGN KEY (portfolio) REFERENCES portfolios(id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Creating Alerts tables - where we keep price alerts and their firings
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS alerts(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			security TEXT NOT NULL,
+			type TEXT NOT NULL,
+			direction TEXT NOT NULL,
+			threshold REAL NOT NULL,
+			enabled INTEGER NOT NULL,
+			url TEXT NOT NULL DEFAULT '',
+			CONSTRAINT FK_Alerts FOREIGN KEY (security) REFERENCES securities(id)
+		);
+		CREATE TABLE IF NOT EXISTS alert_firings(
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert INTEGER NOT NULL,
+			close REAL NOT NULL,
+			quotes_end TEXT NOT NULL,
+			fired_at TEXT NOT NULL,
+			delivery TEXT NOT NULL DEFAULT '',
+			delivery_error TEXT NOT NULL DEFAULT '',
+			CONSTRAINT FK_AlertFirings FOREIGN KEY (alert) REFERENCES alerts(id)
+		);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Secondary indexes speed up searching of last quotes, they are added to existing databases too
+	_, err = db.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_security_quotes_end ON security_quotes (end);
+		CREATE INDEX IF NOT EXISTS idx_security_quotes_security_interv_end ON security_quotes (security, interv, end);`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Changes of existing tables are applied by migrations
+	sqliteDB := securitiesSQL.NewDB(db, Dialect)
+	if securitiesExist == 0 {
+		err = securitiesSQL.MarkMigrationsApplied(sqliteDB, migrations)
+	} else {
+		err = securitiesSQL.ApplyMigrations(sqliteDB, migrations)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return sqliteDB, nil
+}
@@ -0,0 +1,146 @@
+package securitiesSQLite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"securitiesModule/securities/securitiesSQL"
+	"securitiesModule/securities/storetest"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// getDB returns SQLite database in temporary directory
+func getDB(t *testing.T) *securitiesSQL.DB {
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "securities.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.Run(t, securitiesSQL.NewStore(db))
+}
+
+func TestPortfolioStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.RunPortfolios(t, securitiesSQL.NewStore(db))
+}
+
+func TestAlertStore(t *testing.T) {
+	db := getDB(t)
+	defer db.Close()
+
+	storetest.RunAlerts(t, securitiesSQL.NewStore(db))
+}
+
+func TestUpgradeDatabase(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "securities.db")
+
+	// the database of the first version without deletion marks, update times and alerts
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE securities(id TEXT NOT NULL, name TEXT, type TEXT NOT NULL, currency TEXT NOT NULL, PRIMARY KEY (id));
+		INSERT INTO securities (id, name, type, currency) VALUES ('GAZP', 'Gazprom shares', 'share', 'RUB');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countMigrations := func(db *sql.DB) int {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// the database is opened twice, migrations are applied only the first time
+	for i := 0; i < 2; i++ {
+		db, err := OpenDatabase(fileName, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := countMigrations(db.DB); n != len(migrations) {
+			t.Errorf("wrong number of applied migrations - want %d, got %d", len(migrations), n)
+		}
+
+		var deleted, updated sql.NullString
+		err = db.QueryRow("SELECT deleted_at, last_updated FROM securities WHERE id = 'GAZP'").Scan(&deleted, &updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if deleted.Valid || updated.Valid {
+			t.Error("existing security has deletion mark or update time after upgrade")
+		}
+
+		db.Close()
+	}
+
+	// new database gets all migrations recorded without applying them
+	newDB := getDB(t)
+	defer newDB.Close()
+
+	if n := countMigrations(newDB.DB); n != len(migrations) {
+		t.Errorf("wrong number of migrations recorded in new database - want %d, got %d", len(migrations), n)
+	}
+}
+
+func TestOpenDatabaseReadOnly(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "securities.db")
+
+	// the database of the first version, it must not be upgraded in read-only mode
+	db, err := sql.Open("sqlite", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE securities(id TEXT NOT NULL, name TEXT, type TEXT NOT NULL, currency TEXT NOT NULL, PRIMARY KEY (id));
+		INSERT INTO securities (id, name, type, currency) VALUES ('GAZP', 'Gazprom shares', 'share', 'RUB');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roDB, err := OpenDatabase(fileName, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer roDB.Close()
+
+	var tables int
+	err = roDB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tables != 1 {
+		t.Errorf("tables are created in read-only mode - want 1 table, got %d", tables)
+	}
+
+	var name string
+	err = roDB.QueryRow("SELECT name FROM securities WHERE id = 'GAZP'").Scan(&name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = roDB.Exec("DELETE FROM securities")
+	if err == nil {
+		t.Error("no error for writing to database opened in read-only mode")
+	}
+}
@@ -0,0 +1,659 @@
+package securities
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAddQuotes(t *testing.T) {
+	sec := GetQuickSecurity("GAZP", Share)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+			sec.AddQuotes([]SecurityQuotes{
+				{Interval: IntervalDay, Begin: date, End: date.Add(time.Hour), Close: float64(i)},
+				{Interval: IntervalHour, Begin: date, End: date.Add(time.Hour), Close: float64(i)},
+			})
+		}(i)
+	}
+
+	wg.Wait()
+
+	if n := sec.AddQuotes(nil); n != 200 {
+		t.Errorf("wrong number of quotes after concurrent appends - want 200, got %d", n)
+	}
+
+	if n := len(*sec.QuotesOfInterval(IntervalDay)); n != 100 {
+		t.Errorf("wrong number of day quotes after concurrent appends - want 100, got %d", n)
+	}
+}
+
+func TestSetQuotesConcurrentReads(t *testing.T) {
+	// run with -race: quotes are appended, read and replaced from different goroutines at once
+	sec := GetQuickSecurity("GAZP", Share)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+
+		go func(i int) {
+			defer wg.Done()
+
+			date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+			sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: date, End: date.Add(time.Hour), Close: float64(i)})
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			sec.LastQuotes(IntervalDay)
+			sec.QuotesOfInterval(IntervalDay)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			q := sec.Quotes()
+			sec.ClearAndSetQuotesList(q)
+		}()
+	}
+
+	wg.Wait()
+
+	// quotes may be lost by replacing with an old copy, but there must be no more of them than were set
+	if n := len(*sec.Quotes()); n > 50 {
+		t.Errorf("wrong number of quotes after concurrent writes - want not more than 50, got %d", n)
+	}
+}
+
+// getTestSecurity returns security with day quotes with the given close prices (one quote per day)
+func getTestSecurity(closes ...float64) *Security {
+	sec := GetQuickSecurity("TEST", Share)
+
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, c := range closes {
+		begin := date.AddDate(0, 0, i)
+		sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: begin, End: begin.Add(time.Hour), Open: c, Close: c, High: c, Low: c})
+	}
+
+	return sec
+}
+
+func TestResample(t *testing.T) {
+	// 01.01.2023 is Sunday, so days are split into weeks 01.01, 02.01-08.01 and 09.01-10.01
+	sec := getTestSecurity(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	sec.SetQuotes(SecurityQuotes{Interval: IntervalHour, Begin: time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC), Close: 100, High: 100, Low: 100})
+
+	res, err := sec.Resample(IntervalDay, IntervalWeek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 3 {
+		t.Fatalf("wrong number of weeks - want 3, got %d", len(res))
+	}
+
+	w := res[1]
+	if w.Interval != IntervalWeek || w.Open != 2 || w.Close != 8 || w.High != 8 || w.Low != 2 {
+		t.Errorf("wrong week quotes - want 2/8/8/2, got %f/%f/%f/%f", w.Open, w.Close, w.High, w.Low)
+	}
+	if !w.Begin.Equal(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)) || !w.End.Equal(time.Date(2023, 1, 8, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong week dates - got %s - %s", w.Begin, w.End)
+	}
+
+	res, err = sec.Resample(IntervalDay, IntervalMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 1 || res[0].Open != 1 || res[0].Close != 10 {
+		t.Errorf("wrong month quotes - want one month from 1 to 10, got %d months", len(res))
+	}
+
+	_, err = sec.Resample(IntervalWeek, IntervalDay)
+	if err == nil {
+		t.Error("no error when the target interval is finer")
+	}
+
+	_, err = sec.Resample(IntervalDay, IntervalDay)
+	if err == nil {
+		t.Error("no error when the target interval is the same")
+	}
+}
+
+func TestResampleVolume(t *testing.T) {
+	sec := GetQuickSecurity("TEST", Share)
+	for i := 0; i < 6; i++ {
+		begin := time.Date(2023, 3, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)
+		sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: begin, End: begin, Open: 1, Close: 1, High: 1, Low: 1, Volume: 10})
+	}
+
+	// 30.03 and 31.03 are in the first quarter, 01.04-04.04 are in the second one
+	res, err := sec.Resample(IntervalDay, IntervalQuarter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res) != 2 || res[0].Volume != 20 || res[1].Volume != 40 {
+		t.Errorf("wrong quarter volumes - want 20 and 40, got %d quarters", len(res))
+	}
+}
+
+func TestTimeAboveSMA(t *testing.T) {
+	sec := getTestSecurity(1, 2, 3, 2, 1, 2)
+
+	// averages for window 2: 1.5, 2.5, 2.5, 1.5, 1.5 - closes above average: 2, 3, 2
+	res, err := sec.TimeAboveSMA(IntervalDay, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res != 0.6 {
+		t.Errorf("wrong time above SMA - want 0.6, got %f", res)
+	}
+
+	_, err = sec.TimeAboveSMA(IntervalDay, 10)
+	if err == nil {
+		t.Error("no error for window longer than quotes list")
+	}
+}
+
+func TestForwardReturn(t *testing.T) {
+	sec := getTestSecurity(100, 110, 90, 120, 125)
+
+	res, err := sec.ForwardReturn(IntervalDay, time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// from 110 (02.01.2023) to 120 (04.01.2023)
+	if math.Abs(res-100.0/11) > 1e-9 {
+		t.Errorf("wrong forward return - want %f, got %f", 100.0/11, res)
+	}
+
+	_, err = sec.ForwardReturn(IntervalDay, time.Date(2023, 1, 4, 0, 0, 0, 0, time.UTC), 2)
+	if err == nil {
+		t.Error("no error when there are not enough quotes")
+	}
+}
+
+func TestLastChange(t *testing.T) {
+	sec := getTestSecurity(100, 110, 90, 120)
+
+	res, err := sec.LastChange(IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// from 90 (03.01.2023) to 120 (04.01.2023)
+	if math.Abs(res-100.0/3) > 1e-9 {
+		t.Errorf("wrong last change - want %f, got %f", 100.0/3, res)
+	}
+
+	_, err = getTestSecurity(100).LastChange(IntervalDay)
+	if err == nil {
+		t.Error("no error when there are not enough quotes")
+	}
+}
+
+func TestSMA(t *testing.T) {
+	sec := getTestSecurity(1, 2, 3, 4, 5)
+
+	res := sec.SMA(IntervalDay, 3)
+	want := []float64{2, 3, 4}
+
+	if len(res) != len(want) {
+		t.Fatalf("wrong SMA length - want %d, got %d", len(want), len(res))
+	}
+
+	for i, v := range res {
+		if v.Value != want[i] {
+			t.Errorf("wrong SMA value %d - want %f, got %f", i, want[i], v.Value)
+		}
+	}
+
+	if !res[0].Begin.Equal(time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("wrong date of the first SMA value - want 03.01.2023, got %s", res[0].Begin.Format("02.01.2006"))
+	}
+
+	if len(sec.SMA(IntervalDay, 0)) != 0 {
+		t.Error("SMA for zero period is not empty")
+	}
+}
+
+func TestEMA(t *testing.T) {
+	// quotes are added not in order to check sorting
+	sec := getTestSecurity(1, 2, 3)
+	date := time.Date(2022, 12, 31, 0, 0, 0, 0, time.UTC)
+	sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: date, End: date.Add(time.Hour), Close: 3})
+
+	// closes 3, 1, 2, 3: seed (3+1)/2 = 2, k = 2/3 -> 2*2/3+2/3 = 2, 3*2/3+2/3 = 2.666667
+	res := sec.EMA(IntervalDay, 2)
+	want := []float64{2, 2, 8.0 / 3}
+
+	if len(res) != len(want) {
+		t.Fatalf("wrong EMA length - want %d, got %d", len(want), len(res))
+	}
+
+	for i, v := range res {
+		if math.Abs(v-want[i]) > 1e-9 {
+			t.Errorf("wrong EMA value %d - want %f, got %f", i, want[i], v)
+		}
+	}
+
+	if len(sec.EMA(IntervalDay, 5)) != 0 {
+		t.Error("EMA is not empty when there are fewer quotes than period")
+	}
+}
+
+func TestRSI(t *testing.T) {
+	// changes: +2, -1, +1, -2 - first average gain 1, loss 1/3 (RSI 75); then gain 2/3, loss 8/9 (RSI 42.857143)
+	sec := getTestSecurity(10, 12, 11, 12, 10)
+
+	res := sec.RSI(IntervalDay, 3)
+	want := []float64{75, 100 - 100/(1+(2.0/3)/(8.0/9))}
+
+	if len(res) != len(want) {
+		t.Fatalf("wrong RSI length - want %d, got %d", len(want), len(res))
+	}
+
+	for i, v := range res {
+		if math.Abs(v-want[i]) > 1e-9 {
+			t.Errorf("wrong RSI value %d - want %f, got %f", i, want[i], v)
+		}
+	}
+
+	// only gains, only losses and no changes
+	for _, c := range []struct {
+		sec  *Security
+		want float64
+	}{
+		{getTestSecurity(1, 2, 3, 4), 100},
+		{getTestSecurity(4, 3, 2, 1), 0},
+		{getTestSecurity(1, 1, 1, 1), 50},
+	} {
+		res := c.sec.RSI(IntervalDay, 2)
+		for _, v := range res {
+			if v != c.want {
+				t.Errorf("wrong RSI value for flat period - want %f, got %f", c.want, v)
+			}
+		}
+	}
+}
+
+func TestMACD(t *testing.T) {
+	// fast EMA(2): 2, 2, 10/3, 28/9; slow EMA(3): 2, 3, 3
+	// MACD: 0, 1/3, 1/9; signal EMA(2): 1/6, 7/54; histogram: 1/6, -1/54
+	sec := getTestSecurity(1, 3, 2, 4, 3)
+
+	macd, signalLine, histogram, err := sec.MACD(IntervalDay, 2, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, res []float64, want []float64) {
+		if len(res) != len(want) {
+			t.Errorf("wrong %s length - want %d, got %d", name, len(want), len(res))
+			return
+		}
+
+		for i, v := range res {
+			if math.Abs(v-want[i]) > 1e-9 {
+				t.Errorf("wrong %s value %d - want %f, got %f", name, i, want[i], v)
+			}
+		}
+	}
+
+	check("MACD", macd, []float64{0, 1.0 / 3, 1.0 / 9})
+	check("signal line", signalLine, []float64{1.0 / 6, 7.0 / 54})
+	check("histogram", histogram, []float64{1.0 / 6, -1.0 / 54})
+
+	_, _, _, err = sec.MACD(IntervalDay, 3, 2, 2)
+	if err == nil {
+		t.Error("no error when fast period is greater than slow period")
+	}
+
+	_, _, _, err = sec.MACD(IntervalDay, 0, 2, 2)
+	if err == nil {
+		t.Error("no error for zero period")
+	}
+}
+
+func TestBollingerBands(t *testing.T) {
+	// windows: (2, 4, 4, 4) - average 3.5, deviation 0.866025; (4, 4, 4, 5) - average 4.25, deviation 0.433013
+	sec := getTestSecurity(2, 4, 4, 4, 5)
+
+	middle, upper, lower := sec.BollingerBands(IntervalDay, 4, 2)
+	if len(middle) != 2 || len(upper) != 2 || len(lower) != 2 {
+		t.Fatalf("wrong Bollinger bands length - want 2, got %d, %d, %d", len(middle), len(upper), len(lower))
+	}
+
+	wantMiddle := []float64{3.5, 4.25}
+	wantDev := []float64{math.Sqrt(0.75), math.Sqrt(0.1875)}
+	for i := range middle {
+		if math.Abs(middle[i]-wantMiddle[i]) > 1e-9 {
+			t.Errorf("wrong middle band value %d - want %f, got %f", i, wantMiddle[i], middle[i])
+		}
+
+		if math.Abs(upper[i]-(wantMiddle[i]+2*wantDev[i])) > 1e-9 {
+			t.Errorf("wrong upper band value %d - want %f, got %f", i, wantMiddle[i]+2*wantDev[i], upper[i])
+		}
+
+		if math.Abs(lower[i]-(wantMiddle[i]-2*wantDev[i])) > 1e-9 {
+			t.Errorf("wrong lower band value %d - want %f, got %f", i, wantMiddle[i]-2*wantDev[i], lower[i])
+		}
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	a := getTestSecurity(100, 110, 99, 108.9, 108.9)
+	b := getTestSecurity(10, 12, 9.6, 11.52, 11.52)
+	c := getTestSecurity(10, 9, 9.9, 8.91, 8.91)
+
+	// returns of a: 10%, -10%, 10%, 0; b: 20%, -20%, 20%, 0; c: -10%, 10%, -10%, 0
+	res, err := Correlation(a, b, IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res-1) > 1e-9 {
+		t.Errorf("wrong correlation - want 1, got %f", res)
+	}
+
+	res, err = Correlation(a, c, IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res+1) > 1e-9 {
+		t.Errorf("wrong correlation - want -1, got %f", res)
+	}
+
+	_, err = Correlation(a, getTestSecurity(1, 2), IntervalDay)
+	if err == nil {
+		t.Error("no error when there are not enough overlapping quotes")
+	}
+}
+
+func TestBeta(t *testing.T) {
+	market := getTestSecurity(100, 110, 99, 108.9, 108.9)
+	double := getTestSecurity(10, 12, 9.6, 11.52, 11.52)
+	inverse := getTestSecurity(10, 9, 9.9, 8.91, 8.91)
+
+	// returns of market: 10%, -10%, 10%, 0; double: 20%, -20%, 20%, 0; inverse: -10%, 10%, -10%, 0
+	res, err := Beta(double, market, IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res-2) > 1e-9 {
+		t.Errorf("wrong beta - want 2, got %f", res)
+	}
+
+	res, err = Beta(inverse, market, IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res+1) > 1e-9 {
+		t.Errorf("wrong beta - want -1, got %f", res)
+	}
+
+	_, err = Beta(double, getTestSecurity(1, 2), IntervalDay)
+	if err == nil {
+		t.Error("no error when there are not enough overlapping quotes")
+	}
+
+	_, err = Beta(double, getTestSecurity(1, 1, 1, 1), IntervalDay)
+	if err == nil {
+		t.Error("no error when benchmark price doesn't change")
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	// the largest decline is from 120 (03.01.2023) to 60 (06.01.2023), not from 100 to 80
+	sec := getTestSecurity(100, 80, 120, 90, 100, 60, 130)
+
+	drawdown, peak, trough := sec.MaxDrawdown(IntervalDay)
+	if drawdown != -50 {
+		t.Errorf("wrong max drawdown - want -50, got %f", drawdown)
+	}
+
+	if peak.Day() != 3 || trough.Day() != 6 {
+		t.Errorf("wrong max drawdown dates - want 03.01.2023 - 06.01.2023, got %s - %s", peak.Format("02.01.2006"), trough.Format("02.01.2006"))
+	}
+}
+
+func TestHighLow(t *testing.T) {
+	// the window of 3 days before the end of the last quotes (10.01.2023) covers 08.01-10.01
+	sec := getTestSecurity(200, 10, 100, 90, 120, 80, 110, 95, 130, 105)
+
+	high, low, highDate, lowDate := sec.HighLow(IntervalDay, 3*24*time.Hour)
+	if high != 130 || low != 95 {
+		t.Errorf("wrong high and low - want 130 and 95, got %f and %f", high, low)
+	}
+
+	if highDate.Day() != 9 || lowDate.Day() != 8 {
+		t.Errorf("wrong dates of high and low - want 09.01.2023 and 08.01.2023, got %s and %s", highDate.Format("02.01.2006"), lowDate.Format("02.01.2006"))
+	}
+
+	// all quotes are used if they are shorter than the window, close price is used if high and low are not set
+	sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: time.Date(2023, 1, 11, 0, 0, 0, 0, time.UTC), End: time.Date(2023, 1, 11, 1, 0, 0, 0, time.UTC), Close: 5})
+
+	high, low, _, lowDate = sec.HighLow(IntervalDay, 365*24*time.Hour)
+	if high != 200 || low != 5 || lowDate.Day() != 11 {
+		t.Errorf("wrong high and low of all quotes - want 200 and 5 on 11.01.2023, got %f and %f on %s", high, low, lowDate.Format("02.01.2006"))
+	}
+
+	if high, low, _, _ = getTestSecurity().HighLow(IntervalDay, time.Hour); high != 0 || low != 0 {
+		t.Errorf("wrong high and low without quotes - want zeros, got %f and %f", high, low)
+	}
+}
+
+func TestAverageVolume(t *testing.T) {
+	sec := getTestSecurity(1, 2, 3, 4)
+	if res := sec.AverageVolume(IntervalDay, 2); res != 0 {
+		t.Errorf("wrong average volume without volume data - want 0, got %f", res)
+	}
+
+	sec = GetQuickSecurity("TEST", Share)
+	for i, v := range []float64{100, 200, 300, 500} {
+		begin := time.Date(2023, 1, i+1, 0, 0, 0, 0, time.UTC)
+		sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: begin, End: begin.Add(time.Hour), Close: 1, Volume: v})
+	}
+
+	if res := sec.AverageVolume(IntervalDay, 2); res != 400 {
+		t.Errorf("wrong average volume of the last two quotes - want 400, got %f", res)
+	}
+
+	if res := sec.AverageVolume(IntervalDay, 10); res != 275 {
+		t.Errorf("wrong average volume of all quotes - want 275, got %f", res)
+	}
+}
+
+func TestTotalReturn(t *testing.T) {
+	sec := getTestSecurity(100, 100, 50, 110)
+
+	// dividends of the first day and after the last day are not counted
+	dividends := []Dividend{
+		{Date: time.Date(2023, 1, 3, 0, 0, 0, 0, time.UTC), Value: 5, Currency: RUB},
+		{Date: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), Value: 10, Currency: RUB},
+		{Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), Value: 100, Currency: RUB},
+		{Date: time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC), Value: 100, Currency: RUB},
+	}
+
+	// dividends are reinvested at 100 and at 50, so there are 1.1 * 1.1 shares
+	res := sec.TotalReturn(IntervalDay, dividends)
+	if math.Abs(res-33.1) > 1e-9 {
+		t.Errorf("wrong total return - want 33.1, got %f", res)
+	}
+
+	res = sec.TotalReturn(IntervalDay, nil)
+	if math.Abs(res-10) > 1e-9 {
+		t.Errorf("wrong total return without dividends - want 10, got %f", res)
+	}
+
+	if res = getTestSecurity().TotalReturn(IntervalDay, dividends); res != 0 {
+		t.Errorf("wrong total return without quotes - want 0, got %f", res)
+	}
+}
+
+func TestBondYields(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	bond := &BondInfo{
+		FaceValue: 1000,
+		Payments: []BondPayment{
+			{Date: start.AddDate(0, 0, 365), Start: start, Coupon: 100, Amortization: 400},
+			{Date: start.AddDate(0, 0, 730), Start: start.AddDate(0, 0, 365), Coupon: 60, Amortization: 600},
+		},
+	}
+
+	if v := bond.FaceValueAt(start.AddDate(0, 0, 400)); v != 600 {
+		t.Errorf("wrong face value after amortization - want 600, got %f", v)
+	}
+
+	if v := bond.AccruedInterest(start.AddDate(0, 0, 73)); math.Abs(v-20) > 1e-9 {
+		t.Errorf("wrong accrued interest - want 20, got %f", v)
+	}
+
+	res, err := bond.CurrentYield(50, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res-20) > 1e-9 {
+		t.Errorf("wrong current yield - want 20, got %f", res)
+	}
+
+	// the last year: 600 are paid for 660 in a year
+	res, err = YieldToMaturity(bond, 100, start.AddDate(0, 0, 365))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res-10) > 1e-6 {
+		t.Errorf("wrong yield to maturity - want 10, got %f", res)
+	}
+
+	// 1000 are paid for 500 in a year and 660 in two years: 500 / 1.1 + 660 / 1.21 = 1000
+	res, err = YieldToMaturity(bond, 100, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(res-10) > 1e-6 {
+		t.Errorf("wrong yield to maturity of two years - want 10, got %f", res)
+	}
+
+	_, err = YieldToMaturity(bond, 100, start.AddDate(0, 0, 730))
+	if err == nil {
+		t.Error("no error for matured bond")
+	}
+}
+
+func TestVolatility(t *testing.T) {
+	// log returns: ln(2), -ln(2) - standard deviation ln(2)
+	sec := getTestSecurity(1, 2, 1)
+
+	res, err := sec.Volatility(IntervalDay, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res-math.Ln2) > 1e-9 {
+		t.Errorf("wrong volatility - want %f, got %f", math.Ln2, res)
+	}
+
+	res, err = sec.Volatility(IntervalDay, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if math.Abs(res-math.Ln2*math.Sqrt(252)) > 1e-9 {
+		t.Errorf("wrong annualized volatility - want %f, got %f", math.Ln2*math.Sqrt(252), res)
+	}
+
+	_, err = getTestSecurity(1).Volatility(IntervalDay, false)
+	if err == nil {
+		t.Error("no error when there are fewer than two quotes")
+	}
+}
+
+func TestSharpeSortino(t *testing.T) {
+	// returns: 10%, -10%, 10%, 10% - average 5%, standard deviation sqrt(0.0075), downside deviation sqrt(0.01 / 4) = 0.05
+	sec := getTestSecurity(100, 110, 99, 108.9, 119.79)
+
+	want := 0.05 / math.Sqrt(0.0075) * math.Sqrt(252)
+	if res := sec.Sharpe(IntervalDay, 0); math.Abs(res-want) > 1e-9 {
+		t.Errorf("wrong Sharpe ratio - want %f, got %f", want, res)
+	}
+
+	want = 0.05 / 0.05 * math.Sqrt(252)
+	if res := sec.Sortino(IntervalDay, 0); math.Abs(res-want) > 1e-9 {
+		t.Errorf("wrong Sortino ratio - want %f, got %f", want, res)
+	}
+
+	// the risk-free rate of 5.04% a year is 0.02% a day
+	want = 0.0498 / math.Sqrt(0.0075) * math.Sqrt(252)
+	if res := sec.Sharpe(IntervalDay, 0.0504); math.Abs(res-want) > 1e-9 {
+		t.Errorf("wrong Sharpe ratio with risk-free rate - want %f, got %f", want, res)
+	}
+
+	if res := getTestSecurity(1, 2).Sharpe(IntervalDay, 0); res != 0 {
+		t.Errorf("wrong Sharpe ratio with not enough quotes - want 0, got %f", res)
+	}
+
+	if res := getTestSecurity(1, 2, 4).Sortino(IntervalDay, 0); res != 0 {
+		t.Errorf("wrong Sortino ratio without losses - want 0, got %f", res)
+	}
+
+	if res := sec.Sharpe(IntervalHour, 0); res != 0 {
+		t.Errorf("wrong Sharpe ratio of intraday quotes - want 0, got %f", res)
+	}
+}
+
+// weekdaysCalendar is a trading calendar without holidays
+type weekdaysCalendar struct{}
+
+func (weekdaysCalendar) IsTradingDay(date time.Time) bool {
+	return date.Weekday() != time.Saturday && date.Weekday() != time.Sunday
+}
+
+func TestMissingDates(t *testing.T) {
+	// 01.01.2023 is Sunday, quotes are loaded for 02.01-13.01 without 04.01, 05.01 and 11.01
+	sec := GetQuickSecurity("TEST", Share)
+	for _, day := range []int{2, 3, 6, 9, 10, 12, 13} {
+		begin := time.Date(2023, 1, day, 0, 0, 0, 0, time.UTC)
+		sec.SetQuotes(SecurityQuotes{Interval: IntervalDay, Begin: begin, End: begin.Add(time.Hour), Close: 1})
+	}
+
+	res := sec.MissingDates(IntervalDay, weekdaysCalendar{})
+	want := []int{4, 5, 11}
+	if len(res) != len(want) {
+		t.Fatalf("wrong number of missing dates - want %d, got %d", len(want), len(res))
+	}
+
+	for i, day := range want {
+		if !res[i].Equal(time.Date(2023, 1, day, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("wrong missing date - want %02d.01.2023, got %s", day, res[i].Format("02.01.2006"))
+		}
+	}
+
+	// hourly quotes are checked by days
+	sec.SetQuotes(SecurityQuotes{Interval: IntervalHour, Begin: time.Date(2023, 1, 6, 10, 0, 0, 0, time.UTC), Close: 1})
+	sec.SetQuotes(SecurityQuotes{Interval: IntervalHour, Begin: time.Date(2023, 1, 9, 18, 0, 0, 0, time.UTC), Close: 1})
+
+	res = sec.MissingDates(IntervalHour, weekdaysCalendar{})
+	if len(res) != 0 {
+		t.Errorf("weekend is reported as missing for hourly quotes - %v", res)
+	}
+
+	if res = GetQuickSecurity("EMPTY", Share).MissingDates(IntervalDay, weekdaysCalendar{}); len(res) != 0 {
+		t.Errorf("security without quotes has missing dates - %v", res)
+	}
+}
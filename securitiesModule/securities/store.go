@@ -0,0 +1,121 @@
+package securities
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrSecurityNotExist is returned by storage if security is not found
+var ErrSecurityNotExist = errors.New("security does not exist")
+
+// ErrSecurityExists is returned by storage if added security already exists
+var ErrSecurityExists = errors.New("security already exists")
+
+// ErrNoRate is returned by storage if there is no currency rate for the date
+var ErrNoRate = errors.New("no currency rate")
+
+// SortField is a field to sort the list of securities by
+type SortField string
+
+const (
+	UnknownSortField SortField = "unknown"
+	SortByID         SortField = "id"
+	SortByName       SortField = "name"
+	SortByLastPrice  SortField = "lastprice"
+	SortByLastDate   SortField = "lastdate"
+)
+
+// GetSortFieldFromString converts string name of sort field to SortField
+// Securities are sorted by id if the name is empty
+func GetSortFieldFromString(fieldName string) SortField {
+	switch strings.ToLower(fieldName) {
+	case "", "id":
+		return SortByID
+	case "name":
+		return SortByName
+	case "lastprice":
+		return SortByLastPrice
+	case "lastdate":
+		return SortByLastDate
+	default:
+		return UnknownSortField
+	}
+}
+
+// Store is a storage of securities data
+// It's implemented by database packages (securitiesSQL for MySQL and SQLite databases for example)
+type Store interface {
+	// SecurityExists checks if security with given id and type exists in storage (deleted securities don't exist)
+	SecurityExists(id string, sType SecurityType) (bool, error)
+	// SecurityQuotesExist checks if security quotes for the given date and interval exist in storage
+	SecurityQuotesExist(sec *Security, date time.Time, interval QuotesInterval) (bool, error)
+
+	// GetSecurityData fills in security data from storage
+	GetSecurityData(sec *Security) error
+	// GetSecuritiesData fills in data for a list of securities from storage
+	GetSecuritiesData(sec []*Security) error
+	// GetAllSecuritiesData returns limit securities (sorted by the given field) starting from offset from storage (considering type and currency filters) with only last quotes for each security
+	// All securities are returned if limit is 0, the total number of securities considering filters is returned too
+	// Deleted securities are returned only if includeDeleted is set
+	GetAllSecuritiesData(typeNameFilter string, currencyNameFilter string, sortField SortField, desc bool, limit int, offset int, includeDeleted bool) ([]*Security, int, error)
+	// GetAllSecuritiesLastQuotes returns securities from storage (not deleted, considering type and currency filters) with only the last count quotes of the interval for each security
+	// Securities without quotes of the interval are not returned
+	GetAllSecuritiesLastQuotes(typeNameFilter string, currencyNameFilter string, interval QuotesInterval, count int) ([]*Security, error)
+	// GetSecuritiesByQuery returns securities which id or name contains the given text (case-insensitive) without quotes
+	GetSecuritiesByQuery(q string) ([]*Security, error)
+
+	// AddSecurity adds new security to storage, deleted security is restored with new data
+	// ErrSecurityExists is returned if the security already exists, it isn't changed then
+	AddSecurity(sec *Security) error
+	// AddSecurities adds a list of securities to storage, deleted securities are restored with new data
+	AddSecurities(sec []*Security) error
+	// UpdateSecurity changes name and currency of existing security in storage keeping its quotes
+	UpdateSecurity(sec *Security) error
+	// DeleteSecurity marks security as deleted in storage, it's not found anymore but its quotes are kept
+	// ErrSecurityNotExist is returned if there is no such security or it's already deleted
+	DeleteSecurity(sec *Security) error
+	// DeleteSecurities marks a list of securities as deleted in storage at once (all or nothing)
+	DeleteSecurities(sec []*Security) error
+	// RestoreSecurity removes deleted mark from security, so it's found again with all its quotes
+	RestoreSecurity(sec *Security) error
+	// PurgeSecurities removes a list of securities (deleted or not) and their quotes from storage irreversibly
+	PurgeSecurities(sec []*Security) error
+
+	// UpdateSecurityQuotes gets security quotes from Moscow Exchange and writes them down to storage
+	UpdateSecurityQuotes(ctx context.Context, sec *Security, dateFrom time.Time, dateTill time.Time, interval QuotesInterval) error
+	// UpdateSecurityQuotesIncremental gets security quotes from Moscow Exchange only from the last stored quotes of the interval and merges them with stored quotes
+	// The whole period is updated if there are no stored quotes in it
+	UpdateSecurityQuotesIncremental(ctx context.Context, sec *Security, dateFrom time.Time, dateTill time.Time, interval QuotesInterval) error
+	// BackfillSecurityQuotes gets from Moscow Exchange only quotes of the trading days which are missing between the first and the last stored quotes of the period
+	// Stored quotes are not changed, the number of added quotes is returned
+	BackfillSecurityQuotes(ctx context.Context, sec *Security, dateFrom time.Time, dateTill time.Time, interval QuotesInterval) (int, error)
+	// RefetchSecurityQuotesForDate gets security quotes for the given date from Moscow Exchange again and replaces stored quotes of this date
+	// Only the intervals which have stored quotes beginning on this date are refetched (the day interval if there are no such quotes)
+	RefetchSecurityQuotesForDate(ctx context.Context, sec *Security, date time.Time) error
+	// UpdateAllSecuritiesLastQuotes gets last day quotes from Moscow Exchange for all stored securities (considering type and currency filters) and writes them down to storage
+	UpdateAllSecuritiesLastQuotes(ctx context.Context, typeNameFilter string, currencyNameFilter string) error
+	// UpdateSecurityDividends gets dividends of security from Moscow Exchange and replaces stored dividends with them
+	UpdateSecurityDividends(ctx context.Context, sec *Security) error
+	// GetSecurityDividends returns stored dividends of security sorted by date
+	GetSecurityDividends(sec *Security) ([]Dividend, error)
+	// UpdateBondInfo gets face value and payments of bond from Moscow Exchange and replaces stored bond info with them
+	UpdateBondInfo(ctx context.Context, sec *Security) error
+	// GetBondInfo returns stored face value and payments of bond, ErrNoBondInfo is returned if bond info was never stored
+	GetBondInfo(sec *Security) (*BondInfo, error)
+
+	// GetStats returns the number of stored securities (not deleted) and quotes
+	GetStats() (securities int, quotes int, err error)
+	// Ping checks that storage is reachable and answers queries
+	Ping(ctx context.Context) error
+
+	// GetCurrencyRate returns the rate of currency in rubles for the date, missing rates are got from Moscow Exchange and stored
+	// ErrNoRate is returned if there is no rate for the date
+	GetCurrencyRate(ctx context.Context, currency SecurityCurrency, date time.Time) (float64, error)
+	// ConvertPrice converts amount from one currency to another by rates of the date, cross rates are got through rubles
+	ConvertPrice(ctx context.Context, amount float64, from SecurityCurrency, to SecurityCurrency, date time.Time) (float64, error)
+
+	// Close closes storage
+	Close() error
+}
@@ -0,0 +1,1290 @@
+// Package storetest contains common tests for implementations of securities.Store
+// Every storage package runs the same assertions with its own store
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"securitiesModule/securities"
+	"securitiesModule/securities/alerts"
+	"securitiesModule/securities/moex"
+	"securitiesModule/securities/portfolio"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// historyColumns are the columns of Moscow Exchange shares history
+var historyColumns = []string{"BOARDID", "TRADEDATE", "SHORTNAME", "SECID", "NUMTRADES", "VALUE", "OPEN", "LOW", "HIGH", "LEGALCLOSEPRICE", "WAPRICE", "CLOSE", "VOLUME"}
+
+// Run runs all common tests with the given store
+// Moscow Exchange requests are sent to the test server, test securities are removed after the tests
+func Run(t *testing.T, store securities.Store) {
+	price := 100.0
+	var candleRequests, historyRequests int32
+	var candleFrom atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var res []byte
+		if strings.HasSuffix(request.URL.Path, "/dividends.json") {
+			res, _ = json.Marshal(map[string]any{"dividends": map[string]any{
+				"columns": []string{"secid", "isin", "registryclosedate", "value", "currencyid"},
+				"data":    [][]any{{"TSTSTA", "", "2023-05-11", price / 10, "SUR"}, {"TSTSTA", "", "2022-05-12", 5.5, "SUR"}},
+			}})
+		} else if strings.HasSuffix(request.URL.Path, "/bondization.json") {
+			res, _ = json.Marshal(map[string]any{
+				"coupons": map[string]any{
+					"columns": []string{"coupondate", "startdate", "initialfacevalue", "value"},
+					"data":    [][]any{{"2023-07-01", "2023-01-01", 1000.0, 40.0}, {"2024-01-01", "2023-07-01", 1000.0, nil}},
+				},
+				"amortizations": map[string]any{
+					"columns": []string{"amortdate", "initialfacevalue", "value"},
+					"data":    [][]any{{"2024-01-01", 1000.0, 1000.0}},
+				},
+			})
+		} else if request.URL.Query().Get("date") != "" {
+			atomic.AddInt32(&historyRequests, 1)
+			time.Sleep(50 * time.Millisecond)
+
+			records := [][]any{}
+			if request.URL.Query().Get("start") == "0" {
+				for _, id := range []string{"TSTSTA", "TSTSTB"} {
+					records = append(records, []any{"TQBR", request.URL.Query().Get("date"), id, id, 100.0, 1000.0, price, price, price, price, price, price, 10.0})
+				}
+			}
+			res, _ = json.Marshal(map[string]any{"history": map[string]any{"columns": historyColumns, "data": records}})
+		} else {
+			atomic.AddInt32(&candleRequests, 1)
+			candleFrom.Store(request.URL.Query().Get("from"))
+
+			// the slow answer lets concurrent updates of the same quotes meet each other
+			time.Sleep(200 * time.Millisecond)
+
+			// candles of working days 30.01.2023 - 03.02.2023 are returned for the requested period
+			candles := [][]any{}
+			for _, candle := range [][]any{
+				{price, price, price, price, 1000.0, 10.0, "2023-01-30 00:00:00", "2023-01-30 23:59:59"},
+				{price, price, price, price, 1000.0, 10.0, "2023-01-31 00:00:00", "2023-01-31 23:59:59"},
+				{price, price, price, price, 1000.0, 10.0, "2023-02-01 00:00:00", "2023-02-01 23:59:59"},
+				{price, price + 1, price + 2, price - 1, 1000.0, 10.0, "2023-02-02 00:00:00", "2023-02-02 23:59:59"},
+				{price, price, price, price, 1000.0, 10.0, "2023-02-03 00:00:00", "2023-02-03 23:59:59"},
+			} {
+				day := candle[6].(string)[:10]
+				if day >= request.URL.Query().Get("from") && day <= request.URL.Query().Get("till") {
+					candles = append(candles, candle)
+				}
+			}
+			res, _ = json.Marshal(map[string]any{"candles": map[string]any{"data": candles}})
+		}
+		writer.Write(res)
+	}))
+	defer server.Close()
+
+	baseURL, requestDelay := moex.BaseURL, moex.RequestDelay
+	moex.BaseURL, moex.RequestDelay = server.URL, 0
+	defer func() { moex.BaseURL, moex.RequestDelay = baseURL, requestDelay }()
+
+	secA := securities.GetSecurity("TSTSTA", "Test share A", securities.Share, securities.CNY)
+	secB := securities.GetSecurity("TSTSTB", "Test share B", securities.Share, securities.CNY)
+	secC := securities.GetSecurity("TSTSTC", "Test ETF C", securities.ETF, securities.CNY)
+	secList := []*securities.Security{secA, secB, secC}
+
+	// test securities are removed completely, deleted ones too
+	defer func() {
+		err := store.PurgeSecurities(append(secList, securities.GetQuickSecurity("TSTSTD", securities.Share), securities.GetQuickSecurity("TSTSTE", securities.Share)))
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	t.Run("AddSecurities", func(t *testing.T) {
+		err := store.AddSecurities(secList)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// adding of existing securities must be skipped
+		err = store.AddSecurity(secA)
+		if !errors.Is(err, securities.ErrSecurityExists) {
+			t.Fatalf("wrong error for adding of existing security - want %v, got %v", securities.ErrSecurityExists, err)
+		}
+
+		res, err := store.SecurityExists("TSTSTA", securities.Share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res {
+			t.Error("added security TSTSTA doesn't exist")
+		}
+
+		res, err = store.SecurityExists("TSTSTA", securities.ETF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res {
+			t.Error("security TSTSTA exists with wrong type")
+		}
+	})
+
+	t.Run("ConcurrentAddSecurities", func(t *testing.T) {
+		secH := securities.GetSecurity("TSTSTH", "Test share H", securities.Share, securities.CNY)
+		secI := securities.GetSecurity("TSTSTI", "Test share I", securities.Share, securities.CNY)
+		defer store.PurgeSecurities([]*securities.Security{secH, secI})
+
+		const n = 10
+		errs := make([]error, n)
+
+		start := make(chan struct{})
+		wg := new(sync.WaitGroup)
+		for i := 0; i < n; i++ {
+			// every list has the securities in its own order, the list may have the same security twice
+			list := []*securities.Security{secH, secI}
+			if i%2 == 1 {
+				list = []*securities.Security{secI, secH, secI}
+			}
+
+			wg.Add(1)
+			go func(i int, list []*securities.Security) {
+				defer wg.Done()
+
+				<-start
+				errs[i] = store.AddSecurities(list)
+			}(i, list)
+		}
+
+		close(start)
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("concurrent add %d failed: %v", i, err)
+			}
+		}
+
+		for _, sec := range []*securities.Security{secH, secI} {
+			res := securities.GetQuickSecurity(sec.Id(), securities.Share)
+			err := store.GetSecurityData(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res.Name() != sec.Name() || res.Currency() != sec.Currency() {
+				t.Errorf("wrong data of concurrently added security %s - got %s, %s", sec.Id(), res.Name(), res.Currency())
+			}
+		}
+
+		if err := store.AddSecurities([]*securities.Security{securities.GetSecurity("", "No id", securities.Share, securities.RUB)}); err == nil {
+			t.Error("no error for security without id")
+		}
+	})
+
+	t.Run("UpdateSecurityQuotes", func(t *testing.T) {
+		before := time.Now().Add(-time.Second)
+
+		err := store.UpdateSecurityQuotes(context.Background(), secA, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := store.SecurityQuotesExist(secA, time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res {
+			t.Error("TSTSTA quotes for 02.02.2023 don't exist after update")
+		}
+
+		sec := securities.GetQuickSecurity("TSTSTA", securities.Share)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sec.Name() != "Test share A" || sec.Currency() != securities.CNY {
+			t.Errorf("wrong TSTSTA data - want Test share A in CNY, got %s in %s", sec.Name(), sec.Currency())
+		}
+
+		if sec.LastUpdated().Before(before) {
+			t.Errorf("wrong TSTSTA last update time - want after %s, got %s", before, sec.LastUpdated())
+		}
+
+		quotes := *sec.QuotesOfInterval(securities.IntervalDay)
+		if len(quotes) != 2 {
+			t.Fatalf("wrong number of TSTSTA quotes - want 2, got %d", len(quotes))
+		}
+
+		q := quotes[1]
+		if q.Open != 100 || q.Close != 101 || q.High != 102 || q.Low != 99 || q.Volume != 10 {
+			t.Errorf("wrong TSTSTA quotes for 02.02.2023 - want 100/101/102/99/10, got %f/%f/%f/%f/%f", q.Open, q.Close, q.High, q.Low, q.Volume)
+		}
+		if !q.Begin.Equal(time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC)) || !q.End.Equal(time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC)) {
+			t.Errorf("wrong TSTSTA quotes dates - got %s - %s", q.Begin, q.End)
+		}
+	})
+
+	t.Run("UpdateSecurityQuotesIncremental", func(t *testing.T) {
+		price = 110
+		defer func() { price = 100 }()
+
+		sec := securities.GetQuickSecurity("TSTSTA", securities.Share)
+		err := store.UpdateSecurityQuotesIncremental(context.Background(), sec, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only quotes from the last stored day must be requested
+		if from := candleFrom.Load(); from != "2023-02-02" {
+			t.Errorf("wrong start of incremental update - want 2023-02-02, got %v", from)
+		}
+
+		sec = securities.GetQuickSecurity("TSTSTA", securities.Share)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		quotes := *sec.QuotesOfInterval(securities.IntervalDay)
+		if len(quotes) != 2 {
+			t.Fatalf("wrong number of TSTSTA quotes after incremental update - want 2, got %d", len(quotes))
+		}
+		if quotes[1].Close != 111 {
+			t.Errorf("wrong TSTSTA close price for 02.02.2023 after incremental update - want 111, got %f", quotes[1].Close)
+		}
+
+		// security without quotes is updated for the whole period
+		sec = securities.GetQuickSecurity("TSTSTB", securities.Share)
+		err = store.UpdateSecurityQuotesIncremental(context.Background(), sec, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if from := candleFrom.Load(); from != "2023-02-01" {
+			t.Errorf("wrong start of full update - want 2023-02-01, got %v", from)
+		}
+	})
+
+	t.Run("BackfillSecurityQuotes", func(t *testing.T) {
+		sec := securities.GetSecurity("TSTSTF", "Test share F", securities.Share, securities.CNY)
+		err := store.AddSecurity(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.PurgeSecurities([]*securities.Security{sec})
+
+		// quotes of 30.01.2023 and 03.02.2023 are stored, 31.01 - 02.02 are missing
+		for _, date := range []time.Time{time.Date(2023, 1, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 3, 0, 0, 0, 0, time.UTC)} {
+			err = store.UpdateSecurityQuotes(context.Background(), sec, date, date.Add(24*time.Hour-time.Second), securities.IntervalDay)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		atomic.StoreInt32(&candleRequests, 0)
+
+		sec = securities.GetQuickSecurity("TSTSTF", securities.Share)
+		added, err := store.BackfillSecurityQuotes(context.Background(), sec, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if added != 3 {
+			t.Errorf("wrong number of backfilled quotes - want 3, got %d", added)
+		}
+
+		// adjacent missing days are got by one request
+		if n := atomic.LoadInt32(&candleRequests); n != 1 {
+			t.Errorf("wrong number of Moscow Exchange requests - want 1, got %d", n)
+		}
+		if from := candleFrom.Load(); from != "2023-01-31" {
+			t.Errorf("wrong start of backfill - want 2023-01-31, got %v", from)
+		}
+
+		sec = securities.GetQuickSecurity("TSTSTF", securities.Share)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if quotes := *sec.QuotesOfInterval(securities.IntervalDay); len(quotes) != 5 {
+			t.Errorf("wrong number of TSTSTF quotes after backfill - want 5, got %d", len(quotes))
+		}
+
+		// there is nothing to backfill now
+		atomic.StoreInt32(&candleRequests, 0)
+
+		added, err = store.BackfillSecurityQuotes(context.Background(), sec, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if added != 0 || atomic.LoadInt32(&candleRequests) != 0 {
+			t.Errorf("quotes are backfilled without gaps - %d quotes added with %d requests", added, atomic.LoadInt32(&candleRequests))
+		}
+
+		_, err = store.BackfillSecurityQuotes(context.Background(), securities.GetQuickSecurity("TSTSTX", securities.Share), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for absent security - want ErrSecurityNotExist, got %v", err)
+		}
+	})
+
+	t.Run("SecurityDividends", func(t *testing.T) {
+		// dividends are replaced by every update
+		for i := 0; i < 2; i++ {
+			err := store.UpdateSecurityDividends(context.Background(), secA)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		div, err := store.GetSecurityDividends(secA)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(div) != 2 {
+			t.Fatalf("wrong number of TSTSTA dividends - want 2, got %d", len(div))
+		}
+
+		if !div[0].Date.Equal(time.Date(2022, 5, 12, 0, 0, 0, 0, time.UTC)) || div[0].Value != 5.5 || div[0].Currency != securities.RUB {
+			t.Errorf("wrong the first TSTSTA dividend - got %+v", div[0])
+		}
+
+		if div[1].Value != price/10 {
+			t.Errorf("wrong the last TSTSTA dividend value - want %f, got %f", price/10, div[1].Value)
+		}
+
+		_, err = store.GetSecurityDividends(securities.GetQuickSecurity("TSTSTX", securities.Share))
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for absent security - want ErrSecurityNotExist, got %v", err)
+		}
+	})
+
+	t.Run("GetStats", func(t *testing.T) {
+		secCount, quotesCount, err := store.GetStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sec := securities.GetSecurity("TSTSTG", "Test stats", securities.Share, securities.RUB)
+		err = store.AddSecurity(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.PurgeSecurities([]*securities.Security{sec})
+
+		newSecCount, newQuotesCount, err := store.GetStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if newSecCount != secCount+1 || newQuotesCount != quotesCount {
+			t.Errorf("wrong stats after adding security - want %d securities and %d quotes, got %d and %d", secCount+1, quotesCount, newSecCount, newQuotesCount)
+		}
+	})
+
+	t.Run("Ping", func(t *testing.T) {
+		err := store.Ping(context.Background())
+		if err != nil {
+			t.Errorf("storage isn't reachable - %v", err)
+		}
+	})
+
+	t.Run("BondInfo", func(t *testing.T) {
+		bond := securities.GetSecurity("TSTSTD", "Test bond", securities.Bond, securities.RUB)
+		err := store.AddSecurity(bond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.PurgeSecurities([]*securities.Security{bond})
+
+		_, err = store.GetBondInfo(bond)
+		if !errors.Is(err, securities.ErrNoBondInfo) {
+			t.Errorf("wrong error for bond without info - want ErrNoBondInfo, got %v", err)
+		}
+
+		// bond info is replaced by every update
+		for i := 0; i < 2; i++ {
+			err = store.UpdateBondInfo(context.Background(), bond)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		info, err := store.GetBondInfo(bond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.FaceValue != 1000 || len(info.Payments) != 2 {
+			t.Fatalf("wrong TSTSTD info - want face value 1000 and 2 payments, got %f and %d", info.FaceValue, len(info.Payments))
+		}
+
+		last := info.Payments[1]
+		if !last.Date.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) || !last.Start.Equal(time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)) || last.Coupon != 40 || last.Amortization != 1000 {
+			t.Errorf("wrong the last TSTSTD payment - got %+v", last)
+		}
+
+		err = store.UpdateBondInfo(context.Background(), secA)
+		if err == nil {
+			t.Error("bond info of share is updated")
+		}
+	})
+
+	t.Run("GetCurrencyRate", func(t *testing.T) {
+		rateId := moex.CurrencyRateIds[securities.USD]
+		moex.CurrencyRateIds[securities.USD] = "TSTSTR"
+		defer func() { moex.CurrencyRateIds[securities.USD] = rateId }()
+		defer store.PurgeSecurities([]*securities.Security{securities.GetQuickSecurity("TSTSTR", securities.Currency)})
+
+		atomic.StoreInt32(&candleRequests, 0)
+
+		rate, err := store.GetCurrencyRate(context.Background(), securities.USD, time.Date(2023, 2, 2, 12, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate != price+1 {
+			t.Errorf("wrong rate for 02.02.2023 - want %f, got %f", price+1, rate)
+		}
+
+		// the stored rate is used
+		_, err = store.GetCurrencyRate(context.Background(), securities.USD, time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&candleRequests); n != 1 {
+			t.Errorf("wrong number of Moscow Exchange requests - want 1, got %d", n)
+		}
+
+		exists, err := store.SecurityExists("TSTSTR", securities.Currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Error("currency fixing isn't stored as security")
+		}
+
+		// the rate of Friday 03.02.2023 isn't stored yet, it's used for Sunday
+		rate, err = store.GetCurrencyRate(context.Background(), securities.USD, time.Date(2023, 2, 5, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate != price {
+			t.Errorf("wrong rate for 05.02.2023 - want %f, got %f", price, rate)
+		}
+
+		rate, err = store.GetCurrencyRate(context.Background(), securities.RUB, time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC))
+		if err != nil || rate != 1 {
+			t.Errorf("wrong rate of ruble - want 1, got %f (%v)", rate, err)
+		}
+
+		_, err = store.GetCurrencyRate(context.Background(), securities.USD, time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC))
+		if !errors.Is(err, securities.ErrNoRate) {
+			t.Errorf("wrong error for date without rates - want ErrNoRate, got %v", err)
+		}
+
+		_, err = store.GetCurrencyRate(context.Background(), securities.UnknownCurrency, time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC))
+		if !errors.Is(err, securities.ErrNoRate) {
+			t.Errorf("wrong error for unknown currency - want ErrNoRate, got %v", err)
+		}
+	})
+
+	t.Run("ConvertPrice", func(t *testing.T) {
+		rateIds := map[securities.SecurityCurrency]string{}
+		for cur, id := range map[securities.SecurityCurrency]string{securities.USD: "TSTSTR", securities.CNY: "TSTSTS"} {
+			rateIds[cur] = moex.CurrencyRateIds[cur]
+			moex.CurrencyRateIds[cur] = id
+		}
+		defer func() {
+			for cur, id := range rateIds {
+				moex.CurrencyRateIds[cur] = id
+			}
+		}()
+		defer store.PurgeSecurities([]*securities.Security{securities.GetQuickSecurity("TSTSTR", securities.Currency), securities.GetQuickSecurity("TSTSTS", securities.Currency)})
+
+		date := time.Date(2023, 2, 2, 0, 0, 0, 0, time.UTC)
+
+		res, err := store.ConvertPrice(context.Background(), 10, securities.USD, securities.RUB, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != 10*(price+1) {
+			t.Errorf("wrong price in rubles - want %f, got %f", 10*(price+1), res)
+		}
+
+		res, err = store.ConvertPrice(context.Background(), price+1, securities.RUB, securities.USD, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(res-1) > 1e-9 {
+			t.Errorf("wrong price in dollars - want 1, got %f", res)
+		}
+
+		// the test server gives the same rates for all currencies, so the cross rate is 1
+		res, err = store.ConvertPrice(context.Background(), 10, securities.USD, securities.CNY, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(res-10) > 1e-9 {
+			t.Errorf("wrong cross rate price - want 10, got %f", res)
+		}
+
+		_, err = store.ConvertPrice(context.Background(), 10, securities.USD, securities.RUB, time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC))
+		if !errors.Is(err, securities.ErrNoRate) {
+			t.Errorf("wrong error for date without rates - want ErrNoRate, got %v", err)
+		}
+	})
+
+	t.Run("ConcurrentUpdateSecurityQuotes", func(t *testing.T) {
+		atomic.StoreInt32(&candleRequests, 0)
+
+		const n = 10
+		list := make([]*securities.Security, n)
+		errs := make([]error, n)
+
+		start := make(chan struct{})
+		wg := new(sync.WaitGroup)
+		for i := range list {
+			list[i] = securities.GetQuickSecurity("TSTSTB", securities.Share)
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				<-start
+				errs[i] = store.UpdateSecurityQuotes(context.Background(), list[i], time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+			}(i)
+		}
+
+		close(start)
+		wg.Wait()
+
+		for i, err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if q := len(*list[i].Quotes()); q != 2 {
+				t.Errorf("wrong number of TSTSTB quotes of update %d - want 2, got %d", i, q)
+			}
+		}
+
+		if r := atomic.LoadInt32(&candleRequests); r != 1 {
+			t.Errorf("wrong number of Moscow Exchange requests for concurrent updates - want 1, got %d", r)
+		}
+	})
+
+	t.Run("GetSecuritiesData", func(t *testing.T) {
+		list := []*securities.Security{securities.GetQuickSecurity("TSTSTA", securities.Share), securities.GetQuickSecurity("TSTSTC", securities.ETF)}
+
+		err := store.GetSecuritiesData(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(*list[0].Quotes()); n != 2 {
+			t.Errorf("wrong number of TSTSTA quotes - want 2, got %d", n)
+		}
+		if list[1].Name() != "Test ETF C" {
+			t.Errorf("wrong TSTSTC name - want Test ETF C, got %s", list[1].Name())
+		}
+
+		// securities are read concurrently, errors of absent securities mustn't stop reading of the others
+		list = []*securities.Security{securities.GetQuickSecurity("TSTSTX", securities.Share), securities.GetQuickSecurity("TSTSTA", securities.Share), securities.GetQuickSecurity("TSTSTY", securities.Share), securities.GetQuickSecurity("TSTSTB", securities.Share)}
+
+		err = store.GetSecuritiesData(list)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for absent securities - want %v, got %v", securities.ErrSecurityNotExist, err)
+		}
+
+		if list[1].Name() != "Test share A" || list[3].Name() != "Test share B" {
+			t.Errorf("existing securities aren't read with absent ones - got %s and %s", list[1].Name(), list[3].Name())
+		}
+	})
+
+	t.Run("UpdateSecurity", func(t *testing.T) {
+		err := store.UpdateSecurity(securities.GetSecurity("TSTSTC", "Test ETF C renamed", securities.ETF, securities.USD))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sec := securities.GetQuickSecurity("TSTSTC", securities.ETF)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sec.Name() != "Test ETF C renamed" || sec.Currency() != securities.USD {
+			t.Errorf("wrong TSTSTC data after update - want Test ETF C renamed in USD, got %s in %s", sec.Name(), sec.Currency())
+		}
+
+		err = store.UpdateSecurity(secC)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.UpdateSecurity(securities.GetSecurity("TSTSTC", "Test ETF C", securities.Share, securities.CNY))
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for update of security with wrong type - want %v, got %v", securities.ErrSecurityNotExist, err)
+		}
+	})
+
+	t.Run("GetSecuritiesByQuery", func(t *testing.T) {
+		res, err := store.GetSecuritiesByQuery("test share")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 2 || res[0].Id() != "TSTSTA" || res[1].Id() != "TSTSTB" {
+			t.Errorf("wrong securities found by name - want TSTSTA and TSTSTB, got %d securities", len(res))
+		}
+
+		res, err = store.GetSecuritiesByQuery("tststc")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 1 || res[0].SType() != securities.ETF || res[0].Currency() != securities.CNY {
+			t.Errorf("wrong securities found by id - want ETF TSTSTC, got %d securities", len(res))
+		}
+
+		// special symbols of LIKE must be matched literally
+		res, err = store.GetSecuritiesByQuery("TSTST%")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res) != 0 {
+			t.Errorf("securities found by the query with %%: %d", len(res))
+		}
+	})
+
+	t.Run("UpdateAllSecuritiesLastQuotes", func(t *testing.T) {
+		// provisional quotes and then final quotes of the same day
+		for _, p := range []float64{110, 120} {
+			price = p
+
+			err := store.UpdateAllSecuritiesLastQuotes(context.Background(), "share", "CNY")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		list, _, err := store.GetAllSecuritiesData("share", "CNY", securities.SortByID, false, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := 0
+		for _, sec := range list {
+			if sec.Id() != "TSTSTA" && sec.Id() != "TSTSTB" {
+				continue
+			}
+			found++
+
+			if sec.LastUpdated().IsZero() {
+				t.Errorf("%s has no last update time after update", sec.Id())
+			}
+
+			q := sec.LastQuotes(securities.IntervalDay)
+			if q.Close != 120 {
+				t.Errorf("wrong %s last price - want 120, got %f", sec.Id(), q.Close)
+			}
+			// the test server has trading data for any day, so last quotes are quotes of the last trading day
+			if day := moex.LastTradingDay(time.Now().UTC()); !q.Begin.Equal(day) {
+				t.Errorf("wrong %s last quotes date - want %s, got %s", sec.Id(), day, q.Begin)
+			}
+		}
+
+		if found != 2 {
+			t.Errorf("wrong number of test shares in CNY - want 2, got %d", found)
+		}
+
+		_, _, err = store.GetAllSecuritiesData("wrong", "", securities.SortByID, false, 0, 0, false)
+		if err == nil {
+			t.Error("no error for wrong type filter")
+		}
+
+		// concurrent updates with the same filters share Moscow Exchange requests of one update
+		one := atomic.SwapInt32(&historyRequests, 0) / 2
+
+		start := make(chan struct{})
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				<-start
+				if err := store.UpdateAllSecuritiesLastQuotes(context.Background(), "share", "CNY"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+
+		close(start)
+		wg.Wait()
+
+		if n := atomic.LoadInt32(&historyRequests); n != one {
+			t.Errorf("wrong number of Moscow Exchange requests for concurrent updates - want %d, got %d", one, n)
+		}
+	})
+
+	t.Run("GetAllSecuritiesDataPage", func(t *testing.T) {
+		all, total, err := store.GetAllSecuritiesData("", "CNY", securities.SortByID, false, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if total != len(all) {
+			t.Fatalf("wrong total number of securities in CNY - want %d, got %d", len(all), total)
+		}
+
+		idx := -1
+		for i, sec := range all {
+			if sec.Id() == "TSTSTA" {
+				idx = i
+			}
+		}
+		if idx == -1 || idx+2 >= len(all) {
+			t.Fatal("test securities not found in CNY")
+		}
+
+		page, pageTotal, err := store.GetAllSecuritiesData("", "CNY", securities.SortByID, false, 2, idx+1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pageTotal != total {
+			t.Errorf("wrong total number of securities for page - want %d, got %d", total, pageTotal)
+		}
+		if len(page) != 2 || page[0].Id() != "TSTSTB" || page[1].Id() != "TSTSTC" {
+			t.Errorf("wrong page of securities - want TSTSTB and TSTSTC, got %d securities", len(page))
+		}
+		if len(page) > 0 && page[0].LastQuotes(securities.IntervalDay).Close != 120 {
+			t.Errorf("wrong TSTSTB last price in page - want 120, got %f", page[0].LastQuotes(securities.IntervalDay).Close)
+		}
+
+		_, _, err = store.GetAllSecuritiesData("", "", securities.SortByID, false, -1, 0, false)
+		if err == nil {
+			t.Error("no error for negative limit")
+		}
+	})
+
+	t.Run("GetAllSecuritiesDataSort", func(t *testing.T) {
+		// testOrder returns ids of test securities in the order of the list
+		testOrder := func(list []*securities.Security) string {
+			order := ""
+			for _, sec := range list {
+				if strings.HasPrefix(sec.Id(), "TSTST") {
+					order += sec.Id() + " "
+				}
+			}
+
+			return strings.TrimSpace(order)
+		}
+
+		list, _, err := store.GetAllSecuritiesData("", "CNY", securities.SortByName, true, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if order := testOrder(list); order != "TSTSTB TSTSTA TSTSTC" {
+			t.Errorf("wrong order by name desc - want TSTSTB TSTSTA TSTSTC, got %s", order)
+		}
+
+		// TSTSTC has no quotes, TSTSTA and TSTSTB have the same last date, so they are sorted by id
+		list, _, err = store.GetAllSecuritiesData("", "CNY", securities.SortByLastDate, true, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if order := testOrder(list); order != "TSTSTA TSTSTB TSTSTC" {
+			t.Errorf("wrong order by last date desc - want TSTSTA TSTSTB TSTSTC, got %s", order)
+		}
+
+		list, _, err = store.GetAllSecuritiesData("", "CNY", securities.SortByLastPrice, false, 0, 0, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if order := testOrder(list); order != "TSTSTC TSTSTA TSTSTB" {
+			t.Errorf("wrong order by last price - want TSTSTC TSTSTA TSTSTB, got %s", order)
+		}
+
+		_, _, err = store.GetAllSecuritiesData("", "", securities.UnknownSortField, false, 0, 0, false)
+		if err == nil {
+			t.Error("no error for unknown sort field")
+		}
+	})
+
+	t.Run("GetAllSecuritiesLastQuotes", func(t *testing.T) {
+		list, err := store.GetAllSecuritiesLastQuotes("", "CNY", securities.IntervalDay, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var testA *securities.Security
+		for _, sec := range list {
+			switch sec.Id() {
+			case "TSTSTA":
+				testA = sec
+			case "TSTSTC":
+				t.Error("TSTSTC without quotes is returned")
+			}
+		}
+		if testA == nil {
+			t.Fatal("TSTSTA not found in CNY")
+		}
+
+		quotes := *testA.Quotes()
+		if len(quotes) != 2 {
+			t.Fatalf("wrong number of TSTSTA quotes - want 2, got %d", len(quotes))
+		}
+		if !quotes[0].End.Before(quotes[1].End) {
+			t.Errorf("TSTSTA quotes are not sorted by date - %s, %s", quotes[0].End, quotes[1].End)
+		}
+		if quotes[1].Close != 120 {
+			t.Errorf("wrong TSTSTA last price - want 120, got %f", quotes[1].Close)
+		}
+
+		if _, err := testA.LastChange(securities.IntervalDay); err != nil {
+			t.Errorf("no TSTSTA last change: %s", err)
+		}
+
+		_, err = store.GetAllSecuritiesLastQuotes("", "", securities.IntervalDay, 0)
+		if err == nil {
+			t.Error("no error for zero number of quotes")
+		}
+	})
+
+	t.Run("DeleteSecurities", func(t *testing.T) {
+		list := []*securities.Security{
+			securities.GetSecurity("TSTSTD", "Test share D", securities.Share, securities.CNY),
+			securities.GetSecurity("TSTSTE", "Test share E", securities.Share, securities.CNY),
+		}
+
+		err := store.AddSecurities(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.UpdateSecurityQuotes(context.Background(), list[0], time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 2, 23, 59, 59, 0, time.UTC), securities.IntervalDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// absent security is skipped
+		err = store.DeleteSecurities(append(list, securities.GetQuickSecurity("TSTSTX", securities.Share)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sec := range list {
+			res, err := store.SecurityExists(sec.Id(), sec.SType())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res {
+				t.Errorf("security %s exists after deletion", sec.Id())
+			}
+		}
+	})
+
+	t.Run("DeleteSecurity", func(t *testing.T) {
+		err := store.DeleteSecurity(secB)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := store.SecurityExists("TSTSTB", securities.Share)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res {
+			t.Error("security TSTSTB exists after deletion")
+		}
+
+		err = store.DeleteSecurity(secB)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for deleting of deleted security - want %v, got %v", securities.ErrSecurityNotExist, err)
+		}
+
+		err = store.GetSecurityData(securities.GetQuickSecurity("TSTSTB", securities.Share))
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for deleted security - want %v, got %v", securities.ErrSecurityNotExist, err)
+		}
+
+		for _, includeDeleted := range []bool{false, true} {
+			list, _, err := store.GetAllSecuritiesData("", "CNY", securities.SortByID, false, 0, 0, includeDeleted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			found := false
+			for _, sec := range list {
+				if sec.Id() == "TSTSTB" {
+					found = true
+				}
+			}
+
+			if found != includeDeleted {
+				t.Errorf("wrong list of securities (deleted are included - %v) - deleted TSTSTB is found: %v", includeDeleted, found)
+			}
+		}
+	})
+
+	t.Run("RestoreSecurity", func(t *testing.T) {
+		err := store.RestoreSecurity(secB)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// quotes are kept while security is deleted
+		sec := securities.GetQuickSecurity("TSTSTB", securities.Share)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n := len(*sec.Quotes()); n == 0 {
+			t.Error("restored security TSTSTB has no quotes")
+		}
+
+		err = store.RestoreSecurity(secB)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for restoring of not deleted security - want %v, got %v", securities.ErrSecurityNotExist, err)
+		}
+
+		// adding of deleted security restores it too
+		err = store.DeleteSecurity(secB)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddSecurity(securities.GetSecurity("TSTSTB", "Test share B again", securities.Share, securities.CNY))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sec = securities.GetQuickSecurity("TSTSTB", securities.Share)
+		err = store.GetSecurityData(sec)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sec.Name() != "Test share B again" || len(*sec.Quotes()) == 0 {
+			t.Errorf("wrong TSTSTB data after adding of deleted security - got %s with %d quotes", sec.Name(), len(*sec.Quotes()))
+		}
+	})
+}
+
+// PortfolioStore is a storage of securities and portfolios
+type PortfolioStore interface {
+	securities.Store
+	portfolio.Store
+}
+
+// RunPortfolios runs common tests of portfolios with the given store
+// Test securities and portfolios are removed after the tests
+func RunPortfolios(t *testing.T, store PortfolioStore) {
+	secP := securities.GetSecurity("TSTSTP", "Test share P", securities.Share, securities.RUB)
+	secQ := securities.GetSecurity("TSTSTQ", "Test bond Q", securities.Bond, securities.RUB)
+
+	err := store.AddSecurities([]*securities.Security{secP, secQ})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := store.PurgeSecurities([]*securities.Security{secP, secQ})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	p, err := portfolio.New("Test portfolio", []portfolio.Position{
+		{Id: "TSTSTQ", Type: securities.Bond, Quantity: 5, AvgPrice: 99.5},
+		{Id: "tststp", Type: securities.Share, Quantity: 10, AvgPrice: 150.25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("AddPortfolio", func(t *testing.T) {
+		err := store.AddPortfolio(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Id == 0 {
+			t.Error("added portfolio has no id")
+		}
+
+		// positions must refer to existing securities
+		wrong, err := portfolio.New("Wrong portfolio", []portfolio.Position{{Id: "TSTSTP", Type: securities.ETF, Quantity: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddPortfolio(wrong)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for position of absent security - want ErrSecurityNotExist, got %v", err)
+		}
+	})
+	defer store.DeletePortfolio(p.Id)
+
+	t.Run("GetPortfolio", func(t *testing.T) {
+		res, err := store.GetPortfolio(p.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Name != "Test portfolio" || len(res.Positions) != 2 {
+			t.Fatalf("wrong portfolio - want Test portfolio with 2 positions, got %s with %d positions", res.Name, len(res.Positions))
+		}
+
+		// positions are sorted by security id
+		pos := res.Positions[0]
+		if pos.Id != "TSTSTP" || pos.Type != securities.Share || pos.Quantity != 10 || pos.AvgPrice != 150.25 {
+			t.Errorf("wrong position - want TSTSTP share 10 by 150.25, got %s %s %f by %f", pos.Id, pos.Type, pos.Quantity, pos.AvgPrice)
+		}
+
+		list, err := store.GetAllPortfolios()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, one := range list {
+			if one.Id == p.Id {
+				found = len(one.Positions) == 2
+			}
+		}
+		if !found {
+			t.Error("test portfolio with 2 positions is not found in all portfolios")
+		}
+	})
+
+	t.Run("DeletePortfolio", func(t *testing.T) {
+		err := store.DeletePortfolio(p.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.GetPortfolio(p.Id)
+		if !errors.Is(err, portfolio.ErrPortfolioNotExist) {
+			t.Errorf("wrong error for deleted portfolio - want ErrPortfolioNotExist, got %v", err)
+		}
+
+		err = store.DeletePortfolio(p.Id)
+		if !errors.Is(err, portfolio.ErrPortfolioNotExist) {
+			t.Errorf("wrong error for deleting of absent portfolio - want ErrPortfolioNotExist, got %v", err)
+		}
+	})
+}
+
+// AlertStore is a storage of securities and price alerts
+type AlertStore interface {
+	securities.Store
+	alerts.Store
+}
+
+// RunAlerts runs common tests of price alerts with the given store
+// Test securities and alerts are removed after the tests
+func RunAlerts(t *testing.T, store AlertStore) {
+	sec := securities.GetSecurity("TSTSTL", "Test share L", securities.Share, securities.RUB)
+
+	err := store.AddSecurity(sec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		err := store.PurgeSecurities([]*securities.Security{sec})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	a, err := alerts.New("tststl", securities.Share, alerts.Above, 150.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.URL = "https://example.com/hook"
+
+	t.Run("AddAlert", func(t *testing.T) {
+		err := store.AddAlert(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a.Id == 0 {
+			t.Error("added alert has no id")
+		}
+
+		// alert must refer to existing security
+		wrong, err := alerts.New("TSTSTL", securities.Bond, alerts.Below, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddAlert(wrong)
+		if !errors.Is(err, securities.ErrSecurityNotExist) {
+			t.Errorf("wrong error for alert of absent security - want ErrSecurityNotExist, got %v", err)
+		}
+	})
+
+	t.Run("GetAlert", func(t *testing.T) {
+		res, err := store.GetAlert(a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if *res != *a {
+			t.Errorf("wrong alert - want %+v, got %+v", a, res)
+		}
+
+		list, err := store.GetAllAlerts()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, one := range list {
+			found = found || one.Id == a.Id
+		}
+		if !found {
+			t.Error("test alert is not found in all alerts")
+		}
+	})
+
+	t.Run("UpdateAlert", func(t *testing.T) {
+		changed := *a
+		changed.Direction = alerts.Below
+		changed.Threshold = 99.25
+		changed.URL = ""
+
+		err := store.UpdateAlert(&changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the same values are not an error
+		err = store.UpdateAlert(&changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := store.GetAlert(a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Direction != alerts.Below || res.Threshold != 99.25 || !res.Enabled || res.URL != "" {
+			t.Errorf("wrong updated alert - want enabled below 99.25 without webhook, got %+v", res)
+		}
+
+		absent := changed
+		absent.Id = a.Id + 1000
+		err = store.UpdateAlert(&absent)
+		if !errors.Is(err, alerts.ErrAlertNotExist) {
+			t.Errorf("wrong error for updating of absent alert - want ErrAlertNotExist, got %v", err)
+		}
+	})
+
+	t.Run("FireAlerts", func(t *testing.T) {
+		date := time.Date(2023, 1, 2, 23, 59, 59, 0, time.UTC)
+		firedAt := time.Date(2023, 1, 3, 10, 0, 0, 0, time.UTC)
+
+		firings := []alerts.Firing{{AlertId: a.Id, Close: 98.5, Date: date, FiredAt: firedAt, Delivery: alerts.DeliveryPending}}
+		err := store.FireAlerts(firings)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if firings[0].Id == 0 {
+			t.Fatal("recorded firing has no id")
+		}
+
+		err = store.SetFiringDelivery(firings[0].Id, alerts.DeliveryFailed, "webhook answered with status 404 Not Found")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := store.GetAlert(a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Enabled {
+			t.Error("fired alert is not disabled")
+		}
+
+		stored, err := store.GetAlertFirings(a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(stored) != 1 || stored[0].Id != firings[0].Id || stored[0].Close != 98.5 || !stored[0].Date.Equal(date) || !stored[0].FiredAt.Equal(firedAt) {
+			t.Fatalf("wrong firings - want one with close 98.5, got %+v", stored)
+		}
+
+		if stored[0].Delivery != alerts.DeliveryFailed || stored[0].DeliveryError != "webhook answered with status 404 Not Found" {
+			t.Errorf("wrong delivery of firing - want failed, got %s (%s)", stored[0].Delivery, stored[0].DeliveryError)
+		}
+	})
+
+	t.Run("DeleteAlert", func(t *testing.T) {
+		err := store.DeleteAlert(a.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.GetAlert(a.Id)
+		if !errors.Is(err, alerts.ErrAlertNotExist) {
+			t.Errorf("wrong error for deleted alert - want ErrAlertNotExist, got %v", err)
+		}
+
+		_, err = store.GetAlertFirings(a.Id)
+		if !errors.Is(err, alerts.ErrAlertNotExist) {
+			t.Errorf("wrong error for firings of deleted alert - want ErrAlertNotExist, got %v", err)
+		}
+
+		err = store.DeleteAlert(a.Id)
+		if !errors.Is(err, alerts.ErrAlertNotExist) {
+			t.Errorf("wrong error for deleting of absent alert - want ErrAlertNotExist, got %v", err)
+		}
+	})
+
+	// alerts of purged securities are removed with them
+	t.Run("PurgeWithAlerts", func(t *testing.T) {
+		one, err := alerts.New("TSTSTL", securities.Share, alerts.Above, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.AddAlert(one)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.FireAlerts([]alerts.Firing{{AlertId: one.Id, Close: 2, Date: time.Now(), FiredAt: time.Now()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.PurgeSecurities([]*securities.Security{sec})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = store.GetAlert(one.Id)
+		if !errors.Is(err, alerts.ErrAlertNotExist) {
+			t.Errorf("wrong error for alert of purged security - want ErrAlertNotExist, got %v", err)
+		}
+	})
+}
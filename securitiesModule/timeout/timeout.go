@@ -0,0 +1,129 @@
+// Package timeout contains http middleware which limits the time of serving requests
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Handler gives handler the time d to serve the request, the deadline is set to the request context
+// If handler isn't finished in time, the client gets 503 error with json body {"error": "..."} and later output of handler is dropped
+// The response is kept in memory until handler is finished, so long-living streams must not be wrapped
+// Requests are not limited if d isn't positive
+func Handler(d time.Duration, handler http.HandlerFunc) http.HandlerFunc {
+	if d <= 0 {
+		return handler
+	}
+
+	return func(writer http.ResponseWriter, request *http.Request) {
+		ctx, cancel := context.WithTimeout(request.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicChan := make(chan any, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicChan <- p
+				}
+			}()
+
+			handler(tw, request.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			dst := writer.Header()
+			for k, v := range tw.header {
+				dst[k] = v
+			}
+
+			if !tw.wroteHeader {
+				tw.code = http.StatusOK
+			}
+			writer.WriteHeader(tw.code)
+			writer.Write(tw.buf.Bytes())
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			tw.timedOut = true
+
+			// the client has gone, so there is no one to answer
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+
+			res, _ := json.Marshal(struct {
+				Error string `json:"error"`
+			}{Error: "request timed out"})
+
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			writer.Write(res)
+		}
+	}
+}
+
+// timeoutWriter keeps the response of handler until it's finished or the time is out
+type timeoutWriter struct {
+	header http.Header
+
+	mu          sync.Mutex // guards the fields below
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+// Header returns the header map of the kept response
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// Write keeps data of the response, it fails with http.ErrHandlerTimeout if the time is out
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !w.wroteHeader {
+		w.writeHeader(http.StatusOK)
+	}
+
+	return w.buf.Write(data)
+}
+
+// WriteHeader keeps the status of the response, only the first status is used
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.wroteHeader {
+		return
+	}
+
+	w.writeHeader(code)
+}
+
+// writeHeader sets the status of the response, w.mu must be held
+func (w *timeoutWriter) writeHeader(code int) {
+	w.wroteHeader = true
+	w.code = code
+}
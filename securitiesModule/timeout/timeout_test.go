@@ -0,0 +1,54 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	handler := Handler(50*time.Millisecond, func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Query().Get("slow") == "true" {
+			<-request.Context().Done()
+			writer.Write([]byte("late"))
+			return
+		}
+
+		if _, ok := request.Context().Deadline(); !ok {
+			t.Error("request context has no deadline")
+		}
+
+		writer.Header().Set("Content-Type", "text/plain")
+		writer.WriteHeader(http.StatusCreated)
+		writer.Write([]byte("ok"))
+	})
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if recorder.Code != http.StatusCreated || recorder.Body.String() != "ok" || recorder.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("wrong response in time - got %d %q with content type %q", recorder.Code, recorder.Body.String(), recorder.Header().Get("Content-Type"))
+	}
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/?slow=true", nil))
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("wrong status of slow request - want %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+
+	if got := recorder.Body.String(); got != `{"error":"request timed out"}` {
+		t.Errorf("wrong body of slow request - got %q", got)
+	}
+}
+
+func TestNoTimeout(t *testing.T) {
+	handler := Handler(0, func(writer http.ResponseWriter, request *http.Request) {
+		if _, ok := request.Context().Deadline(); ok {
+			t.Error("request context has deadline without timeout")
+		}
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}